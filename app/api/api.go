@@ -1,12 +1,156 @@
 package api
 
 import (
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sync"
+
 	"github.com/v2ray/v2ray-core/app"
+	"github.com/v2ray/v2ray-core/common/alloc"
+	"github.com/v2ray/v2ray-core/common/log"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	"github.com/v2ray/v2ray-core/transport/ray"
 )
 
 const (
 	APP_ID = app.ID(5)
 )
 
+// ApiServer serves control RPCs on a local port, as well as connections dispatched to it as an
+// outbound handler.
 type ApiServer struct {
+	sync.Mutex
+	config    *Config
+	rpcServer *rpc.Server
+	listener  *net.TCPListener
+}
+
+func NewApiServer(config *Config) *ApiServer {
+	return &ApiServer{
+		config:    config,
+		rpcServer: rpc.NewServer(),
+	}
+}
+
+// Register publishes the methods of the given service under the given name.
+func (this *ApiServer) Register(name string, service interface{}) error {
+	return this.rpcServer.RegisterName(name, service)
+}
+
+// Tag returns the tag of inbound whose connections should be dispatched to the API server.
+func (this *ApiServer) Tag() string {
+	return this.config.Tag
+}
+
+// Start listens on the configured port for API requests.
+func (this *ApiServer) Start() error {
+	address := this.config.ListenAddress
+	if address == nil {
+		address = v2net.IPAddress([]byte{127, 0, 0, 1})
+	}
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{
+		IP:   address.IP(),
+		Port: int(this.config.DirectPort),
+	})
+	if err != nil {
+		log.Error("Api: Failed to listen on port ", this.config.DirectPort, ": ", err)
+		return err
+	}
+	log.Info("Api: Listening on ", listener.Addr())
+
+	this.Lock()
+	this.listener = listener
+	this.Unlock()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go this.rpcServer.ServeCodec(jsonrpc.NewServerCodec(conn))
+		}
+	}()
+	return nil
+}
+
+func (this *ApiServer) Close() {
+	this.Lock()
+	defer this.Unlock()
+	if this.listener != nil {
+		this.listener.Close()
+		this.listener = nil
+	}
+}
+
+// Dispatch serves API requests from the given ray.
+func (this *ApiServer) Dispatch(firstPacket v2net.Packet, link ray.OutboundRay) error {
+	conn := &rayConn{
+		current: firstPacket.Chunk(),
+		input:   link.OutboundInput(),
+		output:  link.OutboundOutput(),
+	}
+	if !firstPacket.MoreChunks() {
+		conn.input = nil
+	}
+	this.rpcServer.ServeCodec(jsonrpc.NewServerCodec(conn))
+	return nil
+}
+
+// rayConn is a stream on top of an OutboundRay.
+type rayConn struct {
+	current   *alloc.Buffer
+	input     <-chan *alloc.Buffer
+	output    chan<- *alloc.Buffer
+	closeOnce sync.Once
+}
+
+func (this *rayConn) Read(b []byte) (int, error) {
+	for this.current == nil || this.current.IsEmpty() {
+		if this.current != nil {
+			this.current.Release()
+			this.current = nil
+		}
+		if this.input == nil {
+			return 0, io.EOF
+		}
+		chunk, open := <-this.input
+		if !open {
+			this.input = nil
+			return 0, io.EOF
+		}
+		this.current = chunk
+	}
+	n := copy(b, this.current.Value)
+	this.current.SliceFrom(n)
+	return n, nil
+}
+
+func (this *rayConn) Write(b []byte) (int, error) {
+	this.output <- alloc.NewLargeBuffer().Clear().Append(b)
+	return len(b), nil
+}
+
+func (this *rayConn) Close() error {
+	this.closeOnce.Do(func() {
+		close(this.output)
+		if this.current != nil {
+			this.current.Release()
+			this.current = nil
+		}
+		if this.input != nil {
+			for chunk := range this.input {
+				chunk.Release()
+			}
+		}
+	})
+	return nil
+}
+
+func init() {
+	app.RegisterApp(APP_ID, func(context app.Context, obj interface{}) interface{} {
+		return obj
+	})
 }
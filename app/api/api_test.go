@@ -0,0 +1,69 @@
+package api_test
+
+import (
+	"bytes"
+	"net/rpc/jsonrpc"
+	"testing"
+
+	. "github.com/v2ray/v2ray-core/app/api"
+	"github.com/v2ray/v2ray-core/common/alloc"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+	"github.com/v2ray/v2ray-core/transport/ray"
+)
+
+type EchoArgs struct {
+	Message string
+}
+
+type EchoReply struct {
+	Message string
+}
+
+type echoService struct {
+}
+
+func (this *echoService) Echo(args *EchoArgs, reply *EchoReply) error {
+	reply.Message = args.Message
+	return nil
+}
+
+func TestApiServerListen(t *testing.T) {
+	v2testing.Current(t)
+
+	server := NewApiServer(&Config{DirectPort: v2net.Port(50011)})
+	assert.Error(server.Register("Test", &echoService{})).IsNil()
+	assert.Error(server.Start()).IsNil()
+	defer server.Close()
+
+	client, err := jsonrpc.Dial("tcp", "127.0.0.1:50011")
+	assert.Error(err).IsNil()
+	defer client.Close()
+
+	reply := new(EchoReply)
+	assert.Error(client.Call("Test.Echo", &EchoArgs{Message: "v2ray"}, reply)).IsNil()
+	assert.StringLiteral(reply.Message).Equals("v2ray")
+}
+
+func TestApiServerDispatch(t *testing.T) {
+	v2testing.Current(t)
+
+	server := NewApiServer(&Config{Tag: "api"})
+	assert.Error(server.Register("Test", &echoService{})).IsNil()
+	assert.StringLiteral(server.Tag()).Equals("api")
+
+	request := []byte(`{"method":"Test.Echo","params":[{"Message":"v2ray"}],"id":1}`)
+	link := ray.NewRay()
+	close(link.InboundInput())
+	dest := v2net.TCPDestination(v2net.IPAddress([]byte{127, 0, 0, 1}), v2net.Port(80))
+	go server.Dispatch(v2net.NewPacket(dest, alloc.NewBuffer().Clear().Append(request), false), link)
+
+	response := new(bytes.Buffer)
+	for chunk := range link.InboundOutput() {
+		response.Write(chunk.Value)
+		chunk.Release()
+	}
+	assert.StringLiteral(response.String()).Equals(`{"id":1,"result":{"Message":"v2ray"},"error":null}` + "\n")
+
+}
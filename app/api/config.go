@@ -5,5 +5,7 @@ import (
 )
 
 type Config struct {
-	DirectPort v2net.Port
+	DirectPort    v2net.Port    // Port of the API server.
+	ListenAddress v2net.Address // Address of the API server, loopback if not set.
+	Tag           string        // Connections from the inbound with this tag are served by the API server.
 }
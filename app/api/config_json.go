@@ -0,0 +1,27 @@
+// +build json
+
+package api
+
+import (
+	"encoding/json"
+
+	v2net "github.com/v2ray/v2ray-core/common/net"
+)
+
+func (this *Config) UnmarshalJSON(data []byte) error {
+	type JsonConfig struct {
+		DirectPort    v2net.Port         `json:"port"`
+		ListenAddress *v2net.AddressJson `json:"listen"`
+		Tag           string             `json:"tag"`
+	}
+	jsonConfig := new(JsonConfig)
+	if err := json.Unmarshal(data, jsonConfig); err != nil {
+		return err
+	}
+	this.DirectPort = jsonConfig.DirectPort
+	if jsonConfig.ListenAddress != nil {
+		this.ListenAddress = jsonConfig.ListenAddress.Address
+	}
+	this.Tag = jsonConfig.Tag
+	return nil
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+)
+
+// Arguments and replies of the API methods. All methods are served as JSON-RPC 1.0.
+
+type Empty struct {
+}
+
+type TagArgs struct {
+	Tag string
+}
+
+type InboundInfo struct {
+	Tag      string
+	Protocol string
+	PortFrom uint16
+	PortTo   uint16
+}
+
+type ListInboundsReply struct {
+	Inbounds []*InboundInfo
+}
+
+type AddInboundArgs struct {
+	Tag      string
+	Protocol string
+	PortFrom uint16
+	PortTo   uint16
+	Settings json.RawMessage // Settings of the inbound protocol.
+}
+
+type OutboundInfo struct {
+	Tag      string
+	Protocol string
+}
+
+type ListOutboundsReply struct {
+	Outbounds []*OutboundInfo
+}
+
+type AddOutboundArgs struct {
+	Tag      string
+	Protocol string
+	Settings json.RawMessage // Settings of the outbound protocol.
+}
+
+type AddUserArgs struct {
+	InboundTag string // Empty for the default inbound.
+	Id         string
+	AlterIds   uint16
+	Level      byte
+	Email      string
+	Expiry     int64 // Unix time after which the user is removed, 0 for never.
+}
+
+type RemoveUserArgs struct {
+	InboundTag string // Empty for the default inbound.
+	Email      string
+}
+
+type SetUserExpiryArgs struct {
+	InboundTag string // Empty for the default inbound.
+	Email      string
+	Expiry     int64 // Unix time after which the user is removed, 0 for never.
+}
+
+type SetUserEnabledArgs struct {
+	InboundTag string // Empty for the default inbound.
+	Email      string
+	Enabled    bool
+}
+
+type EmailArgs struct {
+	Email string
+}
+
+type QuotaUsageReply struct {
+	Usage int64 // Bytes used.
+	Quota int64 // Bytes in total, 0 for unlimited.
+}
+
+type QueryRoutingArgs struct {
+	Network string // "tcp" or "udp".
+	Address string
+	Port    uint16
+}
+
+type QueryRoutingReply struct {
+	Tag string // Tag of the routing target, empty for the default outbound.
+}
+
+type ReloadArgs struct {
+	ConfigFile string
+}
+
+type HealthStatus struct {
+	Name      string
+	Healthy   bool
+	Failures  int
+	LastCheck int64 // Unix time of the last probe.
+	LastError string
+}
+
+type HealthStatusReply struct {
+	Status []*HealthStatus
+}
+
+type QueryStatsArgs struct {
+	Kind  string // "user", "inbound" or "outbound". Empty for all kinds.
+	Name  string // Email of user or tag of handler. Empty for all names.
+	Reset bool   // Whether to reset the traffic and total connections after query.
+}
+
+type Stat struct {
+	Kind              string
+	Name              string
+	Uplink            int64
+	Downlink          int64
+	ActiveConnections int64
+	TotalConnections  int64
+}
+
+type QueryStatsReply struct {
+	Stats []*Stat
+}
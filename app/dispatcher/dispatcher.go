@@ -3,6 +3,8 @@ package dispatcher
 import (
 	"github.com/v2ray/v2ray-core/app"
 	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+	"github.com/v2ray/v2ray-core/common/serial"
 	"github.com/v2ray/v2ray-core/transport/ray"
 )
 
@@ -15,8 +17,32 @@ type PacketDispatcher interface {
 	DispatchToOutbound(packet v2net.Packet) ray.InboundRay
 }
 
+// UserPacketDispatcher dispatches a packet from a client on behalf of an authenticated user, so that
+// the traffic is accounted to the user, and the client appears in access log. Both source and user
+// may be nil.
+type UserPacketDispatcher interface {
+	DispatchToOutboundForUser(source serial.String, user *proto.User, packet v2net.Packet) ray.InboundRay
+}
+
+// DispatchToOutboundForUser dispatches the packet from the given source on behalf of the given user,
+// if the dispatcher supports UserPacketDispatcher.
+func DispatchToOutboundForUser(packetDispatcher PacketDispatcher, source serial.String, user *proto.User, packet v2net.Packet) ray.InboundRay {
+	if userDispatcher, ok := packetDispatcher.(UserPacketDispatcher); ok {
+		return userDispatcher.DispatchToOutboundForUser(source, user, packet)
+	}
+	return packetDispatcher.DispatchToOutbound(packet)
+}
+
+// TaggedPacketDispatcher dispatches a packet to the outbound handler of the given tag, bypassing the
+// router. Empty tag means the default outbound handler.
+type TaggedPacketDispatcher interface {
+	DispatchToTaggedOutbound(tag string, packet v2net.Packet) ray.InboundRay
+}
+
 type packetDispatcherWithContext interface {
 	DispatchToOutbound(context app.Context, packet v2net.Packet) ray.InboundRay
+	DispatchToOutboundForUser(context app.Context, source serial.String, user *proto.User, packet v2net.Packet) ray.InboundRay
+	DispatchToTaggedOutbound(context app.Context, tag string, packet v2net.Packet) ray.InboundRay
 }
 
 type contextedPacketDispatcher struct {
@@ -28,6 +54,14 @@ func (this *contextedPacketDispatcher) DispatchToOutbound(packet v2net.Packet) r
 	return this.packetDispatcher.DispatchToOutbound(this.context, packet)
 }
 
+func (this *contextedPacketDispatcher) DispatchToOutboundForUser(source serial.String, user *proto.User, packet v2net.Packet) ray.InboundRay {
+	return this.packetDispatcher.DispatchToOutboundForUser(this.context, source, user, packet)
+}
+
+func (this *contextedPacketDispatcher) DispatchToTaggedOutbound(tag string, packet v2net.Packet) ray.InboundRay {
+	return this.packetDispatcher.DispatchToTaggedOutbound(this.context, tag, packet)
+}
+
 func init() {
 	app.RegisterApp(APP_ID, func(context app.Context, obj interface{}) interface{} {
 		packetDispatcher := obj.(packetDispatcherWithContext)
@@ -0,0 +1,48 @@
+package dns
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	v2net "github.com/v2ray/v2ray-core/common/net"
+)
+
+const (
+	DefaultTimeout = 4 * time.Second
+)
+
+// NameServerConfig is an upstream DNS server.
+type NameServerConfig struct {
+	Address       v2net.Destination // UDP or TCP address of the server, or nil for the system resolver.
+	TLS           bool              // Whether to use DNS over TLS on top of the TCP address.
+	URL           string            // URL of a DNS over HTTPS server, which takes precedence over Address.
+	Method        string            // HTTP method of DNS over HTTPS, either "GET" or "POST" (default).
+	ServerName    string            // Server name to verify in TLS, or empty for the host of the server.
+	AllowInsecure bool              // Whether to accept any certificate in TLS.
+	OutboundTag   string            // Tag of the outbound to send queries through, or empty for direct.
+	Domains       []string          // Domains, with their subdomains, to be resolved by this server only.
+}
+
+// HasDomain returns true if the given domain is one of the Domains, or a subdomain of them.
+func (this *NameServerConfig) HasDomain(domain string) bool {
+	for _, parent := range this.Domains {
+		if domain == parent || strings.HasSuffix(domain, "."+parent) {
+			return true
+		}
+	}
+	return false
+}
+
+// FakeIPConfig is a range of IPs to be handed out to clients as fake IPs of domains.
+type FakeIPConfig struct {
+	IPPool   *net.IPNet
+	PoolSize int // Maximum number of domains with fake IPs at the same time.
+}
+
+type Config struct {
+	NameServers []*NameServerConfig
+	Hosts       map[string]net.IP // Static IPs of domains, which are never queried.
+	Timeout     time.Duration     // Timeout of each query, or 0 for DefaultTimeout.
+	FakeIP      *FakeIPConfig     // Fake IPs for clients, or nil if disabled.
+}
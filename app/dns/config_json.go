@@ -0,0 +1,167 @@
+// +build json
+
+package dns
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/v2ray/v2ray-core/common/log"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+)
+
+const (
+	defaultPort    = v2net.Port(53)
+	defaultTLSPort = v2net.Port(853)
+)
+
+var (
+	ErrorInvalidNameServer = errors.New("Invalid name server.")
+	ErrorInvalidHostIP     = errors.New("Invalid IP of host.")
+	ErrorInvalidFakeIPPool = errors.New("Invalid fake IP pool.")
+)
+
+// parseAddress parses the address of this server in the form of "ip[:port]", "udp://ip[:port]",
+// "tcp://ip[:port]", "tls://host[:port]" or "https://host[:port]/path". "localhost" stands for the
+// system resolver.
+func (this *NameServerConfig) parseAddress(address string) error {
+	if address == "localhost" {
+		return nil
+	}
+	network := "udp"
+	if idx := strings.Index(address, "://"); idx >= 0 {
+		network = strings.ToLower(address[:idx])
+		address = address[idx+3:]
+	}
+
+	port := defaultPort
+	switch network {
+	case "udp", "tcp":
+	case "tls":
+		this.TLS = true
+		port = defaultTLSPort
+	case "https":
+		dohUrl, err := url.Parse(network + "://" + address)
+		if err != nil || len(dohUrl.Host) == 0 {
+			return ErrorInvalidNameServer
+		}
+		this.URL = dohUrl.String()
+		return nil
+	default:
+		return ErrorInvalidNameServer
+	}
+
+	host := address
+	if h, p, err := net.SplitHostPort(address); err == nil {
+		portNumber, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return ErrorInvalidNameServer
+		}
+		host, port = h, v2net.Port(portNumber)
+	}
+	host = strings.Trim(host, "[]")
+	// Plain DNS servers must be IPs, as there is nothing to resolve their domains with.
+	if !this.TLS && net.ParseIP(host) == nil {
+		return ErrorInvalidNameServer
+	}
+	if network == "udp" {
+		this.Address = v2net.UDPDestination(v2net.ParseAddress(host), port)
+	} else {
+		this.Address = v2net.TCPDestination(v2net.ParseAddress(host), port)
+	}
+	return nil
+}
+
+func (this *NameServerConfig) UnmarshalJSON(data []byte) error {
+	type JsonNameServer struct {
+		Address       string   `json:"address"`
+		Method        string   `json:"method"`
+		ServerName    string   `json:"serverName"`
+		AllowInsecure bool     `json:"allowInsecure"`
+		OutboundTag   string   `json:"outbound"`
+		Domains       []string `json:"domains"`
+	}
+	jsonServer := new(JsonNameServer)
+	if err := json.Unmarshal(data, &jsonServer.Address); err != nil {
+		if err := json.Unmarshal(data, jsonServer); err != nil {
+			return err
+		}
+	}
+	if err := this.parseAddress(jsonServer.Address); err != nil {
+		log.Error("DNS: Invalid name server: ", jsonServer.Address)
+		return err
+	}
+	if this.Address == nil && len(this.URL) == 0 && len(jsonServer.OutboundTag) > 0 {
+		log.Error("DNS: System resolver can't send queries through outbound: ", jsonServer.OutboundTag)
+		return ErrorInvalidNameServer
+	}
+	switch method := strings.ToUpper(jsonServer.Method); method {
+	case "", "POST":
+	case "GET":
+		this.Method = method
+	default:
+		log.Error("DNS: Invalid method of DNS over HTTPS: ", jsonServer.Method)
+		return ErrorInvalidNameServer
+	}
+	this.ServerName = jsonServer.ServerName
+	this.AllowInsecure = jsonServer.AllowInsecure
+	this.OutboundTag = jsonServer.OutboundTag
+	this.Domains = make([]string, len(jsonServer.Domains))
+	for idx, domain := range jsonServer.Domains {
+		this.Domains[idx] = normalizeDomain(domain)
+	}
+	return nil
+}
+
+func (this *FakeIPConfig) UnmarshalJSON(data []byte) error {
+	type JsonFakeIPConfig struct {
+		IPPool   string `json:"ipPool"`
+		PoolSize int    `json:"poolSize"`
+	}
+	jsonConfig := &JsonFakeIPConfig{
+		IPPool:   DefaultFakeIPPool,
+		PoolSize: DefaultFakeIPPoolSize,
+	}
+	if err := json.Unmarshal(data, jsonConfig); err != nil {
+		return err
+	}
+	_, ipPool, err := net.ParseCIDR(jsonConfig.IPPool)
+	if err != nil || jsonConfig.PoolSize <= 0 {
+		log.Error("DNS: Invalid fake IP pool: ", jsonConfig.IPPool, " of size ", jsonConfig.PoolSize)
+		return ErrorInvalidFakeIPPool
+	}
+	this.IPPool = ipPool
+	this.PoolSize = jsonConfig.PoolSize
+	return nil
+}
+
+func (this *Config) UnmarshalJSON(data []byte) error {
+	type JsonConfig struct {
+		Servers []*NameServerConfig `json:"servers"`
+		Hosts   map[string]string   `json:"hosts"`
+		Timeout int                 `json:"timeout"` // Seconds.
+		FakeIP  *FakeIPConfig       `json:"fakeIP"`
+	}
+	jsonConfig := new(JsonConfig)
+	if err := json.Unmarshal(data, jsonConfig); err != nil {
+		return err
+	}
+	this.NameServers = jsonConfig.Servers
+	this.Hosts = make(map[string]net.IP, len(jsonConfig.Hosts))
+	for domain, ipString := range jsonConfig.Hosts {
+		ip := net.ParseIP(ipString)
+		if ip == nil {
+			log.Error("DNS: Invalid IP for host ", domain, ": ", ipString)
+			return ErrorInvalidHostIP
+		}
+		this.Hosts[normalizeDomain(domain)] = ip
+	}
+	this.Timeout = time.Duration(jsonConfig.Timeout) * time.Second
+	this.FakeIP = jsonConfig.FakeIP
+	return nil
+}
@@ -0,0 +1,98 @@
+// +build json
+
+package dns_test
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	. "github.com/v2ray/v2ray-core/app/dns"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	netassert "github.com/v2ray/v2ray-core/common/net/testing/assert"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+func TestConfigParsing(t *testing.T) {
+	v2testing.Current(t)
+
+	rawJson := `{
+    "servers": [
+      "8.8.8.8",
+      "tcp://8.8.4.4:5353",
+      "localhost",
+      {"address": "114.114.114.114", "domains": ["CN", "qq.com."]},
+      "tls://1.1.1.1",
+      {"address": "tls://dns.google:8853", "serverName": "google", "outbound": "proxy"},
+      {"address": "https://dns.google/dns-query", "method": "get", "allowInsecure": true}
+    ],
+    "hosts": {"V2Ray.com": "1.2.3.4"},
+    "timeout": 2
+  }`
+	config := new(Config)
+	err := json.Unmarshal([]byte(rawJson), config)
+	assert.Error(err).IsNil()
+
+	assert.Int(len(config.NameServers)).Equals(7)
+	assert.Bool(config.NameServers[0].Address.Equals(v2net.UDPDestination(v2net.IPAddress([]byte{8, 8, 8, 8}), 53))).IsTrue()
+	assert.Bool(config.NameServers[1].Address.Equals(v2net.TCPDestination(v2net.IPAddress([]byte{8, 8, 4, 4}), 5353))).IsTrue()
+	assert.Pointer(config.NameServers[2].Address).IsNil()
+	assert.StringLiteral(config.NameServers[3].Domains[0]).Equals("cn")
+	assert.StringLiteral(config.NameServers[3].Domains[1]).Equals("qq.com")
+	assert.Bool(config.NameServers[3].HasDomain("www.qq.com")).IsTrue()
+	assert.Bool(config.NameServers[3].HasDomain("notqq.com")).IsFalse()
+
+	assert.Bool(config.NameServers[4].TLS).IsTrue()
+	assert.Bool(config.NameServers[4].Address.Equals(v2net.TCPDestination(v2net.IPAddress([]byte{1, 1, 1, 1}), 853))).IsTrue()
+	assert.Bool(config.NameServers[5].TLS).IsTrue()
+	assert.Bool(config.NameServers[5].Address.Equals(v2net.TCPDestination(v2net.DomainAddress("dns.google"), 8853))).IsTrue()
+	assert.StringLiteral(config.NameServers[5].ServerName).Equals("google")
+	assert.StringLiteral(config.NameServers[5].OutboundTag).Equals("proxy")
+	assert.StringLiteral(config.NameServers[6].URL).Equals("https://dns.google/dns-query")
+	assert.StringLiteral(config.NameServers[6].Method).Equals("GET")
+	assert.Bool(config.NameServers[6].AllowInsecure).IsTrue()
+
+	netassert.IP(config.Hosts["v2ray.com"]).Equals(net.ParseIP("1.2.3.4"))
+	assert.Int64(int64(config.Timeout.Seconds())).Equals(2)
+}
+
+func TestInvalidNameServer(t *testing.T) {
+	v2testing.Current(t)
+
+	for _, rawJson := range []string{
+		`{"servers": ["dns.google"]}`,
+		`{"servers": ["quic://8.8.8.8"]}`,
+		`{"servers": ["8.8.8.8:99999"]}`,
+		`{"servers": ["https:///dns-query"]}`,
+		`{"servers": [{"address": "https://dns.google/dns-query", "method": "PUT"}]}`,
+		`{"servers": [{"address": "localhost", "outbound": "proxy"}]}`,
+		`{"hosts": {"v2ray.com": "v2ray.org"}}`,
+	} {
+		err := json.Unmarshal([]byte(rawJson), new(Config))
+		assert.Error(err).IsNotNil()
+	}
+}
+
+func TestFakeIPConfig(t *testing.T) {
+	v2testing.Current(t)
+
+	config := new(Config)
+	assert.Error(json.Unmarshal([]byte(`{"fakeIP": {}}`), config)).IsNil()
+	assert.StringLiteral(config.FakeIP.IPPool.String()).Equals(DefaultFakeIPPool)
+	assert.Int(config.FakeIP.PoolSize).Equals(DefaultFakeIPPoolSize)
+
+	assert.Error(json.Unmarshal([]byte(`{"fakeIP": {"ipPool": "fc00::/64", "poolSize": 100}}`), config)).IsNil()
+	assert.StringLiteral(config.FakeIP.IPPool.String()).Equals("fc00::/64")
+	assert.Int(config.FakeIP.PoolSize).Equals(100)
+
+	assert.Error(json.Unmarshal([]byte(`{}`), config)).IsNil()
+	assert.Bool(config.FakeIP == nil).IsTrue()
+
+	for _, rawJson := range []string{
+		`{"fakeIP": {"ipPool": "198.18.0.0"}}`,
+		`{"fakeIP": {"poolSize": -1}}`,
+	} {
+		assert.Error(json.Unmarshal([]byte(rawJson), new(Config))).IsNotNil()
+	}
+}
@@ -4,42 +4,64 @@ import (
 	"net"
 
 	"github.com/v2ray/v2ray-core/app"
+	v2net "github.com/v2ray/v2ray-core/common/net"
 )
 
 const (
 	APP_ID = app.ID(2)
 )
 
-// A DnsCache is an internal cache of DNS resolutions.
-type DnsCache interface {
-	Get(domain string) net.IP
-	Add(domain string, ip net.IP)
+// A Server resolves domains into IP addresses.
+type Server interface {
+	// Get returns IPs of the given domain, or nil if the domain can't be resolved.
+	Get(domain string) []net.IP
 }
 
-type dnsCacheWithContext interface {
-	Get(context app.Context, domain string) net.IP
-	Add(contaxt app.Context, domain string, ip net.IP)
+// GetServer returns the DNS server in the given space, or nil if there is none.
+func GetServer(space app.Space) Server {
+	if space == nil || !space.HasApp(APP_ID) {
+		return nil
+	}
+	return space.GetApp(APP_ID).(Server)
 }
 
-type contextedDnsCache struct {
-	context  app.Context
-	dnsCache dnsCacheWithContext
+// A FakeIPServer hands out fake IPs of domains to clients, so that connections to the fake IPs can be
+// mapped back to the domains.
+type FakeIPServer interface {
+	// GetFake returns IPs of the given domain for clients, which are fake IPs unless the domain is an IP
+	// or a static host.
+	GetFake(domain string) []net.IP
+	// GetDomain returns the domain the given fake IP is handed out to, or empty if there is none.
+	GetDomain(ip net.IP) string
 }
 
-func (this *contextedDnsCache) Get(domain string) net.IP {
-	return this.dnsCache.Get(this.context, domain)
+// GetFakeIPServer returns the fake IP server in the given space, or nil if fake IP is not enabled.
+func GetFakeIPServer(space app.Space) FakeIPServer {
+	server, ok := GetServer(space).(*CacheServer)
+	if !ok || server.fakeIPs == nil {
+		return nil
+	}
+	return server
 }
 
-func (this *contextedDnsCache) Add(domain string, ip net.IP) {
-	this.dnsCache.Add(this.context, domain, ip)
+// RestoreDomain returns the given destination with its fake IP replaced by the domain it is handed out
+// to. Other destinations are returned as is.
+func RestoreDomain(server FakeIPServer, dest v2net.Destination) v2net.Destination {
+	if dest.Address().IsDomain() {
+		return dest
+	}
+	domain := server.GetDomain(dest.Address().IP())
+	if len(domain) == 0 {
+		return dest
+	}
+	if dest.IsUDP() {
+		return v2net.UDPDestination(v2net.DomainAddress(domain), dest.Port())
+	}
+	return v2net.TCPDestination(v2net.DomainAddress(domain), dest.Port())
 }
 
 func init() {
 	app.RegisterApp(APP_ID, func(context app.Context, obj interface{}) interface{} {
-		dcContext := obj.(dnsCacheWithContext)
-		return &contextedDnsCache{
-			context:  context,
-			dnsCache: dcContext,
-		}
+		return obj
 	})
 }
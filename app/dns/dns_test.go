@@ -0,0 +1,287 @@
+package dns_test
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/v2ray/v2ray-core/app"
+	"github.com/v2ray/v2ray-core/app/dispatcher"
+	. "github.com/v2ray/v2ray-core/app/dns"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	v2nettesting "github.com/v2ray/v2ray-core/common/net/testing"
+	netassert "github.com/v2ray/v2ray-core/common/net/testing/assert"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+	"github.com/v2ray/v2ray-core/common/serial"
+	"github.com/v2ray/v2ray-core/proxy/freedom"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+	dnsserver "github.com/v2ray/v2ray-core/testing/servers/dns"
+	"github.com/v2ray/v2ray-core/transport/ray"
+)
+
+func startServer(records map[string][]net.IP, ttl uint32, silent bool) (*dnsserver.Server, v2net.Destination) {
+	server := &dnsserver.Server{
+		Port:    v2nettesting.PickPort(),
+		Records: records,
+		TTL:     ttl,
+		Silent:  silent,
+	}
+	dest, err := server.Start()
+	assert.Error(err).IsNil()
+	return server, dest
+}
+
+func TestStaticHosts(t *testing.T) {
+	v2testing.Current(t)
+
+	server, dest := startServer(nil, 60, false)
+	defer server.Close()
+
+	dnsServer := NewCacheServer(nil, &Config{
+		NameServers: []*NameServerConfig{{Address: dest}},
+		Hosts: map[string]net.IP{
+			"v2ray.com": net.IP([]byte{1, 2, 3, 4}),
+		},
+	})
+	ips := dnsServer.Get("V2Ray.com.")
+	assert.Int(len(ips)).Equals(1)
+	netassert.IP(ips[0]).Equals(net.IP([]byte{1, 2, 3, 4}))
+
+	ips = dnsServer.Get("127.0.0.1")
+	assert.Int(len(ips)).Equals(1)
+	assert.Bool(ips[0].Equal(net.IP([]byte{127, 0, 0, 1}))).IsTrue()
+
+	assert.Int(server.Queries()).Equals(0)
+}
+
+func TestUDPQueryCachedByTTL(t *testing.T) {
+	v2testing.Current(t)
+
+	server, dest := startServer(map[string][]net.IP{
+		"v2ray.com": {net.IP([]byte{1, 2, 3, 4}), net.ParseIP("2001:db8::1")},
+	}, 60, false)
+	defer server.Close()
+
+	dnsServer := NewCacheServer(nil, &Config{
+		NameServers: []*NameServerConfig{{Address: dest}},
+	})
+	for i := 0; i < 2; i++ {
+		ips := dnsServer.Get("v2ray.com")
+		assert.Int(len(ips)).Equals(2)
+		netassert.IP(ips[0]).Equals(net.IP([]byte{1, 2, 3, 4}))
+		netassert.IP(ips[1]).Equals(net.ParseIP("2001:db8::1"))
+	}
+	// One query for A records, and one for AAAA.
+	assert.Int(server.Queries()).Equals(2)
+
+	assert.Int(len(dnsServer.Get("unknown.v2ray.com"))).Equals(0)
+}
+
+func TestZeroTTLNotCached(t *testing.T) {
+	v2testing.Current(t)
+
+	server, dest := startServer(map[string][]net.IP{
+		"v2ray.com": {net.IP([]byte{1, 2, 3, 4})},
+	}, 0, false)
+	defer server.Close()
+
+	dnsServer := NewCacheServer(nil, &Config{
+		NameServers: []*NameServerConfig{{Address: dest}},
+	})
+	assert.Int(len(dnsServer.Get("v2ray.com"))).Equals(1)
+	assert.Int(len(dnsServer.Get("v2ray.com"))).Equals(1)
+	assert.Int(server.Queries()).Equals(4)
+}
+
+func TestTCPQuery(t *testing.T) {
+	v2testing.Current(t)
+
+	server, dest := startServer(map[string][]net.IP{
+		"v2ray.com": {net.IP([]byte{1, 2, 3, 4})},
+	}, 60, false)
+	defer server.Close()
+
+	dnsServer := NewCacheServer(nil, &Config{
+		NameServers: []*NameServerConfig{{Address: v2net.TCPDestination(dest.Address(), dest.Port())}},
+	})
+	ips := dnsServer.Get("v2ray.com")
+	assert.Int(len(ips)).Equals(1)
+	netassert.IP(ips[0]).Equals(net.IP([]byte{1, 2, 3, 4}))
+}
+
+func TestServerForDomains(t *testing.T) {
+	v2testing.Current(t)
+
+	records := map[string][]net.IP{
+		"www.v2ray.com": {net.IP([]byte{1, 1, 1, 1})},
+		"example.com":   {net.IP([]byte{1, 1, 1, 1})},
+	}
+	general, generalDest := startServer(records, 60, false)
+	defer general.Close()
+
+	dedicatedRecords := map[string][]net.IP{
+		"www.v2ray.com": {net.IP([]byte{2, 2, 2, 2})},
+		"example.com":   {net.IP([]byte{2, 2, 2, 2})},
+	}
+	dedicated, dedicatedDest := startServer(dedicatedRecords, 60, false)
+	defer dedicated.Close()
+
+	dnsServer := NewCacheServer(nil, &Config{
+		NameServers: []*NameServerConfig{
+			{Address: generalDest},
+			{Address: dedicatedDest, Domains: []string{"v2ray.com"}},
+		},
+	})
+	ips := dnsServer.Get("www.v2ray.com")
+	assert.Int(len(ips)).Equals(1)
+	netassert.IP(ips[0]).Equals(net.IP([]byte{2, 2, 2, 2}))
+	assert.Int(general.Queries()).Equals(0)
+
+	ips = dnsServer.Get("example.com")
+	assert.Int(len(ips)).Equals(1)
+	netassert.IP(ips[0]).Equals(net.IP([]byte{1, 1, 1, 1}))
+	assert.Int(dedicated.Queries()).Equals(2)
+}
+
+func TestFirstAnswerWins(t *testing.T) {
+	v2testing.Current(t)
+
+	silent, silentDest := startServer(nil, 60, true)
+	defer silent.Close()
+
+	server, dest := startServer(map[string][]net.IP{
+		"v2ray.com": {net.IP([]byte{1, 2, 3, 4})},
+	}, 60, false)
+	defer server.Close()
+
+	dnsServer := NewCacheServer(nil, &Config{
+		NameServers: []*NameServerConfig{{Address: silentDest}, {Address: dest}},
+		Timeout:     time.Second * 2,
+	})
+	start := time.Now()
+	ips := dnsServer.Get("v2ray.com")
+	assert.Int(len(ips)).Equals(1)
+	netassert.IP(ips[0]).Equals(net.IP([]byte{1, 2, 3, 4}))
+	assert.Bool(time.Since(start) < time.Second).IsTrue()
+}
+
+func startTLSServer(records map[string][]net.IP) (*dnsserver.Server, v2net.Destination) {
+	tlsConfig, err := dnsserver.NewTLSConfig()
+	assert.Error(err).IsNil()
+	server := &dnsserver.Server{
+		Port:      v2nettesting.PickPort(),
+		Records:   records,
+		TTL:       60,
+		TLSConfig: tlsConfig,
+	}
+	dest, err := server.Start()
+	assert.Error(err).IsNil()
+	return server, v2net.TCPDestination(dest.Address(), dest.Port())
+}
+
+func TestDNSOverTLSReusesConnection(t *testing.T) {
+	v2testing.Current(t)
+
+	server, dest := startTLSServer(map[string][]net.IP{
+		"v2ray.com": {net.IP([]byte{1, 2, 3, 4})},
+		"v2ray.org": {net.IP([]byte{5, 6, 7, 8})},
+	})
+	defer server.Close()
+
+	dnsServer := NewCacheServer(nil, &Config{
+		NameServers: []*NameServerConfig{{Address: dest, TLS: true, AllowInsecure: true}},
+	})
+	ips := dnsServer.Get("v2ray.com")
+	assert.Int(len(ips)).Equals(1)
+	netassert.IP(ips[0]).Equals(net.IP([]byte{1, 2, 3, 4}))
+	ips = dnsServer.Get("v2ray.org")
+	assert.Int(len(ips)).Equals(1)
+	netassert.IP(ips[0]).Equals(net.IP([]byte{5, 6, 7, 8}))
+
+	assert.Int(server.Queries()).Equals(4)
+	assert.Int(server.Connections()).Equals(1)
+}
+
+func TestDNSOverTLSVerifiesCertificate(t *testing.T) {
+	v2testing.Current(t)
+
+	server, dest := startTLSServer(map[string][]net.IP{
+		"v2ray.com": {net.IP([]byte{1, 2, 3, 4})},
+	})
+	defer server.Close()
+
+	dnsServer := NewCacheServer(nil, &Config{
+		NameServers: []*NameServerConfig{{Address: dest, TLS: true}},
+	})
+	assert.Int(len(dnsServer.Get("v2ray.com"))).Equals(0)
+	assert.Int(server.Queries()).Equals(0)
+}
+
+func TestDNSOverHTTPS(t *testing.T) {
+	v2testing.Current(t)
+
+	server := &dnsserver.Server{
+		Records: map[string][]net.IP{
+			"v2ray.com": {net.IP([]byte{1, 2, 3, 4})},
+		},
+		TTL: 0,
+	}
+	httpServer := httptest.NewTLSServer(server)
+	defer httpServer.Close()
+
+	for _, method := range []string{"", "GET"} {
+		dnsServer := NewCacheServer(nil, &Config{
+			NameServers: []*NameServerConfig{{URL: httpServer.URL + "/dns-query", Method: method, AllowInsecure: true}},
+		})
+		ips := dnsServer.Get("v2ray.com")
+		assert.Int(len(ips)).Equals(1)
+		netassert.IP(ips[0]).Equals(net.IP([]byte{1, 2, 3, 4}))
+		if len(method) == 0 {
+			method = "POST"
+		}
+		assert.StringLiteral(server.LastHTTPMethod()).Equals(method)
+	}
+}
+
+// freedomDispatcher sends all traffic through a freedom outbound, and records the requested tags.
+type freedomDispatcher struct {
+	tags chan string
+}
+
+func (this *freedomDispatcher) DispatchToOutbound(context app.Context, packet v2net.Packet) ray.InboundRay {
+	return this.DispatchToTaggedOutbound(context, "", packet)
+}
+
+func (this *freedomDispatcher) DispatchToOutboundForUser(context app.Context, source serial.String, user *proto.User, packet v2net.Packet) ray.InboundRay {
+	return this.DispatchToTaggedOutbound(context, "", packet)
+}
+
+func (this *freedomDispatcher) DispatchToTaggedOutbound(context app.Context, tag string, packet v2net.Packet) ray.InboundRay {
+	this.tags <- tag
+	link := ray.NewRay()
+	go new(freedom.FreedomConnection).Dispatch(packet, link)
+	return link
+}
+
+func TestQueriesThroughOutbound(t *testing.T) {
+	v2testing.Current(t)
+
+	server, dest := startTLSServer(map[string][]net.IP{
+		"v2ray.com": {net.IP([]byte{1, 2, 3, 4})},
+	})
+	defer server.Close()
+
+	packetDispatcher := &freedomDispatcher{tags: make(chan string, 16)}
+	space := app.NewController()
+	space.Bind(dispatcher.APP_ID, packetDispatcher)
+
+	dnsServer := NewCacheServer(space.ForContext("dns"), &Config{
+		NameServers: []*NameServerConfig{{Address: dest, TLS: true, AllowInsecure: true, OutboundTag: "proxy"}},
+	})
+	ips := dnsServer.Get("v2ray.com")
+	assert.Int(len(ips)).Equals(1)
+	netassert.IP(ips[0]).Equals(net.IP([]byte{1, 2, 3, 4}))
+	assert.StringLiteral(<-packetDispatcher.tags).Equals("proxy")
+}
@@ -0,0 +1,140 @@
+package dns
+
+import (
+	"container/list"
+	"encoding/binary"
+	"net"
+	"sync"
+)
+
+const (
+	DefaultFakeIPPool     = "198.18.0.0/15"
+	DefaultFakeIPPoolSize = 65535
+)
+
+type fakeIPEntry struct {
+	domain string
+	offset uint64
+}
+
+// FakeIPPool hands out IPs in a range to domains, and maps them back. When all IPs are in use, the IP of
+// the least recently used domain is handed out again.
+type FakeIPPool struct {
+	sync.Mutex
+	network   *net.IPNet
+	size      uint64
+	entries   *list.List // Most recently used first.
+	byDomain  map[string]*list.Element
+	byOffset  map[uint64]*list.Element
+	allocated uint64
+}
+
+// NewFakeIPPool creates a FakeIPPool of the given config. The network and broadcast addresses of the
+// range are never handed out.
+func NewFakeIPPool(config *FakeIPConfig) *FakeIPPool {
+	network := config.IPPool
+	if ip4 := network.IP.To4(); ip4 != nil {
+		network = &net.IPNet{IP: ip4, Mask: network.Mask[len(network.Mask)-net.IPv4len:]}
+	}
+	size := uint64(config.PoolSize)
+	if size == 0 {
+		size = DefaultFakeIPPoolSize
+	}
+	ones, bits := network.Mask.Size()
+	if hostBits := uint(bits - ones); hostBits < 64 {
+		available := uint64(0)
+		if hostBits >= 2 {
+			available = uint64(1)<<hostBits - 2
+		}
+		if available < size {
+			size = available
+		}
+	}
+	return &FakeIPPool{
+		network:  network,
+		size:     size,
+		entries:  list.New(),
+		byDomain: make(map[string]*list.Element),
+		byOffset: make(map[uint64]*list.Element),
+	}
+}
+
+// ip returns the IP at the given offset from the start of the range.
+func (this *FakeIPPool) ip(offset uint64) net.IP {
+	ip := make(net.IP, len(this.network.IP))
+	copy(ip, this.network.IP)
+	if len(ip) == net.IPv4len {
+		binary.BigEndian.PutUint32(ip, binary.BigEndian.Uint32(ip)+uint32(offset))
+	} else {
+		binary.BigEndian.PutUint64(ip[8:], binary.BigEndian.Uint64(ip[8:])+offset)
+	}
+	return ip
+}
+
+// offset returns the offset of the given IP from the start of the range, and false if the IP is not
+// one the pool may hand out.
+func (this *FakeIPPool) offset(ip net.IP) (uint64, bool) {
+	if ip4 := ip.To4(); ip4 != nil && len(this.network.IP) == net.IPv4len {
+		ip = ip4
+	}
+	if len(ip) != len(this.network.IP) || !this.network.Contains(ip) {
+		return 0, false
+	}
+	var offset uint64
+	if len(ip) == net.IPv4len {
+		offset = uint64(binary.BigEndian.Uint32(ip) - binary.BigEndian.Uint32(this.network.IP))
+	} else {
+		offset = binary.BigEndian.Uint64(ip[8:]) - binary.BigEndian.Uint64(this.network.IP[8:])
+	}
+	if offset == 0 || offset > this.size || !this.ip(offset).Equal(ip) {
+		return 0, false
+	}
+	return offset, true
+}
+
+// Get returns the fake IP of the given domain, handing out one if the domain has none.
+func (this *FakeIPPool) Get(domain string) net.IP {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.size == 0 {
+		return nil
+	}
+	if element, found := this.byDomain[domain]; found {
+		this.entries.MoveToFront(element)
+		return this.ip(element.Value.(*fakeIPEntry).offset)
+	}
+
+	var entry *fakeIPEntry
+	if this.allocated < this.size {
+		this.allocated++
+		entry = &fakeIPEntry{offset: this.allocated}
+	} else {
+		oldest := this.entries.Back()
+		entry = this.entries.Remove(oldest).(*fakeIPEntry)
+		delete(this.byDomain, entry.domain)
+	}
+	entry.domain = domain
+	element := this.entries.PushFront(entry)
+	this.byDomain[domain] = element
+	this.byOffset[entry.offset] = element
+	return this.ip(entry.offset)
+}
+
+// GetDomain returns the domain the given IP is handed out to, or empty if there is none.
+func (this *FakeIPPool) GetDomain(ip net.IP) string {
+	offset, ok := this.offset(ip)
+	if !ok {
+		return ""
+	}
+
+	this.Lock()
+	defer this.Unlock()
+
+	element, found := this.byOffset[offset]
+	if !found {
+		return ""
+	}
+	this.entries.MoveToFront(element)
+	return element.Value.(*fakeIPEntry).domain
+}
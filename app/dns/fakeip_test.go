@@ -0,0 +1,84 @@
+package dns_test
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/v2ray/v2ray-core/app/dns"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	netassert "github.com/v2ray/v2ray-core/common/net/testing/assert"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+func newFakeIPPool(cidr string, size int) *FakeIPPool {
+	_, ipPool, err := net.ParseCIDR(cidr)
+	assert.Error(err).IsNil()
+	return NewFakeIPPool(&FakeIPConfig{IPPool: ipPool, PoolSize: size})
+}
+
+func TestFakeIPPool(t *testing.T) {
+	v2testing.Current(t)
+
+	pool := newFakeIPPool("198.18.0.0/15", 65535)
+	ip1 := pool.Get("v2ray.com")
+	ip2 := pool.Get("v2ray.org")
+	netassert.IP(ip1).Equals(net.IP([]byte{198, 18, 0, 1}))
+	netassert.IP(ip2).Equals(net.IP([]byte{198, 18, 0, 2}))
+	netassert.IP(pool.Get("v2ray.com")).Equals(ip1)
+
+	assert.StringLiteral(pool.GetDomain(ip1)).Equals("v2ray.com")
+	assert.StringLiteral(pool.GetDomain(ip2.To16())).Equals("v2ray.org")
+	assert.StringLiteral(pool.GetDomain(net.IP([]byte{198, 18, 0, 3}))).Equals("")
+	assert.StringLiteral(pool.GetDomain(net.IP([]byte{198, 18, 0, 0}))).Equals("")
+	assert.StringLiteral(pool.GetDomain(net.IP([]byte{8, 8, 8, 8}))).Equals("")
+}
+
+func TestFakeIPPoolReplacesLeastRecentlyUsed(t *testing.T) {
+	v2testing.Current(t)
+
+	pool := newFakeIPPool("10.0.0.0/30", 65535)
+	ip1 := pool.Get("v2ray.com")
+	ip2 := pool.Get("v2ray.org")
+	netassert.IP(ip2).Equals(net.IP([]byte{10, 0, 0, 2}))
+
+	// Only 2 IPs are available in the range. The IP of v2ray.org is least recently used after looking
+	// up v2ray.com.
+	assert.StringLiteral(pool.GetDomain(ip1)).Equals("v2ray.com")
+	ip3 := pool.Get("v2fly.org")
+	netassert.IP(ip3).Equals(ip2)
+	assert.StringLiteral(pool.GetDomain(ip2)).Equals("v2fly.org")
+	assert.StringLiteral(pool.GetDomain(ip1)).Equals("v2ray.com")
+	netassert.IP(pool.Get("v2ray.org")).Equals(ip2)
+	assert.StringLiteral(pool.GetDomain(ip2)).Equals("v2ray.org")
+}
+
+func TestFakeIPPoolIPv6(t *testing.T) {
+	v2testing.Current(t)
+
+	pool := newFakeIPPool("fc00::/18", 10)
+	ip := pool.Get("v2ray.com")
+	netassert.IP(ip).Equals(net.ParseIP("fc00::1"))
+	assert.StringLiteral(pool.GetDomain(net.ParseIP("fc00::1"))).Equals("v2ray.com")
+	assert.StringLiteral(pool.GetDomain(net.ParseIP("fc00:1::1"))).Equals("")
+}
+
+func TestFakeIPServer(t *testing.T) {
+	v2testing.Current(t)
+
+	_, ipPool, err := net.ParseCIDR("198.18.0.0/15")
+	assert.Error(err).IsNil()
+	server := NewCacheServer(nil, &Config{
+		Hosts:  map[string]net.IP{"v2ray.com": net.IP([]byte{1, 2, 3, 4})},
+		FakeIP: &FakeIPConfig{IPPool: ipPool, PoolSize: 16},
+	})
+
+	netassert.IP(server.GetFake("v2ray.com")[0]).Equals(net.IP([]byte{1, 2, 3, 4}))
+	fakeIP := server.GetFake("WWW.V2Ray.com.")[0]
+	netassert.IP(fakeIP).Equals(net.IP([]byte{198, 18, 0, 1}))
+
+	dest := RestoreDomain(server, v2net.TCPDestination(v2net.IPAddress(fakeIP), 443))
+	assert.StringLiteral(dest.String()).Equals(v2net.TCPDestination(v2net.DomainAddress("www.v2ray.com"), 443).String())
+	dest = RestoreDomain(server, v2net.UDPDestination(v2net.IPAddress([]byte{1, 2, 3, 4}), 53))
+	assert.Bool(dest.Address().IsIPv4()).IsTrue()
+}
@@ -0,0 +1,133 @@
+package dns
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	v2net "github.com/v2ray/v2ray-core/common/net"
+)
+
+const (
+	dnsMessageType = "application/dns-message"
+	maxMessageSize = 65535
+)
+
+var (
+	ErrorUnexpectedStatus = errors.New("Unexpected HTTP status from name server.")
+)
+
+// httpsNameServer queries a DNS over HTTPS server (RFC 8484).
+type httpsNameServer struct {
+	url       string
+	method    string
+	transport *http.Transport
+}
+
+func newHTTPSNameServer(config *NameServerConfig, dial dialFunc) *httpsNameServer {
+	method := config.Method
+	if len(method) == 0 {
+		method = "POST"
+	}
+	return &httpsNameServer{
+		url:    config.URL,
+		method: method,
+		transport: &http.Transport{
+			Dial: func(network, addr string) (net.Conn, error) {
+				host, portString, err := net.SplitHostPort(addr)
+				if err != nil {
+					return nil, err
+				}
+				port, err := v2net.PortFromString(portString)
+				if err != nil {
+					return nil, err
+				}
+				return dial(v2net.TCPDestination(v2net.ParseAddress(host), port), DefaultTimeout)
+			},
+			TLSClientConfig: &tls.Config{
+				ServerName:         config.ServerName,
+				InsecureSkipVerify: config.AllowInsecure,
+			},
+		},
+	}
+}
+
+func (this *httpsNameServer) Query(domain string, timeout time.Duration) ([]net.IP, time.Duration, error) {
+	queries, err := newQueries(domain)
+	if err != nil {
+		return nil, 0, err
+	}
+	client := &http.Client{
+		Transport: this.transport,
+		Timeout:   timeout,
+	}
+
+	errs := make(chan error, len(queries))
+	for _, q := range queries {
+		// ID should be 0 for better caching.
+		q.setID(0)
+		go func(q *query) {
+			errs <- this.exchange(client, q)
+		}(q)
+	}
+	var lastErr error
+	for range queries {
+		if err := <-errs; err != nil {
+			lastErr = err
+		}
+	}
+	ips, ttl, err := collectAnswers(queries)
+	if err == ErrorNameServerFailed && lastErr != nil {
+		return nil, 0, lastErr
+	}
+	return ips, ttl, err
+}
+
+// exchange sends the given query, and sets its response.
+func (this *httpsNameServer) exchange(client *http.Client, query *query) error {
+	var request *http.Request
+	var err error
+	if this.method == "GET" {
+		separator := "?"
+		if strings.Contains(this.url, "?") {
+			separator = "&"
+		}
+		request, err = http.NewRequest("GET", this.url+separator+"dns="+base64.RawURLEncoding.EncodeToString(query.message), nil)
+	} else {
+		request, err = http.NewRequest("POST", this.url, bytes.NewReader(query.message))
+		if err == nil {
+			request.Header.Set("Content-Type", dnsMessageType)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", dnsMessageType)
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, response.Body)
+		return ErrorUnexpectedStatus
+	}
+	message, err := ioutil.ReadAll(io.LimitReader(response.Body, maxMessageSize))
+	if err != nil {
+		return err
+	}
+	dnsResponse, err := parseResponse(message)
+	if err != nil {
+		return err
+	}
+	query.response = dnsResponse
+	return nil
+}
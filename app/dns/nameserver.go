@@ -0,0 +1,270 @@
+package dns
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/v2ray/v2ray-core/app/dispatcher"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	"github.com/v2ray/v2ray-core/transport/ray"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	maxUDPMessageSize = 4096
+)
+
+var (
+	ErrorNoAnswer         = errors.New("No answer from name server.")
+	ErrorNameServerFailed = errors.New("Name server failed.")
+)
+
+// nameServer queries IPs of domains from an upstream server.
+type nameServer interface {
+	// Query returns IPs of the given domain, and how long they may be cached.
+	Query(domain string, timeout time.Duration) ([]net.IP, time.Duration, error)
+}
+
+// dialFunc opens a TCP connection to the given destination.
+type dialFunc func(dest v2net.Destination, timeout time.Duration) (net.Conn, error)
+
+func dialDirect(dest v2net.Destination, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("tcp", dest.NetAddr(), timeout)
+}
+
+// dialThrough returns a dialFunc which opens connections through the outbound handler of the given tag.
+func dialThrough(packetDispatcher dispatcher.TaggedPacketDispatcher, tag string) dialFunc {
+	return func(dest v2net.Destination, timeout time.Duration) (net.Conn, error) {
+		link := packetDispatcher.DispatchToTaggedOutbound(tag, v2net.NewPacket(dest, nil, true))
+		return ray.NewConn(link, dest), nil
+	}
+}
+
+// newNameServer creates a nameServer of the given config. Connections to the server are opened by the
+// given dialFunc, except for plain UDP servers, which are queried directly. Queries to plain UDP servers
+// through an outbound are sent over TCP instead.
+func newNameServer(config *NameServerConfig, dial dialFunc, throughOutbound bool) nameServer {
+	if len(config.URL) > 0 {
+		return newHTTPSNameServer(config, dial)
+	}
+	if config.Address == nil {
+		return &localNameServer{}
+	}
+	tcpDest := v2net.TCPDestination(config.Address.Address(), config.Address.Port())
+	if config.TLS {
+		tlsConfig := &tls.Config{
+			ServerName:         config.ServerName,
+			InsecureSkipVerify: config.AllowInsecure,
+		}
+		if len(tlsConfig.ServerName) == 0 {
+			if address := config.Address.Address(); address.IsDomain() {
+				tlsConfig.ServerName = address.Domain()
+			} else {
+				tlsConfig.ServerName = address.IP().String()
+			}
+		}
+		return newStreamNameServer(tcpDest, dial, tlsConfig)
+	}
+	if config.Address.IsTCP() || throughOutbound {
+		return newStreamNameServer(tcpDest, dial, nil)
+	}
+	return &udpNameServer{
+		address: config.Address,
+		tcp:     newStreamNameServer(tcpDest, dial, nil),
+	}
+}
+
+// localNameServer uses the system resolver. Its answers are not cached, as the system does.
+type localNameServer struct {
+}
+
+func (this *localNameServer) Query(domain string, timeout time.Duration) ([]net.IP, time.Duration, error) {
+	ips, err := net.LookupIP(domain)
+	if err != nil {
+		return nil, 0, err
+	}
+	return ips, 0, nil
+}
+
+type udpNameServer struct {
+	address v2net.Destination
+	tcp     nameServer // For truncated responses.
+}
+
+func (this *udpNameServer) Query(domain string, timeout time.Duration) ([]net.IP, time.Duration, error) {
+	queries, err := newQueries(domain)
+	if err != nil {
+		return nil, 0, err
+	}
+	conn, err := net.DialTimeout("udp", this.address.NetAddr(), timeout)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	for _, query := range queries {
+		if _, err := conn.Write(query.message); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	buffer := make([]byte, maxUDPMessageSize)
+	for pending := len(queries); pending > 0; {
+		nBytes, err := conn.Read(buffer)
+		if err != nil {
+			// Use whatever we have got on timeout.
+			break
+		}
+		response, err := parseResponse(buffer[:nBytes])
+		if err != nil {
+			continue
+		}
+		query := findQuery(queries, response.Header.ID)
+		if query == nil || query.response != nil {
+			continue
+		}
+		if response.Header.Truncated {
+			return this.tcp.Query(domain, timeout)
+		}
+		query.response = response
+		pending--
+	}
+	return collectAnswers(queries)
+}
+
+// writeStreamQueries writes the given queries into a TCP-like stream, each prefixed by its length.
+func writeStreamQueries(writer io.Writer, queries []*query) error {
+	buffer := make([]byte, 0, 1024)
+	for _, query := range queries {
+		buffer = append(buffer, byte(len(query.message)>>8), byte(len(query.message)))
+		buffer = append(buffer, query.message...)
+	}
+	_, err := writer.Write(buffer)
+	return err
+}
+
+// readStreamMessage reads a length-prefixed message from a TCP-like stream.
+func readStreamMessage(reader io.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(reader, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// query is a DNS question for either A or AAAA records of a domain.
+type query struct {
+	id       uint16
+	message  []byte
+	response *dnsmessage.Message
+}
+
+// setID changes the ID of this query.
+func (this *query) setID(id uint16) {
+	this.id = id
+	binary.BigEndian.PutUint16(this.message, id)
+}
+
+func randomID() uint16 {
+	var id uint16
+	binary.Read(rand.Reader, binary.BigEndian, &id)
+	return id
+}
+
+// newQueries returns queries for both IPv4 and IPv6 addresses of the given domain.
+func newQueries(domain string) ([]*query, error) {
+	name, err := dnsmessage.NewName(domain + ".")
+	if err != nil {
+		return nil, err
+	}
+	queries := make([]*query, 0, 2)
+	for _, recordType := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		id := randomID()
+		message := &dnsmessage.Message{
+			Header: dnsmessage.Header{
+				ID:               id,
+				RecursionDesired: true,
+			},
+			Questions: []dnsmessage.Question{{
+				Name:  name,
+				Type:  recordType,
+				Class: dnsmessage.ClassINET,
+			}},
+		}
+		packed, err := message.Pack()
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, &query{id: id, message: packed})
+	}
+	return queries, nil
+}
+
+func findQuery(queries []*query, id uint16) *query {
+	for _, query := range queries {
+		if query.id == id {
+			return query
+		}
+	}
+	return nil
+}
+
+func parseResponse(data []byte) (*dnsmessage.Message, error) {
+	message := new(dnsmessage.Message)
+	if err := message.Unpack(data); err != nil {
+		return nil, err
+	}
+	if !message.Header.Response {
+		return nil, ErrorNoAnswer
+	}
+	return message, nil
+}
+
+// collectAnswers returns IPs in the responses of the given queries, IPv4 first, and the minimum TTL of
+// them.
+func collectAnswers(queries []*query) ([]net.IP, time.Duration, error) {
+	var ips []net.IP
+	var ttl uint32
+	answered := false
+	for _, query := range queries {
+		if query.response == nil {
+			continue
+		}
+		if rcode := query.response.Header.RCode; rcode != dnsmessage.RCodeSuccess && rcode != dnsmessage.RCodeNameError {
+			continue
+		}
+		answered = true
+		for _, answer := range query.response.Answers {
+			var ip net.IP
+			switch body := answer.Body.(type) {
+			case *dnsmessage.AResource:
+				ip = net.IP(body.A[:])
+			case *dnsmessage.AAAAResource:
+				ip = net.IP(body.AAAA[:])
+			default:
+				continue
+			}
+			if len(ips) == 0 || answer.Header.TTL < ttl {
+				ttl = answer.Header.TTL
+			}
+			ips = append(ips, ip)
+		}
+	}
+	if !answered {
+		return nil, 0, ErrorNameServerFailed
+	}
+	if len(ips) == 0 {
+		return nil, 0, ErrorNoAnswer
+	}
+	return ips, time.Duration(ttl) * time.Second, nil
+}
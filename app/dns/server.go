@@ -0,0 +1,211 @@
+package dns
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/v2ray/v2ray-core/app"
+	"github.com/v2ray/v2ray-core/app/dispatcher"
+	"github.com/v2ray/v2ray-core/common/log"
+)
+
+const (
+	cleanupInterval = time.Minute
+)
+
+type record struct {
+	ips        []net.IP
+	validUntil time.Time
+}
+
+func (this *record) IsValid() bool {
+	return this.validUntil.After(time.Now())
+}
+
+// normalizeDomain returns the given domain in lower case, without the trailing dot.
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(domain), ".")
+}
+
+// CacheServer resolves domains with static hosts, cached records and upstream name servers, in that
+// order. Answers from name servers are cached as long as their TTL.
+type CacheServer struct {
+	sync.Mutex
+	config      *Config
+	configs     []*NameServerConfig
+	servers     []nameServer // Name servers of the corresponding configs.
+	records     map[string]*record
+	lastCleanup time.Time
+	timeout     time.Duration
+	fakeIPs     *FakeIPPool // Nil if fake IP is disabled.
+}
+
+// NewCacheServer creates a CacheServer. Queries through outbounds are sent by the dispatcher in the given
+// space.
+func NewCacheServer(space app.Space, config *Config) *CacheServer {
+	server := &CacheServer{
+		config:      config,
+		records:     make(map[string]*record),
+		lastCleanup: time.Now(),
+		timeout:     config.Timeout,
+	}
+	if server.timeout <= 0 {
+		server.timeout = DefaultTimeout
+	}
+	if config.FakeIP != nil {
+		server.fakeIPs = NewFakeIPPool(config.FakeIP)
+	}
+	server.configs = config.NameServers
+	if len(server.configs) == 0 {
+		// Use the system resolver if no name server is configured.
+		server.configs = []*NameServerConfig{{}}
+	}
+	var packetDispatcher dispatcher.TaggedPacketDispatcher
+	if space != nil && space.HasApp(dispatcher.APP_ID) {
+		packetDispatcher, _ = space.GetApp(dispatcher.APP_ID).(dispatcher.TaggedPacketDispatcher)
+	}
+	server.servers = make([]nameServer, len(server.configs))
+	for idx, serverConfig := range server.configs {
+		dial := dialDirect
+		throughOutbound := len(serverConfig.OutboundTag) > 0
+		if throughOutbound {
+			if packetDispatcher != nil {
+				dial = dialThrough(packetDispatcher, serverConfig.OutboundTag)
+			} else {
+				log.Warning("DNS: No dispatcher for outbound [", serverConfig.OutboundTag, "], sending queries directly.")
+				throughOutbound = false
+			}
+		}
+		server.servers[idx] = newNameServer(serverConfig, dial, throughOutbound)
+	}
+	return server
+}
+
+func (this *CacheServer) Get(domain string) []net.IP {
+	domain = normalizeDomain(domain)
+	if ip := net.ParseIP(domain); ip != nil {
+		return []net.IP{ip}
+	}
+	if ip, found := this.config.Hosts[domain]; found {
+		return []net.IP{ip}
+	}
+	if ips := this.getRecord(domain); ips != nil {
+		return ips
+	}
+
+	ips, ttl, err := this.query(domain)
+	if err != nil {
+		log.Info("DNS: Failed to resolve ", domain, ": ", err)
+		return nil
+	}
+	log.Debug("DNS: ", domain, " resolved to ", ips)
+	if ttl > 0 {
+		this.setRecord(domain, &record{
+			ips:        ips,
+			validUntil: time.Now().Add(ttl),
+		})
+	}
+	return ips
+}
+
+// GetFake returns the fake IP of the given domain, unless the domain is an IP or a static host, whose IPs
+// are returned instead.
+func (this *CacheServer) GetFake(domain string) []net.IP {
+	domain = normalizeDomain(domain)
+	if ip := net.ParseIP(domain); ip != nil {
+		return []net.IP{ip}
+	}
+	if ip, found := this.config.Hosts[domain]; found {
+		return []net.IP{ip}
+	}
+	if this.fakeIPs == nil {
+		return nil
+	}
+	if ip := this.fakeIPs.Get(domain); ip != nil {
+		return []net.IP{ip}
+	}
+	return nil
+}
+
+func (this *CacheServer) GetDomain(ip net.IP) string {
+	if this.fakeIPs == nil {
+		return ""
+	}
+	return this.fakeIPs.GetDomain(ip)
+}
+
+func (this *CacheServer) getRecord(domain string) []net.IP {
+	this.Lock()
+	defer this.Unlock()
+
+	if record, found := this.records[domain]; found && record.IsValid() {
+		return record.ips
+	}
+	return nil
+}
+
+func (this *CacheServer) setRecord(domain string, entry *record) {
+	this.Lock()
+	defer this.Unlock()
+
+	this.records[domain] = entry
+	if time.Since(this.lastCleanup) > cleanupInterval {
+		for domain, record := range this.records {
+			if !record.IsValid() {
+				delete(this.records, domain)
+			}
+		}
+		this.lastCleanup = time.Now()
+	}
+}
+
+// serversFor returns the name servers for the given domain. Servers dedicated to the domain take
+// precedence, so that the domain is never leaked to others.
+func (this *CacheServer) serversFor(domain string) []nameServer {
+	var dedicated, general []nameServer
+	for idx, serverConfig := range this.configs {
+		if len(serverConfig.Domains) == 0 {
+			general = append(general, this.servers[idx])
+		} else if serverConfig.HasDomain(domain) {
+			dedicated = append(dedicated, this.servers[idx])
+		}
+	}
+	if len(dedicated) > 0 {
+		return dedicated
+	}
+	return general
+}
+
+type queryResult struct {
+	ips []net.IP
+	ttl time.Duration
+	err error
+}
+
+// query queries all name servers for the given domain in parallel, and returns the first answer.
+func (this *CacheServer) query(domain string) ([]net.IP, time.Duration, error) {
+	servers := this.serversFor(domain)
+	if len(servers) == 0 {
+		return nil, 0, ErrorNoAnswer
+	}
+
+	results := make(chan *queryResult, len(servers))
+	for _, server := range servers {
+		go func(server nameServer) {
+			ips, ttl, err := server.Query(domain, this.timeout)
+			results <- &queryResult{ips: ips, ttl: ttl, err: err}
+		}(server)
+	}
+
+	var err error
+	for range servers {
+		result := <-results
+		if result.err == nil {
+			return result.ips, result.ttl, nil
+		}
+		err = result.err
+	}
+	return nil, 0, err
+}
@@ -0,0 +1,205 @@
+package dns
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	streamIdleTimeout = 30 * time.Second
+)
+
+var (
+	ErrorSessionClosed = errors.New("DNS session closed.")
+)
+
+// streamNameServer queries a DNS server over TCP (RFC 7766), or TLS (RFC 7858). The connection is reused
+// by subsequent queries, and queries are pipelined on it.
+type streamNameServer struct {
+	sync.Mutex
+	dest      v2net.Destination
+	dial      dialFunc
+	tlsConfig *tls.Config // Nil for plain TCP.
+	session   *streamSession
+}
+
+func newStreamNameServer(dest v2net.Destination, dial dialFunc, tlsConfig *tls.Config) *streamNameServer {
+	return &streamNameServer{
+		dest:      dest,
+		dial:      dial,
+		tlsConfig: tlsConfig,
+	}
+}
+
+func (this *streamNameServer) Query(domain string, timeout time.Duration) ([]net.IP, time.Duration, error) {
+	queries, err := newQueries(domain)
+	if err != nil {
+		return nil, 0, err
+	}
+	for {
+		session, reused, err := this.getSession(timeout)
+		if err != nil {
+			return nil, 0, err
+		}
+		err = session.exchange(queries, timeout)
+		if err == ErrorSessionClosed && reused {
+			// The server may close idle connections at any time. Try again on a new connection.
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		return collectAnswers(queries)
+	}
+}
+
+// getSession returns the current session, or a new one if there is none. The returned bool is true if
+// the session has been used before.
+func (this *streamNameServer) getSession(timeout time.Duration) (*streamSession, bool, error) {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.session != nil && !this.session.isClosed() {
+		return this.session, true, nil
+	}
+
+	conn, err := this.dial(this.dest, timeout)
+	if err != nil {
+		return nil, false, err
+	}
+	if this.tlsConfig != nil {
+		tlsConn := tls.Client(conn, this.tlsConfig)
+		tlsConn.SetDeadline(time.Now().Add(timeout))
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, false, err
+		}
+		tlsConn.SetDeadline(time.Time{})
+		conn = tlsConn
+	}
+	this.session = newStreamSession(conn)
+	return this.session, false, nil
+}
+
+// streamSession is a connection to a DNS server, on which any number of queries are in flight.
+type streamSession struct {
+	sync.Mutex
+	conn       net.Conn
+	writeMutex sync.Mutex
+	pending    map[uint16]chan *dnsmessage.Message
+	closed     bool
+}
+
+func newStreamSession(conn net.Conn) *streamSession {
+	session := &streamSession{
+		conn:    conn,
+		pending: make(map[uint16]chan *dnsmessage.Message),
+	}
+	go session.run()
+	return session
+}
+
+// run reads responses and passes them to their queries, until the connection is closed or idle.
+func (this *streamSession) run() {
+	defer this.close()
+
+	for {
+		this.conn.SetReadDeadline(time.Now().Add(streamIdleTimeout))
+		message, err := readStreamMessage(this.conn)
+		if err != nil {
+			return
+		}
+		response, err := parseResponse(message)
+		if err != nil {
+			continue
+		}
+		this.Lock()
+		if responseChan, found := this.pending[response.Header.ID]; found {
+			delete(this.pending, response.Header.ID)
+			responseChan <- response
+		}
+		this.Unlock()
+	}
+}
+
+func (this *streamSession) isClosed() bool {
+	this.Lock()
+	defer this.Unlock()
+
+	return this.closed
+}
+
+// close closes the connection, and fails all pending queries.
+func (this *streamSession) close() {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.closed {
+		return
+	}
+	this.closed = true
+	for id, responseChan := range this.pending {
+		close(responseChan)
+		delete(this.pending, id)
+	}
+	this.conn.Close()
+}
+
+// exchange sends the given queries, and waits for their responses until the given timeout. Queries
+// without response on timeout are left unanswered.
+func (this *streamSession) exchange(queries []*query, timeout time.Duration) error {
+	responseChans := make([]chan *dnsmessage.Message, len(queries))
+	this.Lock()
+	if this.closed {
+		this.Unlock()
+		return ErrorSessionClosed
+	}
+	for idx, query := range queries {
+		for this.pending[query.id] != nil {
+			query.setID(randomID())
+		}
+		responseChans[idx] = make(chan *dnsmessage.Message, 1)
+		this.pending[query.id] = responseChans[idx]
+	}
+	this.Unlock()
+
+	defer func() {
+		this.Lock()
+		for idx, query := range queries {
+			if this.pending[query.id] == responseChans[idx] {
+				delete(this.pending, query.id)
+			}
+		}
+		this.Unlock()
+	}()
+
+	this.writeMutex.Lock()
+	this.conn.SetWriteDeadline(time.Now().Add(timeout))
+	err := writeStreamQueries(this.conn, queries)
+	this.writeMutex.Unlock()
+	if err != nil {
+		this.close()
+		return ErrorSessionClosed
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for idx, responseChan := range responseChans {
+		select {
+		case response, open := <-responseChan:
+			if !open {
+				return ErrorSessionClosed
+			}
+			queries[idx].response = response
+		case <-deadline.C:
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package limiter
+
+import (
+	"time"
+
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+)
+
+// Policy limits the traffic of a user. Zero values mean unlimited.
+type Policy struct {
+	UplinkRate   int64 // Bytes per second.
+	DownlinkRate int64 // Bytes per second.
+	Quota        int64 // Total bytes of uplink and downlink.
+}
+
+func (this *Policy) apply(settings *proto.UserSettings) {
+	if this.UplinkRate > 0 {
+		settings.UplinkRate = this.UplinkRate
+	}
+	if this.DownlinkRate > 0 {
+		settings.DownlinkRate = this.DownlinkRate
+	}
+	if this.Quota > 0 {
+		settings.Quota = this.Quota
+	}
+}
+
+type Config struct {
+	Levels       map[proto.UserLevel]*Policy // Policies by user level.
+	Users        map[string]*Policy          // Policies by user email, overriding the level ones.
+	QuotaFile    string                      // File to persist quota usage in. Optional.
+	SaveInterval time.Duration               // Interval of saving quota usage into QuotaFile.
+}
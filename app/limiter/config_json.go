@@ -0,0 +1,61 @@
+// +build json
+
+package limiter
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/v2ray/v2ray-core/common/log"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+)
+
+const (
+	defaultSaveIntervalSec = 60
+)
+
+func (this *Policy) UnmarshalJSON(data []byte) error {
+	type JsonPolicy struct {
+		UplinkRate   int64 `json:"uplinkRate"`   // KBytes per second.
+		DownlinkRate int64 `json:"downlinkRate"` // KBytes per second.
+		Quota        int64 `json:"quota"`        // MBytes.
+	}
+	jsonPolicy := new(JsonPolicy)
+	if err := json.Unmarshal(data, jsonPolicy); err != nil {
+		return err
+	}
+	this.UplinkRate = jsonPolicy.UplinkRate * 1024
+	this.DownlinkRate = jsonPolicy.DownlinkRate * 1024
+	this.Quota = jsonPolicy.Quota * 1024 * 1024
+	return nil
+}
+
+func (this *Config) UnmarshalJSON(data []byte) error {
+	type JsonConfig struct {
+		Levels       map[string]*Policy `json:"levels"`
+		Users        map[string]*Policy `json:"users"`
+		QuotaFile    string             `json:"quotaFile"`
+		SaveInterval int                `json:"saveInterval"` // Seconds.
+	}
+	jsonConfig := new(JsonConfig)
+	if err := json.Unmarshal(data, jsonConfig); err != nil {
+		return err
+	}
+	this.Levels = make(map[proto.UserLevel]*Policy)
+	for levelString, policy := range jsonConfig.Levels {
+		level, err := strconv.ParseUint(levelString, 10, 8)
+		if err != nil {
+			log.Error("Limiter: Invalid user level: ", levelString)
+			return err
+		}
+		this.Levels[proto.UserLevel(level)] = policy
+	}
+	this.Users = jsonConfig.Users
+	this.QuotaFile = jsonConfig.QuotaFile
+	if jsonConfig.SaveInterval <= 0 {
+		jsonConfig.SaveInterval = defaultSaveIntervalSec
+	}
+	this.SaveInterval = time.Duration(jsonConfig.SaveInterval) * time.Second
+	return nil
+}
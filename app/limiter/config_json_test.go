@@ -0,0 +1,38 @@
+// +build json
+
+package limiter_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/v2ray/v2ray-core/app/limiter"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+func TestConfigParsing(t *testing.T) {
+	v2testing.Current(t)
+
+	config := new(Config)
+	err := json.Unmarshal([]byte(`{
+    "levels": {
+      "1": {"uplinkRate": 1280, "downlinkRate": 1280}
+    },
+    "users": {
+      "love@v2ray.com": {"quota": 102400}
+    },
+    "quotaFile": "/var/lib/v2ray/quota.json"
+  }`), config)
+	assert.Error(err).IsNil()
+	assert.Int64(config.Levels[proto.UserLevel(1)].UplinkRate).Equals(1280 * 1024)
+	assert.Int64(config.Levels[proto.UserLevel(1)].DownlinkRate).Equals(1280 * 1024)
+	assert.Int64(config.Users["love@v2ray.com"].Quota).Equals(102400 * 1024 * 1024)
+	assert.StringLiteral(config.QuotaFile).Equals("/var/lib/v2ray/quota.json")
+	assert.Int64(int64(config.SaveInterval)).Equals(int64(time.Minute))
+
+	err = json.Unmarshal([]byte(`{"levels": {"x": {}}}`), config)
+	assert.Error(err).IsNotNil()
+}
@@ -0,0 +1,265 @@
+package limiter
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/v2ray/v2ray-core/app"
+	"github.com/v2ray/v2ray-core/common/log"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+	"github.com/v2ray/v2ray-core/transport/ray"
+)
+
+const (
+	APP_ID = app.ID(8)
+)
+
+var (
+	ErrorQuotaExceeded = errors.New("Quota exceeded.")
+)
+
+// userState keeps the usage and rate limits of a user, shared by all its sessions.
+type userState struct {
+	sync.Mutex
+	usage        int64
+	quota        int64
+	uplink       *TokenBucket
+	downlink     *TokenBucket
+	exceeded     chan bool // Closed when the quota is exceeded.
+	exceededOnce *sync.Once
+}
+
+func (this *userState) addUsage(n int) {
+	usage := atomic.AddInt64(&this.usage, int64(n))
+	if this.quota > 0 && usage >= this.quota {
+		this.Lock()
+		once, exceeded := this.exceededOnce, this.exceeded
+		this.Unlock()
+		once.Do(func() {
+			close(exceeded)
+		})
+	}
+}
+
+func (this *userState) isOverQuota() bool {
+	return this.quota > 0 && atomic.LoadInt64(&this.usage) >= this.quota
+}
+
+func (this *userState) exceededChan() <-chan bool {
+	this.Lock()
+	defer this.Unlock()
+	return this.exceeded
+}
+
+func (this *userState) reset() {
+	this.Lock()
+	defer this.Unlock()
+	atomic.StoreInt64(&this.usage, 0)
+	this.exceeded = make(chan bool)
+	this.exceededOnce = new(sync.Once)
+}
+
+// Limiter enforces rate limits and quotas on users. Users are identified by their emails, so users
+// without email are not limited.
+type Limiter struct {
+	sync.Mutex
+	config *Config
+	users  map[string]*userState
+	usages map[string]int64 // Usage loaded from the quota file, for users not seen yet.
+	closed chan bool
+}
+
+func NewLimiter(config *Config) (*Limiter, error) {
+	limiter := &Limiter{
+		config: config,
+		users:  make(map[string]*userState),
+		usages: make(map[string]int64),
+	}
+	if len(config.QuotaFile) > 0 {
+		if err := limiter.load(); err != nil {
+			return nil, err
+		}
+	}
+	return limiter, nil
+}
+
+// GetUserSettings returns the settings of the given user, with the policy of its level and its own
+// policy applied in turn.
+func (this *Limiter) GetUserSettings(user *proto.User) proto.UserSettings {
+	var settings proto.UserSettings
+	if policy, found := this.config.Levels[user.Level]; found {
+		policy.apply(&settings)
+	}
+	if policy, found := this.config.Users[user.Email]; found && len(user.Email) > 0 {
+		policy.apply(&settings)
+	}
+	return settings
+}
+
+func (this *Limiter) getUserState(user *proto.User) *userState {
+	if len(user.Email) == 0 {
+		return nil
+	}
+
+	this.Lock()
+	defer this.Unlock()
+	state, found := this.users[user.Email]
+	if found {
+		return state
+	}
+
+	settings := this.GetUserSettings(user)
+	state = &userState{
+		usage:        this.usages[user.Email],
+		quota:        settings.Quota,
+		exceeded:     make(chan bool),
+		exceededOnce: new(sync.Once),
+	}
+	delete(this.usages, user.Email)
+	if settings.UplinkRate > 0 {
+		state.uplink = NewTokenBucket(settings.UplinkRate)
+	}
+	if settings.DownlinkRate > 0 {
+		state.downlink = NewTokenBucket(settings.DownlinkRate)
+	}
+	state.addUsage(0)
+	this.users[user.Email] = state
+	return state
+}
+
+// IsOverQuota returns whether the given user has used up its quota.
+func (this *Limiter) IsOverQuota(user *proto.User) bool {
+	state := this.getUserState(user)
+	return state != nil && state.isOverQuota()
+}
+
+// Track returns an OutboundRay which applies the rate limits of the given user on the given link,
+// and counts the traffic into its quota. The session is terminated once the quota is exceeded.
+func (this *Limiter) Track(user *proto.User, link ray.OutboundRay) ray.OutboundRay {
+	state := this.getUserState(user)
+	if state == nil || (state.quota <= 0 && state.uplink == nil && state.downlink == nil) {
+		return link
+	}
+	return newLimitedRay(state, link)
+}
+
+// Usage returns the used and total quota of the user with the given email.
+func (this *Limiter) Usage(email string) (int64, int64) {
+	this.Lock()
+	defer this.Unlock()
+	if state, found := this.users[email]; found {
+		return atomic.LoadInt64(&state.usage), state.quota
+	}
+	var quota int64
+	if policy, found := this.config.Users[email]; found {
+		quota = policy.Quota
+	}
+	return this.usages[email], quota
+}
+
+// ResetUsage sets the used quota of the user with the given email to zero.
+func (this *Limiter) ResetUsage(email string) {
+	this.Lock()
+	defer this.Unlock()
+	if state, found := this.users[email]; found {
+		state.reset()
+	}
+	delete(this.usages, email)
+}
+
+func (this *Limiter) load() error {
+	data, err := ioutil.ReadFile(this.config.QuotaFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		log.Error("Limiter: Failed to read quota file: ", err)
+		return err
+	}
+	if err := json.Unmarshal(data, &this.usages); err != nil {
+		log.Error("Limiter: Invalid quota file: ", err)
+		return err
+	}
+	return nil
+}
+
+// Save writes the usage of all users into the quota file.
+func (this *Limiter) Save() error {
+	if len(this.config.QuotaFile) == 0 {
+		return nil
+	}
+
+	this.Lock()
+	usages := make(map[string]int64, len(this.usages)+len(this.users))
+	for email, usage := range this.usages {
+		usages[email] = usage
+	}
+	for email, state := range this.users {
+		usages[email] = atomic.LoadInt64(&state.usage)
+	}
+	this.Unlock()
+
+	data, err := json.Marshal(usages)
+	if err != nil {
+		return err
+	}
+	tmpFile := this.config.QuotaFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, data, 0600); err != nil {
+		log.Error("Limiter: Failed to write quota file: ", err)
+		return err
+	}
+	if err := os.Rename(tmpFile, this.config.QuotaFile); err != nil {
+		log.Error("Limiter: Failed to write quota file: ", err)
+		return err
+	}
+	return nil
+}
+
+// Start starts saving quota usage periodically, if a quota file is configured.
+func (this *Limiter) Start() {
+	if len(this.config.QuotaFile) == 0 || this.config.SaveInterval <= 0 {
+		return
+	}
+	this.Lock()
+	defer this.Unlock()
+	if this.closed != nil {
+		return
+	}
+	this.closed = make(chan bool)
+	go this.saveLoop(this.config.SaveInterval, this.closed)
+}
+
+func (this *Limiter) saveLoop(interval time.Duration, closed <-chan bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			this.Save()
+		case <-closed:
+			return
+		}
+	}
+}
+
+// Close stops saving quota usage periodically, and saves it for the last time.
+func (this *Limiter) Close() {
+	this.Lock()
+	if this.closed != nil {
+		close(this.closed)
+		this.closed = nil
+	}
+	this.Unlock()
+	this.Save()
+}
+
+func init() {
+	app.RegisterApp(APP_ID, func(context app.Context, obj interface{}) interface{} {
+		return obj
+	})
+}
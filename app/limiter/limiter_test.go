@@ -0,0 +1,172 @@
+package limiter_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/v2ray/v2ray-core/app/limiter"
+	"github.com/v2ray/v2ray-core/common/alloc"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+	"github.com/v2ray/v2ray-core/transport/ray"
+)
+
+func TestTokenBucket(t *testing.T) {
+	v2testing.Current(t)
+
+	bucket := NewTokenBucket(1000)
+	start := time.Now()
+	bucket.Wait(1000, nil)
+	assert.Bool(time.Since(start) < 100*time.Millisecond).IsTrue()
+	bucket.Wait(300, nil)
+	assert.Bool(time.Since(start) >= 250*time.Millisecond).IsTrue()
+}
+
+func TestTokenBucketKeepsDebt(t *testing.T) {
+	v2testing.Current(t)
+
+	bucket := NewTokenBucket(1000)
+	start := time.Now()
+	bucket.Wait(2200, nil)
+	assert.Bool(time.Since(start) >= 1100*time.Millisecond).IsTrue()
+	bucket.Wait(500, nil)
+	assert.Bool(time.Since(start) >= 1600*time.Millisecond).IsTrue()
+}
+
+func TestTokenBucketCanceled(t *testing.T) {
+	v2testing.Current(t)
+
+	bucket := NewTokenBucket(1000)
+	done := make(chan struct{})
+	time.AfterFunc(100*time.Millisecond, func() {
+		close(done)
+	})
+	start := time.Now()
+	assert.Bool(bucket.Wait(6000, done)).IsFalse()
+	assert.Bool(time.Since(start) < time.Second).IsTrue()
+}
+
+func TestUserSettings(t *testing.T) {
+	v2testing.Current(t)
+
+	limiter, err := NewLimiter(&Config{
+		Levels: map[proto.UserLevel]*Policy{
+			proto.UserLevel(1): {UplinkRate: 100, DownlinkRate: 200, Quota: 1000},
+		},
+		Users: map[string]*Policy{
+			"love@v2ray.com": {Quota: 5000},
+		},
+	})
+	assert.Error(err).IsNil()
+
+	settings := limiter.GetUserSettings(&proto.User{Level: proto.UserLevel(1), Email: "love@v2ray.com"})
+	assert.Int64(settings.UplinkRate).Equals(100)
+	assert.Int64(settings.DownlinkRate).Equals(200)
+	assert.Int64(settings.Quota).Equals(5000)
+
+	settings = limiter.GetUserSettings(&proto.User{Level: proto.UserLevel(0), Email: "love@v2ray.com"})
+	assert.Int64(settings.UplinkRate).Equals(0)
+	assert.Int64(settings.Quota).Equals(5000)
+}
+
+func TestQuota(t *testing.T) {
+	v2testing.Current(t)
+
+	limiter, err := NewLimiter(&Config{
+		Users: map[string]*Policy{
+			"love@v2ray.com": {Quota: 10},
+		},
+	})
+	assert.Error(err).IsNil()
+	user := &proto.User{Email: "love@v2ray.com"}
+	assert.Bool(limiter.IsOverQuota(user)).IsFalse()
+
+	direct := ray.NewRay()
+	link := limiter.Track(user, direct)
+	direct.InboundInput() <- alloc.NewBuffer().Clear().Append([]byte("request"))
+	chunk := <-link.OutboundInput()
+	chunk.Release()
+	link.OutboundOutput() <- alloc.NewBuffer().Clear().Append([]byte("response"))
+	chunk = <-direct.InboundOutput()
+	chunk.Release()
+
+	// The session is closed once the quota is exceeded.
+	_, open := <-direct.InboundOutput()
+	assert.Bool(open).IsFalse()
+	_, open = <-link.OutboundInput()
+	assert.Bool(open).IsFalse()
+	close(direct.InboundInput())
+	close(link.OutboundOutput())
+
+	assert.Bool(limiter.IsOverQuota(user)).IsTrue()
+	usage, quota := limiter.Usage(user.Email)
+	assert.Int64(usage).Equals(15)
+	assert.Int64(quota).Equals(10)
+
+	limiter.ResetUsage(user.Email)
+	assert.Bool(limiter.IsOverQuota(user)).IsFalse()
+
+	assert.Bool(limiter.IsOverQuota(&proto.User{})).IsFalse()
+}
+
+func TestTrackCanceled(t *testing.T) {
+	v2testing.Current(t)
+
+	limiter, err := NewLimiter(&Config{
+		Users: map[string]*Policy{
+			"love@v2ray.com": {UplinkRate: 10},
+		},
+	})
+	assert.Error(err).IsNil()
+
+	direct := ray.NewRay()
+	link := limiter.Track(&proto.User{Email: "love@v2ray.com"}, direct)
+	direct.InboundInput() <- alloc.NewBuffer().Clear().Append(make([]byte, 100))
+	time.AfterFunc(100*time.Millisecond, direct.Cancel)
+
+	// The throttled chunk is dropped once the session is canceled.
+	start := time.Now()
+	_, open := <-link.OutboundInput()
+	assert.Bool(open).IsFalse()
+	assert.Bool(time.Since(start) < time.Second).IsTrue()
+	close(direct.InboundInput())
+	close(link.OutboundOutput())
+}
+
+func TestQuotaFile(t *testing.T) {
+	v2testing.Current(t)
+
+	dir, err := ioutil.TempDir("", "v2ray-limiter")
+	assert.Error(err).IsNil()
+	defer os.RemoveAll(dir)
+
+	config := &Config{
+		Users: map[string]*Policy{
+			"love@v2ray.com": {Quota: 10},
+		},
+		QuotaFile: filepath.Join(dir, "quota.json"),
+	}
+	limiter, err := NewLimiter(config)
+	assert.Error(err).IsNil()
+
+	user := &proto.User{Email: "love@v2ray.com"}
+	direct := ray.NewRay()
+	link := limiter.Track(user, direct)
+	link.OutboundOutput() <- alloc.NewBuffer().Clear().Append([]byte("response"))
+	close(link.OutboundOutput())
+	for chunk := range direct.InboundOutput() {
+		chunk.Release()
+	}
+	close(direct.InboundInput())
+	limiter.Close()
+
+	limiter, err = NewLimiter(config)
+	assert.Error(err).IsNil()
+	usage, _ := limiter.Usage(user.Email)
+	assert.Int64(usage).Equals(8)
+	assert.Bool(limiter.IsOverQuota(user)).IsFalse()
+}
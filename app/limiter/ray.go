@@ -0,0 +1,107 @@
+package limiter
+
+import (
+	"github.com/v2ray/v2ray-core/common/alloc"
+	"github.com/v2ray/v2ray-core/common/log"
+	"github.com/v2ray/v2ray-core/transport/ray"
+)
+
+// limitedRay applies rate limits and quota of a user on an OutboundRay.
+type limitedRay struct {
+	input  chan *alloc.Buffer
+	output chan *alloc.Buffer
+	done   <-chan struct{}
+}
+
+func newLimitedRay(state *userState, link ray.OutboundRay) *limitedRay {
+	this := &limitedRay{
+		input:  make(chan *alloc.Buffer, 16),
+		output: make(chan *alloc.Buffer, 16),
+		done:   link.Done(),
+	}
+	exceeded := state.exceededChan()
+
+	go func(input <-chan *alloc.Buffer) {
+		defer func() {
+			close(this.input)
+			for chunk := range input {
+				chunk.Release()
+			}
+		}()
+		for {
+			select {
+			case chunk, open := <-input:
+				if !open {
+					return
+				}
+				if state.uplink != nil && !state.uplink.Wait(chunk.Len(), this.done) {
+					chunk.Release()
+					return
+				}
+				state.addUsage(chunk.Len())
+				select {
+				case this.input <- chunk:
+				case <-this.done:
+					chunk.Release()
+					return
+				case <-exceeded:
+					chunk.Release()
+					return
+				}
+			case <-this.done:
+				return
+			case <-exceeded:
+				return
+			}
+		}
+	}(link.OutboundInput())
+
+	go func(output chan<- *alloc.Buffer) {
+		defer func() {
+			close(output)
+			go func() {
+				for chunk := range this.output {
+					chunk.Release()
+				}
+			}()
+		}()
+		for {
+			select {
+			case chunk, open := <-this.output:
+				if !open {
+					return
+				}
+				if state.downlink != nil && !state.downlink.Wait(chunk.Len(), this.done) {
+					chunk.Release()
+					return
+				}
+				state.addUsage(chunk.Len())
+				select {
+				case output <- chunk:
+				case <-this.done:
+					chunk.Release()
+					return
+				}
+			case <-this.done:
+				return
+			case <-exceeded:
+				log.Info("Limiter: Quota exceeded, closing session.")
+				return
+			}
+		}
+	}(link.OutboundOutput())
+
+	return this
+}
+
+func (this *limitedRay) OutboundInput() <-chan *alloc.Buffer {
+	return this.input
+}
+
+func (this *limitedRay) OutboundOutput() chan<- *alloc.Buffer {
+	return this.output
+}
+
+func (this *limitedRay) Done() <-chan struct{} {
+	return this.done
+}
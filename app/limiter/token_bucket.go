@@ -0,0 +1,52 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket limits the rate of a stream. It is safe for concurrent use.
+type TokenBucket struct {
+	sync.Mutex
+	rate   int64 // Tokens per second.
+	tokens int64
+	last   time.Time
+}
+
+// NewTokenBucket creates a TokenBucket with the given rate, allowing bursts of one second.
+func NewTokenBucket(rate int64) *TokenBucket {
+	return &TokenBucket{
+		rate:   rate,
+		tokens: rate,
+		last:   time.Now(),
+	}
+}
+
+// Wait takes the given number of tokens, and blocks until the tokens are available or the given channel
+// is closed. It returns false if the channel is closed first. Tokens are borrowed if there are not
+// enough, so that any size of chunk can pass.
+func (this *TokenBucket) Wait(n int, done <-chan struct{}) bool {
+	this.Lock()
+	now := time.Now()
+	// Refill by the elapsed time, keeping any debt borrowed by earlier chunks.
+	this.tokens += int64(now.Sub(this.last).Seconds() * float64(this.rate))
+	if this.tokens > this.rate {
+		this.tokens = this.rate
+	}
+	this.last = now
+	this.tokens -= int64(n)
+	deficit := -this.tokens
+	this.Unlock()
+
+	if deficit <= 0 {
+		return true
+	}
+	timer := time.NewTimer(time.Duration(deficit * int64(time.Second) / this.rate))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
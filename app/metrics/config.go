@@ -0,0 +1,10 @@
+package metrics
+
+import (
+	v2net "github.com/v2ray/v2ray-core/common/net"
+)
+
+type Config struct {
+	Port          v2net.Port    // Port of the metrics listener.
+	ListenAddress v2net.Address // Address of the metrics listener, loopback if not set.
+}
@@ -0,0 +1,25 @@
+// +build json
+
+package metrics
+
+import (
+	"encoding/json"
+
+	v2net "github.com/v2ray/v2ray-core/common/net"
+)
+
+func (this *Config) UnmarshalJSON(data []byte) error {
+	type JsonConfig struct {
+		Port          v2net.Port         `json:"port"`
+		ListenAddress *v2net.AddressJson `json:"listen"`
+	}
+	jsonConfig := new(JsonConfig)
+	if err := json.Unmarshal(data, jsonConfig); err != nil {
+		return err
+	}
+	this.Port = jsonConfig.Port
+	if jsonConfig.ListenAddress != nil {
+		this.ListenAddress = jsonConfig.ListenAddress.Address
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+	"runtime"
+	"sync"
+
+	"github.com/v2ray/v2ray-core/app"
+	"github.com/v2ray/v2ray-core/common/log"
+	"github.com/v2ray/v2ray-core/common/metrics"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+)
+
+const (
+	APP_ID = app.ID(7)
+)
+
+var (
+	inboundConnections = metrics.NewCounterVec("v2ray_inbound_connections_total", "Number of connections accepted or rejected by inbounds.", "inbound", "status")
+	dialFailures       = metrics.NewCounterVec("v2ray_outbound_dial_failures_total", "Number of failures connecting to remote servers by outbounds.", "outbound")
+)
+
+// Recorder records events of a proxy handler, labeled by the tag of the handler.
+type Recorder interface {
+	// RecordAccess records a connection accepted or rejected by an inbound handler.
+	RecordAccess(status log.AccessStatus)
+
+	// RecordDialFailure records a failure of an outbound handler connecting to a remote server.
+	RecordDialFailure()
+}
+
+type recorder struct {
+	tag string
+}
+
+func (this *recorder) RecordAccess(status log.AccessStatus) {
+	inboundConnections.WithLabelValues(this.tag, string(status)).Inc()
+}
+
+func (this *recorder) RecordDialFailure() {
+	dialFailures.WithLabelValues(this.tag).Inc()
+}
+
+type noOpRecorder struct {
+}
+
+func (this *noOpRecorder) RecordAccess(status log.AccessStatus) {
+}
+
+func (this *noOpRecorder) RecordDialFailure() {
+}
+
+// GetRecorder returns the Recorder in the given space, or a Recorder which records nothing if
+// metrics is not enabled.
+func GetRecorder(space app.Space) Recorder {
+	if space == nil || !space.HasApp(APP_ID) {
+		return &noOpRecorder{}
+	}
+	return space.GetApp(APP_ID).(Recorder)
+}
+
+// MetricsServer exports all metrics over HTTP.
+type MetricsServer struct {
+	sync.Mutex
+	config   *Config
+	listener *net.TCPListener
+}
+
+func NewMetricsServer(config *Config) *MetricsServer {
+	return &MetricsServer{
+		config: config,
+	}
+}
+
+// Start listens on the configured port, and serves metrics on any path.
+func (this *MetricsServer) Start() error {
+	address := this.config.ListenAddress
+	if address == nil {
+		address = v2net.IPAddress([]byte{127, 0, 0, 1})
+	}
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{
+		IP:   address.IP(),
+		Port: int(this.config.Port),
+	})
+	if err != nil {
+		log.Error("Metrics: Failed to listen on port ", this.config.Port, ": ", err)
+		return err
+	}
+	log.Info("Metrics: Listening on ", listener.Addr())
+
+	this.Lock()
+	this.listener = listener
+	this.Unlock()
+
+	go http.Serve(listener, this)
+	return nil
+}
+
+func (this *MetricsServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := metrics.WriteText(writer); err != nil {
+		log.Warning("Metrics: Failed to write metrics: ", err)
+	}
+}
+
+func (this *MetricsServer) Close() {
+	this.Lock()
+	defer this.Unlock()
+	if this.listener != nil {
+		this.listener.Close()
+		this.listener = nil
+	}
+}
+
+func init() {
+	metrics.NewGaugeFunc("v2ray_goroutines", "Number of goroutines.", func() int64 {
+		return int64(runtime.NumGoroutine())
+	})
+
+	app.RegisterApp(APP_ID, func(context app.Context, obj interface{}) interface{} {
+		return &recorder{
+			tag: context.CallerTag(),
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package metrics_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/v2ray/v2ray-core/app"
+	. "github.com/v2ray/v2ray-core/app/metrics"
+	"github.com/v2ray/v2ray-core/common/alloc"
+	"github.com/v2ray/v2ray-core/common/log"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+func TestScrape(t *testing.T) {
+	v2testing.Current(t)
+
+	server := NewMetricsServer(&Config{Port: v2net.Port(50051)})
+	assert.Error(server.Start()).IsNil()
+	defer server.Close()
+
+	spaceController := app.NewController()
+	spaceController.Bind(APP_ID, server)
+	GetRecorder(spaceController.ForContext("in")).RecordAccess(log.AccessAccepted)
+	GetRecorder(spaceController.ForContext("in")).RecordAccess(log.AccessRejected)
+	GetRecorder(spaceController.ForContext("in")).RecordAccess(log.AccessAccepted)
+	GetRecorder(spaceController.ForContext("out")).RecordDialFailure()
+	GetRecorder(app.NewController().ForContext("ignored")).RecordDialFailure()
+	alloc.NewSmallBuffer().Release()
+
+	response, err := http.Get("http://127.0.0.1:50051/metrics")
+	assert.Error(err).IsNil()
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	assert.Error(err).IsNil()
+	text := string(body)
+
+	assert.Bool(strings.Contains(text, "v2ray_inbound_connections_total{inbound=\"in\",status=\"accepted\"} 2\n")).IsTrue()
+	assert.Bool(strings.Contains(text, "v2ray_inbound_connections_total{inbound=\"in\",status=\"rejected\"} 1\n")).IsTrue()
+	assert.Bool(strings.Contains(text, "v2ray_outbound_dial_failures_total{outbound=\"out\"} 1\n")).IsTrue()
+	assert.Bool(strings.Contains(text, "ignored")).IsFalse()
+	assert.Bool(strings.Contains(text, "# TYPE v2ray_goroutines gauge\n")).IsTrue()
+	assert.Bool(strings.Contains(text, "v2ray_buffer_pool_gets_total{pool=\"small\"}")).IsTrue()
+}
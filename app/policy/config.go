@@ -0,0 +1,21 @@
+package policy
+
+import (
+	"time"
+
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+)
+
+// Policy of connections from users of a certain level. Zero timeouts mean no timeout.
+type Policy struct {
+	HandshakeTimeout    time.Duration // Time to read the request header of a new connection.
+	ConnIdleTimeout     time.Duration // Time a connection may stay without any traffic.
+	UplinkOnlyTimeout   time.Duration // Time a connection may stay idle after its downlink is closed.
+	DownlinkOnlyTimeout time.Duration // Time a connection may stay idle after its uplink is closed.
+	BufferSize          int           // Bytes buffered in each direction of a connection, or 0 for default.
+	StatsEnabled        bool          // Whether traffic of users of this level is counted in stats.
+}
+
+type Config struct {
+	Levels map[proto.UserLevel]*Policy // Policies by user level. Levels not listed use DefaultPolicy.
+}
@@ -0,0 +1,62 @@
+// +build json
+
+package policy
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/v2ray/v2ray-core/common/log"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+)
+
+func (this *Config) UnmarshalJSON(data []byte) error {
+	// Fields not present keep the values of DefaultPolicy.
+	type JsonPolicy struct {
+		Handshake    *int  `json:"handshake"`    // Seconds.
+		ConnIdle     *int  `json:"connIdle"`     // Seconds.
+		UplinkOnly   *int  `json:"uplinkOnly"`   // Seconds.
+		DownlinkOnly *int  `json:"downlinkOnly"` // Seconds.
+		BufferSize   *int  `json:"bufferSize"`   // KBytes.
+		Stats        *bool `json:"stats"`
+	}
+	type JsonConfig struct {
+		Levels map[string]*JsonPolicy `json:"levels"`
+	}
+	jsonConfig := new(JsonConfig)
+	if err := json.Unmarshal(data, jsonConfig); err != nil {
+		return err
+	}
+	this.Levels = make(map[proto.UserLevel]*Policy)
+	for levelString, jsonPolicy := range jsonConfig.Levels {
+		level, err := strconv.ParseUint(levelString, 10, 8)
+		if err != nil {
+			log.Error("Policy: Invalid user level: ", levelString)
+			return err
+		}
+		policy := DefaultPolicy(proto.UserLevel(level))
+		if jsonPolicy != nil {
+			if jsonPolicy.Handshake != nil {
+				policy.HandshakeTimeout = time.Duration(*jsonPolicy.Handshake) * time.Second
+			}
+			if jsonPolicy.ConnIdle != nil {
+				policy.ConnIdleTimeout = time.Duration(*jsonPolicy.ConnIdle) * time.Second
+			}
+			if jsonPolicy.UplinkOnly != nil {
+				policy.UplinkOnlyTimeout = time.Duration(*jsonPolicy.UplinkOnly) * time.Second
+			}
+			if jsonPolicy.DownlinkOnly != nil {
+				policy.DownlinkOnlyTimeout = time.Duration(*jsonPolicy.DownlinkOnly) * time.Second
+			}
+			if jsonPolicy.BufferSize != nil {
+				policy.BufferSize = *jsonPolicy.BufferSize * 1024
+			}
+			if jsonPolicy.Stats != nil {
+				policy.StatsEnabled = *jsonPolicy.Stats
+			}
+		}
+		this.Levels[proto.UserLevel(level)] = policy
+	}
+	return nil
+}
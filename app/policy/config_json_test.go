@@ -0,0 +1,42 @@
+// +build json
+
+package policy_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/v2ray/v2ray-core/app/policy"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+func TestConfigParsing(t *testing.T) {
+	v2testing.Current(t)
+
+	config := new(Config)
+	err := json.Unmarshal([]byte(`{
+    "levels": {
+      "0": {"handshake": 4, "connIdle": 300},
+      "1": {"connIdle": 0, "bufferSize": 512, "stats": false}
+    }
+  }`), config)
+	assert.Error(err).IsNil()
+
+	policy := config.Levels[proto.UserLevel(0)]
+	assert.Int64(int64(policy.HandshakeTimeout)).Equals(int64(4 * time.Second))
+	assert.Int64(int64(policy.ConnIdleTimeout)).Equals(int64(300 * time.Second))
+	assert.Int64(int64(policy.DownlinkOnlyTimeout)).Equals(int64(5 * time.Second))
+	assert.Bool(policy.StatsEnabled).IsTrue()
+
+	policy = config.Levels[proto.UserLevel(1)]
+	assert.Int64(int64(policy.HandshakeTimeout)).Equals(int64(16 * time.Second))
+	assert.Int64(int64(policy.ConnIdleTimeout)).Equals(0)
+	assert.Int(policy.BufferSize).Equals(512 * 1024)
+	assert.Bool(policy.StatsEnabled).IsFalse()
+
+	err = json.Unmarshal([]byte(`{"levels": {"256": {}}}`), config)
+	assert.Error(err).IsNotNil()
+}
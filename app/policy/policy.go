@@ -0,0 +1,78 @@
+package policy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/v2ray/v2ray-core/app"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+)
+
+const (
+	APP_ID = app.ID(9)
+)
+
+// DefaultPolicy returns the policy of the given level when it is not configured. Connections from
+// untrusted users time out sooner when idle.
+func DefaultPolicy(level proto.UserLevel) *Policy {
+	policy := &Policy{
+		HandshakeTimeout:    16 * time.Second,
+		ConnIdleTimeout:     120 * time.Second,
+		UplinkOnlyTimeout:   2 * time.Second,
+		DownlinkOnlyTimeout: 5 * time.Second,
+		StatsEnabled:        true,
+	}
+	if level > proto.UserLevelUntrusted {
+		policy.ConnIdleTimeout = 300 * time.Second
+	}
+	return policy
+}
+
+// PolicyManager provides the policy of each user level.
+type PolicyManager struct {
+	sync.RWMutex
+	config *Config
+}
+
+// NewPolicyManager creates a PolicyManager with the given config, which may be nil.
+func NewPolicyManager(config *Config) *PolicyManager {
+	return &PolicyManager{
+		config: config,
+	}
+}
+
+// ForLevel returns the policy of the given user level. The returned policy must not be modified.
+func (this *PolicyManager) ForLevel(level proto.UserLevel) *Policy {
+	this.RLock()
+	config := this.config
+	this.RUnlock()
+
+	if config != nil {
+		if policy, found := config.Levels[level]; found {
+			return policy
+		}
+	}
+	return DefaultPolicy(level)
+}
+
+// Update replaces the config of this PolicyManager. Connections in progress keep their policies.
+func (this *PolicyManager) Update(config *Config) {
+	this.Lock()
+	this.config = config
+	this.Unlock()
+}
+
+// GetPolicyManager returns the PolicyManager in the given space, or a PolicyManager with default
+// policies if there isn't any.
+func GetPolicyManager(space app.Space) *PolicyManager {
+	if space == nil || !space.HasApp(APP_ID) {
+		return NewPolicyManager(nil)
+	}
+	return space.GetApp(APP_ID).(*PolicyManager)
+}
+
+func init() {
+	app.RegisterApp(APP_ID, func(context app.Context, obj interface{}) interface{} {
+		return obj
+	})
+}
@@ -0,0 +1,41 @@
+package policy_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/v2ray/v2ray-core/app/policy"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	v2testing.Current(t)
+
+	manager := NewPolicyManager(nil)
+	policy := manager.ForLevel(proto.UserLevelUntrusted)
+	assert.Int64(int64(policy.HandshakeTimeout)).Equals(int64(16 * time.Second))
+	assert.Int64(int64(policy.ConnIdleTimeout)).Equals(int64(120 * time.Second))
+	assert.Bool(policy.StatsEnabled).IsTrue()
+
+	policy = manager.ForLevel(proto.UserLevel(1))
+	assert.Int64(int64(policy.ConnIdleTimeout)).Equals(int64(300 * time.Second))
+}
+
+func TestPolicyUpdate(t *testing.T) {
+	v2testing.Current(t)
+
+	manager := NewPolicyManager(&Config{
+		Levels: map[proto.UserLevel]*Policy{
+			proto.UserLevel(1): {HandshakeTimeout: 4 * time.Second},
+		},
+	})
+	assert.Int64(int64(manager.ForLevel(proto.UserLevel(1)).HandshakeTimeout)).Equals(int64(4 * time.Second))
+	assert.Int64(int64(manager.ForLevel(proto.UserLevel(2)).HandshakeTimeout)).Equals(int64(16 * time.Second))
+
+	manager.Update(nil)
+	assert.Int64(int64(manager.ForLevel(proto.UserLevel(1)).HandshakeTimeout)).Equals(int64(16 * time.Second))
+
+	assert.Pointer(GetPolicyManager(nil)).IsNotNil()
+}
@@ -1,6 +1,7 @@
 package router
 
 import (
+	"github.com/v2ray/v2ray-core/app"
 	v2net "github.com/v2ray/v2ray-core/common/net"
 )
 
@@ -9,7 +10,7 @@ type Router interface {
 }
 
 type RouterFactory interface {
-	Create(rawConfig interface{}) (Router, error)
+	Create(rawConfig interface{}, space app.Space) (Router, error)
 }
 
 var (
@@ -22,9 +23,9 @@ func RegisterRouter(name string, factory RouterFactory) error {
 	return nil
 }
 
-func CreateRouter(name string, rawConfig interface{}) (Router, error) {
+func CreateRouter(name string, rawConfig interface{}, space app.Space) (Router, error) {
 	if factory, found := routerCache[name]; found {
-		return factory.Create(rawConfig)
+		return factory.Create(rawConfig, space)
 	}
 	return nil, ErrorRouterNotFound
 }
@@ -13,10 +13,11 @@ import (
 func TestChinaIPJson(t *testing.T) {
 	v2testing.Current(t)
 
-	rule := ParseRule([]byte(`{
+	rule, err := ParseRule([]byte(`{
     "type": "chinaip",
     "outboundTag": "x"
   }`))
+	assert.Error(err).IsNil()
 	assert.StringLiteral(rule.Tag).Equals("x")
 	assert.Bool(rule.Apply(makeDestination("121.14.1.189"))).IsTrue()    // sina.com.cn
 	assert.Bool(rule.Apply(makeDestination("101.226.103.106"))).IsTrue() // qq.com
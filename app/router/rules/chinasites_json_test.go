@@ -13,10 +13,11 @@ import (
 func TestChinaSitesJson(t *testing.T) {
 	v2testing.Current(t)
 
-	rule := ParseRule([]byte(`{
+	rule, err := ParseRule([]byte(`{
     "type": "chinasites",
     "outboundTag": "y"
   }`))
+	assert.Error(err).IsNil()
 	assert.StringLiteral(rule.Tag).Equals("y")
 	assert.Bool(rule.Apply(makeDomainDestination("v.qq.com"))).IsTrue()
 	assert.Bool(rule.Apply(makeDomainDestination("www.163.com"))).IsTrue()
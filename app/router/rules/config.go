@@ -13,7 +13,22 @@ func (this *Rule) Apply(dest v2net.Destination) bool {
 	return this.Condition.Apply(dest)
 }
 
+// DomainStrategy decides whether and when a domain destination is resolved into IPs during routing.
+type DomainStrategy int
+
+const (
+	// DomainAsIs routes domain destinations by domain rules only.
+	DomainAsIs = DomainStrategy(0)
+
+	// AlwaysUseIP resolves domain destinations before routing. A rule matches if it matches either
+	// the domain or any of its IPs.
+	AlwaysUseIP = DomainStrategy(1)
+
+	// UseIPIfNonMatch resolves domain destinations only when no rule matches the domain itself.
+	UseIPIfNonMatch = DomainStrategy(2)
+)
+
 type RouterRuleConfig struct {
-	Rules         []*Rule
-	ResolveDomain bool
+	Rules          []*Rule
+	DomainStrategy DomainStrategy
 }
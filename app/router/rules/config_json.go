@@ -78,58 +78,83 @@ func parseFieldRule(msg json.RawMessage) (*Rule, error) {
 	}, nil
 }
 
-func ParseRule(msg json.RawMessage) *Rule {
+// ParseRule parses a routing rule from the given JSON object.
+func ParseRule(msg json.RawMessage) (*Rule, error) {
 	rawRule := new(JsonRule)
 	err := json.Unmarshal(msg, rawRule)
 	if err != nil {
 		log.Error("Router: Invalid router rule: ", err)
-		return nil
+		return nil, err
 	}
-	if rawRule.Type == "field" {
-
+	switch rawRule.Type {
+	case "field":
 		fieldrule, err := parseFieldRule(msg)
 		if err != nil {
-			log.Error("Invalid field rule: ", err)
-			return nil
+			log.Error("Router: Invalid field rule: ", err)
+			return nil, err
 		}
-		return fieldrule
-	}
-	if rawRule.Type == "chinaip" {
+		return fieldrule, nil
+	case "chinaip":
 		chinaiprule, err := parseChinaIPRule(msg)
 		if err != nil {
 			log.Error("Router: Invalid chinaip rule: ", err)
-			return nil
+			return nil, err
 		}
-		return chinaiprule
-	}
-	if rawRule.Type == "chinasites" {
+		return chinaiprule, nil
+	case "chinasites":
 		chinasitesrule, err := parseChinaSitesRule(msg)
 		if err != nil {
-			log.Error("Invalid chinasites rule: ", err)
-			return nil
+			log.Error("Router: Invalid chinasites rule: ", err)
+			return nil, err
 		}
-		return chinasitesrule
+		return chinasitesrule, nil
 	}
-	log.Error("Unknown router rule type: ", rawRule.Type)
-	return nil
+	log.Error("Router: Unknown router rule type: ", rawRule.Type)
+	return nil, ErrorUnknownRuleType
+}
+
+func parseDomainStrategy(strategy string, resolveDomain bool) (DomainStrategy, error) {
+	switch strings.ToLower(strategy) {
+	case "":
+		if resolveDomain {
+			return UseIPIfNonMatch, nil
+		}
+		return DomainAsIs, nil
+	case "asis":
+		return DomainAsIs, nil
+	case "alwaysip":
+		return AlwaysUseIP, nil
+	case "ipifnonmatch":
+		return UseIPIfNonMatch, nil
+	}
+	log.Error("Router: Unknown domain strategy: ", strategy)
+	return DomainAsIs, ErrorInvalidRule
 }
 
 func init() {
 	router.RegisterRouterConfig("rules", func(data []byte) (interface{}, error) {
 		type JsonConfig struct {
-			RuleList      []json.RawMessage `json:"rules"`
-			ResolveDomain bool              `json:"resolveDomain"`
+			RuleList       []json.RawMessage `json:"rules"`
+			ResolveDomain  bool              `json:"resolveDomain"`
+			DomainStrategy string            `json:"domainStrategy"`
 		}
 		jsonConfig := new(JsonConfig)
 		if err := json.Unmarshal(data, jsonConfig); err != nil {
 			return nil, err
 		}
+		domainStrategy, err := parseDomainStrategy(jsonConfig.DomainStrategy, jsonConfig.ResolveDomain)
+		if err != nil {
+			return nil, err
+		}
 		config := &RouterRuleConfig{
-			Rules:         make([]*Rule, len(jsonConfig.RuleList)),
-			ResolveDomain: jsonConfig.ResolveDomain,
+			Rules:          make([]*Rule, len(jsonConfig.RuleList)),
+			DomainStrategy: domainStrategy,
 		}
 		for idx, rawRule := range jsonConfig.RuleList {
-			rule := ParseRule(rawRule)
+			rule, err := ParseRule(rawRule)
+			if err != nil {
+				return nil, err
+			}
 			config.Rules[idx] = rule
 		}
 		return config, nil
@@ -5,6 +5,7 @@ package rules_test
 import (
 	"testing"
 
+	"github.com/v2ray/v2ray-core/app/router"
 	. "github.com/v2ray/v2ray-core/app/router/rules"
 	v2net "github.com/v2ray/v2ray-core/common/net"
 	v2testing "github.com/v2ray/v2ray-core/testing"
@@ -14,7 +15,7 @@ import (
 func TestDomainRule(t *testing.T) {
 	v2testing.Current(t)
 
-	rule := ParseRule([]byte(`{
+	rule, err := ParseRule([]byte(`{
     "type": "field",
     "domain": [
       "ooxx.com",
@@ -24,6 +25,7 @@ func TestDomainRule(t *testing.T) {
     "network": "tcp",
     "outboundTag": "direct"
   }`))
+	assert.Error(err).IsNil()
 	assert.Pointer(rule).IsNotNil()
 	assert.Bool(rule.Apply(v2net.TCPDestination(v2net.DomainAddress("www.ooxx.com"), 80))).IsTrue()
 	assert.Bool(rule.Apply(v2net.TCPDestination(v2net.DomainAddress("www.aabb.com"), 80))).IsFalse()
@@ -35,7 +37,7 @@ func TestDomainRule(t *testing.T) {
 func TestIPRule(t *testing.T) {
 	v2testing.Current(t)
 
-	rule := ParseRule([]byte(`{
+	rule, err := ParseRule([]byte(`{
     "type": "field",
     "ip": [
       "10.0.0.0/8",
@@ -44,9 +46,52 @@ func TestIPRule(t *testing.T) {
     "network": "tcp",
     "outboundTag": "direct"
   }`))
+	assert.Error(err).IsNil()
 	assert.Pointer(rule).IsNotNil()
 	assert.Bool(rule.Apply(v2net.TCPDestination(v2net.DomainAddress("www.ooxx.com"), 80))).IsFalse()
 	assert.Bool(rule.Apply(v2net.TCPDestination(v2net.IPAddress([]byte{10, 0, 0, 1}), 80))).IsTrue()
 	assert.Bool(rule.Apply(v2net.TCPDestination(v2net.IPAddress([]byte{127, 0, 0, 1}), 80))).IsFalse()
 	assert.Bool(rule.Apply(v2net.TCPDestination(v2net.IPAddress([]byte{192, 0, 0, 1}), 80))).IsTrue()
 }
+
+func TestDomainStrategy(t *testing.T) {
+	v2testing.Current(t)
+
+	rawConfig, err := router.CreateRouterConfig("rules", []byte(`{
+    "domainStrategy": "IPIfNonMatch",
+    "rules": []
+  }`))
+	assert.Error(err).IsNil()
+	assert.Bool(rawConfig.(*RouterRuleConfig).DomainStrategy == UseIPIfNonMatch).IsTrue()
+
+	rawConfig, err = router.CreateRouterConfig("rules", []byte(`{
+    "resolveDomain": true,
+    "rules": []
+  }`))
+	assert.Error(err).IsNil()
+	assert.Bool(rawConfig.(*RouterRuleConfig).DomainStrategy == UseIPIfNonMatch).IsTrue()
+
+	_, err = router.CreateRouterConfig("rules", []byte(`{
+    "domainStrategy": "NoSuchStrategy",
+    "rules": []
+  }`))
+	assert.Error(err).IsNotNil()
+}
+
+func TestInvalidRule(t *testing.T) {
+	v2testing.Current(t)
+
+	_, err := ParseRule([]byte(`{"type": "unknown", "outboundTag": "direct"}`))
+	assert.Error(err).Equals(ErrorUnknownRuleType)
+
+	_, err = ParseRule([]byte(`{"type": "field", "outboundTag": "direct"}`))
+	assert.Error(err).IsNotNil()
+
+	_, err = router.CreateRouterConfig("rules", []byte(`{
+    "rules": [
+      {"type": "field", "port": "53", "outboundTag": "direct"},
+      {"type": "field", "ip": ["10.0.0.0/33"], "outboundTag": "direct"}
+    ]
+  }`))
+	assert.Error(err).IsNotNil()
+}
@@ -0,0 +1,123 @@
+package rules
+
+import (
+	"strings"
+
+	"github.com/v2ray/v2ray-core/common/loader"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+)
+
+// RuleMessage is the typed schema of a routing rule. Type is one of "field", "chinaip" and "chinasites".
+type RuleMessage struct {
+	Type        string   `protobuf:"bytes,1,opt,name=type"`
+	OutboundTag string   `protobuf:"bytes,2,opt,name=outbound_tag"`
+	Domain      []string `protobuf:"bytes,3,rep,name=domain"` // Plain domains, or regular expressions prefixed by "regexp:".
+	Ip          []string `protobuf:"bytes,4,rep,name=ip"`     // IPs in CIDR notation.
+	PortFrom    uint32   `protobuf:"varint,5,opt,name=port_from"`
+	PortTo      uint32   `protobuf:"varint,6,opt,name=port_to"` // Same as PortFrom if 0.
+	Network     []string `protobuf:"bytes,7,rep,name=network"`
+}
+
+// ConfigMessage is the typed schema of RouterRuleConfig.
+type ConfigMessage struct {
+	DomainStrategy uint32         `protobuf:"varint,1,opt,name=domain_strategy"`
+	Rule           []*RuleMessage `protobuf:"bytes,2,rep,name=rule"`
+}
+
+func (this *RuleMessage) buildFieldRule() (*Rule, error) {
+	conds := NewConditionChan()
+
+	if len(this.Domain) > 0 {
+		anyCond := NewAnyCondition()
+		for _, domain := range this.Domain {
+			if strings.HasPrefix(domain, "regexp:") {
+				matcher, err := NewRegexpDomainMatcher(domain[7:])
+				if err != nil {
+					return nil, err
+				}
+				anyCond.Add(matcher)
+			} else {
+				anyCond.Add(NewPlainDomainMatcher(domain))
+			}
+		}
+		conds.Add(anyCond)
+	}
+
+	if len(this.Ip) > 0 {
+		anyCond := NewAnyCondition()
+		for _, ip := range this.Ip {
+			matcher, err := NewCIDRMatcher(ip)
+			if err != nil {
+				return nil, err
+			}
+			anyCond.Add(matcher)
+		}
+		conds.Add(anyCond)
+	}
+
+	if this.PortFrom > 0 {
+		portTo := this.PortTo
+		if portTo == 0 {
+			portTo = this.PortFrom
+		}
+		if this.PortFrom > 65535 || portTo > 65535 || this.PortFrom > portTo {
+			return nil, ErrorInvalidRule
+		}
+		conds.Add(NewPortMatcher(v2net.PortRange{
+			From: v2net.Port(this.PortFrom),
+			To:   v2net.Port(portTo),
+		}))
+	}
+
+	if len(this.Network) > 0 {
+		networks := make(v2net.NetworkList, len(this.Network))
+		for idx, network := range this.Network {
+			networks[idx] = v2net.Network(network)
+		}
+		conds.Add(NewNetworkMatcher(&networks))
+	}
+
+	if conds.Len() == 0 {
+		return nil, ErrorInvalidRule
+	}
+	return &Rule{
+		Tag:       this.OutboundTag,
+		Condition: conds,
+	}, nil
+}
+
+// Build returns the Rule of this message.
+func (this *RuleMessage) Build() (*Rule, error) {
+	switch this.Type {
+	case "field":
+		return this.buildFieldRule()
+	case "chinaip":
+		return NewChinaIPRule(this.OutboundTag), nil
+	case "chinasites":
+		return NewChinaSitesRule(this.OutboundTag), nil
+	}
+	return nil, ErrorUnknownRuleType
+}
+
+func (this *ConfigMessage) Build() (interface{}, error) {
+	domainStrategy := DomainStrategy(this.DomainStrategy)
+	if domainStrategy != DomainAsIs && domainStrategy != AlwaysUseIP && domainStrategy != UseIPIfNonMatch {
+		return nil, ErrorInvalidRule
+	}
+	config := &RouterRuleConfig{
+		Rules:          make([]*Rule, len(this.Rule)),
+		DomainStrategy: domainStrategy,
+	}
+	for idx, ruleMessage := range this.Rule {
+		rule, err := ruleMessage.Build()
+		if err != nil {
+			return nil, err
+		}
+		config.Rules[idx] = rule
+	}
+	return config, nil
+}
+
+func init() {
+	loader.MustRegisterType("v2ray.core.app.router.rules.Config", (*ConfigMessage)(nil))
+}
@@ -0,0 +1,52 @@
+package rules_test
+
+import (
+	"testing"
+
+	. "github.com/v2ray/v2ray-core/app/router/rules"
+	"github.com/v2ray/v2ray-core/common/loader"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+func TestConfigMessage(t *testing.T) {
+	v2testing.Current(t)
+
+	settings, err := loader.NewTypedSettings(&ConfigMessage{
+		DomainStrategy: uint32(AlwaysUseIP),
+		Rule: []*RuleMessage{
+			{Type: "field", OutboundTag: "direct", Domain: []string{"v2ray.com", "regexp:\\.cn$"}, Network: []string{"tcp"}},
+			{Type: "field", OutboundTag: "blocked", Ip: []string{"10.0.0.0/8"}, PortFrom: 80, PortTo: 90},
+		},
+	})
+	assert.Error(err).IsNil()
+
+	rawConfig, err := loader.Build(settings)
+	assert.Error(err).IsNil()
+	config := rawConfig.(*RouterRuleConfig)
+	assert.Int(int(config.DomainStrategy)).Equals(int(AlwaysUseIP))
+	assert.Int(len(config.Rules)).Equals(2)
+
+	assert.StringLiteral(config.Rules[0].Tag).Equals("direct")
+	assert.Bool(config.Rules[0].Apply(v2net.TCPDestination(v2net.DomainAddress("www.v2ray.com"), 80))).IsTrue()
+	assert.Bool(config.Rules[0].Apply(v2net.TCPDestination(v2net.DomainAddress("www.12306.cn"), 80))).IsTrue()
+	assert.Bool(config.Rules[0].Apply(v2net.UDPDestination(v2net.DomainAddress("www.v2ray.com"), 80))).IsFalse()
+
+	assert.Bool(config.Rules[1].Apply(v2net.TCPDestination(v2net.IPAddress([]byte{10, 0, 0, 1}), 85))).IsTrue()
+	assert.Bool(config.Rules[1].Apply(v2net.TCPDestination(v2net.IPAddress([]byte{10, 0, 0, 1}), 443))).IsFalse()
+	assert.Bool(config.Rules[1].Apply(v2net.TCPDestination(v2net.IPAddress([]byte{11, 0, 0, 1}), 85))).IsFalse()
+}
+
+func TestInvalidConfigMessage(t *testing.T) {
+	v2testing.Current(t)
+
+	_, err := (&ConfigMessage{Rule: []*RuleMessage{{Type: "chinaports"}}}).Build()
+	assert.Error(err).Equals(ErrorUnknownRuleType)
+
+	_, err = (&ConfigMessage{Rule: []*RuleMessage{{Type: "field", OutboundTag: "direct"}}}).Build()
+	assert.Error(err).Equals(ErrorInvalidRule)
+
+	_, err = (&ConfigMessage{DomainStrategy: 3}).Build()
+	assert.Error(err).Equals(ErrorInvalidRule)
+}
@@ -2,16 +2,26 @@ package rules
 
 import (
 	"errors"
+	"net"
 	"time"
 
+	"github.com/v2ray/v2ray-core/app"
+	"github.com/v2ray/v2ray-core/app/dns"
 	"github.com/v2ray/v2ray-core/app/router"
 	"github.com/v2ray/v2ray-core/common/collect"
+	"github.com/v2ray/v2ray-core/common/log"
+	"github.com/v2ray/v2ray-core/common/metrics"
 	v2net "github.com/v2ray/v2ray-core/common/net"
 )
 
 var (
 	ErrorInvalidRule      = errors.New("Invalid Rule")
 	ErrorNoRuleApplicable = errors.New("No rule applicable")
+	ErrorUnknownRuleType  = errors.New("Unknown rule type.")
+)
+
+var (
+	ruleHits = metrics.NewCounterVec("v2ray_router_rule_hits_total", "Number of destinations matched by routing rules.", "tag")
 )
 
 type cacheEntry struct {
@@ -38,42 +48,105 @@ func (this *cacheEntry) Extend() {
 }
 
 type Router struct {
-	config *RouterRuleConfig
-	cache  *collect.ValidityMap
+	config    *RouterRuleConfig
+	cache     *collect.ValidityMap
+	dnsServer dns.Server
 }
 
-func NewRouter(config *RouterRuleConfig) *Router {
+func NewRouter(config *RouterRuleConfig, space app.Space) *Router {
 	return &Router{
-		config: config,
-		cache:  collect.NewValidityMap(3600),
+		config:    config,
+		cache:     collect.NewValidityMap(3600),
+		dnsServer: dns.GetServer(space),
+	}
+}
+
+// resolveIP resolves the domain of the given destination, and returns destinations of all resolved IPs.
+// DNS server is used if available. System resolver is used if there is no DNS server, or the DNS server
+// returns no IP.
+func (this *Router) resolveIP(dest v2net.Destination) []v2net.Destination {
+	domain := dest.Address().Domain()
+	var ips []net.IP
+	if this.dnsServer != nil {
+		ips = this.dnsServer.Get(domain)
+	}
+	if len(ips) == 0 {
+		resolved, err := net.LookupIP(domain)
+		if err != nil {
+			log.Info("Router: Failed to resolve domain ", domain, ": ", err)
+			return nil
+		}
+		ips = resolved
+	}
+
+	dests := make([]v2net.Destination, 0, len(ips))
+	for _, ip := range ips {
+		address := v2net.IPAddress(ip)
+		if address == nil {
+			continue
+		}
+		if dest.IsUDP() {
+			dests = append(dests, v2net.UDPDestination(address, dest.Port()))
+		} else {
+			dests = append(dests, v2net.TCPDestination(address, dest.Port()))
+		}
 	}
+	return dests
 }
 
 func (this *Router) takeDetourWithoutCache(dest v2net.Destination) (string, error) {
+	var ipDests []v2net.Destination
+	if this.config.DomainStrategy == AlwaysUseIP && dest.Address().IsDomain() {
+		ipDests = this.resolveIP(dest)
+	}
+
 	for _, rule := range this.config.Rules {
 		if rule.Apply(dest) {
 			return rule.Tag, nil
 		}
+		for _, ipDest := range ipDests {
+			if rule.Apply(ipDest) {
+				return rule.Tag, nil
+			}
+		}
 	}
+
+	if this.config.DomainStrategy == UseIPIfNonMatch && dest.Address().IsDomain() {
+		ipDests = this.resolveIP(dest)
+		for _, rule := range this.config.Rules {
+			for _, ipDest := range ipDests {
+				if rule.Apply(ipDest) {
+					return rule.Tag, nil
+				}
+			}
+		}
+	}
+
 	return "", ErrorNoRuleApplicable
 }
 
 func (this *Router) TakeDetour(dest v2net.Destination) (string, error) {
+	var tag string
+	var err error
 	rawEntry := this.cache.Get(dest)
 	if rawEntry == nil {
-		tag, err := this.takeDetourWithoutCache(dest)
+		tag, err = this.takeDetourWithoutCache(dest)
 		this.cache.Set(dest, newCacheEntry(tag, err))
-		return tag, err
+	} else {
+		entry := rawEntry.(*cacheEntry)
+		tag, err = entry.tag, entry.err
+	}
+	if err == nil {
+		ruleHits.WithLabelValues(tag).Inc()
 	}
-	entry := rawEntry.(*cacheEntry)
-	return entry.tag, entry.err
+	return tag, err
 }
 
 type RouterFactory struct {
 }
 
-func (this *RouterFactory) Create(rawConfig interface{}) (router.Router, error) {
-	return NewRouter(rawConfig.(*RouterRuleConfig)), nil
+func (this *RouterFactory) Create(rawConfig interface{}, space app.Space) (router.Router, error) {
+	return NewRouter(rawConfig.(*RouterRuleConfig), space), nil
 }
 
 func init() {
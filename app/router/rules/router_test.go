@@ -1,8 +1,11 @@
 package rules_test
 
 import (
+	"net"
 	"testing"
 
+	"github.com/v2ray/v2ray-core/app"
+	"github.com/v2ray/v2ray-core/app/dns"
 	. "github.com/v2ray/v2ray-core/app/router/rules"
 	v2net "github.com/v2ray/v2ray-core/common/net"
 	v2testing "github.com/v2ray/v2ray-core/testing"
@@ -21,9 +24,120 @@ func TestSimpleRouter(t *testing.T) {
 		},
 	}
 
-	router := NewRouter(config)
+	router := NewRouter(config, nil)
 
 	tag, err := router.TakeDetour(v2net.TCPDestination(v2net.DomainAddress("v2ray.com"), 80))
 	assert.Error(err).IsNil()
 	assert.StringLiteral(tag).Equals("test")
 }
+
+type staticDnsServer struct {
+	ips map[string]net.IP
+}
+
+func (this *staticDnsServer) Get(domain string) []net.IP {
+	if ip, found := this.ips[domain]; found {
+		return []net.IP{ip}
+	}
+	return nil
+}
+
+func TestIPIfNonMatchWithDnsServer(t *testing.T) {
+	v2testing.Current(t)
+
+	cidrMatcher, err := NewCIDRMatcher("1.2.3.0/24")
+	assert.Error(err).IsNil()
+
+	config := &RouterRuleConfig{
+		Rules: []*Rule{
+			{
+				Tag:       "test",
+				Condition: cidrMatcher,
+			},
+		},
+		DomainStrategy: UseIPIfNonMatch,
+	}
+
+	spaceController := app.NewController()
+	spaceController.Bind(dns.APP_ID, &staticDnsServer{
+		ips: map[string]net.IP{
+			"v2ray.com": net.IP([]byte{1, 2, 3, 4}),
+		},
+	})
+
+	router := NewRouter(config, spaceController.ForContext("router"))
+
+	tag, err := router.TakeDetour(v2net.TCPDestination(v2net.DomainAddress("v2ray.com"), 80))
+	assert.Error(err).IsNil()
+	assert.StringLiteral(tag).Equals("test")
+}
+
+func TestDomainAsIsDoesNotResolve(t *testing.T) {
+	v2testing.Current(t)
+
+	cidrMatcher, err := NewCIDRMatcher("127.0.0.0/8")
+	assert.Error(err).IsNil()
+
+	config := &RouterRuleConfig{
+		Rules: []*Rule{
+			{
+				Tag:       "test",
+				Condition: cidrMatcher,
+			},
+		},
+	}
+
+	router := NewRouter(config, nil)
+
+	_, err = router.TakeDetour(v2net.TCPDestination(v2net.DomainAddress("localhost"), 80))
+	assert.Error(err).Equals(ErrorNoRuleApplicable)
+}
+
+func TestAlwaysUseIP(t *testing.T) {
+	v2testing.Current(t)
+
+	cidrMatcher, err := NewCIDRMatcher("127.0.0.0/8")
+	assert.Error(err).IsNil()
+
+	config := &RouterRuleConfig{
+		Rules: []*Rule{
+			{
+				Tag:       "test",
+				Condition: cidrMatcher,
+			},
+		},
+		DomainStrategy: AlwaysUseIP,
+	}
+
+	router := NewRouter(config, nil)
+
+	tag, err := router.TakeDetour(v2net.TCPDestination(v2net.DomainAddress("localhost"), 80))
+	assert.Error(err).IsNil()
+	assert.StringLiteral(tag).Equals("test")
+}
+
+func TestSystemResolverIfDnsServerFails(t *testing.T) {
+	v2testing.Current(t)
+
+	cidrMatcher, err := NewCIDRMatcher("127.0.0.0/8")
+	assert.Error(err).IsNil()
+
+	config := &RouterRuleConfig{
+		Rules: []*Rule{
+			{
+				Tag:       "test",
+				Condition: cidrMatcher,
+			},
+		},
+		DomainStrategy: AlwaysUseIP,
+	}
+
+	spaceController := app.NewController()
+	spaceController.Bind(dns.APP_ID, &staticDnsServer{})
+
+	router := NewRouter(config, spaceController.ForContext("router"))
+
+	tag, err := router.TakeDetour(v2net.TCPDestination(v2net.DomainAddress("localhost"), 80))
+	assert.Error(err).IsNil()
+	assert.StringLiteral(tag).Equals("test")
+}
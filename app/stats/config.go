@@ -0,0 +1,9 @@
+package stats
+
+import (
+	"time"
+)
+
+type Config struct {
+	LogInterval time.Duration // Interval of dumping all counters into log, or 0 to disable.
+}
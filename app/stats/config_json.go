@@ -0,0 +1,20 @@
+// +build json
+
+package stats
+
+import (
+	"encoding/json"
+	"time"
+)
+
+func (this *Config) UnmarshalJSON(data []byte) error {
+	type JsonConfig struct {
+		LogInterval int `json:"logInterval"`
+	}
+	jsonConfig := new(JsonConfig)
+	if err := json.Unmarshal(data, jsonConfig); err != nil {
+		return err
+	}
+	this.LogInterval = time.Duration(jsonConfig.LogInterval) * time.Second
+	return nil
+}
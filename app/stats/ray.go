@@ -0,0 +1,86 @@
+package stats
+
+import (
+	"github.com/v2ray/v2ray-core/common/alloc"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	"github.com/v2ray/v2ray-core/transport/ray"
+)
+
+// statsRay counts the traffic passing through an OutboundRay.
+type statsRay struct {
+	input  chan *alloc.Buffer
+	output chan *alloc.Buffer
+	done   <-chan struct{}
+}
+
+// Track counts a new connection on all given counters, and returns an OutboundRay which counts the
+// traffic of the given link, including the first chunk of the packet. The connection ends when the
+// outbound handler closes its output. Once the link is canceled, chunks are released instead of forwarded.
+func Track(packet v2net.Packet, link ray.OutboundRay, counters ...*Counter) ray.OutboundRay {
+	for _, counter := range counters {
+		counter.openConnection()
+		if chunk := packet.Chunk(); chunk != nil {
+			counter.AddUplink(chunk.Len())
+		}
+	}
+
+	this := &statsRay{
+		input:  make(chan *alloc.Buffer, 16),
+		output: make(chan *alloc.Buffer, 16),
+		done:   link.Done(),
+	}
+	go func(input <-chan *alloc.Buffer) {
+		defer func() {
+			close(this.input)
+			for chunk := range input {
+				chunk.Release()
+			}
+		}()
+		for chunk := range input {
+			for _, counter := range counters {
+				counter.AddUplink(chunk.Len())
+			}
+			select {
+			case this.input <- chunk:
+			case <-this.done:
+				chunk.Release()
+				return
+			}
+		}
+	}(link.OutboundInput())
+	go func(output chan<- *alloc.Buffer) {
+		defer func() {
+			for _, counter := range counters {
+				counter.closeConnection()
+			}
+			close(output)
+			for chunk := range this.output {
+				chunk.Release()
+			}
+		}()
+		for chunk := range this.output {
+			for _, counter := range counters {
+				counter.AddDownlink(chunk.Len())
+			}
+			select {
+			case output <- chunk:
+			case <-this.done:
+				chunk.Release()
+				return
+			}
+		}
+	}(link.OutboundOutput())
+	return this
+}
+
+func (this *statsRay) OutboundInput() <-chan *alloc.Buffer {
+	return this.input
+}
+
+func (this *statsRay) OutboundOutput() chan<- *alloc.Buffer {
+	return this.output
+}
+
+func (this *statsRay) Done() <-chan struct{} {
+	return this.done
+}
@@ -0,0 +1,214 @@
+package stats
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/v2ray/v2ray-core/app"
+	"github.com/v2ray/v2ray-core/common/log"
+)
+
+const (
+	APP_ID = app.ID(6)
+)
+
+// Kinds of counters.
+const (
+	KindUser     = "user"
+	KindInbound  = "inbound"
+	KindOutbound = "outbound"
+)
+
+// Counter accumulates traffic and connections of a user or a handler. It is safe for concurrent use.
+type Counter struct {
+	uplink      int64
+	downlink    int64
+	activeConns int64
+	totalConns  int64
+}
+
+func (this *Counter) AddUplink(n int) {
+	atomic.AddInt64(&this.uplink, int64(n))
+}
+
+func (this *Counter) AddDownlink(n int) {
+	atomic.AddInt64(&this.downlink, int64(n))
+}
+
+func (this *Counter) Uplink() int64 {
+	return atomic.LoadInt64(&this.uplink)
+}
+
+func (this *Counter) Downlink() int64 {
+	return atomic.LoadInt64(&this.downlink)
+}
+
+func (this *Counter) ActiveConnections() int64 {
+	return atomic.LoadInt64(&this.activeConns)
+}
+
+func (this *Counter) TotalConnections() int64 {
+	return atomic.LoadInt64(&this.totalConns)
+}
+
+func (this *Counter) openConnection() {
+	atomic.AddInt64(&this.activeConns, 1)
+	atomic.AddInt64(&this.totalConns, 1)
+}
+
+func (this *Counter) closeConnection() {
+	atomic.AddInt64(&this.activeConns, -1)
+}
+
+// Stat is a snapshot of a Counter.
+type Stat struct {
+	Kind              string
+	Name              string
+	Uplink            int64
+	Downlink          int64
+	ActiveConnections int64
+	TotalConnections  int64
+}
+
+func (this *Counter) snapshot(kind, name string, reset bool) *Stat {
+	stat := &Stat{
+		Kind:              kind,
+		Name:              name,
+		ActiveConnections: this.ActiveConnections(),
+	}
+	if reset {
+		stat.Uplink = atomic.SwapInt64(&this.uplink, 0)
+		stat.Downlink = atomic.SwapInt64(&this.downlink, 0)
+		stat.TotalConnections = atomic.SwapInt64(&this.totalConns, 0)
+	} else {
+		stat.Uplink = this.Uplink()
+		stat.Downlink = this.Downlink()
+		stat.TotalConnections = this.TotalConnections()
+	}
+	return stat
+}
+
+type counterKey struct {
+	kind string
+	name string
+}
+
+// StatsManager keeps all counters of a V2Ray runtime.
+type StatsManager struct {
+	sync.RWMutex
+	config   *Config
+	counters map[counterKey]*Counter
+	closed   chan bool
+}
+
+func NewStatsManager(config *Config) *StatsManager {
+	return &StatsManager{
+		config:   config,
+		counters: make(map[counterKey]*Counter),
+	}
+}
+
+// GetCounter returns the counter of the given kind and name. It is created if not exists.
+func (this *StatsManager) GetCounter(kind, name string) *Counter {
+	key := counterKey{kind: kind, name: name}
+	this.RLock()
+	counter, found := this.counters[key]
+	this.RUnlock()
+	if found {
+		return counter
+	}
+
+	this.Lock()
+	defer this.Unlock()
+	counter, found = this.counters[key]
+	if !found {
+		counter = new(Counter)
+		this.counters[key] = counter
+	}
+	return counter
+}
+
+// Query returns snapshots of counters matching the given kind and name, sorted by kind and name.
+// Empty kind or name matches all. If reset is true, traffic and total connections of the matching
+// counters are set to zero.
+func (this *StatsManager) Query(kind, name string, reset bool) []*Stat {
+	this.RLock()
+	defer this.RUnlock()
+
+	stats := make([]*Stat, 0, len(this.counters))
+	for key, counter := range this.counters {
+		if len(kind) > 0 && key.kind != kind {
+			continue
+		}
+		if len(name) > 0 && key.name != name {
+			continue
+		}
+		stats = append(stats, counter.snapshot(key.kind, key.name, reset))
+	}
+	sort.Sort(statList(stats))
+	return stats
+}
+
+// Start starts dumping counters into log periodically, if configured.
+func (this *StatsManager) Start() {
+	if this.config == nil || this.config.LogInterval <= 0 {
+		return
+	}
+	this.Lock()
+	defer this.Unlock()
+	if this.closed != nil {
+		return
+	}
+	this.closed = make(chan bool)
+	go this.logLoop(this.config.LogInterval, this.closed)
+}
+
+func (this *StatsManager) logLoop(interval time.Duration, closed <-chan bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, stat := range this.Query("", "", false) {
+				log.Info("Stats: ", stat.Kind, " [", stat.Name, "] uplink: ", stat.Uplink, ", downlink: ", stat.Downlink,
+					", active connections: ", stat.ActiveConnections, ", total connections: ", stat.TotalConnections)
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func (this *StatsManager) Close() {
+	this.Lock()
+	defer this.Unlock()
+	if this.closed != nil {
+		close(this.closed)
+		this.closed = nil
+	}
+}
+
+type statList []*Stat
+
+func (this statList) Len() int {
+	return len(this)
+}
+
+func (this statList) Less(i, j int) bool {
+	if this[i].Kind != this[j].Kind {
+		return this[i].Kind < this[j].Kind
+	}
+	return this[i].Name < this[j].Name
+}
+
+func (this statList) Swap(i, j int) {
+	this[i], this[j] = this[j], this[i]
+}
+
+func init() {
+	app.RegisterApp(APP_ID, func(context app.Context, obj interface{}) interface{} {
+		return obj
+	})
+}
@@ -0,0 +1,105 @@
+package stats_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/v2ray/v2ray-core/app/stats"
+	"github.com/v2ray/v2ray-core/common/alloc"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+	"github.com/v2ray/v2ray-core/transport/ray"
+)
+
+func TestQueryAndReset(t *testing.T) {
+	v2testing.Current(t)
+
+	manager := NewStatsManager(&Config{})
+	counter := manager.GetCounter(KindUser, "love@v2ray.com")
+	assert.Pointer(manager.GetCounter(KindUser, "love@v2ray.com")).Equals(counter)
+	counter.AddUplink(10)
+	counter.AddDownlink(20)
+	manager.GetCounter(KindInbound, "in").AddUplink(5)
+	manager.GetCounter(KindOutbound, "out").AddDownlink(7)
+
+	stats := manager.Query("", "", false)
+	assert.Int(len(stats)).Equals(3)
+	assert.StringLiteral(stats[0].Kind).Equals(KindInbound)
+	assert.StringLiteral(stats[1].Kind).Equals(KindOutbound)
+	assert.StringLiteral(stats[2].Kind).Equals(KindUser)
+
+	stats = manager.Query(KindUser, "love@v2ray.com", true)
+	assert.Int(len(stats)).Equals(1)
+	assert.Int64(stats[0].Uplink).Equals(10)
+	assert.Int64(stats[0].Downlink).Equals(20)
+
+	assert.Int64(counter.Uplink()).Equals(0)
+	assert.Int64(counter.Downlink()).Equals(0)
+	assert.Int64(manager.GetCounter(KindInbound, "in").Uplink()).Equals(5)
+	assert.Int(len(manager.Query(KindUser, "nobody", false))).Equals(0)
+}
+
+func TestTrack(t *testing.T) {
+	v2testing.Current(t)
+
+	manager := NewStatsManager(&Config{})
+	userCounter := manager.GetCounter(KindUser, "love@v2ray.com")
+	outboundCounter := manager.GetCounter(KindOutbound, "out")
+
+	direct := ray.NewRay()
+	dest := v2net.TCPDestination(v2net.DomainAddress("v2ray.com"), 80)
+	packet := v2net.NewPacket(dest, alloc.NewBuffer().Clear().Append([]byte("first")), true)
+	link := Track(packet, direct, userCounter, outboundCounter)
+	assert.Int64(userCounter.ActiveConnections()).Equals(1)
+	assert.Int64(userCounter.TotalConnections()).Equals(1)
+	assert.Int64(userCounter.Uplink()).Equals(5)
+
+	direct.InboundInput() <- alloc.NewBuffer().Clear().Append([]byte("request"))
+	close(direct.InboundInput())
+	for chunk := range link.OutboundInput() {
+		chunk.Release()
+	}
+	link.OutboundOutput() <- alloc.NewBuffer().Clear().Append([]byte("response"))
+	close(link.OutboundOutput())
+	for chunk := range direct.InboundOutput() {
+		assert.StringLiteral(string(chunk.Value)).Equals("response")
+		chunk.Release()
+	}
+
+	for _, counter := range []*Counter{userCounter, outboundCounter} {
+		assert.Int64(counter.Uplink()).Equals(12)
+		assert.Int64(counter.Downlink()).Equals(8)
+		assert.Int64(counter.ActiveConnections()).Equals(0)
+		assert.Int64(counter.TotalConnections()).Equals(1)
+	}
+}
+
+func TestTrackCanceled(t *testing.T) {
+	v2testing.Current(t)
+
+	manager := NewStatsManager(&Config{})
+	counter := manager.GetCounter(KindUser, "love@v2ray.com")
+
+	direct := ray.NewRay()
+	dest := v2net.TCPDestination(v2net.DomainAddress("v2ray.com"), 80)
+	packet := v2net.NewPacket(dest, nil, true)
+	link := Track(packet, direct, counter)
+
+	// The outbound handler stops reading its input.
+	for i := 0; i < 32; i++ {
+		direct.InboundInput() <- alloc.NewBuffer().Clear().Append([]byte("request"))
+	}
+	close(direct.InboundInput())
+	close(link.OutboundOutput())
+	direct.Cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	chunks := 0
+	for chunk := range link.OutboundInput() {
+		chunks++
+		chunk.Release()
+	}
+	assert.Bool(chunks < 32).IsTrue()
+	assert.Int64(counter.ActiveConnections()).Equals(0)
+}
@@ -3,6 +3,8 @@ package alloc
 import (
 	"io"
 	"sync"
+
+	"github.com/v2ray/v2ray-core/common/metrics"
 )
 
 const (
@@ -132,17 +134,26 @@ func (b *Buffer) FillFrom(reader io.Reader) (int, error) {
 	return nBytes, err
 }
 
+var (
+	poolGets   = metrics.NewCounterVec("v2ray_buffer_pool_gets_total", "Number of buffers allocated from buffer pools.", "pool")
+	poolMisses = metrics.NewCounterVec("v2ray_buffer_pool_misses_total", "Number of buffers allocated when buffer pools are empty.", "pool")
+)
+
 type bufferPool struct {
 	chain     chan []byte
 	allocator *sync.Pool
+	gets      *metrics.Counter
+	misses    *metrics.Counter
 }
 
-func newBufferPool(bufferSize, poolSize int) *bufferPool {
+func newBufferPool(name string, bufferSize, poolSize int) *bufferPool {
 	pool := &bufferPool{
 		chain: make(chan []byte, poolSize),
 		allocator: &sync.Pool{
 			New: func() interface{} { return make([]byte, bufferSize) },
 		},
+		gets:   poolGets.WithLabelValues(name),
+		misses: poolMisses.WithLabelValues(name),
 	}
 	for i := 0; i < poolSize/2; i++ {
 		pool.chain <- make([]byte, bufferSize)
@@ -152,9 +163,11 @@ func newBufferPool(bufferSize, poolSize int) *bufferPool {
 
 func (p *bufferPool) allocate() *Buffer {
 	var b []byte
+	p.gets.Inc()
 	select {
 	case b = <-p.chain:
 	default:
+		p.misses.Inc()
 		b = p.allocator.Get().([]byte)
 	}
 	return &Buffer{
@@ -177,9 +190,9 @@ func (p *bufferPool) free(buffer *Buffer) {
 	}
 }
 
-var smallPool = newBufferPool(1024, 64)
-var mediumPool = newBufferPool(8*1024, 128)
-var largePool = newBufferPool(64*1024, 64)
+var smallPool = newBufferPool("small", 1024, 64)
+var mediumPool = newBufferPool("medium", 8*1024, 128)
+var largePool = newBufferPool("large", 64*1024, 64)
 
 // NewSmallBuffer creates a Buffer with 1K bytes of arbitrary content.
 func NewSmallBuffer() *Buffer {
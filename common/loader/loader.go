@@ -0,0 +1,202 @@
+// Package loader encodes and decodes typed config messages, which are Go structs with protobuf struct
+// tags, e.g., `protobuf:"varint,1,opt,name=port"`. Messages are encoded in the protobuf wire format, or
+// the protobuf text format, so that they can be generated by any protobuf implementation. Supported field
+// types are bool, int32, int64, uint32, uint64, string, []byte, pointers to messages, and slices of them.
+package loader
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrorUnknownType  = errors.New("Unknown message type.")
+	ErrorNotMessage   = errors.New("Not a pointer to message struct.")
+	ErrorTypeExists   = errors.New("Message type already exists.")
+	ErrorTruncated    = errors.New("Truncated message.")
+	ErrorWireType     = errors.New("Unexpected wire type.")
+	ErrorInvalidField = errors.New("Invalid field number.")
+)
+
+var (
+	typeMutex    sync.RWMutex
+	typesByName  = make(map[string]reflect.Type)
+	namesByType  = make(map[reflect.Type]string)
+	fieldsMutex  sync.RWMutex
+	fieldsByType = make(map[reflect.Type][]*fieldInfo)
+)
+
+// RegisterType registers the type of the given message under the given full name, e.g.,
+// "v2ray.core.proxy.freedom.Config". The message should be a nil pointer to the message struct.
+func RegisterType(name string, message interface{}) error {
+	messageType := reflect.TypeOf(message)
+	if messageType == nil || messageType.Kind() != reflect.Ptr || messageType.Elem().Kind() != reflect.Struct {
+		return ErrorNotMessage
+	}
+
+	typeMutex.Lock()
+	defer typeMutex.Unlock()
+
+	if _, found := typesByName[name]; found {
+		return ErrorTypeExists
+	}
+	typesByName[name] = messageType.Elem()
+	namesByType[messageType.Elem()] = name
+	return nil
+}
+
+func MustRegisterType(name string, message interface{}) {
+	if err := RegisterType(name, message); err != nil {
+		panic(err)
+	}
+}
+
+// GetTypeName returns the registered name of the type of the given message, or empty if it is not
+// registered.
+func GetTypeName(message interface{}) string {
+	messageType := reflect.TypeOf(message)
+	if messageType == nil || messageType.Kind() != reflect.Ptr {
+		return ""
+	}
+
+	typeMutex.RLock()
+	defer typeMutex.RUnlock()
+
+	return namesByType[messageType.Elem()]
+}
+
+// NewMessage returns a new message of the type registered under the given name. Prefixes of type URLs,
+// e.g., "type.googleapis.com/", are ignored.
+func NewMessage(name string) (interface{}, error) {
+	if idx := strings.LastIndex(name, "/"); idx >= 0 {
+		name = name[idx+1:]
+	}
+
+	typeMutex.RLock()
+	messageType, found := typesByName[name]
+	typeMutex.RUnlock()
+
+	if !found {
+		return nil, ErrorUnknownType
+	}
+	return reflect.New(messageType).Interface(), nil
+}
+
+// TypedSettings is a message of any registered type, along with the name of the type. It is encoded as
+// google.protobuf.Any.
+type TypedSettings struct {
+	Type  string `protobuf:"bytes,1,opt,name=type"`
+	Value []byte `protobuf:"bytes,2,opt,name=value"`
+}
+
+// NewTypedSettings returns TypedSettings of the given message, whose type must be registered.
+func NewTypedSettings(message interface{}) (*TypedSettings, error) {
+	name := GetTypeName(message)
+	if len(name) == 0 {
+		return nil, ErrorUnknownType
+	}
+	value, err := Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedSettings{
+		Type:  name,
+		Value: value,
+	}, nil
+}
+
+// GetInstance decodes the message in this TypedSettings.
+func (this *TypedSettings) GetInstance() (interface{}, error) {
+	message, err := NewMessage(this.Type)
+	if err != nil {
+		return nil, err
+	}
+	if err := Unmarshal(this.Value, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// Builder is implemented by messages which build the config objects used at runtime.
+type Builder interface {
+	Build() (interface{}, error)
+}
+
+// Build decodes the message in the given TypedSettings, and returns the config object built by it. Messages
+// which are not Builders are returned as they are.
+func Build(settings *TypedSettings) (interface{}, error) {
+	message, err := settings.GetInstance()
+	if err != nil {
+		return nil, err
+	}
+	if builder, ok := message.(Builder); ok {
+		return builder.Build()
+	}
+	return message, nil
+}
+
+// fieldInfo describes a field of a message struct.
+type fieldInfo struct {
+	index    int
+	number   int
+	name     string
+	repeated bool
+}
+
+// getFields returns the fields of the given message struct type, which have protobuf tags.
+func getFields(messageType reflect.Type) []*fieldInfo {
+	fieldsMutex.RLock()
+	fields, found := fieldsByType[messageType]
+	fieldsMutex.RUnlock()
+	if found {
+		return fields
+	}
+
+	for i := 0; i < messageType.NumField(); i++ {
+		tag := messageType.Field(i).Tag.Get("protobuf")
+		if len(tag) == 0 {
+			continue
+		}
+		field := &fieldInfo{index: i}
+		for idx, part := range strings.Split(tag, ",") {
+			switch {
+			case idx == 1:
+				field.number = parseFieldNumber(part)
+			case part == "rep":
+				field.repeated = true
+			case strings.HasPrefix(part, "name="):
+				field.name = strings.TrimPrefix(part, "name=")
+			}
+		}
+		if field.number <= 0 {
+			panic("Loader: invalid protobuf tag of " + messageType.String() + "." + messageType.Field(i).Name)
+		}
+		fields = append(fields, field)
+	}
+
+	fieldsMutex.Lock()
+	fieldsByType[messageType] = fields
+	fieldsMutex.Unlock()
+	return fields
+}
+
+func parseFieldNumber(value string) int {
+	number := 0
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return 0
+		}
+		number = number*10 + int(c-'0')
+	}
+	return number
+}
+
+func getMessageValue(message interface{}) (reflect.Value, error) {
+	value := reflect.ValueOf(message)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, ErrorNotMessage
+	}
+	return value.Elem(), nil
+}
@@ -0,0 +1,158 @@
+package loader_test
+
+import (
+	"testing"
+
+	. "github.com/v2ray/v2ray-core/common/loader"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+type testUser struct {
+	Name  string   `protobuf:"bytes,1,opt,name=name"`
+	Level uint32   `protobuf:"varint,2,opt,name=level"`
+	Email []string `protobuf:"bytes,3,rep,name=email"`
+}
+
+type testConfig struct {
+	Port     uint32         `protobuf:"varint,1,opt,name=port"`
+	Offset   int32          `protobuf:"varint,2,opt,name=offset"`
+	Enabled  bool           `protobuf:"varint,3,opt,name=enabled"`
+	Key      []byte         `protobuf:"bytes,4,opt,name=key"`
+	User     []*testUser    `protobuf:"bytes,5,rep,name=user"`
+	Codes    []uint32       `protobuf:"varint,6,rep,name=codes"`
+	Settings *TypedSettings `protobuf:"bytes,7,opt,name=settings"`
+}
+
+func init() {
+	MustRegisterType("v2ray.core.testing.User", (*testUser)(nil))
+}
+
+func TestWireFormat(t *testing.T) {
+	v2testing.Current(t)
+
+	data, err := Marshal(&testConfig{Port: 150})
+	assert.Error(err).IsNil()
+	assert.Bytes(data).Equals([]byte{0x08, 0x96, 0x01})
+
+	data, err = Marshal(&testUser{Name: "testing"})
+	assert.Error(err).IsNil()
+	assert.Bytes(data).Equals([]byte{0x0a, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g'})
+
+	// Packed repeated scalars and unknown fields.
+	config := new(testConfig)
+	assert.Error(Unmarshal([]byte{0x32, 0x03, 0x01, 0x96, 0x01, 0x78, 0x05, 0x08, 0x50}, config)).IsNil()
+	assert.Int(len(config.Codes)).Equals(2)
+	assert.Int(int(config.Codes[1])).Equals(150)
+	assert.Int(int(config.Port)).Equals(80)
+
+	assert.Error(Unmarshal([]byte{0x0a, 0x05, 'a'}, new(testUser))).Equals(ErrorTruncated)
+	assert.Error(Unmarshal([]byte{0x08, 0x01}, new(testUser))).Equals(ErrorWireType)
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	v2testing.Current(t)
+
+	settings, err := NewTypedSettings(&testUser{Name: "settings", Level: 1})
+	assert.Error(err).IsNil()
+	config := &testConfig{
+		Port:    1080,
+		Offset:  -1,
+		Enabled: true,
+		Key:     []byte{0, 1, 0xff},
+		User: []*testUser{
+			{Name: "a", Email: []string{"a@v2ray.com", "b@v2ray.com"}},
+			{Name: "b\"\n", Level: 2},
+		},
+		Codes:    []uint32{1, 2},
+		Settings: settings,
+	}
+
+	data, err := Marshal(config)
+	assert.Error(err).IsNil()
+	decoded := new(testConfig)
+	assert.Error(Unmarshal(data, decoded)).IsNil()
+	assertTestConfig(decoded)
+
+	text, err := MarshalText(config)
+	assert.Error(err).IsNil()
+	decoded = new(testConfig)
+	assert.Error(UnmarshalText(text, decoded)).IsNil()
+	assertTestConfig(decoded)
+}
+
+func assertTestConfig(config *testConfig) {
+	assert.Int(int(config.Port)).Equals(1080)
+	assert.Int(int(config.Offset)).Equals(-1)
+	assert.Bool(config.Enabled).IsTrue()
+	assert.Bytes(config.Key).Equals([]byte{0, 1, 0xff})
+	assert.Int(len(config.User)).Equals(2)
+	assert.Int(len(config.User[0].Email)).Equals(2)
+	assert.StringLiteral(config.User[0].Email[1]).Equals("b@v2ray.com")
+	assert.StringLiteral(config.User[1].Name).Equals("b\"\n")
+	assert.Int(int(config.User[1].Level)).Equals(2)
+	assert.Int(len(config.Codes)).Equals(2)
+
+	user, err := config.Settings.GetInstance()
+	assert.Error(err).IsNil()
+	assert.StringLiteral(user.(*testUser).Name).Equals("settings")
+	assert.Int(int(user.(*testUser).Level)).Equals(1)
+}
+
+func TestUnmarshalText(t *testing.T) {
+	v2testing.Current(t)
+
+	config := new(testConfig)
+	err := UnmarshalText([]byte(`
+# Comments are ignored.
+port: 0x438
+enabled: true
+user {
+  name: "a" 'b'
+  email: ["a@v2ray.com", "b@v2ray.com"]
+}
+user < name: "c"; level: 3 >
+codes: 1 codes: 2
+settings {
+  [type.googleapis.com/v2ray.core.testing.User] {
+    name: "\x41\102"
+  }
+}
+`), config)
+	assert.Error(err).IsNil()
+	assert.Int(int(config.Port)).Equals(1080)
+	assert.Bool(config.Enabled).IsTrue()
+	assert.Int(len(config.User)).Equals(2)
+	assert.StringLiteral(config.User[0].Name).Equals("ab")
+	assert.Int(len(config.User[0].Email)).Equals(2)
+	assert.Int(int(config.User[1].Level)).Equals(3)
+	assert.Int(len(config.Codes)).Equals(2)
+
+	user, err := config.Settings.GetInstance()
+	assert.Error(err).IsNil()
+	assert.StringLiteral(user.(*testUser).Name).Equals("AB")
+
+	err = UnmarshalText([]byte("port: 80\nusers {}"), new(testConfig))
+	assert.Int(err.(*SyntaxError).Line).Equals(2)
+
+	err = UnmarshalText([]byte("settings { [v2ray.core.testing.Unknown] {} }"), new(testConfig))
+	assert.Error(err).IsNotNil()
+
+	err = UnmarshalText([]byte("port: -1"), new(testConfig))
+	assert.Error(err).IsNotNil()
+}
+
+func TestTypedSettings(t *testing.T) {
+	v2testing.Current(t)
+
+	_, err := NewTypedSettings(&testConfig{})
+	assert.Error(err).Equals(ErrorUnknownType)
+
+	assert.Error(RegisterType("v2ray.core.testing.User", (*testUser)(nil))).Equals(ErrorTypeExists)
+	assert.Error(RegisterType("v2ray.core.testing.Invalid", testUser{})).Equals(ErrorNotMessage)
+
+	settings := &TypedSettings{Type: "v2ray.core.testing.User", Value: []byte{0x10, 0x05}}
+	user, err := Build(settings)
+	assert.Error(err).IsNil()
+	assert.Int(int(user.(*testUser).Level)).Equals(5)
+}
@@ -0,0 +1,461 @@
+package loader
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	typedSettingsType = reflect.TypeOf(TypedSettings{})
+)
+
+// SyntaxError is an error in a message in the protobuf text format.
+type SyntaxError struct {
+	Line    int
+	Message string
+}
+
+func (this *SyntaxError) Error() string {
+	return "Text line " + strconv.Itoa(this.Line) + ": " + this.Message
+}
+
+// MarshalText encodes the given message in the protobuf text format. TypedSettings of registered types are
+// written in the expanded form of google.protobuf.Any, e.g., "settings { [name.of.Type] { ... } }".
+func MarshalText(message interface{}) ([]byte, error) {
+	value, err := getMessageValue(message)
+	if err != nil {
+		return nil, err
+	}
+	buffer := new(bytes.Buffer)
+	if err := writeMessage(buffer, value, ""); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func writeMessage(buffer *bytes.Buffer, value reflect.Value, indent string) error {
+	if value.Type() == typedSettingsType {
+		settings := value.Addr().Interface().(*TypedSettings)
+		if message, err := settings.GetInstance(); err == nil {
+			buffer.WriteString(indent + "[" + settings.Type + "] {\n")
+			if err := writeMessage(buffer, reflect.ValueOf(message).Elem(), indent+"  "); err != nil {
+				return err
+			}
+			buffer.WriteString(indent + "}\n")
+			return nil
+		}
+	}
+	for _, field := range getFields(value.Type()) {
+		fieldValue := value.Field(field.index)
+		if field.repeated && fieldValue.Type().Elem().Kind() != reflect.Uint8 {
+			for i := 0; i < fieldValue.Len(); i++ {
+				if err := writeField(buffer, field.name, fieldValue.Index(i), indent); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !isZero(fieldValue) {
+			if err := writeField(buffer, field.name, fieldValue, indent); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeField(buffer *bytes.Buffer, name string, value reflect.Value, indent string) error {
+	switch value.Kind() {
+	case reflect.Ptr:
+		buffer.WriteString(indent + name + " {\n")
+		if !value.IsNil() {
+			if err := writeMessage(buffer, value.Elem(), indent+"  "); err != nil {
+				return err
+			}
+		}
+		buffer.WriteString(indent + "}\n")
+		return nil
+	case reflect.Bool:
+		buffer.WriteString(indent + name + ": " + strconv.FormatBool(value.Bool()) + "\n")
+	case reflect.Uint32, reflect.Uint64:
+		buffer.WriteString(indent + name + ": " + strconv.FormatUint(value.Uint(), 10) + "\n")
+	case reflect.Int32, reflect.Int64:
+		buffer.WriteString(indent + name + ": " + strconv.FormatInt(value.Int(), 10) + "\n")
+	case reflect.String:
+		buffer.WriteString(indent + name + ": " + quoteText([]byte(value.String())) + "\n")
+	case reflect.Slice:
+		buffer.WriteString(indent + name + ": " + quoteText(value.Bytes()) + "\n")
+	default:
+		return ErrorNotMessage
+	}
+	return nil
+}
+
+// quoteText quotes the given string, with non-printable bytes escaped in octal.
+func quoteText(data []byte) string {
+	buffer := make([]byte, 0, len(data)+2)
+	buffer = append(buffer, '"')
+	for _, b := range data {
+		switch {
+		case b == '"' || b == '\\':
+			buffer = append(buffer, '\\', b)
+		case b == '\n':
+			buffer = append(buffer, '\\', 'n')
+		case b < 0x20 || b >= 0x7f:
+			buffer = append(buffer, '\\', '0'+b>>6, '0'+(b>>3)&7, '0'+b&7)
+		default:
+			buffer = append(buffer, b)
+		}
+	}
+	return string(append(buffer, '"'))
+}
+
+// UnmarshalText decodes the given data in the protobuf text format into the given message.
+func UnmarshalText(data []byte, message interface{}) error {
+	value, err := getMessageValue(message)
+	if err != nil {
+		return err
+	}
+	parser := &textParser{
+		input: string(data),
+		line:  1,
+	}
+	return parser.parseMessage(value, "")
+}
+
+type textParser struct {
+	input string
+	pos   int
+	line  int
+}
+
+func (this *textParser) errorf(message string) error {
+	return &SyntaxError{Line: this.line, Message: message}
+}
+
+func isIdentChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("_.+-/", c) >= 0
+}
+
+func (this *textParser) skipSpaces() {
+	for this.pos < len(this.input) {
+		switch c := this.input[this.pos]; {
+		case c == '\n':
+			this.line++
+			this.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			this.pos++
+		case c == '#':
+			for this.pos < len(this.input) && this.input[this.pos] != '\n' {
+				this.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// peek returns the next token, which is empty at the end of input. Strings are returned with their quotes.
+func (this *textParser) peek() (string, error) {
+	this.skipSpaces()
+	if this.pos >= len(this.input) {
+		return "", nil
+	}
+	c := this.input[this.pos]
+	switch {
+	case c == '"' || c == '\'':
+		end := this.pos + 1
+		for end < len(this.input) && this.input[end] != c {
+			if this.input[end] == '\\' {
+				end++
+			}
+			if end < len(this.input) && this.input[end] == '\n' {
+				return "", this.errorf("Unterminated string.")
+			}
+			end++
+		}
+		if end >= len(this.input) {
+			return "", this.errorf("Unterminated string.")
+		}
+		return this.input[this.pos : end+1], nil
+	case isIdentChar(c):
+		end := this.pos
+		for end < len(this.input) && isIdentChar(this.input[end]) {
+			end++
+		}
+		return this.input[this.pos:end], nil
+	case strings.IndexByte("{}[]<>:,;", c) >= 0:
+		return this.input[this.pos : this.pos+1], nil
+	}
+	return "", this.errorf("Unexpected character " + strconv.QuoteRune(rune(c)) + ".")
+}
+
+func (this *textParser) next() (string, error) {
+	token, err := this.peek()
+	this.pos += len(token)
+	return token, err
+}
+
+func (this *textParser) expect(expected string) error {
+	token, err := this.next()
+	if err != nil {
+		return err
+	}
+	if token != expected {
+		return this.errorf("Expected \"" + expected + "\", got \"" + token + "\".")
+	}
+	return nil
+}
+
+// skipSeparator skips an optional separator between fields, or elements of lists.
+func (this *textParser) skipSeparator() error {
+	token, err := this.peek()
+	if err == nil && (token == "," || token == ";") {
+		this.pos++
+	}
+	return err
+}
+
+func closingOf(open string) string {
+	if open == "<" {
+		return ">"
+	}
+	return "}"
+}
+
+// parseMessage parses fields into the given message value, until the given closing token or the end of
+// input if it is empty.
+func (this *textParser) parseMessage(value reflect.Value, end string) error {
+	fields := make(map[string]*fieldInfo)
+	for _, field := range getFields(value.Type()) {
+		fields[field.name] = field
+	}
+
+	for {
+		token, err := this.next()
+		if err != nil {
+			return err
+		}
+		if token == end {
+			return nil
+		}
+		if len(token) == 0 {
+			return this.errorf("Unexpected end of input.")
+		}
+		if token == "[" && value.Type() == typedSettingsType {
+			if err := this.parseExpandedSettings(value); err != nil {
+				return err
+			}
+		} else {
+			field, found := fields[token]
+			if !found {
+				return this.errorf("Unknown field \"" + token + "\" in " + value.Type().Name() + ".")
+			}
+			if err := this.parseField(value.Field(field.index), field); err != nil {
+				return err
+			}
+		}
+		if err := this.skipSeparator(); err != nil {
+			return err
+		}
+	}
+}
+
+// parseExpandedSettings parses a message of a registered type into the given TypedSettings value, after
+// the opening "[".
+func (this *textParser) parseExpandedSettings(value reflect.Value) error {
+	name, err := this.next()
+	if err != nil {
+		return err
+	}
+	if err := this.expect("]"); err != nil {
+		return err
+	}
+	message, err := NewMessage(name)
+	if err != nil {
+		return this.errorf("Unknown message type \"" + name + "\".")
+	}
+	if token, _ := this.peek(); token == ":" {
+		this.pos++
+	}
+	open, err := this.next()
+	if err != nil {
+		return err
+	}
+	if open != "{" && open != "<" {
+		return this.errorf("Expected message of type \"" + name + "\".")
+	}
+	if err := this.parseMessage(reflect.ValueOf(message).Elem(), closingOf(open)); err != nil {
+		return err
+	}
+	encoded, err := Marshal(message)
+	if err != nil {
+		return err
+	}
+	settings := value.Addr().Interface().(*TypedSettings)
+	settings.Type = name
+	settings.Value = encoded
+	return nil
+}
+
+func (this *textParser) parseField(value reflect.Value, field *fieldInfo) error {
+	token, err := this.peek()
+	if err != nil {
+		return err
+	}
+	if token == ":" {
+		this.pos++
+		if token, err = this.peek(); err != nil {
+			return err
+		}
+	}
+	repeated := field.repeated && value.Type().Elem().Kind() != reflect.Uint8
+	if !repeated {
+		return this.parseValue(value)
+	}
+	if token != "[" {
+		return this.appendValue(value)
+	}
+	this.pos++
+	for {
+		if token, err := this.peek(); err != nil {
+			return err
+		} else if token == "]" {
+			this.pos++
+			return nil
+		}
+		if err := this.appendValue(value); err != nil {
+			return err
+		}
+		if err := this.skipSeparator(); err != nil {
+			return err
+		}
+	}
+}
+
+func (this *textParser) appendValue(slice reflect.Value) error {
+	element := reflect.New(slice.Type().Elem()).Elem()
+	if err := this.parseValue(element); err != nil {
+		return err
+	}
+	slice.Set(reflect.Append(slice, element))
+	return nil
+}
+
+func (this *textParser) parseValue(value reflect.Value) error {
+	if value.Kind() == reflect.Ptr {
+		open, err := this.next()
+		if err != nil {
+			return err
+		}
+		if open != "{" && open != "<" {
+			return this.errorf("Expected message, got \"" + open + "\".")
+		}
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		return this.parseMessage(value.Elem(), closingOf(open))
+	}
+
+	token, err := this.next()
+	if err != nil {
+		return err
+	}
+	switch value.Kind() {
+	case reflect.String, reflect.Slice:
+		if !isQuoted(token) {
+			return this.errorf("Expected string, got \"" + token + "\".")
+		}
+		var data []byte
+		for {
+			unquoted, err := unquoteText(token[1 : len(token)-1])
+			if err != nil {
+				return this.errorf("Invalid string " + token + ".")
+			}
+			data = append(data, unquoted...)
+			// Adjacent strings are concatenated.
+			if token, err = this.peek(); err != nil {
+				return err
+			}
+			if !isQuoted(token) {
+				break
+			}
+			this.pos += len(token)
+		}
+		if value.Kind() == reflect.String {
+			value.SetString(string(data))
+		} else {
+			value.SetBytes(data)
+		}
+	case reflect.Bool:
+		switch token {
+		case "true", "t", "1":
+			value.SetBool(true)
+		case "false", "f", "0":
+			value.SetBool(false)
+		default:
+			return this.errorf("Expected bool, got \"" + token + "\".")
+		}
+	case reflect.Uint32, reflect.Uint64:
+		number, err := strconv.ParseUint(token, 0, value.Type().Bits())
+		if err != nil {
+			return this.errorf("Expected unsigned integer, got \"" + token + "\".")
+		}
+		value.SetUint(number)
+	case reflect.Int32, reflect.Int64:
+		number, err := strconv.ParseInt(token, 0, value.Type().Bits())
+		if err != nil {
+			return this.errorf("Expected integer, got \"" + token + "\".")
+		}
+		value.SetInt(number)
+	default:
+		return ErrorNotMessage
+	}
+	return nil
+}
+
+func isQuoted(token string) bool {
+	return len(token) >= 2 && (token[0] == '"' || token[0] == '\'')
+}
+
+// unquoteText decodes escapes in a string without its quotes.
+func unquoteText(text string) ([]byte, error) {
+	result := make([]byte, 0, len(text))
+	for i := 0; i < len(text); i++ {
+		if text[i] != '\\' {
+			result = append(result, text[i])
+			continue
+		}
+		i++
+		if i >= len(text) {
+			return nil, ErrorTruncated
+		}
+		switch c := text[i]; {
+		case c == 'n':
+			result = append(result, '\n')
+		case c == 'r':
+			result = append(result, '\r')
+		case c == 't':
+			result = append(result, '\t')
+		case c == 'x' && i+2 < len(text):
+			b, err := strconv.ParseUint(text[i+1:i+3], 16, 8)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, byte(b))
+			i += 2
+		case c >= '0' && c <= '7' && i+2 < len(text):
+			b, err := strconv.ParseUint(text[i:i+3], 8, 8)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, byte(b))
+			i += 2
+		default:
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,245 @@
+package loader
+
+import (
+	"reflect"
+)
+
+const (
+	wireVarint = 0
+	wire64Bit  = 1
+	wireBytes  = 2
+	wire32Bit  = 5
+)
+
+// Marshal encodes the given message in the protobuf wire format. Fields of zero values are omitted, as in
+// proto3.
+func Marshal(message interface{}) ([]byte, error) {
+	value, err := getMessageValue(message)
+	if err != nil {
+		return nil, err
+	}
+	return appendMessage(nil, value), nil
+}
+
+func appendVarint(buffer []byte, value uint64) []byte {
+	for value >= 0x80 {
+		buffer = append(buffer, byte(value)|0x80)
+		value >>= 7
+	}
+	return append(buffer, byte(value))
+}
+
+func appendTag(buffer []byte, number int, wireType int) []byte {
+	return appendVarint(buffer, uint64(number)<<3|uint64(wireType))
+}
+
+func appendMessage(buffer []byte, value reflect.Value) []byte {
+	for _, field := range getFields(value.Type()) {
+		fieldValue := value.Field(field.index)
+		if field.repeated && fieldValue.Type().Elem().Kind() != reflect.Uint8 {
+			for i := 0; i < fieldValue.Len(); i++ {
+				buffer = appendValue(buffer, field.number, fieldValue.Index(i))
+			}
+			continue
+		}
+		if !isZero(fieldValue) {
+			buffer = appendValue(buffer, field.number, fieldValue)
+		}
+	}
+	return buffer
+}
+
+func appendValue(buffer []byte, number int, value reflect.Value) []byte {
+	switch value.Kind() {
+	case reflect.Bool:
+		buffer = appendTag(buffer, number, wireVarint)
+		if value.Bool() {
+			return append(buffer, 1)
+		}
+		return append(buffer, 0)
+	case reflect.Uint32, reflect.Uint64:
+		buffer = appendTag(buffer, number, wireVarint)
+		return appendVarint(buffer, value.Uint())
+	case reflect.Int32, reflect.Int64:
+		buffer = appendTag(buffer, number, wireVarint)
+		return appendVarint(buffer, uint64(value.Int()))
+	case reflect.String:
+		buffer = appendTag(buffer, number, wireBytes)
+		buffer = appendVarint(buffer, uint64(value.Len()))
+		return append(buffer, value.String()...)
+	case reflect.Slice:
+		buffer = appendTag(buffer, number, wireBytes)
+		buffer = appendVarint(buffer, uint64(value.Len()))
+		return append(buffer, value.Bytes()...)
+	case reflect.Ptr:
+		var nested []byte
+		if !value.IsNil() {
+			nested = appendMessage(nil, value.Elem())
+		}
+		buffer = appendTag(buffer, number, wireBytes)
+		buffer = appendVarint(buffer, uint64(len(nested)))
+		return append(buffer, nested...)
+	}
+	panic("Loader: unsupported field type " + value.Type().String())
+}
+
+func isZero(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Bool:
+		return !value.Bool()
+	case reflect.Uint32, reflect.Uint64:
+		return value.Uint() == 0
+	case reflect.Int32, reflect.Int64:
+		return value.Int() == 0
+	case reflect.String, reflect.Slice:
+		return value.Len() == 0
+	case reflect.Ptr:
+		return value.IsNil()
+	}
+	return false
+}
+
+// Unmarshal decodes the given data in the protobuf wire format into the given message. Unknown fields are
+// skipped.
+func Unmarshal(data []byte, message interface{}) error {
+	value, err := getMessageValue(message)
+	if err != nil {
+		return err
+	}
+	return decodeMessage(data, value)
+}
+
+func readVarint(data []byte) (uint64, int, error) {
+	var value uint64
+	for i := 0; i < len(data) && i < 10; i++ {
+		value |= uint64(data[i]&0x7f) << (7 * uint(i))
+		if data[i] < 0x80 {
+			return value, i + 1, nil
+		}
+	}
+	return 0, 0, ErrorTruncated
+}
+
+func decodeMessage(data []byte, value reflect.Value) error {
+	fields := make(map[int]*fieldInfo)
+	for _, field := range getFields(value.Type()) {
+		fields[field.number] = field
+	}
+
+	for len(data) > 0 {
+		tag, n, err := readVarint(data)
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+		number, wireType := int(tag>>3), int(tag&7)
+		if number <= 0 {
+			return ErrorInvalidField
+		}
+
+		var varint uint64
+		var bytes []byte
+		switch wireType {
+		case wireVarint:
+			varint, n, err = readVarint(data)
+			if err != nil {
+				return err
+			}
+		case wireBytes:
+			length, lengthSize, err := readVarint(data)
+			if err != nil {
+				return err
+			}
+			if length > uint64(len(data)-lengthSize) {
+				return ErrorTruncated
+			}
+			n = lengthSize + int(length)
+			bytes = data[lengthSize:n]
+		case wire64Bit:
+			n = 8
+		case wire32Bit:
+			n = 4
+		default:
+			return ErrorWireType
+		}
+		if n > len(data) {
+			return ErrorTruncated
+		}
+		data = data[n:]
+
+		field, found := fields[number]
+		if !found {
+			continue
+		}
+		fieldValue := value.Field(field.index)
+		if field.repeated && fieldValue.Type().Elem().Kind() != reflect.Uint8 {
+			if err := decodeRepeated(fieldValue, wireType, varint, bytes); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := decodeValue(fieldValue, wireType, varint, bytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeRepeated(field reflect.Value, wireType int, varint uint64, bytes []byte) error {
+	elementKind := field.Type().Elem().Kind()
+	if wireType == wireBytes && elementKind != reflect.String && elementKind != reflect.Ptr && elementKind != reflect.Slice {
+		// Packed scalars.
+		for len(bytes) > 0 {
+			element, n, err := readVarint(bytes)
+			if err != nil {
+				return err
+			}
+			bytes = bytes[n:]
+			if err := decodeRepeated(field, wireVarint, element, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	element := reflect.New(field.Type().Elem()).Elem()
+	if err := decodeValue(element, wireType, varint, bytes); err != nil {
+		return err
+	}
+	field.Set(reflect.Append(field, element))
+	return nil
+}
+
+func decodeValue(field reflect.Value, wireType int, varint uint64, bytes []byte) error {
+	switch field.Kind() {
+	case reflect.Bool, reflect.Uint32, reflect.Uint64, reflect.Int32, reflect.Int64:
+		if wireType != wireVarint {
+			return ErrorWireType
+		}
+	default:
+		if wireType != wireBytes {
+			return ErrorWireType
+		}
+	}
+
+	switch field.Kind() {
+	case reflect.Bool:
+		field.SetBool(varint != 0)
+	case reflect.Uint32, reflect.Uint64:
+		field.SetUint(varint)
+	case reflect.Int32, reflect.Int64:
+		field.SetInt(int64(varint))
+	case reflect.String:
+		field.SetString(string(bytes))
+	case reflect.Slice:
+		field.SetBytes(append([]byte(nil), bytes...))
+	case reflect.Ptr:
+		// Occurrences of the same message field are merged.
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		return decodeMessage(bytes, field.Elem())
+	default:
+		panic("Loader: unsupported field type " + field.Type().String())
+	}
+	return nil
+}
@@ -1,6 +1,10 @@
 package log
 
 import (
+	"encoding/json"
+	"strconv"
+	"time"
+
 	"github.com/v2ray/v2ray-core/common/serial"
 )
 
@@ -16,34 +20,107 @@ var (
 	accessLoggerInstance logWriter = &noOpLogWriter{}
 )
 
-type accessLog struct {
-	From   serial.String
-	To     serial.String
-	Status AccessStatus
-	Reason serial.String
+// AccessEntry is an access log of a connection. Accepted connections are logged when they finish, so
+// that the entry includes the amount of traffic.
+type AccessEntry struct {
+	From        serial.String
+	To          serial.String
+	Status      AccessStatus
+	Reason      serial.String
+	InboundTag  string
+	OutboundTag string
+	Email       string
+	Uplink      int64 // Bytes sent by the client.
+	Downlink    int64 // Bytes sent to the client.
+	Duration    time.Duration
+}
+
+func stringOf(value serial.String) string {
+	if value == nil {
+		return ""
+	}
+	return value.String()
 }
 
-func (this *accessLog) String() string {
-	return this.From.String() + " " + string(this.Status) + " " + this.To.String() + " " + this.Reason.String()
+func (this *AccessEntry) String() string {
+	str := stringOf(this.From) + " " + string(this.Status) + " " + stringOf(this.To) + " " + stringOf(this.Reason)
+	if len(this.InboundTag) > 0 {
+		str += " inbound=" + this.InboundTag
+	}
+	if len(this.OutboundTag) > 0 {
+		str += " outbound=" + this.OutboundTag
+	}
+	if len(this.Email) > 0 {
+		str += " email=" + this.Email
+	}
+	if this.Duration > 0 {
+		str += " uplink=" + strconv.FormatInt(this.Uplink, 10) + " downlink=" + strconv.FormatInt(this.Downlink, 10) + " duration=" + this.Duration.String()
+	}
+	return str
 }
 
-// InitAccessLogger initializes the access logger to write into the give file.
-func InitAccessLogger(file string) error {
-	logger, err := newFileLogWriter(file)
+func (this *AccessEntry) JSON(timestamp time.Time) ([]byte, error) {
+	level := "info"
+	if this.Status == AccessRejected {
+		level = "warning"
+	}
+	return json.Marshal(&struct {
+		Time        string `json:"time"`
+		Level       string `json:"level"`
+		Status      string `json:"status"`
+		InboundTag  string `json:"inbound,omitempty"`
+		Source      string `json:"source,omitempty"`
+		Destination string `json:"destination,omitempty"`
+		Email       string `json:"email,omitempty"`
+		OutboundTag string `json:"outbound,omitempty"`
+		Reason      string `json:"reason,omitempty"`
+		Uplink      int64  `json:"uplink"`
+		Downlink    int64  `json:"downlink"`
+		DurationMs  int64  `json:"durationMs"`
+	}{
+		Time:        formatTime(timestamp),
+		Level:       level,
+		Status:      string(this.Status),
+		InboundTag:  this.InboundTag,
+		Source:      stringOf(this.From),
+		Destination: stringOf(this.To),
+		Email:       this.Email,
+		OutboundTag: this.OutboundTag,
+		Reason:      stringOf(this.Reason),
+		Uplink:      this.Uplink,
+		Downlink:    this.Downlink,
+		DurationMs:  int64(this.Duration / time.Millisecond),
+	})
+}
+
+// InitAccessLogger initializes the access logger to write into the given file, rotated according to
+// the given configuration.
+func InitAccessLogger(file string, rotation RotationConfig) error {
+	logger, err := newFileLogWriter(file, rotation)
 	if err != nil {
 		Error("Failed to create access logger on file (", file, "): ", file, err)
 		return err
 	}
+	loggerAccess.Lock()
+	previous := accessLoggerInstance
 	accessLoggerInstance = logger
+	loggerAccess.Unlock()
+
+	closeLogWriter(previous)
 	return nil
 }
 
 // Access writes an access log.
 func Access(from, to serial.String, status AccessStatus, reason serial.String) {
-	accessLoggerInstance.Log(&accessLog{
+	AccessDetails(&AccessEntry{
 		From:   from,
 		To:     to,
 		Status: status,
 		Reason: reason,
 	})
 }
+
+// AccessDetails writes an access log with details of the connection.
+func AccessDetails(entry *AccessEntry) {
+	writeLog(&accessLoggerInstance, entry)
+}
@@ -1,8 +1,10 @@
 package log
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -15,7 +17,7 @@ func TestAccessLog(t *testing.T) {
 	v2testing.Current(t)
 
 	filename := "/tmp/test_access_log.log"
-	InitAccessLogger(filename)
+	InitAccessLogger(filename, RotationConfig{})
 	_, err := os.Stat(filename)
 	assert.Error(err).IsNil()
 
@@ -34,3 +36,47 @@ func TestAccessLog(t *testing.T) {
 	assert.String(contentStr).Contains(serial.StringLiteral("test_reason"))
 	assert.String(contentStr).Contains(serial.StringLiteral("accepted"))
 }
+
+func TestAccessLogDetailsInJSON(t *testing.T) {
+	v2testing.Current(t)
+
+	dir, err := ioutil.TempDir("", "v2ray-log")
+	assert.Error(err).IsNil()
+	defer os.RemoveAll(dir)
+
+	SetFormat(FormatJSON)
+	defer SetFormat(FormatText)
+
+	filename := filepath.Join(dir, "access.log")
+	assert.Error(InitAccessLogger(filename, RotationConfig{})).IsNil()
+	AccessDetails(&AccessEntry{
+		From:        serial.StringLiteral("127.0.0.1:50000"),
+		To:          serial.StringLiteral("tcp:v2ray.com:443"),
+		Status:      AccessAccepted,
+		InboundTag:  "in",
+		OutboundTag: "out",
+		Email:       "love@v2ray.com",
+		Uplink:      100,
+		Downlink:    2000,
+		Duration:    1500 * time.Millisecond,
+	})
+	accessLoggerInstance.(*fileLogWriter).close()
+	accessLoggerInstance = &noOpLogWriter{}
+
+	content, err := ioutil.ReadFile(filename)
+	assert.Error(err).IsNil()
+	var entry map[string]interface{}
+	assert.Error(json.Unmarshal(content, &entry)).IsNil()
+	assert.StringLiteral(entry["level"].(string)).Equals("info")
+	assert.StringLiteral(entry["status"].(string)).Equals("accepted")
+	assert.StringLiteral(entry["inbound"].(string)).Equals("in")
+	assert.StringLiteral(entry["source"].(string)).Equals("127.0.0.1:50000")
+	assert.StringLiteral(entry["destination"].(string)).Equals("tcp:v2ray.com:443")
+	assert.StringLiteral(entry["email"].(string)).Equals("love@v2ray.com")
+	assert.StringLiteral(entry["outbound"].(string)).Equals("out")
+	assert.Int64(int64(entry["uplink"].(float64))).Equals(100)
+	assert.Int64(int64(entry["downlink"].(float64))).Equals(2000)
+	assert.Int64(int64(entry["durationMs"].(float64))).Equals(1500)
+	_, err = time.Parse(time.RFC3339Nano, entry["time"].(string))
+	assert.Error(err).IsNil()
+}
@@ -1,7 +1,10 @@
 package log
 
 import (
+	"encoding/json"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/v2ray/v2ray-core/common/serial"
 )
@@ -15,10 +18,11 @@ const (
 
 type errorLog struct {
 	prefix string
+	level  string
 	values []interface{}
 }
 
-func (this *errorLog) String() string {
+func (this *errorLog) message() string {
 	data := ""
 	for _, value := range this.values {
 		switch typedVal := value.(type) {
@@ -34,13 +38,34 @@ func (this *errorLog) String() string {
 			data += fmt.Sprintf("%v", value)
 		}
 	}
-	return this.prefix + data
+	return data
+}
+
+func (this *errorLog) String() string {
+	return this.prefix + this.message()
+}
+
+func (this *errorLog) JSON(timestamp time.Time) ([]byte, error) {
+	return json.Marshal(&struct {
+		Time    string `json:"time"`
+		Level   string `json:"level"`
+		Message string `json:"message"`
+	}{
+		Time:    formatTime(timestamp),
+		Level:   this.level,
+		Message: this.message(),
+	})
 }
 
 var (
+	// loggerAccess guards the loggers below, as well as the access logger. It is held while writing
+	// a log, so that a replaced file logger is not closed under a writing goroutine.
+	loggerAccess sync.RWMutex
+
 	noOpLoggerInstance   logWriter = &noOpLogWriter{}
 	streamLoggerInstance logWriter = newStdOutLogWriter()
 
+	logLevel      = WarningLevel
 	debugLogger   = noOpLoggerInstance
 	infoLogger    = noOpLoggerInstance
 	warningLogger = streamLoggerInstance
@@ -50,6 +75,17 @@ var (
 type LogLevel int
 
 func SetLogLevel(level LogLevel) {
+	loggerAccess.Lock()
+	defer loggerAccess.Unlock()
+
+	setLogLevel(level)
+}
+
+// setLogLevel points the loggers of each level to the stream logger or to nothing. Caller must hold
+// the lock.
+func setLogLevel(level LogLevel) {
+	logLevel = level
+
 	debugLogger = noOpLoggerInstance
 	if level <= DebugLevel {
 		debugLogger = streamLoggerInstance
@@ -71,44 +107,64 @@ func SetLogLevel(level LogLevel) {
 	}
 }
 
-func InitErrorLogger(file string) error {
-	logger, err := newFileLogWriter(file)
+// InitErrorLogger initializes the error logger to write into the given file, rotated according to
+// the given configuration.
+func InitErrorLogger(file string, rotation RotationConfig) error {
+	logger, err := newFileLogWriter(file, rotation)
 	if err != nil {
 		Error("Failed to create error logger on file (", file, "): ", err)
 		return err
 	}
+	loggerAccess.Lock()
+	previous := streamLoggerInstance
 	streamLoggerInstance = logger
+	setLogLevel(logLevel)
+	loggerAccess.Unlock()
+
+	closeLogWriter(previous)
 	return nil
 }
 
+// writeLog writes the given entry with the given logger, which is read under the lock.
+func writeLog(logger *logWriter, entry logEntry) {
+	loggerAccess.RLock()
+	defer loggerAccess.RUnlock()
+
+	(*logger).Log(entry)
+}
+
 // Debug outputs a debug log with given format and optional arguments.
 func Debug(v ...interface{}) {
-	debugLogger.Log(&errorLog{
+	writeLog(&debugLogger, &errorLog{
 		prefix: "[Debug]",
+		level:  "debug",
 		values: v,
 	})
 }
 
 // Info outputs an info log with given format and optional arguments.
 func Info(v ...interface{}) {
-	infoLogger.Log(&errorLog{
+	writeLog(&infoLogger, &errorLog{
 		prefix: "[Info]",
+		level:  "info",
 		values: v,
 	})
 }
 
 // Warning outputs a warning log with given format and optional arguments.
 func Warning(v ...interface{}) {
-	warningLogger.Log(&errorLog{
+	writeLog(&warningLogger, &errorLog{
 		prefix: "[Warning]",
+		level:  "warning",
 		values: v,
 	})
 }
 
 // Error outputs an error log with given format and optional arguments.
 func Error(v ...interface{}) {
-	errorLogger.Log(&errorLog{
+	writeLog(&errorLogger, &errorLog{
 		prefix: "[Error]",
+		level:  "error",
 		values: v,
 	})
 }
@@ -2,8 +2,12 @@ package log
 
 import (
 	"bytes"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/v2ray/v2ray-core/common/serial"
     "github.com/v2ray/v2ray-core/common/platform"
@@ -38,3 +42,48 @@ func TestStreamLogger(t *testing.T) {
 	Error("Test ", serial.StringLiteral("literal"), " Format")
 	assert.StringLiteral(string(buffer.Bytes())).Equals("[Error]Test literal Format" + platform.LineSeparator())
 }
+
+func TestReplaceLoggersWhileLogging(t *testing.T) {
+	v2testing.Current(t)
+
+	dir, err := ioutil.TempDir("", "v2ray-log")
+	assert.Error(err).IsNil()
+	defer os.RemoveAll(dir)
+
+	SetLogLevel(WarningLevel)
+	stop := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				Warning("Test ", "warning")
+				AccessDetails(&AccessEntry{Status: AccessAccepted})
+			}
+		}
+	}()
+
+	for _, name := range []string{"1", "2"} {
+		assert.Error(InitErrorLogger(filepath.Join(dir, "error"+name+".log"), RotationConfig{})).IsNil()
+		assert.Error(InitAccessLogger(filepath.Join(dir, "access"+name+".log"), RotationConfig{})).IsNil()
+		time.Sleep(100 * time.Millisecond)
+	}
+	close(stop)
+	<-done
+
+	loggerAccess.Lock()
+	closeLogWriter(streamLoggerInstance)
+	closeLogWriter(accessLoggerInstance)
+	streamLoggerInstance = newStdOutLogWriter()
+	accessLoggerInstance = noOpLoggerInstance
+	setLogLevel(WarningLevel)
+	loggerAccess.Unlock()
+
+	// The level loggers follow the new error logger.
+	content, err := ioutil.ReadFile(filepath.Join(dir, "error2.log"))
+	assert.Error(err).IsNil()
+	assert.String(serial.StringLiteral(content)).Contains(serial.StringLiteral("[Warning]Test warning"))
+}
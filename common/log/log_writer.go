@@ -4,74 +4,262 @@ import (
 	"io"
 	"log"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/v2ray/v2ray-core/common/platform"
 	"github.com/v2ray/v2ray-core/common/serial"
 )
 
+// Format is the output format of logs.
+type Format int32
+
+const (
+	FormatText = Format(0) // One line of plain text per entry.
+	FormatJSON = Format(1) // One JSON object per line.
+)
+
+var (
+	logFormat int32 // Accessed atomically.
+)
+
+// SetFormat changes the output format of all logs.
+func SetFormat(format Format) {
+	atomic.StoreInt32(&logFormat, int32(format))
+}
+
+func currentFormat() Format {
+	return Format(atomic.LoadInt32(&logFormat))
+}
+
+func formatTime(timestamp time.Time) string {
+	return timestamp.Format(time.RFC3339Nano)
+}
+
+// logEntry is a log message which can be written as plain text or JSON.
+type logEntry interface {
+	serial.String
+	JSON(timestamp time.Time) ([]byte, error)
+}
+
+// formatEntry returns the given entry as a line in the current format.
+func formatEntry(timestamp time.Time, entry logEntry) []byte {
+	if currentFormat() == FormatJSON {
+		if data, err := entry.JSON(timestamp); err == nil {
+			return append(data, platform.LineSeparator()...)
+		}
+	}
+	return []byte(timestamp.Format("2006/01/02 15:04:05 ") + entry.String() + platform.LineSeparator())
+}
+
 func createLogger(writer io.Writer) *log.Logger {
 	return log.New(writer, "", log.Ldate|log.Ltime)
 }
 
 type logWriter interface {
-	Log(serial.String)
+	Log(logEntry)
+}
+
+// closeLogWriter closes the given logWriter if it writes into a file.
+func closeLogWriter(writer logWriter) {
+	if fileWriter, ok := writer.(*fileLogWriter); ok {
+		fileWriter.close()
+	}
 }
 
 type noOpLogWriter struct {
 }
 
-func (this *noOpLogWriter) Log(serial.String) {
+func (this *noOpLogWriter) Log(logEntry) {
 	// Swallow
 }
 
 type stdOutLogWriter struct {
-	logger *log.Logger
+	logger     *log.Logger
+	jsonLogger *log.Logger // Without timestamp prefix, as JSON entries contain their own.
 }
 
 func newStdOutLogWriter() logWriter {
 	return &stdOutLogWriter{
-		logger: createLogger(os.Stdout),
+		logger:     createLogger(os.Stdout),
+		jsonLogger: log.New(os.Stdout, "", 0),
 	}
 }
 
-func (this *stdOutLogWriter) Log(log serial.String) {
-	this.logger.Print(log.String() + platform.LineSeparator())
+func (this *stdOutLogWriter) Log(entry logEntry) {
+	if this.jsonLogger != nil && currentFormat() == FormatJSON {
+		if data, err := entry.JSON(time.Now()); err == nil {
+			this.jsonLogger.Print(string(data) + platform.LineSeparator())
+			return
+		}
+	}
+	this.logger.Print(entry.String() + platform.LineSeparator())
 }
 
+type logRecord struct {
+	timestamp time.Time
+	entry     logEntry
+}
+
+// fileLogWriter writes logs into a file in its own goroutine. The file is rotated according to
+// RotationConfig, and reopened on Reopen, so that it can be moved by external tools.
 type fileLogWriter struct {
-	queue  chan serial.String
-	logger *log.Logger
-	file   *os.File
+	queue     chan *logRecord
+	reopen    chan bool
+	closed    chan bool
+	done      chan bool
+	closeOnce sync.Once
+	path      string
+	rotation  RotationConfig
+	file      *os.File // Nil if the file failed to open, when logs go to stderr instead.
+	size      int64
+	openTime  time.Time
+	failTime  time.Time // Time of the last failure in opening the file.
 }
 
-func (this *fileLogWriter) Log(log serial.String) {
+// fileRetryInterval is the interval of retrying to open a log file which failed to open.
+const fileRetryInterval = time.Minute
+
+var (
+	fileWriters      = make(map[*fileLogWriter]bool)
+	fileWritersMutex sync.Mutex
+)
+
+// Reopen closes and reopens all log files. It is useful after the files are moved by external tools,
+// e.g., logrotate.
+func Reopen() {
+	fileWritersMutex.Lock()
+	defer fileWritersMutex.Unlock()
+
+	for writer := range fileWriters {
+		select {
+		case writer.reopen <- true:
+		default:
+			// A reopen is already pending.
+		}
+	}
+}
+
+func (this *fileLogWriter) Log(entry logEntry) {
 	select {
-	case this.queue <- log:
+	case this.queue <- &logRecord{timestamp: time.Now(), entry: entry}:
 	default:
 		// We don't expect this to happen, but don't want to block main thread as well.
 	}
 }
 
 func (this *fileLogWriter) run() {
-	for entry := range this.queue {
-		this.logger.Print(entry.String() + platform.LineSeparator())
+	defer close(this.done)
+	for {
+		select {
+		case record := <-this.queue:
+			this.write(record)
+		case <-this.reopen:
+			// The current file is kept if the new one fails to open.
+			this.reopenFile()
+		case <-this.closed:
+			for {
+				select {
+				case record := <-this.queue:
+					this.write(record)
+				default:
+					if this.file != nil {
+						this.file.Close()
+					}
+					return
+				}
+			}
+		}
 	}
 }
 
-func (this *fileLogWriter) close() {
-	this.file.Close()
+func (this *fileLogWriter) write(record *logRecord) {
+	line := formatEntry(record.timestamp, record.entry)
+	if this.file == nil && record.timestamp.Sub(this.failTime) >= fileRetryInterval {
+		this.reopenFile()
+	}
+	if this.file == nil {
+		os.Stderr.Write(line)
+		return
+	}
+	if this.rotation.needsRotation(this.size, len(line), this.openTime, record.timestamp) {
+		this.rotate(record.timestamp)
+		if this.file == nil {
+			os.Stderr.Write(line)
+			return
+		}
+	}
+	n, _ := this.file.Write(line)
+	this.size += int64(n)
 }
 
-func newFileLogWriter(path string) (*fileLogWriter, error) {
-	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+// open opens the log file for appending, and replaces the current file with it. If it fails, the
+// current file is kept.
+func (this *fileLogWriter) open() error {
+	file, err := os.OpenFile(this.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if this.file != nil {
+		this.file.Close()
+	}
+	this.file = file
+	this.size = 0
+	this.openTime = time.Now()
+	if info, err := file.Stat(); err == nil {
+		this.size = info.Size()
+	}
+	return nil
+}
+
+// reopenFile opens the log file again, and reports the error to stderr if it fails.
+func (this *fileLogWriter) reopenFile() {
+	if err := this.open(); err != nil {
+		this.failTime = time.Now()
+		createLogger(os.Stderr).Print("Log: Failed to open log file ", this.path, ": ", err)
 	}
+}
+
+// rotate moves the current log file aside, and starts a new one. If the new one fails to open, logs go
+// to stderr until it opens.
+func (this *fileLogWriter) rotate(now time.Time) {
+	this.file.Close()
+	this.file = nil
+	os.Rename(this.path, this.rotation.backupName(this.path, now))
+	this.rotation.removeOldBackups(this.path)
+	this.reopenFile()
+}
+
+// close stops writing, and closes the file once pending logs are written.
+func (this *fileLogWriter) close() {
+	this.closeOnce.Do(func() {
+		fileWritersMutex.Lock()
+		delete(fileWriters, this)
+		fileWritersMutex.Unlock()
+
+		close(this.closed)
+		<-this.done
+	})
+}
+
+func newFileLogWriter(path string, rotation RotationConfig) (*fileLogWriter, error) {
 	logger := &fileLogWriter{
-		queue:  make(chan serial.String, 16),
-		logger: log.New(file, "", log.Ldate|log.Ltime),
-		file:   file,
+		queue:    make(chan *logRecord, 16),
+		reopen:   make(chan bool, 1),
+		closed:   make(chan bool),
+		done:     make(chan bool),
+		path:     path,
+		rotation: rotation,
+	}
+	if err := logger.open(); err != nil {
+		return nil, err
 	}
+
+	fileWritersMutex.Lock()
+	fileWriters[logger] = true
+	fileWritersMutex.Unlock()
+
 	go logger.run()
 	return logger, nil
 }
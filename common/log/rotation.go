@@ -0,0 +1,63 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	backupTimeFormat = "20060102-150405.000"
+)
+
+// RotationConfig decides when a log file is moved aside for a new one. Rotated files are named after
+// the log file, suffixed with the time of rotation. Zero value means no rotation.
+type RotationConfig struct {
+	MaxSize    int64         // Rotate once the file would exceed this number of bytes, or 0 for no limit.
+	Interval   time.Duration // Rotate once the file has been written for this period, or 0 for no limit.
+	MaxBackups int           // Number of rotated files to keep, or 0 to keep all.
+}
+
+func (this RotationConfig) needsRotation(size int64, lineSize int, openTime time.Time, now time.Time) bool {
+	if this.MaxSize > 0 && size > 0 && size+int64(lineSize) > this.MaxSize {
+		return true
+	}
+	if this.Interval > 0 && now.Sub(openTime) >= this.Interval {
+		return true
+	}
+	return false
+}
+
+func (this RotationConfig) backupName(path string, now time.Time) string {
+	return path + "." + now.Format(backupTimeFormat)
+}
+
+// backups returns the rotated files of the given log file, oldest first.
+func (this RotationConfig) backups(path string) []string {
+	candidates, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil
+	}
+	backups := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		suffix := strings.TrimPrefix(candidate, path+".")
+		if _, err := time.Parse(backupTimeFormat, suffix); err == nil {
+			backups = append(backups, candidate)
+		}
+	}
+	sort.Strings(backups)
+	return backups
+}
+
+func (this RotationConfig) removeOldBackups(path string) {
+	if this.MaxBackups <= 0 {
+		return
+	}
+	backups := this.backups(path)
+	for len(backups) > this.MaxBackups {
+		os.Remove(backups[0])
+		backups = backups[1:]
+	}
+}
@@ -0,0 +1,135 @@
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+func TestRotationBySize(t *testing.T) {
+	v2testing.Current(t)
+
+	dir, err := ioutil.TempDir("", "v2ray-log")
+	assert.Error(err).IsNil()
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "error.log")
+	writer, err := newFileLogWriter(filename, RotationConfig{
+		MaxSize:    64,
+		MaxBackups: 2,
+	})
+	assert.Error(err).IsNil()
+	for i := 0; i < 5; i++ {
+		writer.Log(&errorLog{prefix: "[Info]", level: "info", values: []interface{}{"A message of some length."}})
+		// Backups are named after the time of rotation in milliseconds.
+		time.Sleep(5 * time.Millisecond)
+	}
+	writer.close()
+
+	rotation := RotationConfig{}
+	assert.Int(len(rotation.backups(filename))).Equals(2)
+	content, err := ioutil.ReadFile(filename)
+	assert.Error(err).IsNil()
+	assert.Int(strings.Count(string(content), "A message of some length.")).Equals(1)
+}
+
+func TestRotationByTime(t *testing.T) {
+	v2testing.Current(t)
+
+	rotation := RotationConfig{Interval: time.Hour}
+	now := time.Now()
+	assert.Bool(rotation.needsRotation(100, 10, now.Add(-30*time.Minute), now)).IsFalse()
+	assert.Bool(rotation.needsRotation(100, 10, now.Add(-time.Hour), now)).IsTrue()
+	assert.Bool(RotationConfig{}.needsRotation(1<<40, 10, now.Add(-1000*time.Hour), now)).IsFalse()
+}
+
+func TestReopen(t *testing.T) {
+	v2testing.Current(t)
+
+	dir, err := ioutil.TempDir("", "v2ray-log")
+	assert.Error(err).IsNil()
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "access.log")
+	writer, err := newFileLogWriter(filename, RotationConfig{})
+	assert.Error(err).IsNil()
+	writer.Log(&AccessEntry{Status: AccessAccepted, Reason: nil})
+	time.Sleep(100 * time.Millisecond)
+
+	// Move the file away as logrotate does, and reopen.
+	assert.Error(os.Rename(filename, filename+".1")).IsNil()
+	Reopen()
+	time.Sleep(100 * time.Millisecond)
+	writer.Log(&AccessEntry{Status: AccessRejected})
+	writer.close()
+
+	content, err := ioutil.ReadFile(filename)
+	assert.Error(err).IsNil()
+	assert.Bool(strings.Contains(string(content), "rejected")).IsTrue()
+	assert.Bool(strings.Contains(string(content), "accepted")).IsFalse()
+}
+
+func TestReopenFailure(t *testing.T) {
+	v2testing.Current(t)
+
+	dir, err := ioutil.TempDir("", "v2ray-log")
+	assert.Error(err).IsNil()
+	defer os.RemoveAll(dir)
+
+	logDir := filepath.Join(dir, "logs")
+	assert.Error(os.Mkdir(logDir, 0700)).IsNil()
+	writer, err := newFileLogWriter(filepath.Join(logDir, "access.log"), RotationConfig{})
+	assert.Error(err).IsNil()
+	writer.Log(&AccessEntry{Status: AccessAccepted})
+	time.Sleep(100 * time.Millisecond)
+
+	// The file can't be opened again, so the current one is kept.
+	movedDir := filepath.Join(dir, "moved")
+	assert.Error(os.Rename(logDir, movedDir)).IsNil()
+	Reopen()
+	time.Sleep(100 * time.Millisecond)
+	writer.Log(&AccessEntry{Status: AccessRejected})
+	writer.close()
+
+	content, err := ioutil.ReadFile(filepath.Join(movedDir, "access.log"))
+	assert.Error(err).IsNil()
+	assert.Bool(strings.Contains(string(content), "accepted")).IsTrue()
+	assert.Bool(strings.Contains(string(content), "rejected")).IsTrue()
+}
+
+func TestRotationFailure(t *testing.T) {
+	v2testing.Current(t)
+
+	dir, err := ioutil.TempDir("", "v2ray-log")
+	assert.Error(err).IsNil()
+	defer os.RemoveAll(dir)
+
+	logDir := filepath.Join(dir, "logs")
+	assert.Error(os.Mkdir(logDir, 0700)).IsNil()
+	filename := filepath.Join(logDir, "error.log")
+	writer, err := newFileLogWriter(filename, RotationConfig{MaxSize: 64})
+	assert.Error(err).IsNil()
+	writer.Log(&errorLog{prefix: "[Info]", level: "info", values: []interface{}{"A message of some length."}})
+	time.Sleep(100 * time.Millisecond)
+
+	// Rotation fails to open the new file, and logs go to stderr until the file is reopened.
+	movedDir := filepath.Join(dir, "moved")
+	assert.Error(os.Rename(logDir, movedDir)).IsNil()
+	writer.Log(&errorLog{prefix: "[Info]", level: "info", values: []interface{}{"A message to stderr."}})
+	time.Sleep(100 * time.Millisecond)
+	assert.Error(os.Rename(movedDir, logDir)).IsNil()
+	Reopen()
+	time.Sleep(100 * time.Millisecond)
+	writer.Log(&errorLog{prefix: "[Info]", level: "info", values: []interface{}{"A message after reopen."}})
+	writer.close()
+
+	content, err := ioutil.ReadFile(filename)
+	assert.Error(err).IsNil()
+	assert.Bool(strings.Contains(string(content), "A message after reopen.")).IsTrue()
+}
@@ -0,0 +1,217 @@
+// Package metrics keeps process-wide counters and gauges, and exports them in the text format of
+// Prometheus.
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a value that only goes up. It is safe for concurrent use.
+type Counter struct {
+	value int64
+}
+
+func (this *Counter) Inc() {
+	atomic.AddInt64(&this.value, 1)
+}
+
+func (this *Counter) Add(delta int64) {
+	atomic.AddInt64(&this.value, delta)
+}
+
+func (this *Counter) Value() int64 {
+	return atomic.LoadInt64(&this.value)
+}
+
+// Gauge is a value that goes up and down. It is safe for concurrent use.
+type Gauge struct {
+	value int64
+}
+
+func (this *Gauge) Inc() {
+	atomic.AddInt64(&this.value, 1)
+}
+
+func (this *Gauge) Dec() {
+	atomic.AddInt64(&this.value, -1)
+}
+
+func (this *Gauge) Set(value int64) {
+	atomic.StoreInt64(&this.value, value)
+}
+
+func (this *Gauge) Value() int64 {
+	return atomic.LoadInt64(&this.value)
+}
+
+type labeledCounter struct {
+	values []string
+	Counter
+}
+
+// CounterVec is a group of counters with the same name, distinguished by label values.
+type CounterVec struct {
+	sync.RWMutex
+	labelNames []string
+	counters   map[string]*labeledCounter
+}
+
+// WithLabelValues returns the counter with the given label values, in the same order as label names.
+// It is created if not exists.
+func (this *CounterVec) WithLabelValues(values ...string) *Counter {
+	if len(values) != len(this.labelNames) {
+		panic("metrics: Inconsistent cardinality of label values.")
+	}
+	key := strings.Join(values, "\xff")
+	this.RLock()
+	counter, found := this.counters[key]
+	this.RUnlock()
+	if found {
+		return &counter.Counter
+	}
+
+	this.Lock()
+	defer this.Unlock()
+	counter, found = this.counters[key]
+	if !found {
+		counter = &labeledCounter{values: append([]string(nil), values...)}
+		this.counters[key] = counter
+	}
+	return &counter.Counter
+}
+
+type sample struct {
+	labels string
+	value  int64
+}
+
+type collector func() []sample
+
+type metric struct {
+	name    string
+	help    string
+	kind    string
+	collect collector
+}
+
+var (
+	access  sync.RWMutex
+	metrics = make(map[string]*metric)
+)
+
+func register(name, help, kind string, collect collector) {
+	access.Lock()
+	defer access.Unlock()
+	if _, found := metrics[name]; found {
+		panic("metrics: Duplicate metric " + name)
+	}
+	metrics[name] = &metric{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		collect: collect,
+	}
+}
+
+// NewCounter creates and registers a counter with the given name.
+func NewCounter(name, help string) *Counter {
+	counter := new(Counter)
+	register(name, help, "counter", func() []sample {
+		return []sample{{value: counter.Value()}}
+	})
+	return counter
+}
+
+// NewGauge creates and registers a gauge with the given name.
+func NewGauge(name, help string) *Gauge {
+	gauge := new(Gauge)
+	register(name, help, "gauge", func() []sample {
+		return []sample{{value: gauge.Value()}}
+	})
+	return gauge
+}
+
+// NewGaugeFunc registers a gauge with the given name, whose value is retrieved by the given function
+// on each export.
+func NewGaugeFunc(name, help string, value func() int64) {
+	register(name, help, "gauge", func() []sample {
+		return []sample{{value: value()}}
+	})
+}
+
+// NewCounterVec creates and registers a group of counters with the given name and label names.
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	vec := &CounterVec{
+		labelNames: labelNames,
+		counters:   make(map[string]*labeledCounter),
+	}
+	register(name, help, "counter", func() []sample {
+		vec.RLock()
+		defer vec.RUnlock()
+		samples := make([]sample, 0, len(vec.counters))
+		for _, counter := range vec.counters {
+			samples = append(samples, sample{
+				labels: formatLabels(vec.labelNames, counter.values),
+				value:  counter.Value(),
+			})
+		}
+		sort.Sort(sampleList(samples))
+		return samples
+	})
+	return vec
+}
+
+var labelValueEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func formatLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for idx, name := range names {
+		pairs[idx] = name + "=\"" + labelValueEscaper.Replace(values[idx]) + "\""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+type sampleList []sample
+
+func (this sampleList) Len() int {
+	return len(this)
+}
+
+func (this sampleList) Less(i, j int) bool {
+	return this[i].labels < this[j].labels
+}
+
+func (this sampleList) Swap(i, j int) {
+	this[i], this[j] = this[j], this[i]
+}
+
+// WriteText writes all registered metrics in the text format of Prometheus, sorted by name.
+func WriteText(writer io.Writer) error {
+	access.RLock()
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	access.RUnlock()
+	sort.Strings(names)
+
+	bufferedWriter := bufio.NewWriter(writer)
+	for _, name := range names {
+		access.RLock()
+		metric := metrics[name]
+		access.RUnlock()
+
+		bufferedWriter.WriteString("# HELP " + name + " " + metric.help + "\n")
+		bufferedWriter.WriteString("# TYPE " + name + " " + metric.kind + "\n")
+		for _, sample := range metric.collect() {
+			bufferedWriter.WriteString(name + sample.labels + " " + strconv.FormatInt(sample.value, 10) + "\n")
+		}
+	}
+	return bufferedWriter.Flush()
+}
@@ -0,0 +1,39 @@
+package metrics_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/v2ray/v2ray-core/common/metrics"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+func TestWriteText(t *testing.T) {
+	v2testing.Current(t)
+
+	counter := NewCounter("test_counter_total", "A counter.")
+	counter.Inc()
+	counter.Add(2)
+
+	gauge := NewGauge("test_gauge", "A gauge.")
+	gauge.Set(5)
+	gauge.Dec()
+
+	NewGaugeFunc("test_gauge_func", "A gauge function.", func() int64 { return 42 })
+
+	vec := NewCounterVec("test_vec_total", "A counter vector.", "tag", "status")
+	vec.WithLabelValues("b", "accepted").Inc()
+	vec.WithLabelValues("a\"", "rejected").Add(3)
+	vec.WithLabelValues("b", "accepted").Inc()
+
+	buffer := new(bytes.Buffer)
+	assert.Error(WriteText(buffer)).IsNil()
+	text := buffer.String()
+
+	assert.Bool(strings.Contains(text, "# HELP test_counter_total A counter.\n# TYPE test_counter_total counter\ntest_counter_total 3\n")).IsTrue()
+	assert.Bool(strings.Contains(text, "# TYPE test_gauge gauge\ntest_gauge 4\n")).IsTrue()
+	assert.Bool(strings.Contains(text, "test_gauge_func 42\n")).IsTrue()
+	assert.Bool(strings.Contains(text, "test_vec_total{tag=\"a\\\"\",status=\"rejected\"} 3\ntest_vec_total{tag=\"b\",status=\"accepted\"} 2\n")).IsTrue()
+}
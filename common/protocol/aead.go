@@ -0,0 +1,70 @@
+package protocol
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash/crc32"
+)
+
+const (
+	// AuthIDLen is the length of auth IDs, which start AEAD request headers in place of user hashes.
+	AuthIDLen = 16
+
+	// AuthIDWindowSec is how far the time in an auth ID may differ from the current time, in seconds.
+	AuthIDWindowSec = cacheDurationSec
+
+	kdfSalt          = "VMess AEAD KDF"
+	authIDKeyPath    = "AES Auth ID Encryption"
+	authIDPlainBytes = 12 // Time (8 bytes) and random bytes (4 bytes), followed by their CRC32.
+)
+
+// KDF derives a 32-byte key from the given key, for the purpose identified by the given path.
+func KDF(key []byte, path ...[]byte) []byte {
+	mac := hmac.New(sha256.New, []byte(kdfSalt))
+	for _, element := range path {
+		var length [2]byte
+		binary.BigEndian.PutUint16(length[:], uint16(len(element)))
+		mac.Write(length[:])
+		mac.Write(element)
+	}
+	mac.Write(key)
+	return mac.Sum(nil)
+}
+
+// KDF16 is KDF truncated to 16 bytes, for AES-128 keys.
+func KDF16(key []byte, path ...[]byte) []byte {
+	return KDF(key, path...)[:16]
+}
+
+func newAuthIDCipher(cmdKey []byte) cipher.Block {
+	block, _ := aes.NewCipher(KDF16(cmdKey, []byte(authIDKeyPath)))
+	return block
+}
+
+// NewAuthID returns an auth ID of the given time, for the ID of which the given key is the command key.
+// It is a single AES block of the time, random bytes, and their checksum.
+func NewAuthID(cmdKey []byte, timestamp Timestamp) []byte {
+	var plain [AuthIDLen]byte
+	binary.BigEndian.PutUint64(plain[:8], uint64(timestamp))
+	rand.Read(plain[8:authIDPlainBytes])
+	binary.BigEndian.PutUint32(plain[authIDPlainBytes:], crc32.ChecksumIEEE(plain[:authIDPlainBytes]))
+
+	authID := make([]byte, AuthIDLen)
+	newAuthIDCipher(cmdKey).Encrypt(authID, plain[:])
+	return authID
+}
+
+// openAuthID decrypts the given auth ID with the given cipher, and returns its time if the checksum
+// matches.
+func openAuthID(block cipher.Block, authID []byte) (Timestamp, bool) {
+	var plain [AuthIDLen]byte
+	block.Decrypt(plain[:], authID)
+	if crc32.ChecksumIEEE(plain[:authIDPlainBytes]) != binary.BigEndian.Uint32(plain[authIDPlainBytes:]) {
+		return 0, false
+	}
+	return Timestamp(binary.BigEndian.Uint64(plain[:8])), true
+}
@@ -5,6 +5,7 @@ import (
 )
 
 var (
-	ErrorInvalidUser    = errors.New("Invalid user.")
-	ErrorInvalidVersion = errors.New("Invalid version.")
+	ErrorInvalidUser     = errors.New("Invalid user.")
+	ErrorInvalidVersion  = errors.New("Invalid version.")
+	ErrorReplayedRequest = errors.New("Replayed request.")
 )
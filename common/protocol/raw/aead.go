@@ -0,0 +1,93 @@
+package raw
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/v2ray/v2ray-core/common/log"
+	"github.com/v2ray/v2ray-core/common/protocol"
+	"github.com/v2ray/v2ray-core/transport"
+)
+
+// In AEAD mode, a request header consists of an auth ID, the length of the command section sealed with
+// AES-128-GCM, a random connection nonce, and the command section sealed with AES-128-GCM. Keys and nonces
+// are derived from the command key of the user, the auth ID and the connection nonce, and the auth ID is
+// the additional data of both.
+const (
+	connectionNonceLen = 8
+	sealedLengthLen    = 2 + 16 // Length and GCM tag.
+
+	// maxCommandSectionLen is the length of a command section with the longest domain. It includes 41
+	// bytes from version to address type, up to 256 bytes of domain, and 4 bytes of checksum.
+	maxCommandSectionLen = 301
+
+	aeadLengthKeyPath   = "VMess Header AEAD Key_Length"
+	aeadLengthNoncePath = "VMess Header AEAD Nonce_Length"
+	aeadHeaderKeyPath   = "VMess Header AEAD Key"
+	aeadHeaderNoncePath = "VMess Header AEAD Nonce"
+)
+
+func newHeaderAEAD(cmdKey []byte, keyPath string, noncePath string, authID []byte, connectionNonce []byte) (cipher.AEAD, []byte) {
+	block, _ := aes.NewCipher(protocol.KDF16(cmdKey, []byte(keyPath), authID, connectionNonce))
+	aead, _ := cipher.NewGCM(block)
+	nonce := protocol.KDF(cmdKey, []byte(noncePath), authID, connectionNonce)[:aead.NonceSize()]
+	return aead, nonce
+}
+
+// sealRequestHeader writes a request header in AEAD mode, which contains the given command section.
+func sealRequestHeader(cmdKey []byte, command []byte, writer io.Writer) {
+	authID := protocol.NewAuthID(cmdKey, protocol.NowTime())
+	connectionNonce := make([]byte, connectionNonceLen)
+	rand.Read(connectionNonce)
+
+	var length [2]byte
+	binary.BigEndian.PutUint16(length[:], uint16(len(command)))
+
+	lengthAEAD, lengthNonce := newHeaderAEAD(cmdKey, aeadLengthKeyPath, aeadLengthNoncePath, authID, connectionNonce)
+	headerAEAD, headerNonce := newHeaderAEAD(cmdKey, aeadHeaderKeyPath, aeadHeaderNoncePath, authID, connectionNonce)
+
+	buffer := make([]byte, 0, protocol.AuthIDLen+sealedLengthLen+connectionNonceLen+len(command)+headerAEAD.Overhead())
+	buffer = append(buffer, authID...)
+	buffer = lengthAEAD.Seal(buffer, lengthNonce, length[:], authID)
+	buffer = append(buffer, connectionNonce...)
+	buffer = headerAEAD.Seal(buffer, headerNonce, command, authID)
+	writer.Write(buffer)
+}
+
+// openRequestHeader reads the rest of a request header in AEAD mode after the given auth ID, and returns
+// the command section in it.
+func openRequestHeader(cmdKey []byte, authID []byte, reader io.Reader) ([]byte, error) {
+	buffer := make([]byte, sealedLengthLen+connectionNonceLen)
+	if _, err := io.ReadFull(reader, buffer); err != nil {
+		log.Debug("Raw: Failed to read length of AEAD request header: ", err)
+		return nil, err
+	}
+	connectionNonce := buffer[sealedLengthLen:]
+
+	lengthAEAD, lengthNonce := newHeaderAEAD(cmdKey, aeadLengthKeyPath, aeadLengthNoncePath, authID, connectionNonce)
+	length, err := lengthAEAD.Open(nil, lengthNonce, buffer[:sealedLengthLen], authID)
+	if err != nil {
+		log.Warning("Raw: Failed to open length of AEAD request header: ", err)
+		return nil, transport.ErrorCorruptedPacket
+	}
+	commandLen := int(binary.BigEndian.Uint16(length))
+	if commandLen > maxCommandSectionLen {
+		return nil, transport.ErrorCorruptedPacket
+	}
+
+	headerAEAD, headerNonce := newHeaderAEAD(cmdKey, aeadHeaderKeyPath, aeadHeaderNoncePath, authID, connectionNonce)
+	sealed := make([]byte, commandLen+headerAEAD.Overhead())
+	if _, err := io.ReadFull(reader, sealed); err != nil {
+		log.Debug("Raw: Failed to read AEAD request header: ", err)
+		return nil, err
+	}
+	command, err := headerAEAD.Open(sealed[:0], headerNonce, sealed, authID)
+	if err != nil {
+		log.Warning("Raw: Failed to open AEAD request header: ", err)
+		return nil, transport.ErrorCorruptedPacket
+	}
+	return command, nil
+}
@@ -31,6 +31,7 @@ type ClientSession struct {
 	responseBodyIV  []byte
 	responseReader  io.Reader
 	idHash          protocol.IDHash
+	aead            bool
 }
 
 func NewClientSession(idHash protocol.IDHash) *ClientSession {
@@ -50,12 +51,16 @@ func NewClientSession(idHash protocol.IDHash) *ClientSession {
 	return session
 }
 
-func (this *ClientSession) EncodeRequestHeader(header *protocol.RequestHeader, writer io.Writer) {
-	timestamp := protocol.NewTimestampGenerator(protocol.NowTime(), 30)()
-	idHash := this.idHash(header.User.AnyValidID().Bytes())
-	idHash.Write(timestamp.Bytes())
-	writer.Write(idHash.Sum(nil))
+// NewAEADClientSession returns a ClientSession which encodes request headers in AEAD mode. Such headers
+// are authenticated by the primary ID of the user, and can't be replayed. Only servers which support AEAD
+// mode accept them.
+func NewAEADClientSession() *ClientSession {
+	session := NewClientSession(nil)
+	session.aead = true
+	return session
+}
 
+func (this *ClientSession) EncodeRequestHeader(header *protocol.RequestHeader, writer io.Writer) {
 	buffer := alloc.NewSmallBuffer().Clear()
 	defer buffer.Release()
 
@@ -84,6 +89,16 @@ func (this *ClientSession) EncodeRequestHeader(header *protocol.RequestHeader, w
 	fnvHash := fnv1a.Sum32()
 	buffer.AppendBytes(byte(fnvHash>>24), byte(fnvHash>>16), byte(fnvHash>>8), byte(fnvHash))
 
+	if this.aead {
+		sealRequestHeader(header.User.ID.CmdKey(), buffer.Value, writer)
+		return
+	}
+
+	timestamp := protocol.NewTimestampGenerator(protocol.NowTime(), 30)()
+	idHash := this.idHash(header.User.AnyValidID().Bytes())
+	idHash.Write(timestamp.Bytes())
+	writer.Write(idHash.Sum(nil))
+
 	timestampHash := md5.New()
 	timestampHash.Write(hashTimestamp(timestamp))
 	iv := timestampHash.Sum(nil)
@@ -1,6 +1,7 @@
 package raw_test
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/v2ray/v2ray-core/common/alloc"
@@ -11,6 +12,7 @@ import (
 	"github.com/v2ray/v2ray-core/common/uuid"
 	v2testing "github.com/v2ray/v2ray-core/testing"
 	"github.com/v2ray/v2ray-core/testing/assert"
+	"github.com/v2ray/v2ray-core/transport"
 )
 
 func TestRequestSerialization(t *testing.T) {
@@ -48,3 +50,77 @@ func TestRequestSerialization(t *testing.T) {
 	netassert.Address(expectedRequest.Address).Equals(actualRequest.Address)
 	netassert.Port(expectedRequest.Port).Equals(actualRequest.Port)
 }
+
+func TestAEADRequestSerialization(t *testing.T) {
+	v2testing.Current(t)
+
+	user := protocol.NewUser(
+		protocol.NewID(uuid.New()),
+		protocol.UserLevelUntrusted,
+		4,
+		"test@v2ray.com")
+
+	expectedRequest := &protocol.RequestHeader{
+		Version: 1,
+		User:    user,
+		Command: protocol.RequestCommandUDP,
+		Option:  protocol.RequestOptionChunkStream,
+		Address: v2net.IPAddress([]byte{1, 2, 3, 4}),
+		Port:    v2net.Port(53),
+	}
+
+	buffer := alloc.NewBuffer().Clear()
+	client := NewAEADClientSession()
+	client.EncodeRequestHeader(expectedRequest, buffer)
+	data := append([]byte(nil), buffer.Value...)
+
+	userValidator := protocol.NewTimedUserValidator(protocol.DefaultIDHash)
+	defer userValidator.Close()
+	userValidator.Add(user)
+
+	server := NewServerSession(userValidator)
+	server.DisableLegacyHeader()
+	actualRequest, err := server.DecodeRequestHeader(bytes.NewReader(data))
+	assert.Error(err).IsNil()
+
+	assert.StringLiteral(actualRequest.User.Email).Equals(user.Email)
+	assert.Byte(byte(expectedRequest.Command)).Equals(byte(actualRequest.Command))
+	assert.Byte(byte(expectedRequest.Option)).Equals(byte(actualRequest.Option))
+	netassert.Address(expectedRequest.Address).Equals(actualRequest.Address)
+	netassert.Port(expectedRequest.Port).Equals(actualRequest.Port)
+
+	// Replayed headers are rejected.
+	_, err = NewServerSession(userValidator).DecodeRequestHeader(bytes.NewReader(data))
+	assert.Error(err).Equals(protocol.ErrorReplayedRequest)
+
+	// So are tampered ones.
+	buffer.Clear()
+	NewAEADClientSession().EncodeRequestHeader(expectedRequest, buffer)
+	buffer.Value[len(buffer.Value)-1] ^= 1
+	_, err = NewServerSession(userValidator).DecodeRequestHeader(buffer)
+	assert.Error(err).Equals(transport.ErrorCorruptedPacket)
+}
+
+func TestLegacyHeaderDisabled(t *testing.T) {
+	v2testing.Current(t)
+
+	user := protocol.NewUser(protocol.NewID(uuid.New()), protocol.UserLevelUntrusted, 0, "test@v2ray.com")
+	request := &protocol.RequestHeader{
+		Version: 1,
+		User:    user,
+		Command: protocol.RequestCommandTCP,
+		Address: v2net.DomainAddress("www.v2ray.com"),
+		Port:    v2net.Port(443),
+	}
+
+	userValidator := protocol.NewTimedUserValidator(protocol.DefaultIDHash)
+	defer userValidator.Close()
+	userValidator.Add(user)
+
+	buffer := alloc.NewBuffer().Clear()
+	NewClientSession(protocol.DefaultIDHash).EncodeRequestHeader(request, buffer)
+	server := NewServerSession(userValidator)
+	server.DisableLegacyHeader()
+	_, err := server.DecodeRequestHeader(buffer)
+	assert.Error(err).Equals(protocol.ErrorInvalidUser)
+}
@@ -1,6 +1,7 @@
 package raw
 
 import (
+	"bytes"
 	"crypto/md5"
 	"hash/fnv"
 	"io"
@@ -22,6 +23,7 @@ type ServerSession struct {
 	responseBodyIV  []byte
 	responseHeader  byte
 	responseWriter  io.Writer
+	legacyDisabled  bool
 }
 
 func NewServerSession(validator protocol.UserValidator) *ServerSession {
@@ -30,6 +32,13 @@ func NewServerSession(validator protocol.UserValidator) *ServerSession {
 	}
 }
 
+// DisableLegacyHeader makes this session reject request headers which are not in AEAD mode.
+func (this *ServerSession) DisableLegacyHeader() {
+	this.legacyDisabled = true
+}
+
+// DecodeRequestHeader decodes a request header in either the legacy or AEAD mode. The first 16 bytes are
+// a user hash in legacy mode, or an auth ID in AEAD mode, which are told apart by the user validator.
 func (this *ServerSession) DecodeRequestHeader(reader io.Reader) (*protocol.RequestHeader, error) {
 	buffer := alloc.NewSmallBuffer()
 	defer buffer.Release()
@@ -40,17 +49,27 @@ func (this *ServerSession) DecodeRequestHeader(reader io.Reader) (*protocol.Requ
 		return nil, err
 	}
 
+	var decryptor io.Reader
 	user, timestamp, valid := this.userValidator.Get(buffer.Value[:protocol.IDBytesLen])
-	if !valid {
-		return nil, protocol.ErrorInvalidUser
+	if valid && !this.legacyDisabled {
+		timestampHash := md5.New()
+		timestampHash.Write(hashTimestamp(timestamp))
+		iv := timestampHash.Sum(nil)
+		aesStream := crypto.NewAesDecryptionStream(user.ID.CmdKey(), iv)
+		decryptor = crypto.NewCryptionReader(aesStream, reader)
+	} else {
+		authID := buffer.Value[:protocol.AuthIDLen]
+		user, _, err = this.userValidator.GetByAuthID(authID)
+		if err != nil {
+			return nil, err
+		}
+		command, err := openRequestHeader(user.ID.CmdKey(), authID, reader)
+		if err != nil {
+			return nil, err
+		}
+		decryptor = bytes.NewReader(command)
 	}
 
-	timestampHash := md5.New()
-	timestampHash.Write(hashTimestamp(timestamp))
-	iv := timestampHash.Sum(nil)
-	aesStream := crypto.NewAesDecryptionStream(user.ID.CmdKey(), iv)
-	decryptor := crypto.NewCryptionReader(aesStream, reader)
-
 	nBytes, err := io.ReadFull(decryptor, buffer.Value[:41])
 	if err != nil {
 		log.Debug("Raw: Failed to read request header (", nBytes, " bytes): ", err)
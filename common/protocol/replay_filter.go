@@ -0,0 +1,48 @@
+package protocol
+
+import (
+	"sync"
+	"time"
+)
+
+// ReplayFilter remembers the IDs it has seen for at least the given interval, in two generations of
+// sets. The older generation is dropped when the newer one has been filled for the interval.
+type ReplayFilter struct {
+	sync.Mutex
+	interval time.Duration
+	current  map[[AuthIDLen]byte]bool
+	previous map[[AuthIDLen]byte]bool
+	lastSwap time.Time
+}
+
+func NewReplayFilter(interval time.Duration) *ReplayFilter {
+	return &ReplayFilter{
+		interval: interval,
+		current:  make(map[[AuthIDLen]byte]bool),
+		previous: make(map[[AuthIDLen]byte]bool),
+		lastSwap: time.Now(),
+	}
+}
+
+// Check returns true and remembers the given ID if it has not been seen, or false otherwise.
+func (this *ReplayFilter) Check(id []byte) bool {
+	var key [AuthIDLen]byte
+	copy(key[:], id)
+
+	this.Lock()
+	defer this.Unlock()
+
+	now := time.Now()
+	if now.Sub(this.lastSwap) >= this.interval {
+		// IDs in the previous generation were seen before the last swap, which is long enough ago.
+		this.previous = this.current
+		this.current = make(map[[AuthIDLen]byte]bool)
+		this.lastSwap = now
+	}
+
+	if this.current[key] || this.previous[key] {
+		return false
+	}
+	this.current[key] = true
+	return true
+}
@@ -0,0 +1,29 @@
+package protocol_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/v2ray/v2ray-core/common/protocol"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+func TestReplayFilter(t *testing.T) {
+	v2testing.Current(t)
+
+	filter := NewReplayFilter(100 * time.Millisecond)
+	id1 := []byte("0123456789abcdef")
+	id2 := []byte("fedcba9876543210")
+	assert.Bool(filter.Check(id1)).IsTrue()
+	assert.Bool(filter.Check(id1)).IsFalse()
+
+	// IDs are kept for at least the interval, across one swap.
+	time.Sleep(110 * time.Millisecond)
+	assert.Bool(filter.Check(id2)).IsTrue()
+	assert.Bool(filter.Check(id1)).IsFalse()
+
+	time.Sleep(110 * time.Millisecond)
+	assert.Bool(filter.Check(id1)).IsTrue()
+	assert.Bool(filter.Check(id2)).IsFalse()
+}
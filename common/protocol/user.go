@@ -45,17 +45,9 @@ func (this *User) AnyValidID() *ID {
 }
 
 type UserSettings struct {
-	PayloadReadTimeout int
-}
-
-func GetUserSettings(level UserLevel) UserSettings {
-	settings := UserSettings{
-		PayloadReadTimeout: 120,
-	}
-	if level > 0 {
-		settings.PayloadReadTimeout = 0
-	}
-	return settings
+	UplinkRate   int64 // Bytes per second, 0 for unlimited.
+	DownlinkRate int64 // Bytes per second, 0 for unlimited.
+	Quota        int64 // Total bytes of uplink and downlink, 0 for unlimited.
 }
 
 type Account interface {
@@ -0,0 +1,24 @@
+package protocol
+
+import (
+	"github.com/v2ray/v2ray-core/common/uuid"
+)
+
+// UserMessage is the typed schema of User.
+type UserMessage struct {
+	Id      string `protobuf:"bytes,1,opt,name=id"`
+	AlterId uint32 `protobuf:"varint,2,opt,name=alter_id"`
+	Level   uint32 `protobuf:"varint,3,opt,name=level"`
+	Email   string `protobuf:"bytes,4,opt,name=email"`
+}
+
+func (this *UserMessage) Build() (*User, error) {
+	if this.AlterId > 65535 || this.Level > 255 {
+		return nil, ErrorInvalidUser
+	}
+	id, err := uuid.ParseString(this.Id)
+	if err != nil {
+		return nil, err
+	}
+	return NewUser(NewID(id), UserLevel(this.Level), uint16(this.AlterId), this.Email), nil
+}
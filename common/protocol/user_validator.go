@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"crypto/cipher"
 	"sync"
 	"time"
 )
@@ -15,19 +16,49 @@ type idEntry struct {
 	userIdx        int
 	lastSec        Timestamp
 	lastSecRemoval Timestamp
+	removed        bool
 }
 
 type UserValidator interface {
 	Add(user *User) error
 	Get(timeHash []byte) (*User, Timestamp, bool)
+	// GetByAuthID returns the user of the given auth ID from an AEAD request header, along with the time in
+	// it. Each auth ID is accepted only once, and ErrorReplayedRequest is returned for later ones.
+	GetByAuthID(authID []byte) (*User, Timestamp, error)
+	// Remove removes the user with the given email, and returns false if there is no such user.
+	Remove(email string) bool
+	// SetExpiry sets the time after which the user with the given email is removed. Zero time means
+	// never. It returns false if there is no such user.
+	SetExpiry(email string, expiry time.Time) bool
+	// SetEnabled enables or disables the user with the given email. Disabled users are kept but not
+	// authenticated. It returns false if there is no such user.
+	SetEnabled(email string, enabled bool) bool
+	// Start resumes refreshing user hashes after Close.
+	Start()
+	// Close stops refreshing user hashes. Users are kept.
+	Close()
+}
+
+type userEntry struct {
+	user         *User
+	expiry       time.Time
+	disabled     bool
+	authIDCipher cipher.Block // Decrypts auth IDs of the primary ID of the user.
+}
+
+func (this *userEntry) isExpired(now time.Time) bool {
+	return !this.expiry.IsZero() && now.After(this.expiry)
 }
 
 type TimedUserValidator struct {
-	validUsers []*User
+	validUsers []*userEntry // Slots of removed users are nil, and reused by new users.
 	userHash   map[[16]byte]*indexTimePair
 	ids        []*idEntry
+	authIDs    *ReplayFilter // Auth IDs accepted within the time window.
 	access     sync.RWMutex
 	hasher     IDHash
+	closed     chan bool
+	done       chan bool
 }
 
 type indexTimePair struct {
@@ -37,21 +68,29 @@ type indexTimePair struct {
 
 func NewTimedUserValidator(hasher IDHash) UserValidator {
 	tus := &TimedUserValidator{
-		validUsers: make([]*User, 0, 16),
+		validUsers: make([]*userEntry, 0, 16),
 		userHash:   make(map[[16]byte]*indexTimePair, 512),
 		access:     sync.RWMutex{},
 		ids:        make([]*idEntry, 0, 512),
+		authIDs:    NewReplayFilter(AuthIDWindowSec * 2 * time.Second),
 		hasher:     hasher,
 	}
-	go tus.updateUserHash(time.Tick(updateIntervalSec * time.Second))
+	tus.Start()
 	return tus
 }
 
+// generateNewHashes publishes the hashes of the given ID up to nowSec. The entry is advanced under
+// the lock, so that it may be called from several goroutines at once.
 func (this *TimedUserValidator) generateNewHashes(nowSec Timestamp, idx int, entry *idEntry) {
 	var hashValue [16]byte
 	var hashValueRemoval [16]byte
 	idHash := this.hasher(entry.id.Bytes())
-	for entry.lastSec <= nowSec {
+	for {
+		this.access.Lock()
+		if entry.removed || entry.lastSec > nowSec || this.validUsers[idx] == nil {
+			this.access.Unlock()
+			return
+		}
 		idHash.Write(entry.lastSec.Bytes())
 		idHash.Sum(hashValue[:0])
 		idHash.Reset()
@@ -60,61 +99,255 @@ func (this *TimedUserValidator) generateNewHashes(nowSec Timestamp, idx int, ent
 		idHash.Sum(hashValueRemoval[:0])
 		idHash.Reset()
 
-		this.access.Lock()
 		this.userHash[hashValue] = &indexTimePair{idx, entry.lastSec}
 		delete(this.userHash, hashValueRemoval)
-		this.access.Unlock()
-
 		entry.lastSec++
 		entry.lastSecRemoval++
+		this.access.Unlock()
 	}
 }
 
-func (this *TimedUserValidator) updateUserHash(tick <-chan time.Time) {
-	for now := range tick {
-		nowSec := Timestamp(now.Unix() + cacheDurationSec)
-		for _, entry := range this.ids {
-			this.generateNewHashes(nowSec, entry.userIdx, entry)
+func (this *TimedUserValidator) updateUserHash(closed <-chan bool, done chan<- bool) {
+	defer close(done)
+	ticker := time.NewTicker(updateIntervalSec * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			this.removeExpiredUsers(now)
+			nowSec := Timestamp(now.Unix() + cacheDurationSec)
+			this.access.RLock()
+			ids := this.ids
+			this.access.RUnlock()
+			for _, entry := range ids {
+				this.generateNewHashes(nowSec, entry.userIdx, entry)
+			}
+		case <-closed:
+			return
 		}
 	}
 }
 
+func (this *TimedUserValidator) removeExpiredUsers(now time.Time) {
+	this.access.Lock()
+	defer this.access.Unlock()
+
+	for idx, entry := range this.validUsers {
+		if entry != nil && entry.isExpired(now) {
+			this.removeUser(idx)
+		}
+	}
+}
+
+// resetHashes regenerates all hashes from the given time, discarding the ones that are out of date.
+func (this *TimedUserValidator) resetHashes(now time.Time) {
+	nowSec := now.Unix()
+
+	this.access.Lock()
+	this.userHash = make(map[[16]byte]*indexTimePair, len(this.userHash))
+	ids := this.ids
+	for _, entry := range ids {
+		entry.lastSec = Timestamp(nowSec - cacheDurationSec)
+		entry.lastSecRemoval = Timestamp(nowSec - cacheDurationSec*3)
+	}
+	this.access.Unlock()
+
+	for _, entry := range ids {
+		this.generateNewHashes(Timestamp(nowSec+cacheDurationSec), entry.userIdx, entry)
+	}
+}
+
+func (this *TimedUserValidator) Start() {
+	this.access.Lock()
+	if this.closed != nil {
+		this.access.Unlock()
+		return
+	}
+	this.closed = make(chan bool)
+	this.done = make(chan bool)
+	closed, done := this.closed, this.done
+	resumed := len(this.ids) > 0
+	this.access.Unlock()
+
+	if resumed {
+		this.resetHashes(time.Now())
+	}
+	go this.updateUserHash(closed, done)
+}
+
+// Close stops refreshing user hashes, and waits until the refreshing goroutine exits.
+func (this *TimedUserValidator) Close() {
+	this.access.Lock()
+	closed, done := this.closed, this.done
+	this.closed = nil
+	this.done = nil
+	this.access.Unlock()
+
+	if closed != nil {
+		close(closed)
+		<-done
+	}
+}
+
 func (this *TimedUserValidator) Add(user *User) error {
-	idx := len(this.validUsers)
-	this.validUsers = append(this.validUsers, user)
+	this.access.Lock()
+	idx := -1
+	for i, entry := range this.validUsers {
+		if entry == nil {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		idx = len(this.validUsers)
+		this.validUsers = append(this.validUsers, nil)
+	}
+	this.validUsers[idx] = &userEntry{
+		user:         user,
+		authIDCipher: newAuthIDCipher(user.ID.CmdKey()),
+	}
 
+	// Register the IDs along with the user, so that a concurrent removal finds and stops them.
 	nowSec := time.Now().Unix()
-
-	entry := &idEntry{
-		id:             user.ID,
-		userIdx:        idx,
-		lastSec:        Timestamp(nowSec - cacheDurationSec),
-		lastSecRemoval: Timestamp(nowSec - cacheDurationSec*3),
-	}
-	this.generateNewHashes(Timestamp(nowSec+cacheDurationSec), idx, entry)
-	this.ids = append(this.ids, entry)
-	for _, alterid := range user.AlterIDs {
-		entry := &idEntry{
-			id:             alterid,
+	ids := append([]*ID{user.ID}, user.AlterIDs...)
+	entries := make([]*idEntry, len(ids))
+	for i, id := range ids {
+		entries[i] = &idEntry{
+			id:             id,
 			userIdx:        idx,
 			lastSec:        Timestamp(nowSec - cacheDurationSec),
 			lastSecRemoval: Timestamp(nowSec - cacheDurationSec*3),
 		}
+	}
+	this.ids = append(this.ids, entries...)
+	this.access.Unlock()
+
+	for _, entry := range entries {
 		this.generateNewHashes(Timestamp(nowSec+cacheDurationSec), idx, entry)
-		this.ids = append(this.ids, entry)
 	}
 
 	return nil
 }
 
+// findUser returns the index of user with the given email, or -1 if not found. Caller must hold the
+// lock.
+func (this *TimedUserValidator) findUser(email string) int {
+	if len(email) == 0 {
+		return -1
+	}
+	for idx, entry := range this.validUsers {
+		if entry != nil && entry.user.Email == email {
+			return idx
+		}
+	}
+	return -1
+}
+
+// removeUser removes the user at the given index, along with all hashes of its IDs. Caller must hold
+// the lock.
+func (this *TimedUserValidator) removeUser(idx int) {
+	this.validUsers[idx] = nil
+
+	// Create a new slice, as the updating goroutine may be iterating the old one.
+	ids := make([]*idEntry, 0, len(this.ids))
+	for _, entry := range this.ids {
+		if entry.userIdx == idx {
+			entry.removed = true
+			continue
+		}
+		ids = append(ids, entry)
+	}
+	this.ids = ids
+
+	for hash, pair := range this.userHash {
+		if pair.index == idx {
+			delete(this.userHash, hash)
+		}
+	}
+}
+
+func (this *TimedUserValidator) Remove(email string) bool {
+	this.access.Lock()
+	defer this.access.Unlock()
+
+	idx := this.findUser(email)
+	if idx < 0 {
+		return false
+	}
+	this.removeUser(idx)
+	return true
+}
+
+func (this *TimedUserValidator) SetExpiry(email string, expiry time.Time) bool {
+	this.access.Lock()
+	defer this.access.Unlock()
+
+	idx := this.findUser(email)
+	if idx < 0 {
+		return false
+	}
+	this.validUsers[idx].expiry = expiry
+	return true
+}
+
+func (this *TimedUserValidator) SetEnabled(email string, enabled bool) bool {
+	this.access.Lock()
+	defer this.access.Unlock()
+
+	idx := this.findUser(email)
+	if idx < 0 {
+		return false
+	}
+	this.validUsers[idx].disabled = !enabled
+	return true
+}
+
 func (this *TimedUserValidator) Get(userHash []byte) (*User, Timestamp, bool) {
 	defer this.access.RUnlock()
 	this.access.RLock()
 	var fixedSizeHash [16]byte
 	copy(fixedSizeHash[:], userHash)
 	pair, found := this.userHash[fixedSizeHash]
-	if found {
-		return this.validUsers[pair.index], pair.timeSec, true
+	if !found {
+		return nil, 0, false
+	}
+	entry := this.validUsers[pair.index]
+	if entry == nil || entry.disabled || entry.isExpired(time.Now()) {
+		return nil, 0, false
+	}
+	return entry.user, pair.timeSec, true
+}
+
+func (this *TimedUserValidator) GetByAuthID(authID []byte) (*User, Timestamp, error) {
+	if len(authID) != AuthIDLen {
+		return nil, 0, ErrorInvalidUser
+	}
+	now := time.Now()
+	nowSec := Timestamp(now.Unix())
+
+	this.access.RLock()
+	var user *User
+	var timestamp Timestamp
+	for _, entry := range this.validUsers {
+		if entry == nil {
+			continue
+		}
+		authTime, valid := openAuthID(entry.authIDCipher, authID)
+		if !valid || authTime < nowSec-AuthIDWindowSec || authTime > nowSec+AuthIDWindowSec {
+			continue
+		}
+		if !entry.disabled && !entry.isExpired(now) {
+			user, timestamp = entry.user, authTime
+		}
+		break
+	}
+	this.access.RUnlock()
+
+	if user == nil {
+		return nil, 0, ErrorInvalidUser
+	}
+	if !this.authIDs.Check(authID) {
+		return nil, 0, ErrorReplayedRequest
 	}
-	return nil, 0, false
+	return user, timestamp, nil
 }
@@ -0,0 +1,181 @@
+package protocol_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/v2ray/v2ray-core/common/protocol"
+	"github.com/v2ray/v2ray-core/common/uuid"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+func userHash(id *ID, timestamp Timestamp) []byte {
+	idHash := DefaultIDHash(id.Bytes())
+	idHash.Write(timestamp.Bytes())
+	return idHash.Sum(nil)
+}
+
+func TestUserValidatorRemove(t *testing.T) {
+	v2testing.Current(t)
+
+	validator := NewTimedUserValidator(DefaultIDHash)
+	user1 := NewUser(NewID(uuid.New()), UserLevel(0), 2, "user1@v2ray.com")
+	user2 := NewUser(NewID(uuid.New()), UserLevel(0), 2, "user2@v2ray.com")
+	assert.Error(validator.Add(user1)).IsNil()
+	assert.Error(validator.Add(user2)).IsNil()
+
+	now := Timestamp(time.Now().Unix())
+	for _, id := range append([]*ID{user1.ID}, user1.AlterIDs...) {
+		user, timestamp, found := validator.Get(userHash(id, now))
+		assert.Bool(found).IsTrue()
+		assert.StringLiteral(user.Email).Equals(user1.Email)
+		assert.Int64(int64(timestamp)).Equals(int64(now))
+	}
+
+	assert.Bool(validator.Remove(user1.Email)).IsTrue()
+	assert.Bool(validator.Remove(user1.Email)).IsFalse()
+	assert.Bool(validator.Remove("")).IsFalse()
+
+	for _, id := range append([]*ID{user1.ID}, user1.AlterIDs...) {
+		_, _, found := validator.Get(userHash(id, now))
+		assert.Bool(found).IsFalse()
+	}
+
+	user, _, found := validator.Get(userHash(user2.AlterIDs[1], now))
+	assert.Bool(found).IsTrue()
+	assert.StringLiteral(user.Email).Equals(user2.Email)
+}
+
+func TestUserValidatorExpiryAndEnabled(t *testing.T) {
+	v2testing.Current(t)
+
+	validator := NewTimedUserValidator(DefaultIDHash)
+	defer validator.Close()
+	user := NewUser(NewID(uuid.New()), UserLevel(0), 0, "user@v2ray.com")
+	assert.Error(validator.Add(user)).IsNil()
+
+	now := Timestamp(time.Now().Unix())
+	_, _, found := validator.Get(userHash(user.ID, now))
+	assert.Bool(found).IsTrue()
+
+	assert.Bool(validator.SetEnabled(user.Email, false)).IsTrue()
+	_, _, found = validator.Get(userHash(user.ID, now))
+	assert.Bool(found).IsFalse()
+
+	assert.Bool(validator.SetEnabled(user.Email, true)).IsTrue()
+	_, _, found = validator.Get(userHash(user.ID, now))
+	assert.Bool(found).IsTrue()
+
+	assert.Bool(validator.SetExpiry(user.Email, time.Now().Add(-time.Second))).IsTrue()
+	_, _, found = validator.Get(userHash(user.ID, now))
+	assert.Bool(found).IsFalse()
+
+	assert.Bool(validator.SetExpiry(user.Email, time.Time{})).IsTrue()
+	_, _, found = validator.Get(userHash(user.ID, now))
+	assert.Bool(found).IsTrue()
+
+	assert.Bool(validator.SetEnabled("nobody@v2ray.com", true)).IsFalse()
+	assert.Bool(validator.SetExpiry("nobody@v2ray.com", time.Time{})).IsFalse()
+}
+
+func TestUserValidatorReuseRemovedUser(t *testing.T) {
+	v2testing.Current(t)
+
+	validator := NewTimedUserValidator(DefaultIDHash)
+	defer validator.Close()
+	user1 := NewUser(NewID(uuid.New()), UserLevel(0), 0, "user1@v2ray.com")
+	user2 := NewUser(NewID(uuid.New()), UserLevel(0), 0, "user2@v2ray.com")
+	assert.Error(validator.Add(user1)).IsNil()
+	assert.Bool(validator.Remove(user1.Email)).IsTrue()
+	assert.Error(validator.Add(user2)).IsNil()
+
+	now := Timestamp(time.Now().Unix())
+	_, _, found := validator.Get(userHash(user1.ID, now))
+	assert.Bool(found).IsFalse()
+	user, _, found := validator.Get(userHash(user2.ID, now))
+	assert.Bool(found).IsTrue()
+	assert.StringLiteral(user.Email).Equals(user2.Email)
+}
+
+func TestUserValidatorRestart(t *testing.T) {
+	v2testing.Current(t)
+
+	validator := NewTimedUserValidator(DefaultIDHash)
+	user := NewUser(NewID(uuid.New()), UserLevel(0), 0, "user@v2ray.com")
+	assert.Error(validator.Add(user)).IsNil()
+
+	validator.Close()
+	validator.Close()
+	validator.Start()
+	defer validator.Close()
+
+	user, _, found := validator.Get(userHash(user.ID, Timestamp(time.Now().Unix())))
+	assert.Bool(found).IsTrue()
+	assert.StringLiteral(user.Email).Equals("user@v2ray.com")
+}
+
+func TestUserValidatorAuthID(t *testing.T) {
+	v2testing.Current(t)
+
+	validator := NewTimedUserValidator(DefaultIDHash)
+	defer validator.Close()
+	user1 := NewUser(NewID(uuid.New()), UserLevel(0), 2, "user1@v2ray.com")
+	user2 := NewUser(NewID(uuid.New()), UserLevel(0), 2, "user2@v2ray.com")
+	assert.Error(validator.Add(user1)).IsNil()
+	assert.Error(validator.Add(user2)).IsNil()
+
+	now := Timestamp(time.Now().Unix())
+	authID := NewAuthID(user2.ID.CmdKey(), now)
+	user, timestamp, err := validator.GetByAuthID(authID)
+	assert.Error(err).IsNil()
+	assert.StringLiteral(user.Email).Equals(user2.Email)
+	assert.Int64(int64(timestamp)).Equals(int64(now))
+
+	_, _, err = validator.GetByAuthID(authID)
+	assert.Error(err).Equals(ErrorReplayedRequest)
+
+	// Auth IDs of alter IDs, or out of the time window, are invalid.
+	_, _, err = validator.GetByAuthID(NewAuthID(user2.AlterIDs[0].CmdKey(), now))
+	assert.Error(err).Equals(ErrorInvalidUser)
+	_, _, err = validator.GetByAuthID(NewAuthID(user1.ID.CmdKey(), now-AuthIDWindowSec-10))
+	assert.Error(err).Equals(ErrorInvalidUser)
+
+	assert.Bool(validator.SetEnabled(user1.Email, false)).IsTrue()
+	_, _, err = validator.GetByAuthID(NewAuthID(user1.ID.CmdKey(), now))
+	assert.Error(err).Equals(ErrorInvalidUser)
+
+	assert.Bool(validator.Remove(user2.Email)).IsTrue()
+	_, _, err = validator.GetByAuthID(NewAuthID(user2.ID.CmdKey(), now))
+	assert.Error(err).Equals(ErrorInvalidUser)
+}
+
+func TestUserValidatorConcurrentAddRemove(t *testing.T) {
+	v2testing.Current(t)
+
+	validator := NewTimedUserValidator(DefaultIDHash)
+	defer validator.Close()
+	user := NewUser(NewID(uuid.New()), UserLevel(0), 1, "user@v2ray.com")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			validator.Remove(user.Email)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		assert.Error(validator.Add(user)).IsNil()
+	}
+	wg.Wait()
+	for validator.Remove(user.Email) {
+	}
+
+	now := Timestamp(time.Now().Unix())
+	for _, id := range append([]*ID{user.ID}, user.AlterIDs...) {
+		_, _, found := validator.Get(userHash(id, now))
+		assert.Bool(found).IsFalse()
+	}
+}
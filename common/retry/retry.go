@@ -7,12 +7,17 @@ import (
 
 var (
 	errorRetryFailed = errors.New("All retry attempts failed.")
+	ErrorCanceled    = errors.New("Retry canceled.")
 )
 
 // Strategy is a way to retry on a specific function.
 type Strategy interface {
 	// On performs a retry on a specific function, until it doesn't return any error.
 	On(func() error) error
+
+	// OnUntil performs a retry the same way as On, but gives up with ErrorCanceled once the given
+	// channel is closed.
+	OnUntil(cancel <-chan struct{}, method func() error) error
 }
 
 type retryer struct {
@@ -21,6 +26,11 @@ type retryer struct {
 
 // On implements Strategy.On.
 func (r *retryer) On(method func() error) error {
+	return r.OnUntil(nil, method)
+}
+
+// OnUntil implements Strategy.OnUntil.
+func (r *retryer) OnUntil(cancel <-chan struct{}, method func() error) error {
 	attempt := 0
 	for {
 		err := method()
@@ -31,7 +41,11 @@ func (r *retryer) On(method func() error) error {
 		if delay < 0 {
 			return errorRetryFailed
 		}
-		<-time.After(time.Duration(delay) * time.Millisecond)
+		select {
+		case <-time.After(time.Duration(delay) * time.Millisecond):
+		case <-cancel:
+			return ErrorCanceled
+		}
 		attempt++
 	}
 }
@@ -79,3 +79,25 @@ func TestRetryExhausted(t *testing.T) {
 	assert.Error(err).Equals(errorRetryFailed)
 	assert.Int64(int64(duration / time.Millisecond)).AtLeast(1900)
 }
+
+func TestRetryCanceled(t *testing.T) {
+	v2testing.Current(t)
+
+	cancel := make(chan struct{})
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		close(cancel)
+	}()
+
+	startTime := time.Now()
+	called := 0
+	err := Timed(10, 1000).OnUntil(cancel, func() error {
+		called++
+		return errorTestOnly
+	})
+	duration := time.Since(startTime)
+
+	assert.Error(err).Equals(ErrorCanceled)
+	assert.Int(called).Equals(1)
+	assert.Int64(int64(duration / time.Millisecond)).AtMost(900)
+}
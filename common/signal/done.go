@@ -0,0 +1,21 @@
+package signal
+
+// OnDone calls onDone once the given channel is closed, unless the returned function is called
+// first. The returned function must be called once onDone is no longer needed.
+func OnDone(done <-chan struct{}, onDone func()) func() {
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+			select {
+			case <-stop:
+			default:
+				onDone()
+			}
+		case <-stop:
+		}
+	}()
+	return func() {
+		close(stop)
+	}
+}
@@ -0,0 +1,43 @@
+package signal_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/v2ray/v2ray-core/common/signal"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+func TestOnDone(t *testing.T) {
+	v2testing.Current(t)
+
+	done := make(chan struct{})
+	called := make(chan bool, 1)
+	stop := OnDone(done, func() {
+		called <- true
+	})
+	defer stop()
+
+	close(done)
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("onDone is not called.")
+	}
+}
+
+func TestOnDoneStopped(t *testing.T) {
+	v2testing.Current(t)
+
+	done := make(chan struct{})
+	called := make(chan bool, 1)
+	stop := OnDone(done, func() {
+		called <- true
+	})
+	stop()
+
+	close(done)
+	time.Sleep(100 * time.Millisecond)
+	assert.Int(len(called)).Equals(0)
+}
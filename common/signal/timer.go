@@ -0,0 +1,115 @@
+// Package signal provides utilities for notifying events between goroutines.
+package signal
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ActivityTimer calls a function once there is no activity for a period of time.
+type ActivityTimer struct {
+	sync.Mutex
+	lastActivity int64 // Unix time in nanoseconds, accessed atomically.
+	onTimeout    func()
+	timeout      time.Duration
+	timer        *time.Timer
+	generation   int // Increased on each SetTimeout, so that stale timers are ignored.
+	done         bool
+}
+
+// CancelAfterInactivity returns an ActivityTimer that calls onTimeout once Update is not called for
+// the given period. Non-positive timeout means never.
+func CancelAfterInactivity(onTimeout func(), timeout time.Duration) *ActivityTimer {
+	timer := &ActivityTimer{
+		onTimeout: onTimeout,
+	}
+	timer.SetTimeout(timeout)
+	return timer
+}
+
+// Update records an activity.
+func (this *ActivityTimer) Update() {
+	atomic.StoreInt64(&this.lastActivity, time.Now().UnixNano())
+}
+
+// SetTimeout changes the period of inactivity, counting from now. Non-positive timeout means never.
+func (this *ActivityTimer) SetTimeout(timeout time.Duration) {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.done {
+		return
+	}
+	if this.timer != nil {
+		this.timer.Stop()
+		this.timer = nil
+	}
+	this.generation++
+	this.timeout = timeout
+	this.Update()
+	if timeout > 0 {
+		this.schedule(timeout)
+	}
+}
+
+// schedule checks the activity after the given delay. Caller must hold the lock.
+func (this *ActivityTimer) schedule(delay time.Duration) {
+	generation := this.generation
+	this.timer = time.AfterFunc(delay, func() {
+		this.check(generation)
+	})
+}
+
+func (this *ActivityTimer) check(generation int) {
+	this.Lock()
+	if this.done || generation != this.generation {
+		this.Unlock()
+		return
+	}
+	idle := time.Duration(time.Now().UnixNano() - atomic.LoadInt64(&this.lastActivity))
+	if idle < this.timeout {
+		this.schedule(this.timeout - idle)
+		this.Unlock()
+		return
+	}
+	this.done = true
+	this.timer = nil
+	this.Unlock()
+
+	this.onTimeout()
+}
+
+// Close stops this ActivityTimer without calling onTimeout.
+func (this *ActivityTimer) Close() {
+	this.Lock()
+	defer this.Unlock()
+
+	this.done = true
+	if this.timer != nil {
+		this.timer.Stop()
+		this.timer = nil
+	}
+}
+
+type activityReader struct {
+	reader io.Reader
+	timer  *ActivityTimer
+}
+
+// NewActivityReader returns a Reader that updates the given ActivityTimer whenever any byte is read.
+func NewActivityReader(reader io.Reader, timer *ActivityTimer) io.Reader {
+	return &activityReader{
+		reader: reader,
+		timer:  timer,
+	}
+}
+
+func (this *activityReader) Read(b []byte) (int, error) {
+	nBytes, err := this.reader.Read(b)
+	if nBytes > 0 {
+		this.timer.Update()
+	}
+	return nBytes, err
+}
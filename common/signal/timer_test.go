@@ -0,0 +1,78 @@
+package signal_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	. "github.com/v2ray/v2ray-core/common/signal"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+func TestActivityTimer(t *testing.T) {
+	v2testing.Current(t)
+
+	fired := make(chan bool, 1)
+	timer := CancelAfterInactivity(func() {
+		fired <- true
+	}, 200*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		time.Sleep(100 * time.Millisecond)
+		timer.Update()
+	}
+	assert.Int(len(fired)).Equals(0)
+
+	start := time.Now()
+	<-fired
+	assert.Bool(time.Since(start) >= 150*time.Millisecond).IsTrue()
+}
+
+func TestActivityTimerSetTimeout(t *testing.T) {
+	v2testing.Current(t)
+
+	fired := make(chan bool, 1)
+	timer := CancelAfterInactivity(func() {
+		fired <- true
+	}, 0)
+	time.Sleep(100 * time.Millisecond)
+	assert.Int(len(fired)).Equals(0)
+
+	timer.SetTimeout(50 * time.Millisecond)
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Error("Timer is not fired.")
+	}
+}
+
+func TestActivityTimerClose(t *testing.T) {
+	v2testing.Current(t)
+
+	fired := make(chan bool, 1)
+	timer := CancelAfterInactivity(func() {
+		fired <- true
+	}, 50*time.Millisecond)
+	timer.Close()
+	time.Sleep(100 * time.Millisecond)
+	assert.Int(len(fired)).Equals(0)
+}
+
+func TestActivityReader(t *testing.T) {
+	v2testing.Current(t)
+
+	fired := make(chan bool, 1)
+	timer := CancelAfterInactivity(func() {
+		fired <- true
+	}, 200*time.Millisecond)
+	defer timer.Close()
+
+	time.Sleep(150 * time.Millisecond)
+	content, err := ioutil.ReadAll(NewActivityReader(bytes.NewReader([]byte("data")), timer))
+	assert.Error(err).IsNil()
+	assert.StringLiteral(string(content)).Equals("data")
+	time.Sleep(100 * time.Millisecond)
+	assert.Int(len(fired)).Equals(0)
+}
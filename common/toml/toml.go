@@ -0,0 +1,581 @@
+// Package toml decodes TOML documents (https://toml.io) into generic values, which are
+// map[string]interface{} for tables, []interface{} for arrays, and string, int64, float64 or bool for
+// others. Dates and times are not supported.
+package toml
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SyntaxError is an error in a TOML document.
+type SyntaxError struct {
+	Line    int
+	Message string
+}
+
+func (this *SyntaxError) Error() string {
+	return "TOML line " + strconv.Itoa(this.Line) + ": " + this.Message
+}
+
+// Decode returns the root table of the given TOML document.
+func Decode(data []byte) (map[string]interface{}, error) {
+	if !utf8.Valid(data) {
+		return nil, &SyntaxError{Line: 1, Message: "Invalid UTF-8."}
+	}
+	decoder := &decoder{
+		input:   string(data),
+		line:    1,
+		root:    make(map[string]interface{}),
+		defined: make(map[uintptr]bool),
+	}
+	if err := decoder.decode(); err != nil {
+		return nil, err
+	}
+	return decoder.root, nil
+}
+
+type decoder struct {
+	input   string
+	pos     int
+	line    int
+	root    map[string]interface{}
+	current map[string]interface{} // Table of the last header.
+	defined map[uintptr]bool       // Tables defined by headers, which can't be defined again.
+}
+
+func (this *decoder) errorf(message string) error {
+	return &SyntaxError{Line: this.line, Message: message}
+}
+
+func (this *decoder) eof() bool {
+	return this.pos >= len(this.input)
+}
+
+func (this *decoder) peek() byte {
+	if this.eof() {
+		return 0
+	}
+	return this.input[this.pos]
+}
+
+func (this *decoder) hasPrefix(prefix string) bool {
+	return strings.HasPrefix(this.input[this.pos:], prefix)
+}
+
+func (this *decoder) next() byte {
+	c := this.input[this.pos]
+	this.pos++
+	if c == '\n' {
+		this.line++
+	}
+	return c
+}
+
+// skipSpaces skips spaces and tabs.
+func (this *decoder) skipSpaces() {
+	for this.peek() == ' ' || this.peek() == '\t' {
+		this.pos++
+	}
+}
+
+// skipComment skips a comment till the end of the line.
+func (this *decoder) skipComment() {
+	if this.peek() != '#' {
+		return
+	}
+	for !this.eof() && this.peek() != '\n' {
+		this.pos++
+	}
+}
+
+// skipNewLine skips a new line, and returns false if there is none.
+func (this *decoder) skipNewLine() bool {
+	if this.hasPrefix("\r\n") {
+		this.pos++
+	}
+	if this.peek() != '\n' {
+		return false
+	}
+	this.next()
+	return true
+}
+
+// skipBlank skips spaces, comments and new lines.
+func (this *decoder) skipBlank() {
+	for {
+		this.skipSpaces()
+		this.skipComment()
+		if !this.skipNewLine() {
+			return
+		}
+	}
+}
+
+// endLine expects the end of a line, after optional spaces and comment.
+func (this *decoder) endLine() error {
+	this.skipSpaces()
+	this.skipComment()
+	if !this.eof() && !this.skipNewLine() {
+		return this.errorf("Expected end of line.")
+	}
+	return nil
+}
+
+func (this *decoder) decode() error {
+	this.current = this.root
+	for {
+		this.skipBlank()
+		if this.eof() {
+			return nil
+		}
+		var err error
+		if this.hasPrefix("[[") {
+			err = this.decodeArrayTableHeader()
+		} else if this.peek() == '[' {
+			err = this.decodeTableHeader()
+		} else {
+			err = this.decodeKeyValue(this.current)
+		}
+		if err != nil {
+			return err
+		}
+		if err := this.endLine(); err != nil {
+			return err
+		}
+	}
+}
+
+func tableID(table map[string]interface{}) uintptr {
+	return reflect.ValueOf(table).Pointer()
+}
+
+func (this *decoder) decodeTableHeader() error {
+	this.pos++
+	keys, err := this.decodeKey()
+	if err != nil {
+		return err
+	}
+	if this.peek() != ']' {
+		return this.errorf("Expected ] after table name.")
+	}
+	this.pos++
+	name := strings.Join(keys, ".")
+	parent, err := this.walk(this.root, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	var table map[string]interface{}
+	switch value := parent[last].(type) {
+	case nil:
+		table = make(map[string]interface{})
+		parent[last] = table
+	case map[string]interface{}:
+		if this.defined[tableID(value)] {
+			return this.errorf("Table " + name + " is defined more than once.")
+		}
+		table = value
+	default:
+		return this.errorf("Key " + name + " is not a table.")
+	}
+	this.defined[tableID(table)] = true
+	this.current = table
+	return nil
+}
+
+func (this *decoder) decodeArrayTableHeader() error {
+	this.pos += 2
+	keys, err := this.decodeKey()
+	if err != nil {
+		return err
+	}
+	if !this.hasPrefix("]]") {
+		return this.errorf("Expected ]] after table name.")
+	}
+	this.pos += 2
+	name := strings.Join(keys, ".")
+	parent, err := this.walk(this.root, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	table := make(map[string]interface{})
+	switch value := parent[last].(type) {
+	case nil:
+		parent[last] = []interface{}{table}
+	case []interface{}:
+		if this.isInline(value) {
+			return this.errorf("Key " + name + " is not an array of tables.")
+		}
+		parent[last] = append(value, table)
+	default:
+		return this.errorf("Key " + name + " is not an array of tables.")
+	}
+	this.defined[tableID(table)] = true
+	this.current = table
+	return nil
+}
+
+// isInline returns true if the given array is an array value, instead of an array of tables.
+func (this *decoder) isInline(array []interface{}) bool {
+	if len(array) == 0 {
+		return true
+	}
+	for _, element := range array {
+		if table, ok := element.(map[string]interface{}); !ok || !this.defined[tableID(table)] {
+			return true
+		}
+	}
+	return false
+}
+
+// walk returns the table at the given path from the given table, creating tables on the way. Arrays of
+// tables on the way stand for their last tables.
+func (this *decoder) walk(table map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, key := range keys {
+		switch value := table[key].(type) {
+		case nil:
+			child := make(map[string]interface{})
+			table[key] = child
+			table = child
+		case map[string]interface{}:
+			table = value
+		case []interface{}:
+			if this.isInline(value) {
+				return nil, this.errorf("Key " + key + " is not a table.")
+			}
+			table = value[len(value)-1].(map[string]interface{})
+		default:
+			return nil, this.errorf("Key " + key + " is not a table.")
+		}
+	}
+	return table, nil
+}
+
+// decodeKey decodes a dotted key, and returns its parts.
+func (this *decoder) decodeKey() ([]string, error) {
+	var keys []string
+	for {
+		this.skipSpaces()
+		var key string
+		switch c := this.peek(); {
+		case c == '"':
+			value, err := this.decodeBasicString()
+			if err != nil {
+				return nil, err
+			}
+			key = value
+		case c == '\'':
+			value, err := this.decodeLiteralString()
+			if err != nil {
+				return nil, err
+			}
+			key = value
+		default:
+			start := this.pos
+			for !this.eof() && isBareKeyChar(this.peek()) {
+				this.pos++
+			}
+			if start == this.pos {
+				return nil, this.errorf("Expected key.")
+			}
+			key = this.input[start:this.pos]
+		}
+		keys = append(keys, key)
+		this.skipSpaces()
+		if this.peek() != '.' {
+			return keys, nil
+		}
+		this.pos++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// decodeKeyValue decodes a key-value pair into the given table.
+func (this *decoder) decodeKeyValue(table map[string]interface{}) error {
+	keys, err := this.decodeKey()
+	if err != nil {
+		return err
+	}
+	if this.peek() != '=' {
+		return this.errorf("Expected = after key.")
+	}
+	this.pos++
+	this.skipSpaces()
+	value, err := this.decodeValue()
+	if err != nil {
+		return err
+	}
+	parent, err := this.walk(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, found := parent[last]; found {
+		return this.errorf("Key " + strings.Join(keys, ".") + " is defined more than once.")
+	}
+	parent[last] = value
+	return nil
+}
+
+func (this *decoder) decodeValue() (interface{}, error) {
+	switch c := this.peek(); {
+	case this.hasPrefix(`"""`):
+		return this.decodeMultiLineString(`"""`)
+	case this.hasPrefix("'''"):
+		return this.decodeMultiLineString("'''")
+	case c == '"':
+		return this.decodeBasicString()
+	case c == '\'':
+		return this.decodeLiteralString()
+	case c == '[':
+		return this.decodeArray()
+	case c == '{':
+		return this.decodeInlineTable()
+	case this.hasPrefix("true") && !this.continuesWord(4):
+		this.pos += 4
+		return true, nil
+	case this.hasPrefix("false") && !this.continuesWord(5):
+		this.pos += 5
+		return false, nil
+	}
+	return this.decodeNumber()
+}
+
+// continuesWord returns true if the input at the given offset continues a bare word.
+func (this *decoder) continuesWord(offset int) bool {
+	return this.pos+offset < len(this.input) && isBareKeyChar(this.input[this.pos+offset])
+}
+
+func (this *decoder) decodeNumber() (interface{}, error) {
+	start := this.pos
+	for !this.eof() {
+		c := this.peek()
+		if !isBareKeyChar(c) && c != '+' && c != '.' {
+			break
+		}
+		this.pos++
+	}
+	literal := this.input[start:this.pos]
+	if len(literal) == 0 {
+		return nil, this.errorf("Expected value.")
+	}
+	switch strings.TrimLeft(literal, "+-") {
+	case "inf":
+		if literal[0] == '-' {
+			return math.Inf(-1), nil
+		}
+		return math.Inf(1), nil
+	case "nan":
+		return math.NaN(), nil
+	}
+	if strings.Contains(literal, "__") || strings.HasPrefix(literal, "_") || strings.HasSuffix(literal, "_") {
+		return nil, this.errorf("Invalid number: " + literal)
+	}
+	number := strings.Replace(literal, "_", "", -1)
+	if len(number) > 2 && number[0] == '0' {
+		base := 0
+		switch number[1] {
+		case 'x':
+			base = 16
+		case 'o':
+			base = 8
+		case 'b':
+			base = 2
+		}
+		if base > 0 {
+			value, err := strconv.ParseUint(number[2:], base, 63)
+			if err != nil {
+				return nil, this.errorf("Invalid number: " + literal)
+			}
+			return int64(value), nil
+		}
+	}
+	if strings.ContainsAny(number, ".eE") {
+		value, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return nil, this.errorf("Invalid number: " + literal)
+		}
+		return value, nil
+	}
+	digits := strings.TrimLeft(number, "+-")
+	if len(digits) > 1 && digits[0] == '0' {
+		return nil, this.errorf("Invalid number: " + literal)
+	}
+	value, err := strconv.ParseInt(number, 10, 64)
+	if err != nil {
+		return nil, this.errorf("Invalid value: " + literal)
+	}
+	return value, nil
+}
+
+func (this *decoder) decodeArray() (interface{}, error) {
+	this.pos++
+	array := make([]interface{}, 0)
+	for {
+		this.skipBlank()
+		if this.peek() == ']' {
+			this.pos++
+			return array, nil
+		}
+		value, err := this.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, value)
+		this.skipBlank()
+		switch this.peek() {
+		case ',':
+			this.pos++
+		case ']':
+		default:
+			return nil, this.errorf("Expected , or ] in array.")
+		}
+	}
+}
+
+func (this *decoder) decodeInlineTable() (interface{}, error) {
+	this.pos++
+	table := make(map[string]interface{})
+	this.skipSpaces()
+	if this.peek() == '}' {
+		this.pos++
+		return table, nil
+	}
+	for {
+		if err := this.decodeKeyValue(table); err != nil {
+			return nil, err
+		}
+		this.skipSpaces()
+		switch this.peek() {
+		case ',':
+			this.pos++
+		case '}':
+			this.pos++
+			return table, nil
+		default:
+			return nil, this.errorf("Expected , or } in inline table.")
+		}
+	}
+}
+
+func (this *decoder) decodeLiteralString() (string, error) {
+	this.pos++
+	end := strings.IndexAny(this.input[this.pos:], "'\n")
+	if end < 0 || this.input[this.pos+end] != '\'' {
+		return "", this.errorf("Unterminated string.")
+	}
+	value := this.input[this.pos : this.pos+end]
+	this.pos += end + 1
+	return value, nil
+}
+
+func (this *decoder) decodeBasicString() (string, error) {
+	this.pos++
+	var value []byte
+	for {
+		if this.eof() || this.peek() == '\n' {
+			return "", this.errorf("Unterminated string.")
+		}
+		c := this.next()
+		switch c {
+		case '"':
+			return string(value), nil
+		case '\\':
+			escaped, err := this.decodeEscape()
+			if err != nil {
+				return "", err
+			}
+			value = append(value, escaped...)
+		default:
+			value = append(value, c)
+		}
+	}
+}
+
+// decodeMultiLineString decodes a string between the given triple quotes. A new line right after the
+// opening quotes is trimmed.
+func (this *decoder) decodeMultiLineString(quotes string) (string, error) {
+	this.pos += 3
+	this.skipNewLine()
+	var value []byte
+	for {
+		if this.eof() {
+			return "", this.errorf("Unterminated string.")
+		}
+		if this.hasPrefix(quotes) {
+			// Up to 2 quotes right before the closing ones belong to the string.
+			for i := 0; i < 2 && this.pos+3 < len(this.input) && this.input[this.pos+3] == quotes[0]; i++ {
+				value = append(value, this.next())
+			}
+			this.pos += 3
+			return string(value), nil
+		}
+		c := this.next()
+		if c != '\\' || quotes == "'''" {
+			value = append(value, c)
+			continue
+		}
+		// A backslash at the end of a line trims all whitespace up to the next non-whitespace.
+		lineEnd := this.pos
+		for lineEnd < len(this.input) && (this.input[lineEnd] == ' ' || this.input[lineEnd] == '\t' || this.input[lineEnd] == '\r') {
+			lineEnd++
+		}
+		if lineEnd < len(this.input) && this.input[lineEnd] == '\n' {
+			this.pos = lineEnd
+			for !this.eof() && strings.IndexByte(" \t\r\n", this.peek()) >= 0 {
+				this.next()
+			}
+			continue
+		}
+		escaped, err := this.decodeEscape()
+		if err != nil {
+			return "", err
+		}
+		value = append(value, escaped...)
+	}
+}
+
+// decodeEscape decodes an escape sequence after the backslash.
+func (this *decoder) decodeEscape() ([]byte, error) {
+	if this.eof() {
+		return nil, this.errorf("Unterminated string.")
+	}
+	switch c := this.next(); c {
+	case 'b':
+		return []byte{'\b'}, nil
+	case 't':
+		return []byte{'\t'}, nil
+	case 'n':
+		return []byte{'\n'}, nil
+	case 'f':
+		return []byte{'\f'}, nil
+	case 'r':
+		return []byte{'\r'}, nil
+	case '"', '\\':
+		return []byte{c}, nil
+	case 'u', 'U':
+		length := 4
+		if c == 'U' {
+			length = 8
+		}
+		if this.pos+length > len(this.input) {
+			return nil, this.errorf("Invalid escape sequence.")
+		}
+		code, err := strconv.ParseUint(this.input[this.pos:this.pos+length], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return nil, this.errorf("Invalid escape sequence.")
+		}
+		this.pos += length
+		buffer := make([]byte, utf8.UTFMax)
+		return buffer[:utf8.EncodeRune(buffer, rune(code))], nil
+	}
+	return nil, this.errorf("Invalid escape sequence.")
+}
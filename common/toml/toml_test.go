@@ -0,0 +1,115 @@
+package toml_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/v2ray/v2ray-core/common/toml"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+func decodeToJson(document string) string {
+	value, err := Decode([]byte(document))
+	assert.Error(err).IsNil()
+	data, err := json.Marshal(value)
+	assert.Error(err).IsNil()
+	return string(data)
+}
+
+func TestDecodeValues(t *testing.T) {
+	v2testing.Current(t)
+
+	document := `
+# Comment
+port = 1080 # Comment after value.
+hex = 0xff
+negative = -1_000
+ratio = 0.5
+exp = 1e3
+enabled = true
+disabled = false
+name = "v2ray \"core\" \u00e9"
+path = 'C:\temp'
+"quoted key" = 1
+dotted.key = "value"
+list = [
+  1, 2,
+  3, # Comment in array.
+]
+nested = [[1], ["a", 'b']]
+inline = { a = 1, b.c = "d" }
+multi = """
+line 1
+line 2\
+    continued"""
+literal = '''
+raw \n'''
+`
+	assert.StringLiteral(decodeToJson(document)).Equals(`{"disabled":false,"dotted":{"key":"value"},"enabled":true,"exp":1000,"hex":255,` +
+		`"inline":{"a":1,"b":{"c":"d"}},"list":[1,2,3],"literal":"raw \\n","multi":"line 1\nline 2continued",` +
+		`"name":"v2ray \"core\" é","negative":-1000,"nested":[[1],["a","b"]],"path":"C:\\temp","port":1080,"quoted key":1,"ratio":0.5}`)
+}
+
+func TestDecodeTables(t *testing.T) {
+	v2testing.Current(t)
+
+	document := `
+port = 1080
+
+[inbound]
+protocol = "socks"
+
+[inbound.settings]
+auth = "noauth"
+
+[[outboundDetour]]
+protocol = "freedom"
+tag = "direct"
+
+[[outboundDetour]]
+protocol = "vmess"
+tag = "proxy"
+
+[outboundDetour.settings]
+level = 1
+
+[[outboundDetour.settings.vnext]]
+address = "127.0.0.1"
+
+[routing.settings]
+rules = [{ type = "field", outboundTag = "direct" }]
+`
+	assert.StringLiteral(decodeToJson(document)).Equals(`{"inbound":{"protocol":"socks","settings":{"auth":"noauth"}},` +
+		`"outboundDetour":[{"protocol":"freedom","tag":"direct"},{"protocol":"vmess","settings":{"level":1,"vnext":[{"address":"127.0.0.1"}]},"tag":"proxy"}],` +
+		`"port":1080,"routing":{"settings":{"rules":[{"outboundTag":"direct","type":"field"}]}}}`)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	v2testing.Current(t)
+
+	for _, document := range []string{
+		`a = `,
+		`a = 1 b = 2`,
+		`a = "unterminated`,
+		"a = 'multi\nline'",
+		`a = 1979-05-27`,
+		`a = 007`,
+		`a = 1__0`,
+		`a = "\x"`,
+		"a = 1\na = 2",
+		"[a]\n[a]",
+		"a = 1\n[a]",
+		"a = []\n[[a]]",
+		"[[a]]\n[a]",
+		`[a`,
+		`a = [1 2]`,
+		`a = {b = 1`,
+	} {
+		_, err := Decode([]byte(document))
+		assert.Error(err).IsNotNil()
+	}
+
+	_, err := Decode([]byte("a = 1\n\nb = ]"))
+	assert.StringLiteral(err.Error()).Equals("TOML line 3: Expected value.")
+}
@@ -31,6 +31,9 @@ func (this *BlackHole) Dispatch(firstPacket v2net.Packet, ray ray.OutboundRay) e
 	return nil
 }
 
+func (this *BlackHole) Close() {
+}
+
 func init() {
 	internal.MustRegisterOutboundHandlerCreator("blackhole",
 		func(space app.Space, config interface{}) (proxy.OutboundHandler, error) {
@@ -0,0 +1,17 @@
+package blackhole
+
+import (
+	"github.com/v2ray/v2ray-core/common/loader"
+)
+
+// ConfigMessage is the typed schema of Config.
+type ConfigMessage struct {
+}
+
+func (this *ConfigMessage) Build() (interface{}, error) {
+	return new(Config), nil
+}
+
+func init() {
+	loader.MustRegisterType("v2ray.core.proxy.blackhole.Config", (*ConfigMessage)(nil))
+}
@@ -0,0 +1,14 @@
+package dns
+
+import (
+	v2net "github.com/v2ray/v2ray-core/common/net"
+)
+
+const (
+	DefaultTTL = 60
+)
+
+type Config struct {
+	Network *v2net.NetworkList // Networks to serve DNS on, for inbound only.
+	TTL     uint32             // TTL of answers in seconds.
+}
@@ -0,0 +1,37 @@
+// +build json
+
+package dns
+
+import (
+	"encoding/json"
+
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	"github.com/v2ray/v2ray-core/proxy/internal/config"
+)
+
+func parseConfig(data []byte) (interface{}, error) {
+	type JsonConfig struct {
+		Network *v2net.NetworkList `json:"network"`
+		TTL     *uint32            `json:"ttl"`
+	}
+	jsonConfig := new(JsonConfig)
+	if err := json.Unmarshal(data, jsonConfig); err != nil {
+		return nil, err
+	}
+	result := &Config{
+		Network: jsonConfig.Network,
+		TTL:     DefaultTTL,
+	}
+	if result.Network == nil {
+		result.Network = &v2net.NetworkList{v2net.TCPNetwork, v2net.UDPNetwork}
+	}
+	if jsonConfig.TTL != nil {
+		result.TTL = *jsonConfig.TTL
+	}
+	return result, nil
+}
+
+func init() {
+	config.RegisterInboundConfig("dns", parseConfig)
+	config.RegisterOutboundConfig("dns", parseConfig)
+}
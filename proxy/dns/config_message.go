@@ -0,0 +1,34 @@
+package dns
+
+import (
+	"github.com/v2ray/v2ray-core/common/loader"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+)
+
+// ConfigMessage is the typed schema of Config, for both inbound and outbound.
+type ConfigMessage struct {
+	Network []string `protobuf:"bytes,1,rep,name=network"` // Both TCP and UDP if empty.
+	Ttl     uint32   `protobuf:"varint,2,opt,name=ttl"`    // DefaultTTL if 0.
+}
+
+func (this *ConfigMessage) Build() (interface{}, error) {
+	config := &Config{
+		Network: &v2net.NetworkList{v2net.TCPNetwork, v2net.UDPNetwork},
+		TTL:     this.Ttl,
+	}
+	if len(this.Network) > 0 {
+		networks := make(v2net.NetworkList, len(this.Network))
+		for idx, network := range this.Network {
+			networks[idx] = v2net.Network(network)
+		}
+		config.Network = &networks
+	}
+	if config.TTL == 0 {
+		config.TTL = DefaultTTL
+	}
+	return config, nil
+}
+
+func init() {
+	loader.MustRegisterType("v2ray.core.proxy.dns.Config", (*ConfigMessage)(nil))
+}
@@ -0,0 +1,201 @@
+package dns_test
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	appdns "github.com/v2ray/v2ray-core/app/dns"
+	"github.com/v2ray/v2ray-core/common/alloc"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	v2nettesting "github.com/v2ray/v2ray-core/common/net/testing"
+	. "github.com/v2ray/v2ray-core/proxy/dns"
+	proxyrepo "github.com/v2ray/v2ray-core/proxy/repo"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+	"github.com/v2ray/v2ray-core/transport/ray"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func newResolver() appdns.Server {
+	return appdns.NewCacheServer(nil, &appdns.Config{
+		NameServers: []*appdns.NameServerConfig{{
+			Address: v2net.UDPDestination(v2net.IPAddress([]byte{127, 0, 0, 1}), v2nettesting.PickPort()),
+		}},
+		Hosts: map[string]net.IP{
+			"v2ray.com": net.IP([]byte{1, 2, 3, 4}),
+		},
+		Timeout: 100 * time.Millisecond,
+	})
+}
+
+func newQuery(id uint16, domain string, recordType dnsmessage.Type) []byte {
+	message := &dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               id,
+			RecursionDesired: true,
+		},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(domain + "."),
+			Type:  recordType,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	packed, err := message.Pack()
+	assert.Error(err).IsNil()
+	return packed
+}
+
+func parseResponse(data []byte) *dnsmessage.Message {
+	message := new(dnsmessage.Message)
+	assert.Error(message.Unpack(data)).IsNil()
+	assert.Bool(message.Header.Response).IsTrue()
+	return message
+}
+
+func assertAnswer(message *dnsmessage.Message, id uint16, ip []byte, ttl uint32) {
+	assert.Int(int(message.Header.ID)).Equals(int(id))
+	assert.Int(int(message.Header.RCode)).Equals(int(dnsmessage.RCodeSuccess))
+	assert.Int(len(message.Answers)).Equals(1)
+	assert.Int(int(message.Answers[0].Header.TTL)).Equals(int(ttl))
+	assert.Bytes(message.Answers[0].Body.(*dnsmessage.AResource).A[:]).Equals(ip)
+}
+
+func TestInboundAnswersUDPAndTCP(t *testing.T) {
+	v2testing.Current(t)
+
+	port := v2nettesting.PickPort()
+	server := NewServer(&Config{
+		Network: &v2net.NetworkList{v2net.TCPNetwork, v2net.UDPNetwork},
+		TTL:     30,
+	}, newResolver())
+	assert.Error(server.Listen(port)).IsNil()
+	defer server.Close()
+
+	udpConn, err := net.Dial("udp", "127.0.0.1:"+port.String())
+	assert.Error(err).IsNil()
+	defer udpConn.Close()
+	udpConn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	_, err = udpConn.Write(newQuery(1, "v2ray.com", dnsmessage.TypeA))
+	assert.Error(err).IsNil()
+	buffer := make([]byte, 2048)
+	nBytes, err := udpConn.Read(buffer)
+	assert.Error(err).IsNil()
+	assertAnswer(parseResponse(buffer[:nBytes]), 1, []byte{1, 2, 3, 4}, 30)
+
+	// No AAAA record for the host, but the query is still answered.
+	_, err = udpConn.Write(newQuery(2, "v2ray.com", dnsmessage.TypeAAAA))
+	assert.Error(err).IsNil()
+	nBytes, err = udpConn.Read(buffer)
+	assert.Error(err).IsNil()
+	response := parseResponse(buffer[:nBytes])
+	assert.Int(int(response.Header.ID)).Equals(2)
+	assert.Int(len(response.Answers)).Equals(0)
+
+	tcpConn, err := net.Dial("tcp", "127.0.0.1:"+port.String())
+	assert.Error(err).IsNil()
+	defer tcpConn.Close()
+	tcpConn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	for _, id := range []uint16{3, 4} {
+		query := newQuery(id, "V2Ray.com", dnsmessage.TypeA)
+		_, err = tcpConn.Write(append([]byte{byte(len(query) >> 8), byte(len(query))}, query...))
+		assert.Error(err).IsNil()
+
+		var length uint16
+		assert.Error(binary.Read(tcpConn, binary.BigEndian, &length)).IsNil()
+		message := make([]byte, length)
+		_, err = io.ReadFull(tcpConn, message)
+		assert.Error(err).IsNil()
+		assertAnswer(parseResponse(message), id, []byte{1, 2, 3, 4}, 30)
+	}
+}
+
+func TestInboundFailsUnresolvedDomain(t *testing.T) {
+	v2testing.Current(t)
+
+	port := v2nettesting.PickPort()
+	server := NewServer(&Config{
+		Network: &v2net.NetworkList{v2net.UDPNetwork},
+		TTL:     DefaultTTL,
+	}, newResolver())
+	assert.Error(server.Listen(port)).IsNil()
+	defer server.Close()
+
+	udpConn, err := net.Dial("udp", "127.0.0.1:"+port.String())
+	assert.Error(err).IsNil()
+	defer udpConn.Close()
+	udpConn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	_, err = udpConn.Write(newQuery(5, "unknown.v2ray.com", dnsmessage.TypeA))
+	assert.Error(err).IsNil()
+	buffer := make([]byte, 2048)
+	nBytes, err := udpConn.Read(buffer)
+	assert.Error(err).IsNil()
+	response := parseResponse(buffer[:nBytes])
+	assert.Int(int(response.Header.RCode)).Equals(int(dnsmessage.RCodeServerFailure))
+}
+
+func TestOutboundInterceptsUDP(t *testing.T) {
+	v2testing.Current(t)
+
+	interceptor := NewInterceptor(&Config{TTL: 10}, newResolver())
+	traffic := ray.NewRay()
+	dest := v2net.UDPDestination(v2net.IPAddress([]byte{8, 8, 8, 8}), 53)
+	payload := alloc.NewBuffer().Clear().Append(newQuery(6, "v2ray.com", dnsmessage.TypeA))
+
+	go interceptor.Dispatch(v2net.NewPacket(dest, payload, true), traffic)
+
+	chunk := <-traffic.InboundOutput()
+	assertAnswer(parseResponse(chunk.Value), 6, []byte{1, 2, 3, 4}, 10)
+	chunk.Release()
+
+	traffic.InboundInput() <- alloc.NewBuffer().Clear().Append(newQuery(7, "v2ray.com", dnsmessage.TypeA))
+	chunk = <-traffic.InboundOutput()
+	assertAnswer(parseResponse(chunk.Value), 7, []byte{1, 2, 3, 4}, 10)
+	chunk.Release()
+
+	close(traffic.InboundInput())
+	_, open := <-traffic.InboundOutput()
+	assert.Bool(open).IsFalse()
+}
+
+func TestOutboundInterceptsTCP(t *testing.T) {
+	v2testing.Current(t)
+
+	interceptor := NewInterceptor(&Config{TTL: 10}, newResolver())
+	traffic := ray.NewRay()
+	dest := v2net.TCPDestination(v2net.IPAddress([]byte{8, 8, 8, 8}), 53)
+	query := newQuery(8, "v2ray.com", dnsmessage.TypeA)
+	framed := append([]byte{byte(len(query) >> 8), byte(len(query))}, query...)
+
+	// The query is split across chunks.
+	go interceptor.Dispatch(v2net.NewPacket(dest, alloc.NewBuffer().Clear().Append(framed[:5]), true), traffic)
+	traffic.InboundInput() <- alloc.NewBuffer().Clear().Append(framed[5:])
+	close(traffic.InboundInput())
+
+	chunk := <-traffic.InboundOutput()
+	defer chunk.Release()
+	assert.Int(int(chunk.Value[0])<<8 | int(chunk.Value[1])).Equals(len(chunk.Value) - 2)
+	assertAnswer(parseResponse(chunk.Value[2:]), 8, []byte{1, 2, 3, 4}, 10)
+
+	_, open := <-traffic.InboundOutput()
+	assert.Bool(open).IsFalse()
+}
+
+func TestHandlersWithoutSettings(t *testing.T) {
+	v2testing.Current(t)
+
+	inbound, err := proxyrepo.CreateInboundHandler("dns", nil, nil)
+	assert.Error(err).IsNil()
+	port := v2nettesting.PickPort()
+	assert.Error(inbound.Listen(port)).IsNil()
+	inbound.Close()
+
+	outbound, err := proxyrepo.CreateOutboundHandler("dns", nil, nil)
+	assert.Error(err).IsNil()
+	outbound.Close()
+}
@@ -0,0 +1,55 @@
+package dns
+
+import (
+	"net"
+
+	"github.com/v2ray/v2ray-core/app"
+	appdns "github.com/v2ray/v2ray-core/app/dns"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	"github.com/v2ray/v2ray-core/proxy"
+	"github.com/v2ray/v2ray-core/proxy/internal"
+)
+
+// fakeServer resolves domains into fake IPs.
+type fakeServer struct {
+	server appdns.FakeIPServer
+}
+
+func (this *fakeServer) Get(domain string) []net.IP {
+	return this.server.GetFake(domain)
+}
+
+// getServer returns the DNS server in the given space, which hands out fake IPs if enabled, or one using
+// the system resolver if there is none.
+func getServer(space app.Space) appdns.Server {
+	if server := appdns.GetFakeIPServer(space); server != nil {
+		return &fakeServer{server: server}
+	}
+	if server := appdns.GetServer(space); server != nil {
+		return server
+	}
+	return appdns.NewCacheServer(space, &appdns.Config{})
+}
+
+// getConfig returns the given config, or the default one if there is none.
+func getConfig(rawConfig interface{}) *Config {
+	if config, ok := rawConfig.(*Config); ok && config != nil {
+		return config
+	}
+	return &Config{
+		Network: &v2net.NetworkList{v2net.TCPNetwork, v2net.UDPNetwork},
+		TTL:     DefaultTTL,
+	}
+}
+
+func init() {
+	internal.MustRegisterInboundHandlerCreator("dns",
+		func(space app.Space, rawConfig interface{}) (proxy.InboundHandler, error) {
+			return NewServer(getConfig(rawConfig), getServer(space)), nil
+		})
+
+	internal.MustRegisterOutboundHandlerCreator("dns",
+		func(space app.Space, rawConfig interface{}) (proxy.OutboundHandler, error) {
+			return NewInterceptor(getConfig(rawConfig), getServer(space)), nil
+		})
+}
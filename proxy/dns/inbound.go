@@ -0,0 +1,127 @@
+package dns
+
+import (
+	"sync"
+	"time"
+
+	appdns "github.com/v2ray/v2ray-core/app/dns"
+	"github.com/v2ray/v2ray-core/common/alloc"
+	"github.com/v2ray/v2ray-core/common/log"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	"github.com/v2ray/v2ray-core/proxy"
+	"github.com/v2ray/v2ray-core/transport/hub"
+)
+
+const (
+	tcpIdleTimeout = 30 * time.Second
+)
+
+// Server answers DNS queries from clients over UDP and TCP, with IPs from the DNS app.
+type Server struct {
+	sync.RWMutex
+	config        *Config
+	dns           appdns.Server
+	accepting     bool
+	tcpListener   *hub.TCPHub
+	udpHub        *hub.UDPHub
+	listeningPort v2net.Port
+}
+
+func NewServer(config *Config, dns appdns.Server) *Server {
+	return &Server{
+		config: config,
+		dns:    dns,
+	}
+}
+
+func (this *Server) Port() v2net.Port {
+	return this.listeningPort
+}
+
+func (this *Server) Close() {
+	this.Lock()
+	defer this.Unlock()
+
+	this.accepting = false
+	if this.tcpListener != nil {
+		this.tcpListener.Close()
+		this.tcpListener = nil
+	}
+	if this.udpHub != nil {
+		this.udpHub.Close()
+		this.udpHub = nil
+	}
+}
+
+func (this *Server) Listen(port v2net.Port) error {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.accepting {
+		if this.listeningPort == port {
+			return nil
+		} else {
+			return proxy.ErrorAlreadyListening
+		}
+	}
+
+	if this.config.Network.HasNetwork(v2net.TCPNetwork) {
+		tcpListener, err := hub.ListenTCP(port, this.handleTCPConnection)
+		if err != nil {
+			log.Error("DNS: Failed to listen on TCP port ", port, ": ", err)
+			return err
+		}
+		this.tcpListener = tcpListener
+	}
+	if this.config.Network.HasNetwork(v2net.UDPNetwork) {
+		udpHub, err := hub.ListenUDP(port, this.handleUDPPayload)
+		if err != nil {
+			log.Error("DNS: Failed to listen on UDP port ", port, ": ", err)
+			if this.tcpListener != nil {
+				this.tcpListener.Close()
+				this.tcpListener = nil
+			}
+			return err
+		}
+		this.udpHub = udpHub
+	}
+	this.listeningPort = port
+	this.accepting = true
+	return nil
+}
+
+func (this *Server) handleUDPPayload(payload *alloc.Buffer, source v2net.Destination) {
+	defer payload.Release()
+
+	response, err := answer(this.dns, payload.Value, this.config.TTL)
+	if err != nil {
+		log.Warning("DNS: Invalid query from ", source, ": ", err)
+		return
+	}
+
+	this.RLock()
+	defer this.RUnlock()
+	if this.udpHub != nil {
+		this.udpHub.WriteTo(response, source)
+	}
+}
+
+func (this *Server) handleTCPConnection(conn *hub.TCPConn) {
+	defer conn.Close()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(tcpIdleTimeout))
+		query, err := readStreamMessage(conn)
+		if err != nil {
+			return
+		}
+		response, err := answer(this.dns, query, this.config.TTL)
+		if err != nil {
+			log.Warning("DNS: Invalid query from ", conn.RemoteAddr(), ": ", err)
+			return
+		}
+		if _, err := conn.Write(streamMessage(response)); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	appdns "github.com/v2ray/v2ray-core/app/dns"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var (
+	ErrorInvalidQuery = errors.New("Invalid DNS query.")
+)
+
+// answer returns the response to the given DNS query, with IPs from the given server. Only A and AAAA
+// questions are answered, while others get empty responses.
+func answer(server appdns.Server, data []byte, ttl uint32) ([]byte, error) {
+	query := new(dnsmessage.Message)
+	if err := query.Unpack(data); err != nil {
+		return nil, err
+	}
+	if query.Header.Response {
+		return nil, ErrorInvalidQuery
+	}
+
+	response := &dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 query.Header.ID,
+			Response:           true,
+			OpCode:             query.Header.OpCode,
+			RecursionDesired:   query.Header.RecursionDesired,
+			RecursionAvailable: true,
+		},
+		Questions: query.Questions,
+	}
+	if query.Header.OpCode != 0 || len(query.Questions) != 1 {
+		response.Header.RCode = dnsmessage.RCodeNotImplemented
+		return response.Pack()
+	}
+
+	question := query.Questions[0]
+	if question.Class != dnsmessage.ClassINET || (question.Type != dnsmessage.TypeA && question.Type != dnsmessage.TypeAAAA) {
+		return response.Pack()
+	}
+	ips := server.Get(strings.TrimSuffix(question.Name.String(), "."))
+	if len(ips) == 0 {
+		response.Header.RCode = dnsmessage.RCodeServerFailure
+		return response.Pack()
+	}
+	header := dnsmessage.ResourceHeader{
+		Name:  question.Name,
+		Type:  question.Type,
+		Class: dnsmessage.ClassINET,
+		TTL:   ttl,
+	}
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil && question.Type == dnsmessage.TypeA {
+			resource := new(dnsmessage.AResource)
+			copy(resource.A[:], ip4)
+			response.Answers = append(response.Answers, dnsmessage.Resource{Header: header, Body: resource})
+		} else if ip4 == nil && len(ip) == net.IPv6len && question.Type == dnsmessage.TypeAAAA {
+			resource := new(dnsmessage.AAAAResource)
+			copy(resource.AAAA[:], ip)
+			response.Answers = append(response.Answers, dnsmessage.Resource{Header: header, Body: resource})
+		}
+	}
+	return response.Pack()
+}
+
+// readStreamMessage reads a length-prefixed DNS message from a TCP stream.
+func readStreamMessage(reader io.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(reader, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// streamMessage returns the given DNS message prefixed by its length, to be sent in a TCP stream.
+func streamMessage(message []byte) []byte {
+	return append([]byte{byte(len(message) >> 8), byte(len(message))}, message...)
+}
@@ -0,0 +1,152 @@
+package dns
+
+import (
+	"io"
+	"time"
+
+	appdns "github.com/v2ray/v2ray-core/app/dns"
+	"github.com/v2ray/v2ray-core/common/alloc"
+	"github.com/v2ray/v2ray-core/common/log"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	"github.com/v2ray/v2ray-core/transport/ray"
+)
+
+const (
+	udpIdleTimeout = 16 * time.Second
+)
+
+// Interceptor answers DNS queries sent to it with IPs from the DNS app, instead of forwarding them to
+// their destinations.
+type Interceptor struct {
+	config *Config
+	dns    appdns.Server
+}
+
+func NewInterceptor(config *Config, dns appdns.Server) *Interceptor {
+	return &Interceptor{
+		config: config,
+		dns:    dns,
+	}
+}
+
+func (this *Interceptor) Dispatch(firstPacket v2net.Packet, ray ray.OutboundRay) error {
+	defer close(ray.OutboundOutput())
+
+	reader := &chunkReader{
+		current: firstPacket.Chunk(),
+		done:    ray.Done(),
+	}
+	if firstPacket.MoreChunks() {
+		reader.input = ray.OutboundInput()
+	}
+	defer reader.Release()
+
+	if firstPacket.Destination().IsUDP() {
+		// Each chunk is a query on its own.
+		reader.timeout = udpIdleTimeout
+		for {
+			chunk, err := reader.nextChunk()
+			if err != nil {
+				return nil
+			}
+			response, err := answer(this.dns, chunk.Value, this.config.TTL)
+			chunk.Release()
+			if err != nil {
+				log.Warning("DNS: Invalid query to ", firstPacket.Destination(), ": ", err)
+				continue
+			}
+			if !this.send(ray, response) {
+				return nil
+			}
+		}
+	}
+
+	reader.timeout = tcpIdleTimeout
+	for {
+		query, err := readStreamMessage(reader)
+		if err != nil {
+			return nil
+		}
+		response, err := answer(this.dns, query, this.config.TTL)
+		if err != nil {
+			log.Warning("DNS: Invalid query to ", firstPacket.Destination(), ": ", err)
+			return err
+		}
+		if !this.send(ray, streamMessage(response)) {
+			return nil
+		}
+	}
+}
+
+// send writes the given response into the output of the ray, and returns false if the ray is canceled.
+func (this *Interceptor) send(ray ray.OutboundRay, response []byte) bool {
+	select {
+	case ray.OutboundOutput() <- alloc.NewBuffer().Clear().Append(response):
+		return true
+	case <-ray.Done():
+		return false
+	}
+}
+
+// Close does nothing, as queries are answered without connections.
+func (this *Interceptor) Close() {
+}
+
+// chunkReader reads chunks from the input of a ray, after the chunk of the first packet. It returns
+// io.EOF on timeout or cancellation, as well as at the end of the input.
+type chunkReader struct {
+	current *alloc.Buffer
+	input   <-chan *alloc.Buffer
+	done    <-chan struct{}
+	timeout time.Duration
+}
+
+// nextChunk returns the next non-empty chunk, which the caller releases.
+func (this *chunkReader) nextChunk() (*alloc.Buffer, error) {
+	for this.current == nil || this.current.IsEmpty() {
+		if this.current != nil {
+			this.current.Release()
+			this.current = nil
+		}
+		if this.input == nil {
+			return nil, io.EOF
+		}
+		timer := time.NewTimer(this.timeout)
+		select {
+		case chunk, open := <-this.input:
+			timer.Stop()
+			if !open {
+				return nil, io.EOF
+			}
+			this.current = chunk
+		case <-timer.C:
+			return nil, io.EOF
+		case <-this.done:
+			timer.Stop()
+			return nil, io.EOF
+		}
+	}
+	chunk := this.current
+	this.current = nil
+	return chunk, nil
+}
+
+func (this *chunkReader) Read(b []byte) (int, error) {
+	if this.current == nil || this.current.IsEmpty() {
+		chunk, err := this.nextChunk()
+		if err != nil {
+			return 0, err
+		}
+		this.current = chunk
+	}
+	n := copy(b, this.current.Value)
+	this.current.SliceFrom(n)
+	return n, nil
+}
+
+func (this *chunkReader) Release() {
+	if this.current != nil {
+		this.current.Release()
+		this.current = nil
+	}
+}
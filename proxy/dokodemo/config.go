@@ -2,11 +2,13 @@ package dokodemo
 
 import (
 	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
 )
 
 type Config struct {
 	Address v2net.Address
 	Port    v2net.Port
 	Network *v2net.NetworkList
-	Timeout int
+	Timeout int             // Seconds of read timeout, or 0 for none.
+	Level   proto.UserLevel // User level of all connections, which decides their policy.
 }
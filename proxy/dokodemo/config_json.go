@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 
 	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
 	"github.com/v2ray/v2ray-core/proxy/internal/config"
 )
 
@@ -17,6 +18,7 @@ func init() {
 				PortValue    v2net.Port         `json:"port"`
 				NetworkList  *v2net.NetworkList `json:"network"`
 				TimeoutValue int                `json:"timeout"`
+				Level        byte               `json:"level"`
 			}
 			rawConfig := new(DokodemoConfig)
 			if err := json.Unmarshal(data, rawConfig); err != nil {
@@ -27,6 +29,7 @@ func init() {
 				Port:    rawConfig.PortValue,
 				Network: rawConfig.NetworkList,
 				Timeout: rawConfig.TimeoutValue,
+				Level:   proto.UserLevel(rawConfig.Level),
 			}, nil
 		})
 }
@@ -0,0 +1,38 @@
+package dokodemo
+
+import (
+	"github.com/v2ray/v2ray-core/common/loader"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+	"github.com/v2ray/v2ray-core/proxy/internal"
+)
+
+// ConfigMessage is the typed schema of Config.
+type ConfigMessage struct {
+	Address string   `protobuf:"bytes,1,opt,name=address"`
+	Port    uint32   `protobuf:"varint,2,opt,name=port"`
+	Network []string `protobuf:"bytes,3,rep,name=network"`
+	Timeout uint32   `protobuf:"varint,4,opt,name=timeout"` // Seconds.
+	Level   uint32   `protobuf:"varint,5,opt,name=level"`
+}
+
+func (this *ConfigMessage) Build() (interface{}, error) {
+	if len(this.Address) == 0 || this.Port > 65535 || this.Level > 255 {
+		return nil, internal.ErrorBadConfiguration
+	}
+	networks := make(v2net.NetworkList, len(this.Network))
+	for idx, network := range this.Network {
+		networks[idx] = v2net.Network(network)
+	}
+	return &Config{
+		Address: v2net.ParseAddress(this.Address),
+		Port:    v2net.Port(this.Port),
+		Network: &networks,
+		Timeout: int(this.Timeout),
+		Level:   proto.UserLevel(this.Level),
+	}, nil
+}
+
+func init() {
+	loader.MustRegisterType("v2ray.core.proxy.dokodemo.Config", (*ConfigMessage)(nil))
+}
@@ -9,6 +9,7 @@ import (
 	v2io "github.com/v2ray/v2ray-core/common/io"
 	"github.com/v2ray/v2ray-core/common/log"
 	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
 	"github.com/v2ray/v2ray-core/proxy"
 	"github.com/v2ray/v2ray-core/transport/hub"
 )
@@ -54,6 +55,9 @@ func (this *DokodemoDoor) Close() {
 		this.udpHub = nil
 		this.udpMutex.Unlock()
 	}
+	if this.udpServer != nil {
+		this.udpServer.Close()
+	}
 }
 
 func (this *DokodemoDoor) Listen(port v2net.Port) error {
@@ -125,7 +129,11 @@ func (this *DokodemoDoor) HandleTCPConnection(conn *hub.TCPConn) {
 	defer conn.Close()
 
 	packet := v2net.NewPacket(v2net.TCPDestination(this.address, this.port), nil, true)
-	ray := this.packetDispatcher.DispatchToOutbound(packet)
+	user := &proto.User{
+		Level: this.config.Level,
+	}
+	ray := dispatcher.DispatchToOutboundForUser(this.packetDispatcher, conn.RemoteAddr(), user, packet)
+	defer ray.Cancel()
 
 	var inputFinish, outputFinish sync.Mutex
 	inputFinish.Lock()
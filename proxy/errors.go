@@ -8,4 +8,6 @@ var (
 	ErrorInvalidAuthentication  = errors.New("Invalid authentication.")
 	ErrorInvalidProtocolVersion = errors.New("Invalid protocol version.")
 	ErrorAlreadyListening       = errors.New("Already listening on another port.")
+	ErrorUserNotFound           = errors.New("User not found.")
+	ErrorClosed                 = errors.New("Handler closed.")
 )
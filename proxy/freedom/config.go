@@ -1,4 +1,50 @@
 package freedom
 
+import (
+	"errors"
+
+	v2net "github.com/v2ray/v2ray-core/common/net"
+)
+
+var (
+	ErrorInvalidDomainStrategy = errors.New("Invalid domain strategy.")
+	ErrorInvalidRedirect       = errors.New("Invalid redirect.")
+)
+
+// DomainStrategy is how domains of destinations are resolved.
+type DomainStrategy int
+
+const (
+	// DomainStrategyAsIs resolves domains with the DNS app if present, or the system resolver otherwise.
+	DomainStrategyAsIs = DomainStrategy(0)
+	// DomainStrategyUseIP resolves domains into both IPv4 and IPv6 addresses, with the DNS app if present.
+	DomainStrategyUseIP = DomainStrategy(1)
+	// DomainStrategyUseIPv4 resolves domains into IPv4 addresses only.
+	DomainStrategyUseIPv4 = DomainStrategy(2)
+	// DomainStrategyUseIPv6 resolves domains into IPv6 addresses only.
+	DomainStrategyUseIPv6 = DomainStrategy(3)
+)
+
 type Config struct {
+	DomainStrategy  DomainStrategy
+	RedirectAddress v2net.Address // Address to connect to instead of the destination, or nil.
+	RedirectPort    v2net.Port    // Port to connect to instead of the destination, or 0.
+}
+
+// redirect returns the destination to connect to for the given destination.
+func (this *Config) redirect(dest v2net.Destination) v2net.Destination {
+	if this.RedirectAddress == nil && this.RedirectPort == 0 {
+		return dest
+	}
+	address, port := dest.Address(), dest.Port()
+	if this.RedirectAddress != nil {
+		address = this.RedirectAddress
+	}
+	if this.RedirectPort != 0 {
+		port = this.RedirectPort
+	}
+	if dest.IsUDP() {
+		return v2net.UDPDestination(address, port)
+	}
+	return v2net.TCPDestination(address, port)
 }
@@ -3,12 +3,72 @@
 package freedom
 
 import (
+	"encoding/json"
+	"net"
+	"strings"
+
+	"github.com/v2ray/v2ray-core/common/log"
+	v2net "github.com/v2ray/v2ray-core/common/net"
 	"github.com/v2ray/v2ray-core/proxy/internal/config"
 )
 
+func (this *DomainStrategy) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	switch strings.ToLower(name) {
+	case "", "asis":
+		*this = DomainStrategyAsIs
+	case "useip":
+		*this = DomainStrategyUseIP
+	case "useipv4":
+		*this = DomainStrategyUseIPv4
+	case "useipv6":
+		*this = DomainStrategyUseIPv6
+	default:
+		log.Error("Freedom: Invalid domain strategy: ", name)
+		return ErrorInvalidDomainStrategy
+	}
+	return nil
+}
+
+func (this *Config) UnmarshalJSON(data []byte) error {
+	type JsonConfig struct {
+		DomainStrategy DomainStrategy `json:"domainStrategy"`
+		Redirect       string         `json:"redirect"` // "host:port", or ":port" to keep the host.
+	}
+	jsonConfig := new(JsonConfig)
+	if err := json.Unmarshal(data, jsonConfig); err != nil {
+		return err
+	}
+	this.DomainStrategy = jsonConfig.DomainStrategy
+	if len(jsonConfig.Redirect) > 0 {
+		host, portString, err := net.SplitHostPort(jsonConfig.Redirect)
+		if err != nil {
+			log.Error("Freedom: Invalid redirect: ", jsonConfig.Redirect)
+			return ErrorInvalidRedirect
+		}
+		port, err := v2net.PortFromString(portString)
+		if err != nil {
+			log.Error("Freedom: Invalid redirect port: ", jsonConfig.Redirect)
+			return ErrorInvalidRedirect
+		}
+		if len(host) > 0 {
+			this.RedirectAddress = v2net.ParseAddress(host)
+		}
+		this.RedirectPort = port
+	}
+	return nil
+}
+
 func init() {
 	config.RegisterOutboundConfig("freedom",
 		func(data []byte) (interface{}, error) {
-			return new(Config), nil
+			config := new(Config)
+			if err := json.Unmarshal(data, config); err != nil {
+				return nil, err
+			}
+			return config, nil
 		})
 }
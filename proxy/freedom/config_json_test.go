@@ -0,0 +1,126 @@
+// +build json
+
+package freedom_test
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/v2ray/v2ray-core/app"
+	"github.com/v2ray/v2ray-core/app/dns"
+	"github.com/v2ray/v2ray-core/common/alloc"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	v2nettesting "github.com/v2ray/v2ray-core/common/net/testing"
+	. "github.com/v2ray/v2ray-core/proxy/freedom"
+	proxyrepo "github.com/v2ray/v2ray-core/proxy/repo"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+	"github.com/v2ray/v2ray-core/testing/servers/tcp"
+	"github.com/v2ray/v2ray-core/transport/ray"
+)
+
+func TestConfigParsing(t *testing.T) {
+	v2testing.Current(t)
+
+	config := new(Config)
+	assert.Error(json.Unmarshal([]byte(`{"domainStrategy": "UseIPv4", "redirect": "127.0.0.1:3366"}`), config)).IsNil()
+	assert.Int(int(config.DomainStrategy)).Equals(int(DomainStrategyUseIPv4))
+	assert.StringLiteral(config.RedirectAddress.String()).Equals("127.0.0.1")
+	assert.Int(int(config.RedirectPort)).Equals(3366)
+
+	config = new(Config)
+	assert.Error(json.Unmarshal([]byte(`{"redirect": ":53"}`), config)).IsNil()
+	assert.Int(int(config.DomainStrategy)).Equals(int(DomainStrategyAsIs))
+	assert.Pointer(config.RedirectAddress).IsNil()
+	assert.Int(int(config.RedirectPort)).Equals(53)
+
+	for _, rawJson := range []string{
+		`{"domainStrategy": "UseIPv5"}`,
+		`{"redirect": "127.0.0.1"}`,
+		`{"redirect": "127.0.0.1:99999"}`,
+	} {
+		assert.Error(json.Unmarshal([]byte(rawJson), new(Config))).IsNotNil()
+	}
+}
+
+type staticDnsServer struct {
+	ips map[string][]net.IP
+}
+
+func (this *staticDnsServer) Get(domain string) []net.IP {
+	return this.ips[domain]
+}
+
+func startEchoServer() (*tcp.Server, v2net.Port) {
+	port := v2nettesting.PickPort()
+	tcpServer := &tcp.Server{
+		Port: port,
+		MsgProcessor: func(data []byte) []byte {
+			return append([]byte("Processed: "), data...)
+		},
+	}
+	_, err := tcpServer.Start()
+	assert.Error(err).IsNil()
+	return tcpServer, port
+}
+
+func dispatch(space app.Space, rawConfig string, dest v2net.Destination) (string, error) {
+	freedom, err := proxyrepo.CreateOutboundHandler("freedom", space, []byte(rawConfig))
+	assert.Error(err).IsNil()
+
+	traffic := ray.NewRay()
+	payload := alloc.NewSmallBuffer().Clear().Append([]byte("Data"))
+	err = freedom.Dispatch(v2net.NewPacket(dest, payload, false), traffic)
+	close(traffic.InboundInput())
+	response := ""
+	for chunk := range traffic.InboundOutput() {
+		response += string(chunk.Value)
+		chunk.Release()
+	}
+	return response, err
+}
+
+func TestRedirect(t *testing.T) {
+	v2testing.Current(t)
+
+	tcpServer, port := startEchoServer()
+	defer tcpServer.Close()
+
+	dest := v2net.TCPDestination(v2net.DomainAddress("v2ray.com"), 80)
+	response, err := dispatch(nil, `{"redirect": "127.0.0.1:`+port.String()+`"}`, dest)
+	assert.Error(err).IsNil()
+	assert.StringLiteral(response).Equals("Processed: Data")
+
+	dest = v2net.TCPDestination(v2net.IPAddress([]byte{127, 0, 0, 1}), 128)
+	response, err = dispatch(nil, `{"redirect": ":`+port.String()+`"}`, dest)
+	assert.Error(err).IsNil()
+	assert.StringLiteral(response).Equals("Processed: Data")
+}
+
+func TestDomainStrategy(t *testing.T) {
+	v2testing.Current(t)
+
+	tcpServer, port := startEchoServer()
+	defer tcpServer.Close()
+
+	spaceController := app.NewController()
+	spaceController.Bind(dns.APP_ID, &staticDnsServer{
+		ips: map[string][]net.IP{
+			"v4.test": {net.IP([]byte{127, 0, 0, 1})},
+			"v6.test": {net.ParseIP("::1")},
+		},
+	})
+	space := spaceController.ForContext("freedom")
+
+	for _, strategy := range []string{"AsIs", "UseIP", "UseIPv4"} {
+		response, err := dispatch(space, `{"domainStrategy": "`+strategy+`"}`, v2net.TCPDestination(v2net.DomainAddress("v4.test"), port))
+		assert.Error(err).IsNil()
+		assert.StringLiteral(response).Equals("Processed: Data")
+	}
+
+	_, err := dispatch(space, `{"domainStrategy": "UseIPv6"}`, v2net.TCPDestination(v2net.DomainAddress("v4.test"), port))
+	assert.Error(err).IsNotNil()
+	_, err = dispatch(space, `{"domainStrategy": "UseIPv4"}`, v2net.TCPDestination(v2net.DomainAddress("v6.test"), port))
+	assert.Error(err).IsNotNil()
+}
@@ -0,0 +1,34 @@
+package freedom
+
+import (
+	"github.com/v2ray/v2ray-core/common/loader"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+)
+
+// ConfigMessage is the typed schema of Config.
+type ConfigMessage struct {
+	DomainStrategy  uint32 `protobuf:"varint,1,opt,name=domain_strategy"` // Value of DomainStrategy.
+	RedirectAddress string `protobuf:"bytes,2,opt,name=redirect_address"`
+	RedirectPort    uint32 `protobuf:"varint,3,opt,name=redirect_port"`
+}
+
+func (this *ConfigMessage) Build() (interface{}, error) {
+	if this.DomainStrategy > uint32(DomainStrategyUseIPv6) {
+		return nil, ErrorInvalidDomainStrategy
+	}
+	if this.RedirectPort > 65535 {
+		return nil, ErrorInvalidRedirect
+	}
+	config := &Config{
+		DomainStrategy: DomainStrategy(this.DomainStrategy),
+		RedirectPort:   v2net.Port(this.RedirectPort),
+	}
+	if len(this.RedirectAddress) > 0 {
+		config.RedirectAddress = v2net.ParseAddress(this.RedirectAddress)
+	}
+	return config, nil
+}
+
+func init() {
+	loader.MustRegisterType("v2ray.core.proxy.freedom.Config", (*ConfigMessage)(nil))
+}
@@ -4,36 +4,97 @@ import (
 	"io"
 	"net"
 	"sync"
+	"time"
 
+	"github.com/v2ray/v2ray-core/app/dns"
+	"github.com/v2ray/v2ray-core/app/metrics"
+	"github.com/v2ray/v2ray-core/app/policy"
 	v2io "github.com/v2ray/v2ray-core/common/io"
 	"github.com/v2ray/v2ray-core/common/log"
 	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
 	"github.com/v2ray/v2ray-core/common/retry"
+	"github.com/v2ray/v2ray-core/common/signal"
+	"github.com/v2ray/v2ray-core/proxy"
+	"github.com/v2ray/v2ray-core/proxy/internal"
 	"github.com/v2ray/v2ray-core/transport/dialer"
 	"github.com/v2ray/v2ray-core/transport/ray"
 )
 
 type FreedomConnection struct {
+	config  *Config               // Optional.
+	metrics metrics.Recorder      // Optional.
+	policy  *policy.PolicyManager // Optional.
+	dns     dns.Server            // Optional.
+	conns   internal.ConnectionSet
+}
+
+// downlinkOnlyTimeout returns the time a connection may stay idle after the request is sent
+// completely, or 0 for no timeout. Users are unknown to outbounds, so the policy of untrusted users
+// applies.
+func (this *FreedomConnection) downlinkOnlyTimeout() time.Duration {
+	if this.policy == nil {
+		return 0
+	}
+	return this.policy.ForLevel(proto.UserLevelUntrusted).DownlinkOnlyTimeout
+}
+
+// resolver returns the resolver of domains for dialing, or nil for the system resolver.
+func (this *FreedomConnection) resolver() dialer.Resolver {
+	if this.config == nil || this.config.DomainStrategy == DomainStrategyAsIs {
+		return this.dns
+	}
+	return &strategyResolver{
+		dns:      this.dns,
+		strategy: this.config.DomainStrategy,
+	}
 }
 
 func (this *FreedomConnection) Dispatch(firstPacket v2net.Packet, ray ray.OutboundRay) error {
-	log.Info("Freedom: Opening connection to ", firstPacket.Destination())
+	dest := firstPacket.Destination()
+	if this.config != nil {
+		dest = this.config.redirect(dest)
+	}
+	log.Info("Freedom: Opening connection to ", dest)
 
 	var conn net.Conn
-	err := retry.Timed(5, 100).On(func() error {
-		rawConn, err := dialer.Dial(firstPacket.Destination())
+	resolver := this.resolver()
+	err := retry.Timed(5, 100).OnUntil(ray.Done(), func() error {
+		rawConn, err := dialer.Dial(dest, resolver, ray.Done())
 		if err != nil {
 			return err
 		}
 		conn = rawConn
 		return nil
 	})
+	if err == retry.ErrorCanceled {
+		close(ray.OutboundOutput())
+		log.Info("Freedom: Connection to ", dest, " is canceled.")
+		return err
+	}
 	if err != nil {
 		close(ray.OutboundOutput())
-		log.Error("Freedom: Failed to open connection to ", firstPacket.Destination(), ": ", err)
+		log.Error("Freedom: Failed to open connection to ", dest, ": ", err)
+		if this.metrics != nil {
+			this.metrics.RecordDialFailure()
+		}
 		return err
 	}
 	defer conn.Close()
+	if !this.conns.Add(conn) {
+		close(ray.OutboundOutput())
+		return proxy.ErrorClosed
+	}
+	defer this.conns.Remove(conn)
+	stopWatching := signal.OnDone(ray.Done(), func() {
+		conn.Close()
+	})
+	defer stopWatching()
+
+	timer := signal.CancelAfterInactivity(func() {
+		conn.Close()
+	}, 0)
+	defer timer.Close()
 
 	input := ray.OutboundInput()
 	output := ray.OutboundOutput()
@@ -61,18 +122,55 @@ func (this *FreedomConnection) Dispatch(firstPacket v2net.Packet, ray ray.Outbou
 
 		var reader io.Reader = conn
 
-		if firstPacket.Destination().IsUDP() {
+		if dest.IsUDP() {
 			reader = v2net.NewTimeOutReader(16 /* seconds */, conn)
 		}
 
-		v2io.RawReaderToChan(output, reader)
+		v2io.RawReaderToChan(output, signal.NewActivityReader(reader, timer))
 	}()
 
 	writeMutex.Lock()
 	if tcpConn, ok := conn.(*net.TCPConn); ok {
 		tcpConn.CloseWrite()
+		timer.SetTimeout(this.downlinkOnlyTimeout())
 	}
 	readMutex.Lock()
 
 	return nil
 }
+
+// strategyResolver resolves domains with the DNS app, or the system resolver if there is none, and keeps
+// IPs of the families allowed by the domain strategy only.
+type strategyResolver struct {
+	dns      dns.Server // Optional.
+	strategy DomainStrategy
+}
+
+func (this *strategyResolver) Get(domain string) []net.IP {
+	var ips []net.IP
+	if this.dns != nil {
+		ips = this.dns.Get(domain)
+	} else {
+		var err error
+		ips, err = net.LookupIP(domain)
+		if err != nil {
+			log.Info("Freedom: Failed to resolve ", domain, ": ", err)
+			return nil
+		}
+	}
+	if this.strategy == DomainStrategyUseIP {
+		return ips
+	}
+	filtered := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		if isIPv4 := ip.To4() != nil; isIPv4 == (this.strategy == DomainStrategyUseIPv4) {
+			filtered = append(filtered, ip)
+		}
+	}
+	return filtered
+}
+
+// Close closes all connections in progress.
+func (this *FreedomConnection) Close() {
+	this.conns.Close()
+}
@@ -2,6 +2,7 @@ package freedom_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/v2ray/v2ray-core/common/alloc"
 	v2net "github.com/v2ray/v2ray-core/common/net"
@@ -64,3 +65,57 @@ func TestUnreachableDestination(t *testing.T) {
 	_, open := <-traffic.InboundOutput()
 	assert.Bool(open).IsFalse()
 }
+
+func TestCanceledConnection(t *testing.T) {
+	v2testing.Current(t)
+	port := v2nettesting.PickPort()
+
+	tcpServer := &tcp.Server{
+		Port: port,
+		MsgProcessor: func(data []byte) []byte {
+			return nil
+		},
+	}
+	_, err := tcpServer.Start()
+	assert.Error(err).IsNil()
+
+	freedom := &FreedomConnection{}
+	traffic := ray.NewRay()
+	payload := alloc.NewSmallBuffer().Clear().Append([]byte("Data without response"))
+	packet := v2net.NewPacket(v2net.TCPDestination(v2net.IPAddress([]byte{127, 0, 0, 1}), port), payload, true)
+
+	finished := make(chan error, 1)
+	go func() {
+		finished <- freedom.Dispatch(packet, traffic)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	traffic.Cancel()
+	select {
+	case _, open := <-traffic.InboundOutput():
+		assert.Bool(open).IsFalse()
+	case <-time.After(5 * time.Second):
+		t.Fatal("Output is not closed after cancellation.")
+	}
+
+	close(traffic.InboundInput())
+	assert.Error(<-finished).IsNil()
+}
+
+func TestCanceledBeforeDial(t *testing.T) {
+	v2testing.Current(t)
+
+	freedom := &FreedomConnection{}
+	traffic := ray.NewRay()
+	traffic.Cancel()
+	payload := alloc.NewSmallBuffer().Clear().Append([]byte("Data to be sent to remote"))
+	packet := v2net.NewPacket(v2net.TCPDestination(v2net.IPAddress([]byte{127, 0, 0, 1}), 128), payload, false)
+
+	start := time.Now()
+	err := freedom.Dispatch(packet, traffic)
+	assert.Error(err).IsNotNil()
+	assert.Bool(time.Since(start) < 100*time.Millisecond).IsTrue()
+
+	_, open := <-traffic.InboundOutput()
+	assert.Bool(open).IsFalse()
+}
@@ -2,13 +2,22 @@ package freedom
 
 import (
 	"github.com/v2ray/v2ray-core/app"
+	"github.com/v2ray/v2ray-core/app/dns"
+	"github.com/v2ray/v2ray-core/app/metrics"
+	"github.com/v2ray/v2ray-core/app/policy"
 	"github.com/v2ray/v2ray-core/proxy"
 	"github.com/v2ray/v2ray-core/proxy/internal"
 )
 
 func init() {
 	internal.MustRegisterOutboundHandlerCreator("freedom",
-		func(space app.Space, config interface{}) (proxy.OutboundHandler, error) {
-			return &FreedomConnection{}, nil
+		func(space app.Space, rawConfig interface{}) (proxy.OutboundHandler, error) {
+			config, _ := rawConfig.(*Config)
+			return &FreedomConnection{
+				config:  config,
+				metrics: metrics.GetRecorder(space),
+				policy:  policy.GetPolicyManager(space),
+				dns:     dns.GetServer(space),
+			}, nil
 		})
 }
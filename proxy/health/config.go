@@ -0,0 +1,40 @@
+package health
+
+import (
+	"time"
+)
+
+const (
+	DefaultInterval   = 30 * time.Second
+	DefaultTimeout    = 5 * time.Second
+	DefaultMaxBackoff = 5 * time.Minute
+)
+
+// Config is the configuration of health checking on an outbound server.
+type Config struct {
+	Interval   time.Duration // Time between two probes on a healthy server.
+	Timeout    time.Duration // Time before a probe is considered failed.
+	MaxBackoff time.Duration // Maximum time between two probes on an unhealthy server.
+	URL        string        // If set, servers are probed by a full HTTP request to this URL instead of a TCP connect.
+}
+
+func (this *Config) interval() time.Duration {
+	if this.Interval <= 0 {
+		return DefaultInterval
+	}
+	return this.Interval
+}
+
+func (this *Config) timeout() time.Duration {
+	if this.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return this.Timeout
+}
+
+func (this *Config) maxBackoff() time.Duration {
+	if this.MaxBackoff <= 0 {
+		return DefaultMaxBackoff
+	}
+	return this.MaxBackoff
+}
@@ -0,0 +1,35 @@
+// +build json
+
+package health
+
+import (
+	"encoding/json"
+	"net/url"
+	"time"
+
+	"github.com/v2ray/v2ray-core/common/log"
+)
+
+func (this *Config) UnmarshalJSON(data []byte) error {
+	type JsonConfig struct {
+		Interval   int    `json:"interval"`
+		Timeout    int    `json:"timeout"`
+		MaxBackoff int    `json:"maxBackoff"`
+		URL        string `json:"url"`
+	}
+	jsonConfig := new(JsonConfig)
+	if err := json.Unmarshal(data, jsonConfig); err != nil {
+		return err
+	}
+	this.Interval = time.Duration(jsonConfig.Interval) * time.Second
+	this.Timeout = time.Duration(jsonConfig.Timeout) * time.Second
+	this.MaxBackoff = time.Duration(jsonConfig.MaxBackoff) * time.Second
+	if len(jsonConfig.URL) > 0 {
+		if _, err := url.Parse(jsonConfig.URL); err != nil {
+			log.Error("Health: Invalid probe URL: ", jsonConfig.URL)
+			return err
+		}
+	}
+	this.URL = jsonConfig.URL
+	return nil
+}
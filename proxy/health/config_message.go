@@ -0,0 +1,22 @@
+package health
+
+import (
+	"time"
+)
+
+// ConfigMessage is the typed schema of Config.
+type ConfigMessage struct {
+	Interval   uint32 `protobuf:"varint,1,opt,name=interval"`    // Seconds
+	Timeout    uint32 `protobuf:"varint,2,opt,name=timeout"`     // Seconds
+	MaxBackoff uint32 `protobuf:"varint,3,opt,name=max_backoff"` // Seconds
+	Url        string `protobuf:"bytes,4,opt,name=url"`
+}
+
+func (this *ConfigMessage) Build() *Config {
+	return &Config{
+		Interval:   time.Duration(this.Interval) * time.Second,
+		Timeout:    time.Duration(this.Timeout) * time.Second,
+		MaxBackoff: time.Duration(this.MaxBackoff) * time.Second,
+		URL:        this.Url,
+	}
+}
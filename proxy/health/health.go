@@ -0,0 +1,140 @@
+// Package health probes outbound servers periodically and keeps track of their availability.
+package health
+
+import (
+	"sync"
+	"time"
+
+	"github.com/v2ray/v2ray-core/common/log"
+)
+
+// A Prober checks the availability of a server once.
+type Prober interface {
+	Probe(timeout time.Duration) error
+}
+
+// Status is a snapshot of the health state of a server.
+type Status struct {
+	Name      string
+	Healthy   bool
+	Failures  int       // Number of consecutive failed probes.
+	LastCheck time.Time // Time of the last probe, zero if never probed.
+	NextCheck time.Time
+	LastError error
+}
+
+// A Reporter reports the health state of the servers it checks, e.g., an outbound handler with health
+// check on its servers.
+type Reporter interface {
+	HealthStatus() []*Status
+}
+
+// A Checker probes a server periodically. A server is considered healthy until a probe fails.
+// Failed servers are probed again with exponential backoff.
+type Checker struct {
+	sync.RWMutex
+	name      string
+	prober    Prober
+	config    *Config
+	failures  int
+	lastCheck time.Time
+	nextCheck time.Time
+	lastError error
+	closed    chan bool
+	closeOnce sync.Once
+}
+
+func NewChecker(name string, prober Prober, config *Config) *Checker {
+	return &Checker{
+		name:   name,
+		prober: prober,
+		config: config,
+		closed: make(chan bool),
+	}
+}
+
+func (this *Checker) Name() string {
+	return this.name
+}
+
+// IsHealthy returns false if the last probe on the server failed.
+func (this *Checker) IsHealthy() bool {
+	this.RLock()
+	defer this.RUnlock()
+	return this.failures == 0
+}
+
+func (this *Checker) Status() *Status {
+	this.RLock()
+	defer this.RUnlock()
+	return &Status{
+		Name:      this.name,
+		Healthy:   this.failures == 0,
+		Failures:  this.failures,
+		LastCheck: this.lastCheck,
+		NextCheck: this.nextCheck,
+		LastError: this.lastError,
+	}
+}
+
+// Check probes the server immediately, and returns the time to wait before the next probe.
+func (this *Checker) Check() time.Duration {
+	err := this.prober.Probe(this.config.timeout())
+
+	this.Lock()
+	defer this.Unlock()
+
+	wasHealthy := this.failures == 0
+	this.lastCheck = time.Now()
+	this.lastError = err
+	if err == nil {
+		this.failures = 0
+		if !wasHealthy {
+			log.Warning("Health: [", this.name, "] is up again.")
+		}
+	} else {
+		this.failures++
+		if wasHealthy {
+			log.Warning("Health: [", this.name, "] is down: ", err)
+		} else {
+			log.Info("Health: [", this.name, "] is still down (", this.failures, " failures): ", err)
+		}
+	}
+
+	wait := this.config.interval()
+	for i := 1; i < this.failures && wait < this.config.maxBackoff(); i++ {
+		wait *= 2
+	}
+	if this.failures > 0 && wait > this.config.maxBackoff() {
+		wait = this.config.maxBackoff()
+	}
+	this.nextCheck = this.lastCheck.Add(wait)
+	return wait
+}
+
+// Start probes the server periodically in background until the Checker is closed. It does nothing
+// once the Checker is closed.
+func (this *Checker) Start() {
+	select {
+	case <-this.closed:
+		return
+	default:
+	}
+	go func() {
+		for {
+			wait := this.Check()
+			select {
+			case <-this.closed:
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+}
+
+// Close stops background probing.
+func (this *Checker) Close() {
+	this.closeOnce.Do(func() {
+		close(this.closed)
+	})
+}
@@ -0,0 +1,121 @@
+package health_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	"github.com/v2ray/v2ray-core/proxy/freedom"
+	. "github.com/v2ray/v2ray-core/proxy/health"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+type staticProber struct {
+	err error
+}
+
+func (this *staticProber) Probe(timeout time.Duration) error {
+	return this.err
+}
+
+func TestCheckerBackoff(t *testing.T) {
+	v2testing.Current(t)
+
+	prober := &staticProber{}
+	checker := NewChecker("test", prober, &Config{
+		Interval:   time.Second,
+		MaxBackoff: 5 * time.Second,
+	})
+	assert.Bool(checker.IsHealthy()).IsTrue()
+
+	assert.Int64(int64(checker.Check())).Equals(int64(time.Second))
+	assert.Bool(checker.IsHealthy()).IsTrue()
+
+	prober.err = errors.New("test error")
+	assert.Int64(int64(checker.Check())).Equals(int64(time.Second))
+	assert.Bool(checker.IsHealthy()).IsFalse()
+	assert.Int64(int64(checker.Check())).Equals(int64(2 * time.Second))
+	assert.Int64(int64(checker.Check())).Equals(int64(4 * time.Second))
+	assert.Int64(int64(checker.Check())).Equals(int64(5 * time.Second))
+
+	status := checker.Status()
+	assert.StringLiteral(status.Name).Equals("test")
+	assert.Bool(status.Healthy).IsFalse()
+	assert.Int(status.Failures).Equals(4)
+	assert.Error(status.LastError).Equals(prober.err)
+
+	prober.err = nil
+	assert.Int64(int64(checker.Check())).Equals(int64(time.Second))
+	assert.Bool(checker.IsHealthy()).IsTrue()
+}
+
+type countingProber struct {
+	sync.Mutex
+	probes int
+}
+
+func (this *countingProber) Probe(timeout time.Duration) error {
+	this.Lock()
+	defer this.Unlock()
+	this.probes++
+	return nil
+}
+
+func TestCheckerStartAfterClose(t *testing.T) {
+	v2testing.Current(t)
+
+	prober := new(countingProber)
+	checker := NewChecker("closed", prober, &Config{})
+	checker.Close()
+	checker.Start()
+	time.Sleep(100 * time.Millisecond)
+
+	prober.Lock()
+	defer prober.Unlock()
+	assert.Int(prober.probes).Equals(0)
+}
+
+func TestTCPProber(t *testing.T) {
+	v2testing.Current(t)
+
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: []byte{127, 0, 0, 1}})
+	assert.Error(err).IsNil()
+	port := v2net.Port(listener.Addr().(*net.TCPAddr).Port)
+
+	prober := &TCPProber{Destination: v2net.TCPDestination(v2net.IPAddress([]byte{127, 0, 0, 1}), port)}
+	assert.Error(prober.Probe(time.Second)).IsNil()
+
+	listener.Close()
+	assert.Error(prober.Probe(time.Second)).IsNotNil()
+}
+
+func TestOutboundProber(t *testing.T) {
+	v2testing.Current(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/generate_204" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	prober, err := NewOutboundProber(&freedom.FreedomConnection{}, server.URL+"/generate_204")
+	assert.Error(err).IsNil()
+	assert.Error(prober.Probe(5 * time.Second)).IsNil()
+
+	prober, err = NewOutboundProber(&freedom.FreedomConnection{}, server.URL+"/not_found")
+	assert.Error(err).IsNil()
+	assert.Error(prober.Probe(5 * time.Second)).Equals(ErrorUnexpectedStatus)
+
+	_, err = NewOutboundProber(&freedom.FreedomConnection{}, fmt.Sprintf("https://%s/", server.Listener.Addr()))
+	assert.Error(err).Equals(ErrorUnsupportedScheme)
+}
@@ -0,0 +1,132 @@
+package health
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/v2ray/v2ray-core/common/alloc"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	"github.com/v2ray/v2ray-core/proxy"
+	"github.com/v2ray/v2ray-core/transport/ray"
+)
+
+var (
+	ErrorProbeTimeout      = errors.New("Probe timed out.")
+	ErrorUnexpectedStatus  = errors.New("Unexpected HTTP status.")
+	ErrorUnsupportedScheme = errors.New("Unsupported URL scheme.")
+)
+
+// TCPProber probes a server by opening a TCP connection to it.
+type TCPProber struct {
+	Destination v2net.Destination
+}
+
+func (this *TCPProber) Probe(timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", this.Destination.NetAddr(), timeout)
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	return nil
+}
+
+// OutboundProber probes an outbound handler by sending a HTTP GET request through it.
+type OutboundProber struct {
+	handler proxy.OutboundHandler
+	url     *url.URL
+	dest    v2net.Destination
+}
+
+func NewOutboundProber(handler proxy.OutboundHandler, rawUrl string) (*OutboundProber, error) {
+	probeUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	if probeUrl.Scheme != "http" {
+		return nil, ErrorUnsupportedScheme
+	}
+	port := v2net.Port(80)
+	if len(probeUrl.Port()) > 0 {
+		port, err = v2net.PortFromString(probeUrl.Port())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &OutboundProber{
+		handler: handler,
+		url:     probeUrl,
+		dest:    v2net.TCPDestination(v2net.ParseAddress(probeUrl.Hostname()), port),
+	}, nil
+}
+
+func (this *OutboundProber) Probe(timeout time.Duration) error {
+	request := "GET " + this.url.RequestURI() + " HTTP/1.1\r\n" +
+		"Host: " + this.url.Host + "\r\n" +
+		"User-Agent: V2Ray-HealthCheck\r\n" +
+		"Connection: close\r\n\r\n"
+
+	link := ray.NewRay()
+	defer link.Cancel()
+	close(link.InboundInput())
+	packet := v2net.NewPacket(this.dest, alloc.NewSmallBuffer().Clear().Append([]byte(request)), false)
+	go this.handler.Dispatch(packet, link)
+
+	result := make(chan error, 1)
+	go func() {
+		reader := &chanReader{stream: link.InboundOutput()}
+		response, err := http.ReadResponse(bufio.NewReader(reader), nil)
+		if err == nil {
+			response.Body.Close()
+			if response.StatusCode >= 400 {
+				err = ErrorUnexpectedStatus
+			}
+		}
+		result <- err
+		reader.drain()
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(timeout):
+		return ErrorProbeTimeout
+	}
+}
+
+// chanReader reads the content of a stream of buffers.
+type chanReader struct {
+	stream  <-chan *alloc.Buffer
+	current *alloc.Buffer
+}
+
+func (this *chanReader) Read(b []byte) (int, error) {
+	for this.current == nil || this.current.IsEmpty() {
+		if this.current != nil {
+			this.current.Release()
+		}
+		chunk, open := <-this.stream
+		if !open {
+			this.current = nil
+			return 0, io.EOF
+		}
+		this.current = chunk
+	}
+	n := copy(b, this.current.Value)
+	this.current.SliceFrom(n)
+	return n, nil
+}
+
+func (this *chanReader) drain() {
+	if this.current != nil {
+		this.current.Release()
+		this.current = nil
+	}
+	for chunk := range this.stream {
+		chunk.Release()
+	}
+}
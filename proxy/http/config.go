@@ -2,10 +2,12 @@ package http
 
 import (
 	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
 )
 
 type Config struct {
 	OwnHosts []v2net.Address
+	Level    proto.UserLevel // User level of all connections, which decides their policy.
 }
 
 func (this *Config) IsOwnHost(host v2net.Address) bool {
@@ -6,12 +6,14 @@ import (
 	"encoding/json"
 
 	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
 	"github.com/v2ray/v2ray-core/proxy/internal/config"
 )
 
 func (this *Config) UnmarshalJSON(data []byte) error {
 	type JsonConfig struct {
 		Hosts []v2net.AddressJson `json:"ownHosts"`
+		Level byte                `json:"level"`
 	}
 	jsonConfig := new(JsonConfig)
 	if err := json.Unmarshal(data, jsonConfig); err != nil {
@@ -22,6 +24,8 @@ func (this *Config) UnmarshalJSON(data []byte) error {
 		this.OwnHosts[idx] = host.Address
 	}
 
+	this.Level = proto.UserLevel(jsonConfig.Level)
+
 	v2rayHost := v2net.DomainAddress("local.v2ray.com")
 	if !this.IsOwnHost(v2rayHost) {
 		this.OwnHosts = append(this.OwnHosts, v2rayHost)
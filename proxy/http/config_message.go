@@ -0,0 +1,36 @@
+package http
+
+import (
+	"github.com/v2ray/v2ray-core/common/loader"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+	"github.com/v2ray/v2ray-core/proxy/internal"
+)
+
+// ConfigMessage is the typed schema of Config.
+type ConfigMessage struct {
+	OwnHost []string `protobuf:"bytes,1,rep,name=own_host"`
+	Level   uint32   `protobuf:"varint,2,opt,name=level"`
+}
+
+func (this *ConfigMessage) Build() (interface{}, error) {
+	if this.Level > 255 {
+		return nil, internal.ErrorBadConfiguration
+	}
+	config := &Config{
+		OwnHosts: make([]v2net.Address, len(this.OwnHost), len(this.OwnHost)+1),
+		Level:    proto.UserLevel(this.Level),
+	}
+	for idx, host := range this.OwnHost {
+		config.OwnHosts[idx] = v2net.ParseAddress(host)
+	}
+	v2rayHost := v2net.DomainAddress("local.v2ray.com")
+	if !config.IsOwnHost(v2rayHost) {
+		config.OwnHosts = append(config.OwnHosts, v2rayHost)
+	}
+	return config, nil
+}
+
+func init() {
+	loader.MustRegisterType("v2ray.core.proxy.http.Config", (*ConfigMessage)(nil))
+}
@@ -8,13 +8,17 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/v2ray/v2ray-core/app/dispatcher"
+	"github.com/v2ray/v2ray-core/app/policy"
 	"github.com/v2ray/v2ray-core/common/alloc"
 	v2io "github.com/v2ray/v2ray-core/common/io"
 	"github.com/v2ray/v2ray-core/common/log"
 	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
 	"github.com/v2ray/v2ray-core/common/serial"
+	"github.com/v2ray/v2ray-core/common/signal"
 	"github.com/v2ray/v2ray-core/proxy"
 	"github.com/v2ray/v2ray-core/transport/hub"
 	"github.com/v2ray/v2ray-core/transport/ray"
@@ -27,12 +31,14 @@ type HttpProxyServer struct {
 	config           *Config
 	tcpListener      *hub.TCPHub
 	listeningPort    v2net.Port
+	policy           *policy.PolicyManager
 }
 
-func NewHttpProxyServer(config *Config, packetDispatcher dispatcher.PacketDispatcher) *HttpProxyServer {
+func NewHttpProxyServer(config *Config, packetDispatcher dispatcher.PacketDispatcher, policyManager *policy.PolicyManager) *HttpProxyServer {
 	return &HttpProxyServer{
 		packetDispatcher: packetDispatcher,
 		config:           config,
+		policy:           policyManager,
 	}
 }
 
@@ -97,13 +103,22 @@ func parseHost(rawHost string, defaultPort v2net.Port) (v2net.Destination, error
 
 func (this *HttpProxyServer) handleConnection(conn *hub.TCPConn) {
 	defer conn.Close()
-	reader := bufio.NewReader(conn)
+	userPolicy := this.policy.ForLevel(this.config.Level)
+	timedReader := v2net.NewTimeOutReader(int(userPolicy.HandshakeTimeout/time.Second), conn)
+	timer := signal.CancelAfterInactivity(func() {
+		conn.Close()
+	}, 0)
+	defer timer.Close()
+	reader := bufio.NewReader(signal.NewActivityReader(timedReader, timer))
 
 	request, err := http.ReadRequest(reader)
 	if err != nil {
 		log.Warning("Failed to read http request: ", err)
 		return
 	}
+	request.RemoteAddr = conn.RemoteAddr().String()
+	// Idle connections are closed by the dispatcher from now on.
+	timedReader.SetTimeOut(0)
 	log.Info("Request to Method [", request.Method, "] Host [", request.Host, "] with URL [", request.URL, "]")
 	defaultPort := v2net.Port(80)
 	if strings.ToLower(request.URL.Scheme) == "https" {
@@ -119,13 +134,13 @@ func (this *HttpProxyServer) handleConnection(conn *hub.TCPConn) {
 		return
 	}
 	if strings.ToUpper(request.Method) == "CONNECT" {
-		this.handleConnect(request, dest, reader, conn)
+		this.handleConnect(request, dest, reader, conn, timer)
 	} else {
 		this.handlePlainHTTP(request, dest, reader, conn)
 	}
 }
 
-func (this *HttpProxyServer) handleConnect(request *http.Request, destination v2net.Destination, reader io.Reader, writer io.Writer) {
+func (this *HttpProxyServer) handleConnect(request *http.Request, destination v2net.Destination, reader io.Reader, writer io.Writer, timer *signal.ActivityTimer) {
 	response := &http.Response{
 		Status:        "200 OK",
 		StatusCode:    200,
@@ -144,11 +159,21 @@ func (this *HttpProxyServer) handleConnect(request *http.Request, destination v2
 	buffer.Release()
 
 	packet := v2net.NewPacket(destination, nil, true)
-	ray := this.packetDispatcher.DispatchToOutbound(packet)
-	this.transport(reader, writer, ray)
+	ray := dispatcher.DispatchToOutboundForUser(this.packetDispatcher, serial.StringLiteral(request.RemoteAddr), this.user(), packet)
+	defer ray.Cancel()
+	this.transport(reader, writer, ray, timer)
 }
 
-func (this *HttpProxyServer) transport(input io.Reader, output io.Writer, ray ray.InboundRay) {
+// user returns the user on behalf of whom connections are dispatched.
+func (this *HttpProxyServer) user() *proto.User {
+	return &proto.User{
+		Level: this.config.Level,
+	}
+}
+
+// transport forwards traffic between the client and the given ray. The given timer closes the client
+// connection, and is started once the response finishes.
+func (this *HttpProxyServer) transport(input io.Reader, output io.Writer, ray ray.InboundRay, timer *signal.ActivityTimer) {
 	var wg sync.WaitGroup
 	wg.Add(2)
 	defer wg.Wait()
@@ -161,6 +186,7 @@ func (this *HttpProxyServer) transport(input io.Reader, output io.Writer, ray ra
 
 	go func() {
 		v2io.ChanToRawWriter(output, ray.InboundOutput())
+		timer.SetTimeout(this.policy.ForLevel(this.config.Level).UplinkOnlyTimeout)
 		wg.Done()
 	}()
 }
@@ -221,7 +247,8 @@ func (this *HttpProxyServer) handlePlainHTTP(request *http.Request, dest v2net.D
 	log.Debug("Request to remote:\n", serial.BytesLiteral(requestBuffer.Value))
 
 	packet := v2net.NewPacket(dest, requestBuffer, true)
-	ray := this.packetDispatcher.DispatchToOutbound(packet)
+	ray := dispatcher.DispatchToOutboundForUser(this.packetDispatcher, serial.StringLiteral(request.RemoteAddr), this.user(), packet)
+	defer ray.Cancel()
 	defer close(ray.InboundInput())
 
 	var wg sync.WaitGroup
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	testdispatcher "github.com/v2ray/v2ray-core/app/dispatcher/testing"
+	"github.com/v2ray/v2ray-core/app/policy"
 	v2nettesting "github.com/v2ray/v2ray-core/common/net/testing"
 	netassert "github.com/v2ray/v2ray-core/common/net/testing/assert"
 	. "github.com/v2ray/v2ray-core/proxy/http"
@@ -53,7 +54,7 @@ func TestNormalGetRequest(t *testing.T) {
 
 	testPacketDispatcher := testdispatcher.NewTestPacketDispatcher(nil)
 
-	httpProxy := NewHttpProxyServer(&Config{}, testPacketDispatcher)
+	httpProxy := NewHttpProxyServer(&Config{}, testPacketDispatcher, policy.NewPolicyManager(nil))
 	defer httpProxy.Close()
 
 	port := v2nettesting.PickPort()
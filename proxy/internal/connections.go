@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"net"
+	"sync"
+)
+
+// ConnectionSet keeps track of the connections of a handler in progress, so that they can be closed
+// at once when the handler is closed.
+type ConnectionSet struct {
+	sync.Mutex
+	conns  map[net.Conn]bool
+	closed bool
+}
+
+// Add adds a connection into this set. It returns false if this set is already closed, in which case
+// the caller should close the connection itself.
+func (this *ConnectionSet) Add(conn net.Conn) bool {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.closed {
+		return false
+	}
+	if this.conns == nil {
+		this.conns = make(map[net.Conn]bool)
+	}
+	this.conns[conn] = true
+	return true
+}
+
+// Remove removes a finished connection from this set.
+func (this *ConnectionSet) Remove(conn net.Conn) {
+	this.Lock()
+	defer this.Unlock()
+
+	delete(this.conns, conn)
+}
+
+// Close closes all connections in this set, as well as those added afterwards.
+func (this *ConnectionSet) Close() {
+	this.Lock()
+	conns := this.conns
+	this.conns = nil
+	this.closed = true
+	this.Unlock()
+
+	for conn := range conns {
+		conn.Close()
+	}
+}
@@ -63,7 +63,7 @@ func CreateInboundHandler(name string, space app.Space, rawConfig []byte) (proxy
 func CreateOutboundHandler(name string, space app.Space, rawConfig []byte) (proxy.OutboundHandler, error) {
 	creator, found := outboundFactories[name]
 	if !found {
-		return nil, ErrorNameExists
+		return nil, ErrorProxyNotFound
 	}
 
 	if len(rawConfig) > 0 {
@@ -76,3 +76,48 @@ func CreateOutboundHandler(name string, space app.Space, rawConfig []byte) (prox
 
 	return creator(space, nil)
 }
+
+// CreateInboundHandlerFromConfig creates an inbound handler of the given name with a config object which
+// has been built already, e.g., from a typed config message.
+func CreateInboundHandlerFromConfig(name string, space app.Space, proxyConfig interface{}) (proxy.InboundHandler, error) {
+	creator, found := inboundFactories[name]
+	if !found {
+		return nil, ErrorProxyNotFound
+	}
+	return creator(space, proxyConfig)
+}
+
+// CreateOutboundHandlerFromConfig is the outbound counterpart of CreateInboundHandlerFromConfig.
+func CreateOutboundHandlerFromConfig(name string, space app.Space, proxyConfig interface{}) (proxy.OutboundHandler, error) {
+	creator, found := outboundFactories[name]
+	if !found {
+		return nil, ErrorProxyNotFound
+	}
+	return creator(space, proxyConfig)
+}
+
+// ValidateInboundConfig returns ErrorProxyNotFound if there is no inbound handler of the given name, or the
+// error in parsing the given config for it.
+func ValidateInboundConfig(name string, rawConfig []byte) error {
+	if _, found := inboundFactories[name]; !found {
+		return ErrorProxyNotFound
+	}
+	if len(rawConfig) > 0 {
+		_, err := config.CreateInboundConfig(name, rawConfig)
+		return err
+	}
+	return nil
+}
+
+// ValidateOutboundConfig returns ErrorProxyNotFound if there is no outbound handler of the given name, or
+// the error in parsing the given config for it.
+func ValidateOutboundConfig(name string, rawConfig []byte) error {
+	if _, found := outboundFactories[name]; !found {
+		return ErrorProxyNotFound
+	}
+	if len(rawConfig) > 0 {
+		_, err := config.CreateOutboundConfig(name, rawConfig)
+		return err
+	}
+	return nil
+}
@@ -2,7 +2,10 @@
 package proxy // import "github.com/v2ray/v2ray-core/proxy"
 
 import (
+	"time"
+
 	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
 	"github.com/v2ray/v2ray-core/transport/ray"
 )
 
@@ -27,4 +30,30 @@ type InboundHandler interface {
 type OutboundHandler interface {
 	// Dispatch sends one or more Packets to its destination.
 	Dispatch(firstPacket v2net.Packet, ray ray.OutboundRay) error
+	// Close closes all connections of the handler in progress, and releases its resources. The handler
+	// must not be used afterwards.
+	Close()
+}
+
+// A HealthCheckingHandler is an OutboundHandler which probes its servers in background. Probing starts
+// and stops separately from creating and closing the handler, so that a handler which is created but
+// never used doesn't probe anything.
+type HealthCheckingHandler interface {
+	// StartHealthCheck starts probing servers periodically.
+	StartHealthCheck()
+	// StopHealthCheck stops probing servers. Connections in progress are not affected.
+	StopHealthCheck()
+}
+
+// A UserManager is an InboundHandler whose users can be changed while running.
+type UserManager interface {
+	// AddUser adds a new user, or updates the user with the same email.
+	AddUser(user *proto.User) error
+	// RemoveUser removes the user with the given email.
+	RemoveUser(email string) error
+	// SetUserExpiry sets the time after which the user with the given email is removed. Zero time
+	// means never.
+	SetUserExpiry(email string, expiry time.Time) error
+	// SetUserEnabled enables or disables the user with the given email.
+	SetUserEnabled(email string, enabled bool) error
 }
@@ -6,6 +6,10 @@ import (
 	"github.com/v2ray/v2ray-core/proxy/internal"
 )
 
+var (
+	ErrorProxyNotFound = internal.ErrorProxyNotFound
+)
+
 func CreateInboundHandler(name string, space app.Space, rawConfig []byte) (proxy.InboundHandler, error) {
 	return internal.CreateInboundHandler(name, space, rawConfig)
 }
@@ -13,3 +17,23 @@ func CreateInboundHandler(name string, space app.Space, rawConfig []byte) (proxy
 func CreateOutboundHandler(name string, space app.Space, rawConfig []byte) (proxy.OutboundHandler, error) {
 	return internal.CreateOutboundHandler(name, space, rawConfig)
 }
+
+// CreateInboundHandlerFromConfig creates an inbound handler with a config object built already.
+func CreateInboundHandlerFromConfig(name string, space app.Space, config interface{}) (proxy.InboundHandler, error) {
+	return internal.CreateInboundHandlerFromConfig(name, space, config)
+}
+
+// CreateOutboundHandlerFromConfig creates an outbound handler with a config object built already.
+func CreateOutboundHandlerFromConfig(name string, space app.Space, config interface{}) (proxy.OutboundHandler, error) {
+	return internal.CreateOutboundHandlerFromConfig(name, space, config)
+}
+
+// ValidateInboundConfig checks the config of an inbound handler without creating it.
+func ValidateInboundConfig(name string, rawConfig []byte) error {
+	return internal.ValidateInboundConfig(name, rawConfig)
+}
+
+// ValidateOutboundConfig checks the config of an outbound handler without creating it.
+func ValidateOutboundConfig(name string, rawConfig []byte) error {
+	return internal.ValidateOutboundConfig(name, rawConfig)
+}
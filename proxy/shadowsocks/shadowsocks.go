@@ -5,9 +5,12 @@ import (
 	"crypto/rand"
 	"io"
 	"sync"
+	"time"
 
 	"github.com/v2ray/v2ray-core/app"
 	"github.com/v2ray/v2ray-core/app/dispatcher"
+	"github.com/v2ray/v2ray-core/app/metrics"
+	"github.com/v2ray/v2ray-core/app/policy"
 	"github.com/v2ray/v2ray-core/common/alloc"
 	"github.com/v2ray/v2ray-core/common/crypto"
 	v2io "github.com/v2ray/v2ray-core/common/io"
@@ -15,6 +18,7 @@ import (
 	v2net "github.com/v2ray/v2ray-core/common/net"
 	"github.com/v2ray/v2ray-core/common/protocol"
 	"github.com/v2ray/v2ray-core/common/serial"
+	"github.com/v2ray/v2ray-core/common/signal"
 	"github.com/v2ray/v2ray-core/proxy"
 	"github.com/v2ray/v2ray-core/proxy/internal"
 	"github.com/v2ray/v2ray-core/transport/hub"
@@ -28,12 +32,16 @@ type Shadowsocks struct {
 	tcpHub           *hub.TCPHub
 	udpHub           *hub.UDPHub
 	udpServer        *hub.UDPServer
+	metrics          metrics.Recorder
+	policy           *policy.PolicyManager
 }
 
-func NewShadowsocks(config *Config, packetDispatcher dispatcher.PacketDispatcher) *Shadowsocks {
+func NewShadowsocks(config *Config, packetDispatcher dispatcher.PacketDispatcher, recorder metrics.Recorder, policyManager *policy.PolicyManager) *Shadowsocks {
 	return &Shadowsocks{
 		config:           config,
 		packetDispatcher: packetDispatcher,
+		metrics:          recorder,
+		policy:           policyManager,
 	}
 }
 
@@ -53,6 +61,9 @@ func (this *Shadowsocks) Close() {
 		this.udpHub.Close()
 		this.udpHub = nil
 	}
+	if this.udpServer != nil {
+		this.udpServer.Close()
+	}
 
 }
 
@@ -107,12 +118,13 @@ func (this *Shadowsocks) handlerUDPPayload(payload *alloc.Buffer, source v2net.D
 	request, err := ReadRequest(reader, NewAuthenticator(HeaderKeyGenerator(key, iv)), true)
 	if err != nil {
 		log.Access(source, serial.StringLiteral(""), log.AccessRejected, serial.StringLiteral(err.Error()))
+		this.metrics.RecordAccess(log.AccessRejected)
 		log.Warning("Shadowsocks: Invalid request from ", source, ": ", err)
 		return
 	}
 
 	dest := v2net.UDPDestination(request.Address, request.Port)
-	log.Access(source, dest, log.AccessAccepted, serial.StringLiteral(""))
+	this.metrics.RecordAccess(log.AccessAccepted)
 	log.Info("Shadowsocks: Tunnelling request to ", dest)
 
 	packet := v2net.NewPacket(dest, request.UDPPayload, false)
@@ -163,12 +175,14 @@ func (this *Shadowsocks) handleConnection(conn *hub.TCPConn) {
 	buffer := alloc.NewSmallBuffer()
 	defer buffer.Release()
 
-	timedReader := v2net.NewTimeOutReader(16, conn)
+	userPolicy := this.policy.ForLevel(this.config.Level)
+	timedReader := v2net.NewTimeOutReader(int(userPolicy.HandshakeTimeout/time.Second), conn)
 
 	ivLen := this.config.Cipher.IVSize()
 	_, err := io.ReadFull(timedReader, buffer.Value[:ivLen])
 	if err != nil {
 		log.Access(conn.RemoteAddr(), serial.StringLiteral(""), log.AccessRejected, serial.StringLiteral(err.Error()))
+		this.metrics.RecordAccess(log.AccessRejected)
 		log.Error("Shadowsocks: Failed to read IV: ", err)
 		return
 	}
@@ -182,24 +196,35 @@ func (this *Shadowsocks) handleConnection(conn *hub.TCPConn) {
 		return
 	}
 
-	reader := crypto.NewCryptionReader(stream, timedReader)
+	timer := signal.CancelAfterInactivity(func() {
+		conn.Close()
+	}, 0)
+	defer timer.Close()
+
+	reader := crypto.NewCryptionReader(stream, signal.NewActivityReader(timedReader, timer))
 
 	request, err := ReadRequest(reader, NewAuthenticator(HeaderKeyGenerator(key, iv)), false)
 	if err != nil {
 		log.Access(conn.RemoteAddr(), serial.StringLiteral(""), log.AccessRejected, serial.StringLiteral(err.Error()))
+		this.metrics.RecordAccess(log.AccessRejected)
 		log.Warning("Shadowsocks: Invalid request from ", conn.RemoteAddr(), ": ", err)
 		return
 	}
 
-	userSettings := protocol.GetUserSettings(this.config.Level)
-	timedReader.SetTimeOut(userSettings.PayloadReadTimeout)
+	// Idle connections are closed by the dispatcher from now on.
+	timedReader.SetTimeOut(0)
 
 	dest := v2net.TCPDestination(request.Address, request.Port)
-	log.Access(conn.RemoteAddr(), dest, log.AccessAccepted, serial.StringLiteral(""))
+	this.metrics.RecordAccess(log.AccessAccepted)
 	log.Info("Shadowsocks: Tunnelling request to ", dest)
 
 	packet := v2net.NewPacket(dest, nil, true)
-	ray := this.packetDispatcher.DispatchToOutbound(packet)
+	user := &protocol.User{
+		Level: this.config.Level,
+		Email: this.config.Email,
+	}
+	ray := dispatcher.DispatchToOutboundForUser(this.packetDispatcher, conn.RemoteAddr(), user, packet)
+	defer ray.Cancel()
 
 	var writeFinish sync.Mutex
 	writeFinish.Lock()
@@ -221,6 +246,7 @@ func (this *Shadowsocks) handleConnection(conn *hub.TCPConn) {
 			writer := crypto.NewCryptionWriter(stream, conn)
 			v2io.ChanToRawWriter(writer, ray.InboundOutput())
 		}
+		timer.SetTimeout(userPolicy.UplinkOnlyTimeout)
 		writeFinish.Unlock()
 	}()
 
@@ -246,6 +272,8 @@ func init() {
 			}
 			return NewShadowsocks(
 				rawConfig.(*Config),
-				space.GetApp(dispatcher.APP_ID).(dispatcher.PacketDispatcher)), nil
+				space.GetApp(dispatcher.APP_ID).(dispatcher.PacketDispatcher),
+				metrics.GetRecorder(space),
+				policy.GetPolicyManager(space)), nil
 		})
 }
@@ -2,6 +2,7 @@ package socks
 
 import (
 	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
 )
 
 const (
@@ -14,6 +15,7 @@ type Config struct {
 	Accounts   map[string]string
 	Address    v2net.Address
 	UDPEnabled bool
+	Level      proto.UserLevel // User level of all connections, which decides their policy.
 }
 
 func (this *Config) HasAccount(username, password string) bool {
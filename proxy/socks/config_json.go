@@ -7,6 +7,7 @@ import (
 
 	"github.com/v2ray/v2ray-core/common/log"
 	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
 	"github.com/v2ray/v2ray-core/proxy/internal"
 	"github.com/v2ray/v2ray-core/proxy/internal/config"
 )
@@ -29,6 +30,7 @@ func init() {
 				Accounts   []*SocksAccount    `json:"accounts"`
 				UDP        bool               `json:"udp"`
 				Host       *v2net.AddressJson `json:"ip"`
+				Level      byte               `json:"level"`
 			}
 
 			rawConfig := new(SocksConfig)
@@ -58,6 +60,7 @@ func init() {
 			} else {
 				socksConfig.Address = v2net.IPAddress([]byte{127, 0, 0, 1})
 			}
+			socksConfig.Level = proto.UserLevel(rawConfig.Level)
 			return socksConfig, nil
 		})
 }
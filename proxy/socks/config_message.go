@@ -0,0 +1,49 @@
+package socks
+
+import (
+	"github.com/v2ray/v2ray-core/common/loader"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+	"github.com/v2ray/v2ray-core/proxy/internal"
+)
+
+// AccountMessage is a user of socks inbound with password authentication.
+type AccountMessage struct {
+	Username string `protobuf:"bytes,1,opt,name=username"`
+	Password string `protobuf:"bytes,2,opt,name=password"`
+}
+
+// ConfigMessage is the typed schema of Config.
+type ConfigMessage struct {
+	AuthType uint32            `protobuf:"varint,1,opt,name=auth_type"` // AuthTypeNoAuth or AuthTypePassword.
+	Account  []*AccountMessage `protobuf:"bytes,2,rep,name=account"`
+	Udp      bool              `protobuf:"varint,3,opt,name=udp"`
+	Address  string            `protobuf:"bytes,4,opt,name=address"` // Address for UDP, 127.0.0.1 if empty.
+	Level    uint32            `protobuf:"varint,5,opt,name=level"`
+}
+
+func (this *ConfigMessage) Build() (interface{}, error) {
+	if this.AuthType != uint32(AuthTypeNoAuth) && this.AuthType != uint32(AuthTypePassword) || this.Level > 255 {
+		return nil, internal.ErrorBadConfiguration
+	}
+	config := &Config{
+		AuthType:   byte(this.AuthType),
+		UDPEnabled: this.Udp,
+		Address:    v2net.IPAddress([]byte{127, 0, 0, 1}),
+		Level:      proto.UserLevel(this.Level),
+	}
+	if len(this.Account) > 0 {
+		config.Accounts = make(map[string]string, len(this.Account))
+		for _, account := range this.Account {
+			config.Accounts[account.Username] = account.Password
+		}
+	}
+	if len(this.Address) > 0 {
+		config.Address = v2net.ParseAddress(this.Address)
+	}
+	return config, nil
+}
+
+func init() {
+	loader.MustRegisterType("v2ray.core.proxy.socks.Config", (*ConfigMessage)(nil))
+}
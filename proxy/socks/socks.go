@@ -7,9 +7,12 @@ import (
 	"time"
 
 	"github.com/v2ray/v2ray-core/app/dispatcher"
+	"github.com/v2ray/v2ray-core/app/policy"
 	v2io "github.com/v2ray/v2ray-core/common/io"
 	"github.com/v2ray/v2ray-core/common/log"
 	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+	"github.com/v2ray/v2ray-core/common/serial"
 	"github.com/v2ray/v2ray-core/proxy"
 	"github.com/v2ray/v2ray-core/proxy/socks/protocol"
 	"github.com/v2ray/v2ray-core/transport/hub"
@@ -32,13 +35,15 @@ type SocksServer struct {
 	udpAddress       v2net.Destination
 	udpServer        *hub.UDPServer
 	listeningPort    v2net.Port
+	policy           *policy.PolicyManager
 }
 
 // NewSocksSocks creates a new SocksServer object.
-func NewSocksServer(config *Config, packetDispatcher dispatcher.PacketDispatcher) *SocksServer {
+func NewSocksServer(config *Config, packetDispatcher dispatcher.PacketDispatcher, policyManager *policy.PolicyManager) *SocksServer {
 	return &SocksServer{
 		config:           config,
 		packetDispatcher: packetDispatcher,
+		policy:           policyManager,
 	}
 }
 
@@ -62,6 +67,9 @@ func (this *SocksServer) Close() {
 		this.udpHub = nil
 		this.udpMutex.Unlock()
 	}
+	if this.udpServer != nil {
+		this.udpServer.Close()
+	}
 }
 
 // Listen implements InboundHandler.Listen().
@@ -93,7 +101,8 @@ func (this *SocksServer) Listen(port v2net.Port) error {
 func (this *SocksServer) handleConnection(connection *hub.TCPConn) {
 	defer connection.Close()
 
-	timedReader := v2net.NewTimeOutReader(120, connection)
+	handshakeTimeout := this.policy.ForLevel(this.config.Level).HandshakeTimeout
+	timedReader := v2net.NewTimeOutReader(int(handshakeTimeout/time.Second), connection)
 	reader := v2io.NewBufferedReader(timedReader)
 
 	writer := v2io.NewBufferedWriter(connection)
@@ -105,13 +114,13 @@ func (this *SocksServer) handleConnection(connection *hub.TCPConn) {
 	}
 
 	if err != nil && err == protocol.Socks4Downgrade {
-		this.handleSocks4(reader, writer, auth4)
+		this.handleSocks4(connection.RemoteAddr(), timedReader, reader, writer, auth4)
 	} else {
-		this.handleSocks5(reader, writer, auth)
+		this.handleSocks5(connection.RemoteAddr(), timedReader, reader, writer, auth)
 	}
 }
 
-func (this *SocksServer) handleSocks5(reader *v2io.BufferedReader, writer *v2io.BufferedWriter, auth protocol.Socks5AuthenticationRequest) error {
+func (this *SocksServer) handleSocks5(source serial.String, timedReader *v2net.TimeOutReader, reader *v2io.BufferedReader, writer *v2io.BufferedWriter, auth protocol.Socks5AuthenticationRequest) error {
 	expectedAuthMethod := protocol.AuthNotRequired
 	if this.config.AuthType == AuthTypePassword {
 		expectedAuthMethod = protocol.AuthUserPass
@@ -205,7 +214,7 @@ func (this *SocksServer) handleSocks5(reader *v2io.BufferedReader, writer *v2io.
 	log.Info("Socks: TCP Connect request to ", dest)
 
 	packet := v2net.NewPacket(dest, nil, true)
-	this.transport(reader, writer, packet)
+	this.transport(source, timedReader, reader, writer, packet)
 	return nil
 }
 
@@ -241,7 +250,7 @@ func (this *SocksServer) handleUDP(reader io.Reader, writer *v2io.BufferedWriter
 	return nil
 }
 
-func (this *SocksServer) handleSocks4(reader *v2io.BufferedReader, writer *v2io.BufferedWriter, auth protocol.Socks4AuthenticationRequest) error {
+func (this *SocksServer) handleSocks4(source serial.String, timedReader *v2net.TimeOutReader, reader *v2io.BufferedReader, writer *v2io.BufferedWriter, auth protocol.Socks4AuthenticationRequest) error {
 	result := protocol.Socks4RequestGranted
 	if auth.Command == protocol.CmdBind {
 		result = protocol.Socks4RequestRejected
@@ -260,12 +269,21 @@ func (this *SocksServer) handleSocks4(reader *v2io.BufferedReader, writer *v2io.
 
 	dest := v2net.TCPDestination(v2net.IPAddress(auth.IP[:]), auth.Port)
 	packet := v2net.NewPacket(dest, nil, true)
-	this.transport(reader, writer, packet)
+	this.transport(source, timedReader, reader, writer, packet)
 	return nil
 }
 
-func (this *SocksServer) transport(reader io.Reader, writer io.Writer, firstPacket v2net.Packet) {
-	ray := this.packetDispatcher.DispatchToOutbound(firstPacket)
+// transport forwards traffic between the client at source and the destination in the given packet.
+// timedReader is the underlying reader of the given reader, whose handshake timeout is removed as idle
+// connections are closed by the dispatcher.
+func (this *SocksServer) transport(source serial.String, timedReader *v2net.TimeOutReader, reader io.Reader, writer io.Writer, firstPacket v2net.Packet) {
+	timedReader.SetTimeOut(0)
+
+	user := &proto.User{
+		Level: this.config.Level,
+	}
+	ray := dispatcher.DispatchToOutboundForUser(this.packetDispatcher, source, user, firstPacket)
+	defer ray.Cancel()
 	input := ray.InboundInput()
 	output := ray.InboundOutput()
 
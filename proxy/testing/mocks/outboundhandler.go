@@ -46,6 +46,9 @@ func (this *OutboundConnectionHandler) Dispatch(packet v2net.Packet, ray ray.Out
 	return nil
 }
 
+func (this *OutboundConnectionHandler) Close() {
+}
+
 func (this *OutboundConnectionHandler) Create(space app.Space, config interface{}) (proxy.OutboundHandler, error) {
 	return this, nil
 }
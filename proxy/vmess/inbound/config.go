@@ -1,6 +1,8 @@
 package inbound
 
 import (
+	"time"
+
 	proto "github.com/v2ray/v2ray-core/common/protocol"
 )
 
@@ -17,8 +19,16 @@ type DefaultConfig struct {
 	Level    proto.UserLevel
 }
 
+// UserOptions contains the state of an allowed user, other than its identity.
+type UserOptions struct {
+	Expiry   time.Time // The user is removed after this time. Zero for never.
+	Disabled bool
+}
+
 type Config struct {
 	AllowedUsers []*proto.User
+	UserOptions  map[string]*UserOptions // Options of allowed users by email.
 	Features     *FeaturesConfig
 	Defaults     *DefaultConfig
+	AEADOnly     bool // Whether to reject request headers not in AEAD mode, once all clients support it.
 }
@@ -4,6 +4,7 @@ package inbound
 
 import (
 	"encoding/json"
+	"time"
 
 	proto "github.com/v2ray/v2ray-core/common/protocol"
 	"github.com/v2ray/v2ray-core/proxy/internal/config"
@@ -55,14 +56,43 @@ func (this *Config) UnmarshalJSON(data []byte) error {
 		Users    []*proto.User   `json:"clients"`
 		Features *FeaturesConfig `json:"features"`
 		Defaults *DefaultConfig  `json:"default"`
+		AEADOnly bool            `json:"aeadOnly"`
 	}
 	jsonConfig := new(JsonConfig)
 	if err := json.Unmarshal(data, jsonConfig); err != nil {
 		return err
 	}
 	this.AllowedUsers = jsonConfig.Users
+
+	type JsonUserOptions struct {
+		Email   string `json:"email"`
+		Expiry  int64  `json:"expiry"` // Unix time.
+		Enabled *bool  `json:"enabled"`
+	}
+	type JsonClients struct {
+		Users []*JsonUserOptions `json:"clients"`
+	}
+	jsonClients := new(JsonClients)
+	if err := json.Unmarshal(data, jsonClients); err != nil {
+		return err
+	}
+	this.UserOptions = make(map[string]*UserOptions)
+	for _, jsonOptions := range jsonClients.Users {
+		if len(jsonOptions.Email) == 0 {
+			continue
+		}
+		options := new(UserOptions)
+		if jsonOptions.Expiry > 0 {
+			options.Expiry = time.Unix(jsonOptions.Expiry, 0)
+		}
+		if jsonOptions.Enabled != nil {
+			options.Disabled = !*jsonOptions.Enabled
+		}
+		this.UserOptions[jsonOptions.Email] = options
+	}
 	this.Features = jsonConfig.Features
 	this.Defaults = jsonConfig.Defaults
+	this.AEADOnly = jsonConfig.AEADOnly
 	if this.Defaults == nil {
 		this.Defaults = &DefaultConfig{
 			Level:    proto.UserLevel(0),
@@ -0,0 +1,51 @@
+// +build json
+
+package inbound_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/v2ray/v2ray-core/proxy/vmess/inbound"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+func TestUserOptionsParsing(t *testing.T) {
+	v2testing.Current(t)
+
+	config := new(Config)
+	err := json.Unmarshal([]byte(`{
+    "clients": [
+      {"id": "96edb838-6d68-42ef-a933-25f7ac3a9d09", "email": "love@v2ray.com", "expiry": 1500000000},
+      {"id": "ad937d9d-6e23-4a5a-ba23-bce5092a7c51", "email": "disabled@v2ray.com", "enabled": false},
+      {"id": "a9a3f7e6-9b6e-4d93-8c6b-2a4b7e0c1f3d", "email": "plain@v2ray.com"}
+    ]
+  }`), config)
+	assert.Error(err).IsNil()
+	assert.Int(len(config.AllowedUsers)).Equals(3)
+
+	options := config.UserOptions["love@v2ray.com"]
+	assert.Int64(options.Expiry.Unix()).Equals(1500000000)
+	assert.Bool(options.Disabled).IsFalse()
+
+	options = config.UserOptions["disabled@v2ray.com"]
+	assert.Bool(options.Expiry.IsZero()).IsTrue()
+	assert.Bool(options.Disabled).IsTrue()
+
+	options = config.UserOptions["plain@v2ray.com"]
+	assert.Bool(options.Expiry.IsZero()).IsTrue()
+	assert.Bool(options.Disabled).IsFalse()
+}
+
+func TestAEADOnlyParsing(t *testing.T) {
+	v2testing.Current(t)
+
+	config := new(Config)
+	assert.Error(json.Unmarshal([]byte(`{"clients": []}`), config)).IsNil()
+	assert.Bool(config.AEADOnly).IsFalse()
+
+	config = new(Config)
+	assert.Error(json.Unmarshal([]byte(`{"clients": [], "aeadOnly": true}`), config)).IsNil()
+	assert.Bool(config.AEADOnly).IsTrue()
+}
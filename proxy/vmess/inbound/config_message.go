@@ -0,0 +1,71 @@
+package inbound
+
+import (
+	"time"
+
+	"github.com/v2ray/v2ray-core/common/loader"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+	"github.com/v2ray/v2ray-core/proxy/internal"
+)
+
+// ClientMessage is an allowed user of VMess inbound.
+type ClientMessage struct {
+	User     *proto.UserMessage `protobuf:"bytes,1,opt,name=user"`
+	Expiry   int64              `protobuf:"varint,2,opt,name=expiry"` // Unix time, never if 0.
+	Disabled bool               `protobuf:"varint,3,opt,name=disabled"`
+}
+
+// ConfigMessage is the typed schema of Config.
+type ConfigMessage struct {
+	Client         []*ClientMessage `protobuf:"bytes,1,rep,name=client"`
+	DetourTo       string           `protobuf:"bytes,2,opt,name=detour_to"`
+	DefaultAlterId uint32           `protobuf:"varint,3,opt,name=default_alter_id"` // 32 if 0.
+	DefaultLevel   uint32           `protobuf:"varint,4,opt,name=default_level"`
+	AeadOnly       bool             `protobuf:"varint,5,opt,name=aead_only"`
+}
+
+func (this *ConfigMessage) Build() (interface{}, error) {
+	if this.DefaultAlterId > 65535 || this.DefaultLevel > 255 {
+		return nil, internal.ErrorBadConfiguration
+	}
+	config := &Config{
+		AllowedUsers: make([]*proto.User, 0, len(this.Client)),
+		UserOptions:  make(map[string]*UserOptions),
+		Defaults: &DefaultConfig{
+			AlterIDs: uint16(this.DefaultAlterId),
+			Level:    proto.UserLevel(this.DefaultLevel),
+		},
+		AEADOnly: this.AeadOnly,
+	}
+	if config.Defaults.AlterIDs == 0 {
+		config.Defaults.AlterIDs = 32
+	}
+	if len(this.DetourTo) > 0 {
+		config.Features = &FeaturesConfig{
+			Detour: &DetourConfig{ToTag: this.DetourTo},
+		}
+	}
+	for _, client := range this.Client {
+		if client.User == nil {
+			return nil, internal.ErrorBadConfiguration
+		}
+		user, err := client.User.Build()
+		if err != nil {
+			return nil, err
+		}
+		config.AllowedUsers = append(config.AllowedUsers, user)
+		if len(user.Email) == 0 {
+			continue
+		}
+		options := &UserOptions{Disabled: client.Disabled}
+		if client.Expiry > 0 {
+			options.Expiry = time.Unix(client.Expiry, 0)
+		}
+		config.UserOptions[user.Email] = options
+	}
+	return config, nil
+}
+
+func init() {
+	loader.MustRegisterType("v2ray.core.proxy.vmess.inbound.Config", (*ConfigMessage)(nil))
+}
@@ -2,9 +2,13 @@ package inbound
 
 import (
 	"sync"
+	"time"
 
 	"github.com/v2ray/v2ray-core/app"
 	"github.com/v2ray/v2ray-core/app/dispatcher"
+	"github.com/v2ray/v2ray-core/app/limiter"
+	"github.com/v2ray/v2ray-core/app/metrics"
+	"github.com/v2ray/v2ray-core/app/policy"
 	"github.com/v2ray/v2ray-core/app/proxyman"
 	v2io "github.com/v2ray/v2ray-core/common/io"
 	"github.com/v2ray/v2ray-core/common/log"
@@ -12,6 +16,7 @@ import (
 	proto "github.com/v2ray/v2ray-core/common/protocol"
 	raw "github.com/v2ray/v2ray-core/common/protocol/raw"
 	"github.com/v2ray/v2ray-core/common/serial"
+	"github.com/v2ray/v2ray-core/common/signal"
 	"github.com/v2ray/v2ray-core/common/uuid"
 	"github.com/v2ray/v2ray-core/proxy"
 	"github.com/v2ray/v2ray-core/proxy/internal"
@@ -57,6 +62,18 @@ func (this *userByEmail) Get(email string) (*proto.User, bool) {
 	return user, found
 }
 
+func (this *userByEmail) Set(user *proto.User) {
+	this.Lock()
+	this.cache[user.Email] = user
+	this.Unlock()
+}
+
+func (this *userByEmail) Remove(email string) {
+	this.Lock()
+	delete(this.cache, email)
+	this.Unlock()
+}
+
 // Inbound connection handler that handles messages in VMess format.
 type VMessInboundHandler struct {
 	sync.Mutex
@@ -67,7 +84,11 @@ type VMessInboundHandler struct {
 	accepting             bool
 	listener              *hub.TCPHub
 	features              *FeaturesConfig
+	aeadOnly              bool
 	listeningPort         v2net.Port
+	metrics               metrics.Recorder
+	limiter               *limiter.Limiter
+	policy                *policy.PolicyManager
 }
 
 func (this *VMessInboundHandler) Port() v2net.Port {
@@ -82,6 +103,7 @@ func (this *VMessInboundHandler) Close() {
 		this.listener = nil
 		this.Unlock()
 	}
+	this.clients.Close()
 }
 
 func (this *VMessInboundHandler) GetUser(email string) *proto.User {
@@ -92,6 +114,36 @@ func (this *VMessInboundHandler) GetUser(email string) *proto.User {
 	return user
 }
 
+func (this *VMessInboundHandler) AddUser(user *proto.User) error {
+	if len(user.Email) > 0 {
+		this.clients.Remove(user.Email)
+		this.usersByEmail.Set(user)
+	}
+	return this.clients.Add(user)
+}
+
+func (this *VMessInboundHandler) RemoveUser(email string) error {
+	if !this.clients.Remove(email) {
+		return proxy.ErrorUserNotFound
+	}
+	this.usersByEmail.Remove(email)
+	return nil
+}
+
+func (this *VMessInboundHandler) SetUserExpiry(email string, expiry time.Time) error {
+	if !this.clients.SetExpiry(email, expiry) {
+		return proxy.ErrorUserNotFound
+	}
+	return nil
+}
+
+func (this *VMessInboundHandler) SetUserEnabled(email string, enabled bool) error {
+	if !this.clients.SetEnabled(email, enabled) {
+		return proxy.ErrorUserNotFound
+	}
+	return nil
+}
+
 func (this *VMessInboundHandler) Listen(port v2net.Port) error {
 	if this.accepting {
 		if this.listeningPort == port {
@@ -101,6 +153,7 @@ func (this *VMessInboundHandler) Listen(port v2net.Port) error {
 		}
 	}
 	this.listeningPort = port
+	this.clients.Start()
 
 	tcpListener, err := hub.ListenTCP(port, this.HandleConnection)
 	if err != nil {
@@ -117,32 +170,51 @@ func (this *VMessInboundHandler) Listen(port v2net.Port) error {
 func (this *VMessInboundHandler) HandleConnection(connection *hub.TCPConn) {
 	defer connection.Close()
 
-	connReader := v2net.NewTimeOutReader(16, connection)
+	// The user is unknown until the request header is decoded, so the handshake follows the policy of
+	// untrusted users.
+	handshakeTimeout := this.policy.ForLevel(proto.UserLevelUntrusted).HandshakeTimeout
+	connReader := v2net.NewTimeOutReader(int(handshakeTimeout/time.Second), connection)
 	defer connReader.Release()
 
-	reader := v2io.NewBufferedReader(connReader)
+	timer := signal.CancelAfterInactivity(func() {
+		connection.Close()
+	}, 0)
+	defer timer.Close()
+
+	reader := v2io.NewBufferedReader(signal.NewActivityReader(connReader, timer))
 	defer reader.Release()
 
 	session := raw.NewServerSession(this.clients)
+	if this.aeadOnly {
+		session.DisableLegacyHeader()
+	}
 
 	request, err := session.DecodeRequestHeader(reader)
 	if err != nil {
 		log.Access(connection.RemoteAddr(), serial.StringLiteral(""), log.AccessRejected, serial.StringLiteral(err.Error()))
+		this.metrics.RecordAccess(log.AccessRejected)
 		log.Warning("VMessIn: Invalid request from ", connection.RemoteAddr(), ": ", err)
 		return
 	}
-	log.Access(connection.RemoteAddr(), request.Destination(), log.AccessAccepted, serial.StringLiteral(""))
+	if this.limiter != nil && this.limiter.IsOverQuota(request.User) {
+		log.Access(connection.RemoteAddr(), request.Destination(), log.AccessRejected, serial.StringLiteral(limiter.ErrorQuotaExceeded.Error()))
+		this.metrics.RecordAccess(log.AccessRejected)
+		log.Info("VMessIn: Quota of user ", request.User.Email, " is exceeded.")
+		return
+	}
+	this.metrics.RecordAccess(log.AccessAccepted)
 	log.Debug("VMessIn: Received request for ", request.Destination())
 
-	ray := this.packetDispatcher.DispatchToOutbound(v2net.NewPacket(request.Destination(), nil, true))
-	input := ray.InboundInput()
-	output := ray.InboundOutput()
+	link := dispatcher.DispatchToOutboundForUser(this.packetDispatcher, connection.RemoteAddr(), request.User, v2net.NewPacket(request.Destination(), nil, true))
+	defer link.Cancel()
+	input := link.InboundInput()
+	output := link.InboundOutput()
 	var readFinish, writeFinish sync.Mutex
 	readFinish.Lock()
 	writeFinish.Lock()
 
-	userSettings := proto.GetUserSettings(request.User.Level)
-	connReader.SetTimeOut(userSettings.PayloadReadTimeout)
+	// Idle connections are closed by the dispatcher from now on.
+	connReader.SetTimeOut(0)
 	reader.SetCached(false)
 	go func() {
 		defer close(input)
@@ -191,6 +263,7 @@ func (this *VMessInboundHandler) HandleConnection(connection *hub.TCPConn) {
 	}
 
 	connection.CloseWrite()
+	timer.SetTimeout(this.policy.ForLevel(request.User.Level).UplinkOnlyTimeout)
 	readFinish.Lock()
 }
 
@@ -205,13 +278,24 @@ func init() {
 			allowedClients := proto.NewTimedUserValidator(proto.DefaultIDHash)
 			for _, user := range config.AllowedUsers {
 				allowedClients.Add(user)
+				if options, found := config.UserOptions[user.Email]; found {
+					allowedClients.SetExpiry(user.Email, options.Expiry)
+					allowedClients.SetEnabled(user.Email, !options.Disabled)
+				}
 			}
 
 			handler := &VMessInboundHandler{
 				packetDispatcher: space.GetApp(dispatcher.APP_ID).(dispatcher.PacketDispatcher),
 				clients:          allowedClients,
 				features:         config.Features,
+				aeadOnly:         config.AEADOnly,
 				usersByEmail:     NewUserByEmail(config.AllowedUsers, config.Defaults),
+				metrics:          metrics.GetRecorder(space),
+				policy:           policy.GetPolicyManager(space),
+			}
+
+			if space.HasApp(limiter.APP_ID) {
+				handler.limiter = space.GetApp(limiter.APP_ID).(*limiter.Limiter)
 			}
 
 			if space.HasApp(proxyman.APP_ID_INBOUND_MANAGER) {
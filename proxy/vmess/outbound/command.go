@@ -6,19 +6,23 @@ import (
 	proto "github.com/v2ray/v2ray-core/common/protocol"
 )
 
-func (this *VMessOutboundHandler) handleSwitchAccount(cmd *protocol.CommandSwitchAccount) {
+// handleSwitchAccount adds the server in the given command as a detour, in AEAD mode if the server which
+// sent the command is.
+func (this *VMessOutboundHandler) handleSwitchAccount(cmd *protocol.CommandSwitchAccount, aead bool) {
 	user := proto.NewUser(proto.NewID(cmd.ID), cmd.Level, cmd.AlterIds.Value(), "")
 	dest := v2net.TCPDestination(cmd.Host, cmd.Port)
-	this.receiverManager.AddDetour(NewReceiver(dest, user), cmd.ValidMin)
+	rec := NewReceiver(dest, user)
+	rec.AEAD = aead
+	this.receiverManager.AddDetour(rec, cmd.ValidMin)
 }
 
-func (this *VMessOutboundHandler) handleCommand(dest v2net.Destination, cmd protocol.ResponseCommand) {
+func (this *VMessOutboundHandler) handleCommand(dest v2net.Destination, aead bool, cmd protocol.ResponseCommand) {
 	switch typedCommand := cmd.(type) {
 	case *protocol.CommandSwitchAccount:
 		if typedCommand.Host == nil {
 			typedCommand.Host = dest.Address()
 		}
-		this.handleSwitchAccount(typedCommand)
+		this.handleSwitchAccount(typedCommand, aead)
 	default:
 	}
 }
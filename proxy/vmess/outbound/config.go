@@ -1,5 +1,10 @@
 package outbound
 
+import (
+	"github.com/v2ray/v2ray-core/proxy/health"
+)
+
 type Config struct {
-	Receivers []*Receiver
+	Receivers   []*Receiver
+	HealthCheck *health.Config
 }
@@ -6,13 +6,15 @@ import (
 	"encoding/json"
 
 	"github.com/v2ray/v2ray-core/common/log"
+	"github.com/v2ray/v2ray-core/proxy/health"
 	"github.com/v2ray/v2ray-core/proxy/internal"
 	proxyconfig "github.com/v2ray/v2ray-core/proxy/internal/config"
 )
 
 func (this *Config) UnmarshalJSON(data []byte) error {
 	type RawOutbound struct {
-		Receivers []*Receiver `json:"vnext"`
+		Receivers   []*Receiver    `json:"vnext"`
+		HealthCheck *health.Config `json:"healthCheck"`
 	}
 	rawOutbound := &RawOutbound{}
 	err := json.Unmarshal(data, rawOutbound)
@@ -24,6 +26,7 @@ func (this *Config) UnmarshalJSON(data []byte) error {
 		return internal.ErrorBadConfiguration
 	}
 	this.Receivers = rawOutbound.Receivers
+	this.HealthCheck = rawOutbound.HealthCheck
 	return nil
 }
 
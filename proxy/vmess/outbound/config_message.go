@@ -0,0 +1,74 @@
+package outbound
+
+import (
+	"github.com/v2ray/v2ray-core/common/loader"
+	"github.com/v2ray/v2ray-core/common/log"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+	"github.com/v2ray/v2ray-core/proxy/health"
+	"github.com/v2ray/v2ray-core/proxy/internal"
+)
+
+// ReceiverMessage is the typed schema of Receiver.
+type ReceiverMessage struct {
+	Address string               `protobuf:"bytes,1,opt,name=address"`
+	Port    uint32               `protobuf:"varint,2,opt,name=port"`
+	User    []*proto.UserMessage `protobuf:"bytes,3,rep,name=user"`
+	Aead    bool                 `protobuf:"varint,4,opt,name=aead"`
+}
+
+func (this *ReceiverMessage) Build() (*Receiver, error) {
+	if len(this.User) == 0 {
+		log.Error("VMess: 0 user configured for VMess outbound.")
+		return nil, internal.ErrorBadConfiguration
+	}
+	if len(this.Address) == 0 {
+		log.Error("VMess: Address is not set in VMess outbound config.")
+		return nil, internal.ErrorBadConfiguration
+	}
+	if this.Port == 0 || this.Port > 65535 {
+		return nil, internal.ErrorBadConfiguration
+	}
+	users := make([]*proto.User, len(this.User))
+	for idx, userMessage := range this.User {
+		user, err := userMessage.Build()
+		if err != nil {
+			return nil, err
+		}
+		users[idx] = user
+	}
+	receiver := NewReceiver(v2net.TCPDestination(v2net.ParseAddress(this.Address), v2net.Port(this.Port)), users...)
+	receiver.AEAD = this.Aead
+	return receiver, nil
+}
+
+// ConfigMessage is the typed schema of Config.
+type ConfigMessage struct {
+	Receiver    []*ReceiverMessage    `protobuf:"bytes,1,rep,name=receiver"`
+	HealthCheck *health.ConfigMessage `protobuf:"bytes,2,opt,name=health_check"`
+}
+
+func (this *ConfigMessage) Build() (interface{}, error) {
+	if len(this.Receiver) == 0 {
+		log.Error("VMess: 0 VMess receiver configured.")
+		return nil, internal.ErrorBadConfiguration
+	}
+	config := &Config{
+		Receivers: make([]*Receiver, len(this.Receiver)),
+	}
+	for idx, receiverMessage := range this.Receiver {
+		receiver, err := receiverMessage.Build()
+		if err != nil {
+			return nil, err
+		}
+		config.Receivers[idx] = receiver
+	}
+	if this.HealthCheck != nil {
+		config.HealthCheck = this.HealthCheck.Build()
+	}
+	return config, nil
+}
+
+func init() {
+	loader.MustRegisterType("v2ray.core.proxy.vmess.outbound.Config", (*ConfigMessage)(nil))
+}
@@ -1,28 +1,40 @@
 package outbound
 
 import (
+	"io"
 	"net"
 	"sync"
 
 	"github.com/v2ray/v2ray-core/app"
+	"github.com/v2ray/v2ray-core/app/dns"
+	"github.com/v2ray/v2ray-core/app/metrics"
+	"github.com/v2ray/v2ray-core/app/policy"
 	"github.com/v2ray/v2ray-core/common/alloc"
 	v2io "github.com/v2ray/v2ray-core/common/io"
 	"github.com/v2ray/v2ray-core/common/log"
 	v2net "github.com/v2ray/v2ray-core/common/net"
 	proto "github.com/v2ray/v2ray-core/common/protocol"
 	raw "github.com/v2ray/v2ray-core/common/protocol/raw"
+	"github.com/v2ray/v2ray-core/common/signal"
 	"github.com/v2ray/v2ray-core/proxy"
+	"github.com/v2ray/v2ray-core/proxy/health"
 	"github.com/v2ray/v2ray-core/proxy/internal"
 	vmessio "github.com/v2ray/v2ray-core/proxy/vmess/io"
+	"github.com/v2ray/v2ray-core/transport/dialer"
 	"github.com/v2ray/v2ray-core/transport/ray"
 )
 
 type VMessOutboundHandler struct {
 	receiverManager *ReceiverManager
+	metrics         metrics.Recorder
+	policy          *policy.PolicyManager
+	dns             dns.Server
+	conns           internal.ConnectionSet
 }
 
 func (this *VMessOutboundHandler) Dispatch(firstPacket v2net.Packet, ray ray.OutboundRay) error {
-	vNextAddress, vNextUser := this.receiverManager.PickReceiver()
+	rec := this.receiverManager.pickReceiver()
+	vNextUser := rec.PickUser()
 
 	command := proto.RequestCommandTCP
 	if firstPacket.Destination().IsUDP() {
@@ -39,34 +51,41 @@ func (this *VMessOutboundHandler) Dispatch(firstPacket v2net.Packet, ray ray.Out
 		request.Option |= proto.RequestOptionChunkStream
 	}
 
-	return this.startCommunicate(request, vNextAddress, ray, firstPacket)
+	return this.startCommunicate(request, rec.Destination, rec.AEAD, ray, firstPacket)
 }
 
-func (this *VMessOutboundHandler) startCommunicate(request *proto.RequestHeader, dest v2net.Destination, ray ray.OutboundRay, firstPacket v2net.Packet) error {
-	var destIP net.IP
-	if dest.Address().IsIPv4() || dest.Address().IsIPv6() {
-		destIP = dest.Address().IP()
-	} else {
-		ips, err := net.LookupIP(dest.Address().Domain())
-		if err != nil {
-			return err
-		}
-		destIP = ips[0]
+func (this *VMessOutboundHandler) startCommunicate(request *proto.RequestHeader, dest v2net.Destination, aead bool, ray ray.OutboundRay, firstPacket v2net.Packet) error {
+	rawConn, err := dialer.Dial(dest, this.dns, ray.Done())
+	if err == dialer.ErrorCanceled {
+		log.Info("VMessOut: Connection to ", dest, " is canceled.")
+		close(ray.OutboundOutput())
+		return err
 	}
-	conn, err := net.DialTCP("tcp", nil, &net.TCPAddr{
-		IP:   destIP,
-		Port: int(dest.Port()),
-	})
 	if err != nil {
 		log.Error("Failed to open ", dest, ": ", err)
-		if ray != nil {
-			close(ray.OutboundOutput())
-		}
+		this.metrics.RecordDialFailure()
+		close(ray.OutboundOutput())
 		return err
 	}
+	conn := rawConn.(*net.TCPConn)
 	log.Info("VMessOut: Tunneling request to ", request.Address, " via ", dest)
 
 	defer conn.Close()
+	if !this.conns.Add(conn) {
+		firstPacket.Chunk().Release()
+		close(ray.OutboundOutput())
+		return proxy.ErrorClosed
+	}
+	defer this.conns.Remove(conn)
+	stopWatching := signal.OnDone(ray.Done(), func() {
+		conn.Close()
+	})
+	defer stopWatching()
+
+	timer := signal.CancelAfterInactivity(func() {
+		conn.Close()
+	}, 0)
+	defer timer.Close()
 
 	input := ray.OutboundInput()
 	output := ray.OutboundOutput()
@@ -76,12 +95,17 @@ func (this *VMessOutboundHandler) startCommunicate(request *proto.RequestHeader,
 	responseFinish.Lock()
 
 	session := raw.NewClientSession(proto.DefaultIDHash)
+	if aead {
+		session = raw.NewAEADClientSession()
+	}
 
 	go this.handleRequest(session, conn, request, firstPacket, input, &requestFinish)
-	go this.handleResponse(session, conn, request, dest, output, &responseFinish)
+	go this.handleResponse(session, signal.NewActivityReader(conn, timer), request, dest, aead, output, &responseFinish)
 
 	requestFinish.Lock()
 	conn.CloseWrite()
+	// Users are unknown to outbounds, so the policy of untrusted users applies.
+	timer.SetTimeout(this.policy.ForLevel(proto.UserLevelUntrusted).DownlinkOnlyTimeout)
 	responseFinish.Lock()
 	return nil
 }
@@ -126,7 +150,7 @@ func (this *VMessOutboundHandler) handleRequest(session *raw.ClientSession, conn
 	return
 }
 
-func (this *VMessOutboundHandler) handleResponse(session *raw.ClientSession, conn net.Conn, request *proto.RequestHeader, dest v2net.Destination, output chan<- *alloc.Buffer, finish *sync.Mutex) {
+func (this *VMessOutboundHandler) handleResponse(session *raw.ClientSession, conn io.Reader, request *proto.RequestHeader, dest v2net.Destination, aead bool, output chan<- *alloc.Buffer, finish *sync.Mutex) {
 	defer finish.Unlock()
 	defer close(output)
 
@@ -137,7 +161,7 @@ func (this *VMessOutboundHandler) handleResponse(session *raw.ClientSession, con
 		log.Warning("VMessOut: Failed to read response: ", err)
 		return
 	}
-	go this.handleCommand(dest, header.Command)
+	go this.handleCommand(dest, aead, header.Command)
 
 	reader.SetCached(false)
 	decryptReader := session.DecodeResponseBody(conn)
@@ -154,12 +178,68 @@ func (this *VMessOutboundHandler) handleResponse(session *raw.ClientSession, con
 	return
 }
 
+// Close stops health checking on receivers, and closes all connections in progress.
+func (this *VMessOutboundHandler) Close() {
+	this.receiverManager.Close()
+	this.conns.Close()
+}
+
+// StartHealthCheck implements proxy.HealthCheckingHandler.
+func (this *VMessOutboundHandler) StartHealthCheck() {
+	this.receiverManager.StartHealthCheck()
+}
+
+// StopHealthCheck implements proxy.HealthCheckingHandler.
+func (this *VMessOutboundHandler) StopHealthCheck() {
+	this.receiverManager.Close()
+}
+
+// HealthStatus implements health.Reporter. It returns the health state of the receivers.
+func (this *VMessOutboundHandler) HealthStatus() []*health.Status {
+	return this.receiverManager.HealthStatus()
+}
+
+// setupHealthCheck creates a health checker for each receiver. The checkers start with
+// StartHealthCheck.
+func (this *VMessOutboundHandler) setupHealthCheck(receivers []*Receiver, config *health.Config) error {
+	checkers := make([]*health.Checker, len(receivers))
+	for idx, rec := range receivers {
+		var prober health.Prober = &health.TCPProber{Destination: rec.Destination}
+		if len(config.URL) > 0 {
+			// Probe with a full request through this receiver only.
+			recHandler := &VMessOutboundHandler{
+				receiverManager: NewReceiverManager([]*Receiver{rec}),
+				metrics:         metrics.GetRecorder(nil),
+				policy:          this.policy,
+			}
+			urlProber, err := health.NewOutboundProber(recHandler, config.URL)
+			if err != nil {
+				log.Error("VMessOut: Invalid health check URL: ", config.URL, ": ", err)
+				return err
+			}
+			prober = urlProber
+		}
+		checkers[idx] = health.NewChecker("vmess:"+rec.Destination.String(), prober, config)
+	}
+	this.receiverManager.SetHealthCheckers(checkers)
+	return nil
+}
+
 func init() {
 	internal.MustRegisterOutboundHandlerCreator("vmess",
 		func(space app.Space, rawConfig interface{}) (proxy.OutboundHandler, error) {
 			vOutConfig := rawConfig.(*Config)
-			return &VMessOutboundHandler{
+			handler := &VMessOutboundHandler{
 				receiverManager: NewReceiverManager(vOutConfig.Receivers),
-			}, nil
+				metrics:         metrics.GetRecorder(space),
+				policy:          policy.GetPolicyManager(space),
+				dns:             dns.GetServer(space),
+			}
+			if vOutConfig.HealthCheck != nil {
+				if err := handler.setupHealthCheck(vOutConfig.Receivers, vOutConfig.HealthCheck); err != nil {
+					return nil, err
+				}
+			}
+			return handler, nil
 		})
 }
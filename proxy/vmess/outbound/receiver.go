@@ -7,12 +7,14 @@ import (
 	"github.com/v2ray/v2ray-core/common/dice"
 	v2net "github.com/v2ray/v2ray-core/common/net"
 	proto "github.com/v2ray/v2ray-core/common/protocol"
+	"github.com/v2ray/v2ray-core/proxy/health"
 )
 
 type Receiver struct {
 	sync.RWMutex
 	Destination v2net.Destination
 	Accounts    []*proto.User
+	AEAD        bool // Whether request headers to this server are in AEAD mode, which old servers don't support.
 }
 
 func NewReceiver(dest v2net.Destination, users ...*proto.User) *Receiver {
@@ -58,6 +60,7 @@ func (this *ExpiringReceiver) Expired() bool {
 
 type ReceiverManager struct {
 	receivers    []*Receiver
+	checkers     []*health.Checker
 	detours      []*ExpiringReceiver
 	detourAccess sync.RWMutex
 }
@@ -69,6 +72,35 @@ func NewReceiverManager(receivers []*Receiver) *ReceiverManager {
 	}
 }
 
+// SetHealthCheckers sets the health checker of each receiver, in the same order as the receivers.
+// Once set, receivers that are considered unhealthy are only picked when no receiver is healthy.
+func (this *ReceiverManager) SetHealthCheckers(checkers []*health.Checker) {
+	this.checkers = checkers
+}
+
+// StartHealthCheck starts all health checkers.
+func (this *ReceiverManager) StartHealthCheck() {
+	for _, checker := range this.checkers {
+		checker.Start()
+	}
+}
+
+// HealthStatus returns the health state of the receivers with health check.
+func (this *ReceiverManager) HealthStatus() []*health.Status {
+	statusList := make([]*health.Status, 0, len(this.checkers))
+	for _, checker := range this.checkers {
+		statusList = append(statusList, checker.Status())
+	}
+	return statusList
+}
+
+// Close stops all health checkers.
+func (this *ReceiverManager) Close() {
+	for _, checker := range this.checkers {
+		checker.Close()
+	}
+}
+
 func (this *ReceiverManager) AddDetour(rec *Receiver, availableMin byte) {
 	if availableMin < 2 {
 		return
@@ -122,14 +154,30 @@ func (this *ReceiverManager) pickDetour() *Receiver {
 }
 
 func (this *ReceiverManager) pickStdReceiver() *Receiver {
+	if len(this.checkers) == len(this.receivers) {
+		healthy := make([]*Receiver, 0, len(this.receivers))
+		for idx, rec := range this.receivers {
+			if this.checkers[idx].IsHealthy() {
+				healthy = append(healthy, rec)
+			}
+		}
+		if len(healthy) > 0 {
+			return healthy[dice.Roll(len(healthy))]
+		}
+	}
 	return this.receivers[dice.Roll(len(this.receivers))]
 }
 
-func (this *ReceiverManager) PickReceiver() (v2net.Destination, *proto.User) {
+func (this *ReceiverManager) pickReceiver() *Receiver {
 	rec := this.pickDetour()
 	if rec == nil {
 		rec = this.pickStdReceiver()
 	}
+	return rec
+}
+
+func (this *ReceiverManager) PickReceiver() (v2net.Destination, *proto.User) {
+	rec := this.pickReceiver()
 	user := rec.PickUser()
 
 	return rec.Destination, user
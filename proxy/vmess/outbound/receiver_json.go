@@ -16,6 +16,7 @@ func (this *Receiver) UnmarshalJSON(data []byte) error {
 		Address *v2net.AddressJson `json:"address"`
 		Port    v2net.Port         `json:"port"`
 		Users   []*proto.User      `json:"users"`
+		AEAD    bool               `json:"aead"`
 	}
 	var rawConfig RawConfigTarget
 	if err := json.Unmarshal(data, &rawConfig); err != nil {
@@ -31,5 +32,6 @@ func (this *Receiver) UnmarshalJSON(data []byte) error {
 		return internal.ErrorBadConfiguration
 	}
 	this.Destination = v2net.TCPDestination(rawConfig.Address.Address, rawConfig.Port)
+	this.AEAD = rawConfig.AEAD
 	return nil
 }
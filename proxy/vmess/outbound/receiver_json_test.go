@@ -32,4 +32,10 @@ func TestConfigTargetParsing(t *testing.T) {
 	assert.String(receiver.Destination).Equals("tcp:127.0.0.1:80")
 	assert.Int(len(receiver.Accounts)).Equals(1)
 	assert.String(receiver.Accounts[0].ID).Equals("e641f5ad-9397-41e3-bf1a-e8740dfed019")
+	assert.Bool(receiver.AEAD).IsFalse()
+
+	receiver = new(Receiver)
+	err = json.Unmarshal([]byte(`{"address": "127.0.0.1", "port": 80, "aead": true, "users": [{"id": "e641f5ad-9397-41e3-bf1a-e8740dfed019"}]}`), &receiver)
+	assert.Error(err).IsNil()
+	assert.Bool(receiver.AEAD).IsTrue()
 }
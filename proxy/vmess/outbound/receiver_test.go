@@ -1,11 +1,16 @@
 package outbound_test
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	v2net "github.com/v2ray/v2ray-core/common/net"
 	proto "github.com/v2ray/v2ray-core/common/protocol"
 	"github.com/v2ray/v2ray-core/common/uuid"
+	"github.com/v2ray/v2ray-core/proxy"
+	"github.com/v2ray/v2ray-core/proxy/health"
+	proxyrepo "github.com/v2ray/v2ray-core/proxy/repo"
 	. "github.com/v2ray/v2ray-core/proxy/vmess/outbound"
 	v2testing "github.com/v2ray/v2ray-core/testing"
 	"github.com/v2ray/v2ray-core/testing/assert"
@@ -28,3 +33,67 @@ func TestReceiverUser(t *testing.T) {
 	assert.Bool(rec.HasUser(user2)).IsTrue()
 	assert.Int(len(rec.Accounts)).Equals(2)
 }
+
+type staticProber struct {
+	err error
+}
+
+func (this *staticProber) Probe(timeout time.Duration) error {
+	return this.err
+}
+
+func TestPickHealthyReceiver(t *testing.T) {
+	v2testing.Current(t)
+
+	user := proto.NewUser(proto.NewID(uuid.New()), proto.UserLevel(0), 100, "")
+	recDown := NewReceiver(v2net.TCPDestination(v2net.DomainAddress("down.v2ray.com"), 80), user)
+	recUp := NewReceiver(v2net.TCPDestination(v2net.DomainAddress("up.v2ray.com"), 80), user)
+
+	checkerDown := health.NewChecker("down", &staticProber{err: errors.New("down")}, &health.Config{})
+	checkerDown.Check()
+	checkerUp := health.NewChecker("up", &staticProber{}, &health.Config{})
+	checkerUp.Check()
+
+	manager := NewReceiverManager([]*Receiver{recDown, recUp})
+	manager.SetHealthCheckers([]*health.Checker{checkerDown, checkerUp})
+
+	for i := 0; i < 16; i++ {
+		dest, _ := manager.PickReceiver()
+		assert.StringLiteral(dest.String()).Equals(recUp.Destination.String())
+	}
+}
+
+func waitForHealthCheck(reporter health.Reporter) bool {
+	for i := 0; i < 100; i++ {
+		if !reporter.HealthStatus()[0].LastCheck.IsZero() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestHealthCheckStartsSeparately(t *testing.T) {
+	v2testing.Current(t)
+
+	user := proto.NewUser(proto.NewID(uuid.New()), proto.UserLevel(0), 100, "")
+	rec := NewReceiver(v2net.TCPDestination(v2net.IPAddress([]byte{127, 0, 0, 1}), 50301), user)
+	handler, err := proxyrepo.CreateOutboundHandlerFromConfig("vmess", nil, &Config{
+		Receivers:   []*Receiver{rec},
+		HealthCheck: &health.Config{},
+	})
+	assert.Error(err).IsNil()
+	reporter := handler.(health.Reporter)
+	statusList := reporter.HealthStatus()
+	assert.Int(len(statusList)).Equals(1)
+	assert.StringLiteral(statusList[0].Name).Equals("vmess:" + rec.Destination.String())
+	time.Sleep(50 * time.Millisecond)
+	assert.Bool(reporter.HealthStatus()[0].LastCheck.IsZero()).IsTrue()
+
+	checkingHandler := handler.(proxy.HealthCheckingHandler)
+	checkingHandler.StartHealthCheck()
+	assert.Bool(waitForHealthCheck(reporter)).IsTrue()
+	assert.Bool(reporter.HealthStatus()[0].Healthy).IsFalse()
+	checkingHandler.StopHealthCheck()
+	handler.Close()
+}
@@ -20,9 +20,9 @@ import (
 	"github.com/v2ray/v2ray-core/testing/assert"
 )
 
-func TestVMessInAndOut(t *testing.T) {
-	v2testing.Current(t)
-
+// testVMessInAndOut sends data through a VMess outbound and inbound, with the given options in their
+// settings.
+func testVMessInAndOut(outboundOptions string, inboundOptions string) {
 	id, err := uuid.ParseString("ad937d9d-6e23-4a5a-ba23-bce5092a7c51")
 	assert.Error(err).IsNil()
 
@@ -56,7 +56,7 @@ func TestVMessInAndOut(t *testing.T) {
         "vnext": [
           {
             "address": "127.0.0.1",
-            "port": ` + portB.String() + `,
+            "port": ` + portB.String() + `,` + outboundOptions + `
             "users": [
               {"id": "` + testAccount.String() + `"}
             ]
@@ -91,7 +91,7 @@ func TestVMessInAndOut(t *testing.T) {
 			Settings: []byte(`{
         "clients": [
           {"id": "` + testAccount.String() + `"}
-        ]
+        ]` + inboundOptions + `
       }`),
 		},
 		OutboundConfig: &point.ConnectionConfig{
@@ -111,3 +111,22 @@ func TestVMessInAndOut(t *testing.T) {
 	assert.Bytes(ichConnInput).Equals(ochConnOutput.Bytes())
 	assert.Bytes(ichConnOutput.Bytes()).Equals(ochConnInput)
 }
+
+func TestVMessInAndOut(t *testing.T) {
+	v2testing.Current(t)
+
+	testVMessInAndOut("", "")
+}
+
+func TestVMessAEADInAndOut(t *testing.T) {
+	v2testing.Current(t)
+
+	testVMessInAndOut(`"aead": true,`, `, "aeadOnly": true`)
+}
+
+func TestVMessAEADWithMixedModeServer(t *testing.T) {
+	v2testing.Current(t)
+
+	// Servers accept both modes unless aeadOnly is set, so clients can migrate one by one.
+	testVMessInAndOut(`"aead": true,`, "")
+}
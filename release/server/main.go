@@ -4,7 +4,10 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
 
 	"github.com/v2ray/v2ray-core"
 	_ "github.com/v2ray/v2ray-core/app/router/rules"
@@ -13,6 +16,7 @@ import (
 
 	// The following are necessary as they register handlers in their init functions.
 	_ "github.com/v2ray/v2ray-core/proxy/blackhole"
+	_ "github.com/v2ray/v2ray-core/proxy/dns"
 	_ "github.com/v2ray/v2ray-core/proxy/dokodemo"
 	_ "github.com/v2ray/v2ray-core/proxy/freedom"
 	_ "github.com/v2ray/v2ray-core/proxy/http"
@@ -22,20 +26,34 @@ import (
 	_ "github.com/v2ray/v2ray-core/proxy/vmess/outbound"
 )
 
+// Exit codes of -test.
+const (
+	exitConfigInvalid = 1 // Problems found in the config files.
+	exitPointFailed   = 2 // Config files are valid, but the Point server can't be created, e.g., due to inaccessible log files.
+)
+
+// configFileList is the value of -config flags, which may be given more than once.
+type configFileList []string
+
+func (this *configFileList) String() string {
+	return strings.Join(*this, ", ")
+}
+
+func (this *configFileList) Set(value string) error {
+	*this = append(*this, value)
+	return nil
+}
+
 var (
-	configFile string
-	logLevel   = flag.String("loglevel", "warning", "Level of log info to be printed to console, available value: debug, info, warning, error")
-	version    = flag.Bool("version", false, "Show current version of V2Ray.")
-	test       = flag.Bool("test", false, "Test config file only, without launching V2Ray server.")
+	configFiles   configFileList
+	logLevel      = flag.String("loglevel", "warning", "Level of log info to be printed to console, available value: debug, info, warning, error")
+	version       = flag.Bool("version", false, "Show current version of V2Ray.")
+	test          = flag.Bool("test", false, "Test config file only, without launching V2Ray server. Exits with non-zero code if the config is invalid.")
+	configRefresh = flag.Duration("config-refresh", 0, "Interval of reloading config files when they change, e.g., 1m. Useful for configs from URLs. 0 means never.")
 )
 
 func init() {
-	defaultConfigFile := ""
-	workingDir, err := filepath.Abs(filepath.Dir(os.Args[0]))
-	if err == nil {
-		defaultConfigFile = filepath.Join(workingDir, "config.json")
-	}
-	flag.StringVar(&configFile, "config", defaultConfigFile, "Config file for this Point server.")
+	flag.Var(&configFiles, "config", "Config file or directory for this Point server, \""+point.StdinConfig+"\" for standard input, or a HTTP(S) URL. Multiple ones are merged in order. A single \""+point.SchemaConfigExtension+"\" or \""+point.SchemaTextConfigExtension+"\" file is loaded as a typed config message. (default: config.json next to the executable)")
 }
 
 func main() {
@@ -61,18 +79,22 @@ func main() {
 		return
 	}
 
-	if len(configFile) == 0 {
-		log.Error("Config file is not set.")
-		return
+	if len(configFiles) == 0 {
+		workingDir, err := filepath.Abs(filepath.Dir(os.Args[0]))
+		if err != nil {
+			log.Error("Config file is not set.")
+			return
+		}
+		configFiles = configFileList{filepath.Join(workingDir, "config.json")}
 	}
-	config, err := point.LoadConfig(configFile)
-	if err != nil {
-		log.Error("Failed to read config file (", configFile, "): ", configFile, err)
-		return
+	if *test {
+		os.Exit(testConfig())
 	}
 
-	if config.LogConfig != nil && len(config.LogConfig.AccessLog) > 0 {
-		log.InitAccessLogger(config.LogConfig.AccessLog)
+	config, err := point.LoadConfig(configFiles...)
+	if err != nil {
+		log.Error("Failed to read config file (", configFiles.String(), "): ", err)
+		return
 	}
 
 	vPoint, err := point.NewPoint(config)
@@ -81,17 +103,105 @@ func main() {
 		return
 	}
 
-	if *test {
-		fmt.Println("Configuration OK.")
-		return
-	}
-
 	err = vPoint.Start()
 	if err != nil {
 		log.Error("Error starting Point server: ", err)
 		return
 	}
 
-	finish := make(chan bool)
-	<-finish
+	if *configRefresh > 0 {
+		stopWatching := point.WatchConfig(config, *configRefresh, func(config *point.Config) {
+			log.Warning("Config changed, reloading: ", configFiles.String())
+			if err := vPoint.Reload(config); err != nil {
+				log.Error("Failed to reload config: ", err)
+			}
+		}, configFiles...)
+		defer stopWatching()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, append([]os.Signal{syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM}, reopenSignals...)...)
+	for sig := range signals {
+		if isReopenSignal(sig) {
+			log.Reopen()
+			continue
+		}
+		if sig != syscall.SIGHUP {
+			shutdown(vPoint, signals)
+			return
+		}
+		log.Warning("Reloading config file: ", configFiles.String())
+		config, err := point.LoadConfig(configFiles...)
+		if err != nil {
+			log.Error("Failed to read config file (", configFiles.String(), "): ", err)
+			continue
+		}
+		if err := vPoint.Reload(config); err != nil {
+			log.Error("Failed to reload config: ", err)
+		}
+	}
+}
+
+// testConfig validates the config files, and tries creating a Point server of them. It prints problems
+// found, and returns the exit code.
+func testConfig() int {
+	if problems := point.ValidateConfig(configFiles...); len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		fmt.Println("Configuration invalid:", len(problems), "problem(s) found.")
+		return exitConfigInvalid
+	}
+
+	config, err := point.LoadConfig(configFiles...)
+	if err != nil {
+		fmt.Println("Failed to read config file:", err)
+		return exitConfigInvalid
+	}
+	if _, err := point.NewPoint(config); err != nil {
+		fmt.Println("Failed to create Point server:", err)
+		return exitPointFailed
+	}
+	fmt.Println("Configuration OK.")
+	return 0
+}
+
+// shutdown drains active sessions of the given Point server before closing it. Another SIGINT or
+// SIGTERM during draining closes the server immediately.
+func shutdown(vPoint *point.Point, signals <-chan os.Signal) {
+	timeout := vPoint.GetConfig().DrainTimeout
+	log.Warning("Shutting down, draining connections for up to ", timeout)
+
+	done := make(chan bool)
+	go func() {
+		vPoint.Shutdown(timeout)
+		close(done)
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		case sig := <-signals:
+			if isReopenSignal(sig) {
+				log.Reopen()
+				continue
+			}
+			if sig == syscall.SIGHUP {
+				continue
+			}
+			log.Warning("Closing all connections.")
+			vPoint.Close()
+			return
+		}
+	}
+}
+
+func isReopenSignal(sig os.Signal) bool {
+	for _, reopenSignal := range reopenSignals {
+		if sig == reopenSignal {
+			return true
+		}
+	}
+	return false
 }
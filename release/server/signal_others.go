@@ -0,0 +1,11 @@
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reopenSignals are the signals to reopen log files on.
+var reopenSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,10 @@
+// +build windows
+
+package main
+
+import (
+	"os"
+)
+
+// reopenSignals are the signals to reopen log files on. There is no such signal on Windows.
+var reopenSignals = []os.Signal{}
@@ -0,0 +1,85 @@
+package point_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/v2ray/v2ray-core/app"
+	apptesting "github.com/v2ray/v2ray-core/app/testing"
+	"github.com/v2ray/v2ray-core/common/alloc"
+	"github.com/v2ray/v2ray-core/common/log"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+	"github.com/v2ray/v2ray-core/proxy"
+	proxytesting "github.com/v2ray/v2ray-core/proxy/testing"
+	"github.com/v2ray/v2ray-core/proxy/testing/mocks"
+	. "github.com/v2ray/v2ray-core/shell/point"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+func TestAccessLogAtSessionEnd(t *testing.T) {
+	v2testing.Current(t)
+
+	tempDir, err := ioutil.TempDir("", "v2ray-access")
+	assert.Error(err).IsNil()
+	defer os.RemoveAll(tempDir)
+	accessLog := filepath.Join(tempDir, "access.log")
+	defer log.SetFormat(log.FormatText)
+
+	inboundProtocol, err := proxytesting.RegisterInboundConnectionHandlerCreator("access_ich",
+		func(space app.Space, config interface{}) (proxy.InboundHandler, error) {
+			return new(recordingInboundHandler), nil
+		})
+	assert.Error(err).IsNil()
+
+	outboundProtocol, err := proxytesting.RegisterOutboundConnectionHandlerCreator("access_och",
+		func(space app.Space, config interface{}) (proxy.OutboundHandler, error) {
+			return &mocks.OutboundConnectionHandler{
+				ConnInput:  bytes.NewReader([]byte("response")),
+				ConnOutput: new(bytes.Buffer),
+			}, nil
+		})
+	assert.Error(err).IsNil()
+
+	vpoint, err := NewPoint(&Config{
+		Port:           v2net.Port(50081),
+		LogConfig:      &LogConfig{AccessLog: accessLog, Format: log.FormatJSON},
+		InboundConfig:  &ConnectionConfig{Protocol: inboundProtocol},
+		OutboundConfig: &ConnectionConfig{Protocol: outboundProtocol},
+	})
+	assert.Error(err).IsNil()
+
+	user := &proto.User{Email: "love@v2ray.com"}
+	source := v2net.TCPDestination(v2net.IPAddress([]byte{127, 0, 0, 1}), 50082)
+	dest := v2net.TCPDestination(v2net.DomainAddress("v2ray.com"), 80)
+	packet := v2net.NewPacket(dest, alloc.NewBuffer().Clear().Append([]byte("request")), false)
+	link := vpoint.DispatchToOutboundForUser(&apptesting.Context{CallerTagValue: "in"}, source, user, packet)
+	close(link.InboundInput())
+	for chunk := range link.InboundOutput() {
+		chunk.Release()
+	}
+
+	var content []byte
+	for i := 0; i < 100 && len(content) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		content, err = ioutil.ReadFile(accessLog)
+		assert.Error(err).IsNil()
+	}
+
+	entry := make(map[string]interface{})
+	assert.Error(json.Unmarshal(content, &entry)).IsNil()
+	assert.StringLiteral(entry["status"].(string)).Equals("accepted")
+	assert.StringLiteral(entry["inbound"].(string)).Equals("in")
+	assert.StringLiteral(entry["source"].(string)).Equals(source.String())
+	assert.StringLiteral(entry["destination"].(string)).Equals(dest.String())
+	assert.StringLiteral(entry["email"].(string)).Equals("love@v2ray.com")
+	assert.StringLiteral(entry["outbound"].(string)).Equals("vpoint-default-outbound")
+	assert.Int64(int64(entry["uplink"].(float64))).Equals(7)
+	assert.Int64(int64(entry["downlink"].(float64))).Equals(8)
+}
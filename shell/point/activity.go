@@ -0,0 +1,167 @@
+package point
+
+import (
+	"sync"
+	"time"
+
+	"github.com/v2ray/v2ray-core/app/policy"
+	"github.com/v2ray/v2ray-core/common/alloc"
+	"github.com/v2ray/v2ray-core/common/log"
+	"github.com/v2ray/v2ray-core/common/signal"
+	"github.com/v2ray/v2ray-core/transport/ray"
+)
+
+// activityRay cancels both directions of a session when there is no traffic for a while, when
+// Cancel is called, or when the inbound connection is canceled. Once a direction is closed, the
+// shorter timeout in policy applies to the other one.
+type activityRay struct {
+	sync.Mutex
+	input        chan *alloc.Buffer
+	output       chan *alloc.Buffer
+	timer        *signal.ActivityTimer
+	canceled     chan struct{}
+	cancelOnce   sync.Once
+	onDone       func()
+	uplinkDone   bool
+	downlinkDone bool
+	start        time.Time
+	uplink       int64 // Written by the uplink goroutine only.
+	downlink     int64 // Written by the downlink goroutine only.
+}
+
+// trackActivity returns an OutboundRay on top of the given one, which is canceled according to the
+// timeouts in the given policy. onDone, if not nil, is called once both directions are closed.
+func trackActivity(link ray.OutboundRay, sessionPolicy *policy.Policy, onDone func()) *activityRay {
+	this := newActivityRay(onDone)
+	this.run(link, sessionPolicy)
+	return this
+}
+
+// newActivityRay returns an activityRay which doesn't forward anything until run.
+func newActivityRay(onDone func()) *activityRay {
+	return &activityRay{
+		input:    make(chan *alloc.Buffer, 16),
+		output:   make(chan *alloc.Buffer, 16),
+		canceled: make(chan struct{}),
+		onDone:   onDone,
+		start:    time.Now(),
+	}
+}
+
+// run starts forwarding both directions of the given link, which are canceled according to the
+// timeouts in the given policy.
+func (this *activityRay) run(link ray.OutboundRay, sessionPolicy *policy.Policy) {
+	this.timer = signal.CancelAfterInactivity(func() {
+		log.Info("Point: Closing idle session.")
+		this.Cancel()
+	}, sessionPolicy.ConnIdleTimeout)
+
+	go func(upstream <-chan struct{}) {
+		select {
+		case <-upstream:
+			this.Cancel()
+		case <-this.canceled:
+		}
+	}(link.Done())
+
+	go func(input <-chan *alloc.Buffer) {
+		defer func() {
+			close(this.input)
+			this.finish(&this.uplinkDone, sessionPolicy.DownlinkOnlyTimeout)
+			for chunk := range input {
+				chunk.Release()
+			}
+		}()
+		for {
+			select {
+			case chunk, open := <-input:
+				if !open {
+					return
+				}
+				this.timer.Update()
+				this.uplink += int64(chunk.Len())
+				select {
+				case this.input <- chunk:
+				case <-this.canceled:
+					chunk.Release()
+					return
+				}
+			case <-this.canceled:
+				return
+			}
+		}
+	}(link.OutboundInput())
+
+	go func(output chan<- *alloc.Buffer) {
+		defer func() {
+			close(output)
+			this.finish(&this.downlinkDone, sessionPolicy.UplinkOnlyTimeout)
+			for chunk := range this.output {
+				chunk.Release()
+			}
+		}()
+		for {
+			select {
+			case chunk, open := <-this.output:
+				if !open {
+					return
+				}
+				this.timer.Update()
+				this.downlink += int64(chunk.Len())
+				select {
+				case output <- chunk:
+				case <-this.canceled:
+					chunk.Release()
+					return
+				}
+			case <-this.canceled:
+				return
+			}
+		}
+	}(link.OutboundOutput())
+}
+
+// finish marks a direction as closed, and applies the given timeout, if positive, to the other
+// direction.
+func (this *activityRay) finish(done *bool, timeout time.Duration) {
+	this.Lock()
+	*done = true
+	allDone := this.uplinkDone && this.downlinkDone
+	if allDone {
+		this.timer.Close()
+		// Release the goroutine watching the inbound connection.
+		this.Cancel()
+	} else if timeout > 0 {
+		this.timer.SetTimeout(timeout)
+	}
+	this.Unlock()
+
+	if allDone && this.onDone != nil {
+		this.onDone()
+	}
+}
+
+// Cancel closes both directions of the session immediately, and notifies the outbound handler.
+func (this *activityRay) Cancel() {
+	this.cancelOnce.Do(func() {
+		close(this.canceled)
+	})
+}
+
+// Traffic returns the number of bytes passed in both directions, and the time since the session
+// started. It must be called after the session finishes.
+func (this *activityRay) Traffic() (uplink int64, downlink int64, duration time.Duration) {
+	return this.uplink, this.downlink, time.Since(this.start)
+}
+
+func (this *activityRay) Done() <-chan struct{} {
+	return this.canceled
+}
+
+func (this *activityRay) OutboundInput() <-chan *alloc.Buffer {
+	return this.input
+}
+
+func (this *activityRay) OutboundOutput() chan<- *alloc.Buffer {
+	return this.output
+}
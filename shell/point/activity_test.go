@@ -0,0 +1,131 @@
+package point
+
+import (
+	"testing"
+	"time"
+
+	"github.com/v2ray/v2ray-core/app/policy"
+	"github.com/v2ray/v2ray-core/common/alloc"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+	"github.com/v2ray/v2ray-core/transport/ray"
+)
+
+func TestIdleSessionCanceled(t *testing.T) {
+	v2testing.Current(t)
+
+	direct := ray.NewRay()
+	link := trackActivity(direct, &policy.Policy{
+		ConnIdleTimeout: 200 * time.Millisecond,
+	}, nil)
+
+	direct.InboundInput() <- alloc.NewBuffer().Clear().Append([]byte("request"))
+	chunk := <-link.OutboundInput()
+	chunk.Release()
+
+	start := time.Now()
+	_, open := <-direct.InboundOutput()
+	assert.Bool(open).IsFalse()
+	_, open = <-link.OutboundInput()
+	assert.Bool(open).IsFalse()
+	assert.Bool(time.Since(start) >= 150*time.Millisecond).IsTrue()
+
+	// Handlers close their sides as usual.
+	close(direct.InboundInput())
+	link.OutboundOutput() <- alloc.NewBuffer().Clear().Append([]byte("response"))
+	close(link.OutboundOutput())
+}
+
+func TestHalfClosedSessionCanceled(t *testing.T) {
+	v2testing.Current(t)
+
+	direct := ray.NewRay()
+	link := trackActivity(direct, &policy.Policy{
+		ConnIdleTimeout:     time.Minute,
+		DownlinkOnlyTimeout: 100 * time.Millisecond,
+	}, nil)
+
+	close(direct.InboundInput())
+	_, open := <-link.OutboundInput()
+	assert.Bool(open).IsFalse()
+
+	link.OutboundOutput() <- alloc.NewBuffer().Clear().Append([]byte("response"))
+	chunk := <-direct.InboundOutput()
+	chunk.Release()
+
+	_, open = <-direct.InboundOutput()
+	assert.Bool(open).IsFalse()
+	close(link.OutboundOutput())
+}
+
+func TestSessionWithoutTimeout(t *testing.T) {
+	v2testing.Current(t)
+
+	direct := ray.NewRay()
+	done := make(chan bool)
+	link := trackActivity(direct, &policy.Policy{}, func() {
+		close(done)
+	})
+
+	direct.InboundInput() <- alloc.NewBuffer().Clear().Append([]byte("request"))
+	chunk := <-link.OutboundInput()
+	assert.StringLiteral(string(chunk.Value)).Equals("request")
+	chunk.Release()
+
+	close(direct.InboundInput())
+	close(link.OutboundOutput())
+	_, open := <-direct.InboundOutput()
+	assert.Bool(open).IsFalse()
+	<-done
+}
+
+func TestSessionCanceled(t *testing.T) {
+	v2testing.Current(t)
+
+	direct := ray.NewRay()
+	done := make(chan bool)
+	link := trackActivity(direct, &policy.Policy{}, func() {
+		close(done)
+	})
+
+	link.Cancel()
+	_, open := <-link.OutboundInput()
+	assert.Bool(open).IsFalse()
+	_, open = <-direct.InboundOutput()
+	assert.Bool(open).IsFalse()
+	close(link.OutboundOutput())
+	<-done
+}
+
+func TestSessionCanceledByInbound(t *testing.T) {
+	v2testing.Current(t)
+
+	direct := ray.NewRay()
+	link := trackActivity(direct, &policy.Policy{}, nil)
+
+	direct.Cancel()
+	<-link.Done()
+	_, open := <-link.OutboundInput()
+	assert.Bool(open).IsFalse()
+	close(direct.InboundInput())
+	close(link.OutboundOutput())
+}
+
+func TestSessionFinishedOnTrack(t *testing.T) {
+	v2testing.Current(t)
+
+	manager := newSessionManager()
+	finished := make(chan *activityRay, 1)
+
+	// The session finishes right away, possibly before Track returns.
+	direct := ray.NewRay()
+	direct.Cancel()
+	close(direct.InboundInput())
+	link := manager.Track(direct, &policy.Policy{}, func(session *activityRay) {
+		finished <- session
+	})
+
+	assert.Pointer(<-finished).Equals(link)
+	close(link.OutboundOutput())
+	assert.Bool(manager.Wait(time.Second)).IsTrue()
+}
@@ -0,0 +1,201 @@
+package point
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/v2ray/v2ray-core/app/api"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+	"github.com/v2ray/v2ray-core/common/uuid"
+)
+
+// apiService exposes management of a Point server through the API server.
+type apiService struct {
+	point *Point
+}
+
+// rawSettings returns the given settings of a proxy, or nil if they are absent.
+func rawSettings(settings json.RawMessage) []byte {
+	if len(settings) == 0 || string(settings) == "null" {
+		return nil
+	}
+	return []byte(settings)
+}
+
+func (this *apiService) ListInbounds(args *api.Empty, reply *api.ListInboundsReply) error {
+	config := this.point.GetConfig()
+	reply.Inbounds = append(reply.Inbounds, &api.InboundInfo{
+		Protocol: config.InboundConfig.Protocol,
+		PortFrom: config.Port.Value(),
+		PortTo:   config.Port.Value(),
+	})
+	for _, detourConfig := range config.InboundDetours {
+		reply.Inbounds = append(reply.Inbounds, &api.InboundInfo{
+			Tag:      detourConfig.Tag,
+			Protocol: detourConfig.Protocol,
+			PortFrom: detourConfig.PortRange.From.Value(),
+			PortTo:   detourConfig.PortRange.To.Value(),
+		})
+	}
+	return nil
+}
+
+func (this *apiService) AddInbound(args *api.AddInboundArgs, reply *api.Empty) error {
+	portTo := args.PortTo
+	if portTo == 0 {
+		portTo = args.PortFrom
+	}
+	if args.PortFrom == 0 || portTo < args.PortFrom {
+		return ErrorBadConfiguration
+	}
+	return this.point.AddInboundDetour(&InboundDetourConfig{
+		Protocol: args.Protocol,
+		PortRange: v2net.PortRange{
+			From: v2net.Port(args.PortFrom),
+			To:   v2net.Port(portTo),
+		},
+		Tag: args.Tag,
+		Allocation: &InboundDetourAllocationConfig{
+			Strategy: AllocationStrategyAlways,
+			Refresh:  DefaultRefreshMinute,
+		},
+		Settings: rawSettings(args.Settings),
+	})
+}
+
+func (this *apiService) RemoveInbound(args *api.TagArgs, reply *api.Empty) error {
+	return this.point.RemoveInboundDetour(args.Tag)
+}
+
+func (this *apiService) ListOutbounds(args *api.Empty, reply *api.ListOutboundsReply) error {
+	config := this.point.GetConfig()
+	reply.Outbounds = append(reply.Outbounds, &api.OutboundInfo{
+		Protocol: config.OutboundConfig.Protocol,
+	})
+	for _, detourConfig := range config.OutboundDetours {
+		reply.Outbounds = append(reply.Outbounds, &api.OutboundInfo{
+			Tag:      detourConfig.Tag,
+			Protocol: detourConfig.Protocol,
+		})
+	}
+	return nil
+}
+
+func (this *apiService) AddOutbound(args *api.AddOutboundArgs, reply *api.Empty) error {
+	return this.point.AddOutboundDetour(&OutboundDetourConfig{
+		Protocol: args.Protocol,
+		Tag:      args.Tag,
+		Settings: rawSettings(args.Settings),
+	})
+}
+
+func (this *apiService) RemoveOutbound(args *api.TagArgs, reply *api.Empty) error {
+	return this.point.RemoveOutboundDetour(args.Tag)
+}
+
+func (this *apiService) AddUser(args *api.AddUserArgs, reply *api.Empty) error {
+	id, err := uuid.ParseString(args.Id)
+	if err != nil {
+		return err
+	}
+	user := proto.NewUser(proto.NewID(id), proto.UserLevel(args.Level), args.AlterIds, args.Email)
+	if err := this.point.AddUser(args.InboundTag, user); err != nil {
+		return err
+	}
+	if args.Expiry > 0 {
+		return this.point.SetUserExpiry(args.InboundTag, args.Email, time.Unix(args.Expiry, 0))
+	}
+	return nil
+}
+
+func (this *apiService) RemoveUser(args *api.RemoveUserArgs, reply *api.Empty) error {
+	return this.point.RemoveUser(args.InboundTag, args.Email)
+}
+
+func (this *apiService) SetUserExpiry(args *api.SetUserExpiryArgs, reply *api.Empty) error {
+	var expiry time.Time
+	if args.Expiry > 0 {
+		expiry = time.Unix(args.Expiry, 0)
+	}
+	return this.point.SetUserExpiry(args.InboundTag, args.Email, expiry)
+}
+
+func (this *apiService) SetUserEnabled(args *api.SetUserEnabledArgs, reply *api.Empty) error {
+	return this.point.SetUserEnabled(args.InboundTag, args.Email, args.Enabled)
+}
+
+func (this *apiService) QueryRouting(args *api.QueryRoutingArgs, reply *api.QueryRoutingReply) error {
+	address := v2net.ParseAddress(args.Address)
+	port := v2net.Port(args.Port)
+	var dest v2net.Destination
+	switch args.Network {
+	case "udp":
+		dest = v2net.UDPDestination(address, port)
+	case "tcp", "":
+		dest = v2net.TCPDestination(address, port)
+	default:
+		return ErrorBadConfiguration
+	}
+	reply.Tag = this.point.TakeDetour(dest)
+	return nil
+}
+
+func (this *apiService) Reload(args *api.ReloadArgs, reply *api.Empty) error {
+	config, err := LoadConfig(args.ConfigFile)
+	if err != nil {
+		return err
+	}
+	return this.point.Reload(config)
+}
+
+func (this *apiService) HealthStatus(args *api.Empty, reply *api.HealthStatusReply) error {
+	for _, status := range this.point.HealthStatus() {
+		apiStatus := &api.HealthStatus{
+			Name:     status.Name,
+			Healthy:  status.Healthy,
+			Failures: status.Failures,
+		}
+		if !status.LastCheck.IsZero() {
+			apiStatus.LastCheck = status.LastCheck.Unix()
+		}
+		if status.LastError != nil {
+			apiStatus.LastError = status.LastError.Error()
+		}
+		reply.Status = append(reply.Status, apiStatus)
+	}
+	return nil
+}
+
+func (this *apiService) QueryStats(args *api.QueryStatsArgs, reply *api.QueryStatsReply) error {
+	if this.point.stats == nil {
+		return ErrorStatsNotEnabled
+	}
+	for _, stat := range this.point.stats.Query(args.Kind, args.Name, args.Reset) {
+		reply.Stats = append(reply.Stats, &api.Stat{
+			Kind:              stat.Kind,
+			Name:              stat.Name,
+			Uplink:            stat.Uplink,
+			Downlink:          stat.Downlink,
+			ActiveConnections: stat.ActiveConnections,
+			TotalConnections:  stat.TotalConnections,
+		})
+	}
+	return nil
+}
+
+func (this *apiService) QueryQuotaUsage(args *api.EmailArgs, reply *api.QuotaUsageReply) error {
+	if this.point.limiter == nil {
+		return ErrorLimiterNotEnabled
+	}
+	reply.Usage, reply.Quota = this.point.limiter.Usage(args.Email)
+	return nil
+}
+
+func (this *apiService) ResetQuotaUsage(args *api.EmailArgs, reply *api.Empty) error {
+	if this.point.limiter == nil {
+		return ErrorLimiterNotEnabled
+	}
+	this.point.limiter.ResetUsage(args.Email)
+	return nil
+}
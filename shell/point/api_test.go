@@ -0,0 +1,267 @@
+package point_test
+
+import (
+	"bytes"
+	"net/rpc/jsonrpc"
+	"testing"
+	"time"
+
+	"github.com/v2ray/v2ray-core/app"
+	"github.com/v2ray/v2ray-core/app/api"
+	apptesting "github.com/v2ray/v2ray-core/app/testing"
+	"github.com/v2ray/v2ray-core/common/alloc"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+	"github.com/v2ray/v2ray-core/proxy"
+	proxytesting "github.com/v2ray/v2ray-core/proxy/testing"
+	"github.com/v2ray/v2ray-core/proxy/testing/mocks"
+	. "github.com/v2ray/v2ray-core/shell/point"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+type userManagingInboundHandler struct {
+	recordingInboundHandler
+	users    map[string]*proto.User
+	expiries map[string]time.Time
+	disabled map[string]bool
+}
+
+func (this *userManagingInboundHandler) AddUser(user *proto.User) error {
+	this.users[user.Email] = user
+	return nil
+}
+
+func (this *userManagingInboundHandler) RemoveUser(email string) error {
+	if _, found := this.users[email]; !found {
+		return proxy.ErrorUserNotFound
+	}
+	delete(this.users, email)
+	return nil
+}
+
+func (this *userManagingInboundHandler) SetUserExpiry(email string, expiry time.Time) error {
+	if _, found := this.users[email]; !found {
+		return proxy.ErrorUserNotFound
+	}
+	this.expiries[email] = expiry
+	return nil
+}
+
+func (this *userManagingInboundHandler) SetUserEnabled(email string, enabled bool) error {
+	if _, found := this.users[email]; !found {
+		return proxy.ErrorUserNotFound
+	}
+	this.disabled[email] = !enabled
+	return nil
+}
+
+func TestApi(t *testing.T) {
+	v2testing.Current(t)
+
+	inbounds := make([]*userManagingInboundHandler, 0, 4)
+	inboundProtocol, err := proxytesting.RegisterInboundConnectionHandlerCreator("api_ich",
+		func(space app.Space, config interface{}) (proxy.InboundHandler, error) {
+			ich := &userManagingInboundHandler{
+				users:    make(map[string]*proto.User),
+				expiries: make(map[string]time.Time),
+				disabled: make(map[string]bool),
+			}
+			inbounds = append(inbounds, ich)
+			return ich, nil
+		})
+	assert.Error(err).IsNil()
+
+	outboundProtocol, err := proxytesting.RegisterOutboundConnectionHandlerCreator("api_och",
+		func(space app.Space, config interface{}) (proxy.OutboundHandler, error) {
+			return &mocks.OutboundConnectionHandler{
+				ConnInput:  bytes.NewReader(nil),
+				ConnOutput: new(bytes.Buffer),
+			}, nil
+		})
+	assert.Error(err).IsNil()
+
+	vpoint, err := NewPoint(&Config{
+		Port:           v2net.Port(50021),
+		InboundConfig:  &ConnectionConfig{Protocol: inboundProtocol},
+		OutboundConfig: &ConnectionConfig{Protocol: outboundProtocol},
+		ApiConfig: &api.Config{
+			DirectPort: v2net.Port(50022),
+			Tag:        "api",
+		},
+	})
+	assert.Error(err).IsNil()
+	assert.Error(vpoint.Start()).IsNil()
+	defer vpoint.Close()
+
+	client, err := jsonrpc.Dial("tcp", "127.0.0.1:50022")
+	assert.Error(err).IsNil()
+	defer client.Close()
+
+	empty := &api.Empty{}
+
+	err = client.Call("Point.AddInbound", &api.AddInboundArgs{
+		Tag:      "detour",
+		Protocol: inboundProtocol,
+		PortFrom: 50023,
+	}, empty)
+	assert.Error(err).IsNil()
+	assert.Int(len(inbounds)).Equals(2)
+	netPort := inbounds[1].Port()
+	assert.Int(int(netPort)).Equals(50023)
+
+	err = client.Call("Point.AddInbound", &api.AddInboundArgs{
+		Tag:      "detour",
+		Protocol: inboundProtocol,
+		PortFrom: 50024,
+	}, empty)
+	assert.StringLiteral(err.Error()).Equals(ErrorTagExists.Error())
+
+	inboundsReply := new(api.ListInboundsReply)
+	assert.Error(client.Call("Point.ListInbounds", empty, inboundsReply)).IsNil()
+	assert.Int(len(inboundsReply.Inbounds)).Equals(2)
+	assert.StringLiteral(inboundsReply.Inbounds[1].Tag).Equals("detour")
+
+	err = client.Call("Point.AddUser", &api.AddUserArgs{
+		InboundTag: "detour",
+		Id:         "ad937d9d-6e23-4a5a-ba23-bce5092a7c51",
+		AlterIds:   2,
+		Email:      "love@v2ray.com",
+		Expiry:     1500000000,
+	}, empty)
+	assert.Error(err).IsNil()
+	user := inbounds[1].users["love@v2ray.com"]
+	assert.Pointer(user).IsNotNil()
+	assert.StringLiteral(user.ID.String()).Equals("ad937d9d-6e23-4a5a-ba23-bce5092a7c51")
+	assert.Int(len(user.AlterIDs)).Equals(2)
+	assert.Int64(inbounds[1].expiries["love@v2ray.com"].Unix()).Equals(1500000000)
+
+	assert.Error(client.Call("Point.SetUserExpiry", &api.SetUserExpiryArgs{InboundTag: "detour", Email: "love@v2ray.com"}, empty)).IsNil()
+	assert.Bool(inbounds[1].expiries["love@v2ray.com"].IsZero()).IsTrue()
+	assert.Error(client.Call("Point.SetUserEnabled", &api.SetUserEnabledArgs{InboundTag: "detour", Email: "love@v2ray.com", Enabled: false}, empty)).IsNil()
+	assert.Bool(inbounds[1].disabled["love@v2ray.com"]).IsTrue()
+	assert.Error(client.Call("Point.SetUserEnabled", &api.SetUserEnabledArgs{InboundTag: "detour", Email: "nobody@v2ray.com", Enabled: true}, empty)).IsNotNil()
+
+	assert.Error(client.Call("Point.RemoveUser", &api.RemoveUserArgs{InboundTag: "detour", Email: "love@v2ray.com"}, empty)).IsNil()
+	assert.Int(len(inbounds[1].users)).Equals(0)
+	assert.Error(client.Call("Point.RemoveUser", &api.RemoveUserArgs{InboundTag: "detour", Email: "love@v2ray.com"}, empty)).IsNotNil()
+
+	assert.Error(client.Call("Point.RemoveInbound", &api.TagArgs{Tag: "detour"}, empty)).IsNil()
+	assert.Bool(inbounds[1].closed).IsTrue()
+	assert.Error(client.Call("Point.RemoveInbound", &api.TagArgs{Tag: "detour"}, empty)).IsNotNil()
+
+	err = client.Call("Point.AddOutbound", &api.AddOutboundArgs{
+		Tag:      "direct",
+		Protocol: outboundProtocol,
+	}, empty)
+	assert.Error(err).IsNil()
+
+	outboundsReply := new(api.ListOutboundsReply)
+	assert.Error(client.Call("Point.ListOutbounds", empty, outboundsReply)).IsNil()
+	assert.Int(len(outboundsReply.Outbounds)).Equals(2)
+	assert.StringLiteral(outboundsReply.Outbounds[1].Tag).Equals("direct")
+
+	assert.Error(client.Call("Point.RemoveOutbound", &api.TagArgs{Tag: "direct"}, empty)).IsNil()
+	outboundsReply = new(api.ListOutboundsReply)
+	assert.Error(client.Call("Point.ListOutbounds", empty, outboundsReply)).IsNil()
+	assert.Int(len(outboundsReply.Outbounds)).Equals(1)
+
+	routingReply := new(api.QueryRoutingReply)
+	err = client.Call("Point.QueryRouting", &api.QueryRoutingArgs{Network: "tcp", Address: "v2ray.com", Port: 80}, routingReply)
+	assert.Error(err).IsNil()
+	assert.StringLiteral(routingReply.Tag).Equals("")
+}
+
+func TestApiThroughInbound(t *testing.T) {
+	v2testing.Current(t)
+
+	inboundProtocol, err := proxytesting.RegisterInboundConnectionHandlerCreator("api_ich",
+		func(space app.Space, config interface{}) (proxy.InboundHandler, error) {
+			return new(recordingInboundHandler), nil
+		})
+	assert.Error(err).IsNil()
+
+	outboundProtocol, err := proxytesting.RegisterOutboundConnectionHandlerCreator("api_och",
+		func(space app.Space, config interface{}) (proxy.OutboundHandler, error) {
+			return &mocks.OutboundConnectionHandler{
+				ConnInput:  bytes.NewReader(nil),
+				ConnOutput: new(bytes.Buffer),
+			}, nil
+		})
+	assert.Error(err).IsNil()
+
+	vpoint, err := NewPoint(&Config{
+		Port:           v2net.Port(50031),
+		InboundConfig:  &ConnectionConfig{Protocol: inboundProtocol},
+		OutboundConfig: &ConnectionConfig{Protocol: outboundProtocol},
+		ApiConfig: &api.Config{
+			DirectPort: v2net.Port(50032),
+			Tag:        "api",
+		},
+	})
+	assert.Error(err).IsNil()
+
+	request := []byte(`{"method":"Point.QueryRouting","params":[{"Address":"v2ray.com","Port":80}],"id":1}`)
+	dest := v2net.TCPDestination(v2net.DomainAddress("v2ray.com"), 80)
+	link := vpoint.DispatchToOutbound(&apptesting.Context{CallerTagValue: "api"}, v2net.NewPacket(dest, alloc.NewBuffer().Clear().Append(request), false))
+	close(link.InboundInput())
+
+	response := new(bytes.Buffer)
+	for chunk := range link.InboundOutput() {
+		response.Write(chunk.Value)
+		chunk.Release()
+	}
+	assert.StringLiteral(response.String()).Equals(`{"id":1,"result":{"Tag":""},"error":null}` + "\n")
+}
+
+func TestReloadKeepsUsers(t *testing.T) {
+	v2testing.Current(t)
+
+	inbounds := make([]*userManagingInboundHandler, 0, 2)
+	inboundProtocol, err := proxytesting.RegisterInboundConnectionHandlerCreator("users_ich",
+		func(space app.Space, config interface{}) (proxy.InboundHandler, error) {
+			ich := &userManagingInboundHandler{
+				users:    make(map[string]*proto.User),
+				expiries: make(map[string]time.Time),
+				disabled: make(map[string]bool),
+			}
+			inbounds = append(inbounds, ich)
+			return ich, nil
+		})
+	assert.Error(err).IsNil()
+	outboundProtocol, err := proxytesting.RegisterOutboundConnectionHandlerCreator("users_och",
+		func(space app.Space, config interface{}) (proxy.OutboundHandler, error) {
+			return &mocks.OutboundConnectionHandler{}, nil
+		})
+	assert.Error(err).IsNil()
+
+	config := &Config{
+		Port:           v2net.Port(50027),
+		InboundConfig:  &ConnectionConfig{Protocol: inboundProtocol},
+		OutboundConfig: &ConnectionConfig{Protocol: outboundProtocol},
+	}
+	vpoint, err := NewPoint(config)
+	assert.Error(err).IsNil()
+	assert.Error(vpoint.Start()).IsNil()
+	defer vpoint.Close()
+
+	for _, email := range []string{"a@v2ray.com", "b@v2ray.com", "c@v2ray.com"} {
+		assert.Error(vpoint.AddUser("", &proto.User{Email: email})).IsNil()
+	}
+	assert.Error(vpoint.SetUserEnabled("", "a@v2ray.com", false)).IsNil()
+	assert.Error(vpoint.SetUserEnabled("", "a@v2ray.com", true)).IsNil()
+	assert.Error(vpoint.SetUserEnabled("", "b@v2ray.com", false)).IsNil()
+	assert.Error(vpoint.SetUserExpiry("", "b@v2ray.com", time.Unix(1500000000, 0))).IsNil()
+	assert.Error(vpoint.RemoveUser("", "c@v2ray.com")).IsNil()
+
+	newConfig := *config
+	newConfig.Port = v2net.Port(50028)
+	assert.Error(vpoint.Reload(&newConfig)).IsNil()
+	assert.Int(len(inbounds)).Equals(2)
+
+	ich := inbounds[1]
+	assert.Int(len(ich.users)).Equals(2)
+	assert.Bool(ich.disabled["a@v2ray.com"]).IsFalse()
+	assert.Bool(ich.disabled["b@v2ray.com"]).IsTrue()
+	assert.Int64(ich.expiries["b@v2ray.com"].Unix()).Equals(1500000000)
+}
@@ -0,0 +1,219 @@
+package point
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/v2ray/v2ray-core/common/alloc"
+	"github.com/v2ray/v2ray-core/common/dice"
+	"github.com/v2ray/v2ray-core/common/log"
+	"github.com/v2ray/v2ray-core/proxy/health"
+	"github.com/v2ray/v2ray-core/transport/ray"
+)
+
+const (
+	// Weight of the latest sample in the moving average of outbound latency.
+	latencySampleWeight = 0.3
+
+	// Latency recorded for a connection that closed without any response.
+	latencyFailurePenalty = 10 * time.Second
+)
+
+// outboundState keeps track of the connections dispatched to a tagged outbound handler.
+type outboundState struct {
+	tag          string
+	activeConns  int64
+	trackLatency bool
+	latency      time.Duration // Moving average of time to first response, 0 if never measured.
+	checker      *health.Checker
+	sync.Mutex
+}
+
+func newOutboundState(tag string) *outboundState {
+	return &outboundState{
+		tag: tag,
+	}
+}
+
+func (this *outboundState) ActiveConnections() int64 {
+	return atomic.LoadInt64(&this.activeConns)
+}
+
+// IsHealthy returns false if health check is enabled on the outbound and the outbound is down.
+func (this *outboundState) IsHealthy() bool {
+	return this.checker == nil || this.checker.IsHealthy()
+}
+
+// healthyStates returns the healthy ones in the given states. If none of them is healthy, all states
+// are returned.
+func healthyStates(states []*outboundState) []*outboundState {
+	healthy := make([]*outboundState, 0, len(states))
+	for _, state := range states {
+		if state.IsHealthy() {
+			healthy = append(healthy, state)
+		}
+	}
+	if len(healthy) == 0 {
+		return states
+	}
+	return healthy
+}
+
+func (this *outboundState) Latency() time.Duration {
+	this.Lock()
+	defer this.Unlock()
+	return this.latency
+}
+
+func (this *outboundState) addLatencySample(sample time.Duration) {
+	this.Lock()
+	defer this.Unlock()
+	if this.latency == 0 {
+		this.latency = sample
+		return
+	}
+	this.latency = time.Duration(float64(this.latency)*(1-latencySampleWeight) + float64(sample)*latencySampleWeight)
+}
+
+// Track marks the beginning of a connection through this outbound. It returns the ray that should be
+// passed to the outbound handler instead of the given one. The returned function must be called
+// when the outbound handler finishes.
+func (this *outboundState) Track(link ray.OutboundRay) (ray.OutboundRay, func()) {
+	atomic.AddInt64(&this.activeConns, 1)
+	done := func() {
+		atomic.AddInt64(&this.activeConns, -1)
+	}
+	if !this.trackLatency {
+		return link, done
+	}
+	return newLatencyRay(this, link), done
+}
+
+// latencyRay measures the time between its creation and the first response from the outbound handler.
+type latencyRay struct {
+	input  <-chan *alloc.Buffer
+	output chan *alloc.Buffer
+	done   <-chan struct{}
+}
+
+func newLatencyRay(state *outboundState, link ray.OutboundRay) *latencyRay {
+	this := &latencyRay{
+		input:  link.OutboundInput(),
+		output: make(chan *alloc.Buffer, 16),
+		done:   link.Done(),
+	}
+	go func(start time.Time, output chan<- *alloc.Buffer) {
+		measured := false
+		for chunk := range this.output {
+			if !measured {
+				state.addLatencySample(time.Since(start))
+				measured = true
+			}
+			output <- chunk
+		}
+		if !measured {
+			state.addLatencySample(latencyFailurePenalty)
+		}
+		close(output)
+	}(time.Now(), link.OutboundOutput())
+	return this
+}
+
+func (this *latencyRay) OutboundInput() <-chan *alloc.Buffer {
+	return this.input
+}
+
+func (this *latencyRay) OutboundOutput() chan<- *alloc.Buffer {
+	return this.output
+}
+
+func (this *latencyRay) Done() <-chan struct{} {
+	return this.done
+}
+
+// An OutboundBalancer chooses one outbound handler out of a group for each dispatch.
+type OutboundBalancer interface {
+	// PickOutbound returns the tag of the outbound handler for the next connection.
+	PickOutbound() string
+}
+
+func newOutboundBalancer(config *BalancerConfig, states []*outboundState) (OutboundBalancer, error) {
+	if len(states) == 0 {
+		log.Error("Point: Balancer [", config.Tag, "] has no outbound.")
+		return nil, ErrorBadConfiguration
+	}
+	switch config.Strategy {
+	case BalancerStrategyRandom:
+		return &randomBalancer{states: states}, nil
+	case BalancerStrategyRoundRobin:
+		return &roundRobinBalancer{states: states}, nil
+	case BalancerStrategyLeastConn:
+		return &leastConnBalancer{states: states}, nil
+	case BalancerStrategyLeastLatency:
+		for _, state := range states {
+			state.trackLatency = true
+		}
+		return &leastLatencyBalancer{states: states}, nil
+	}
+	log.Error("Point: Unknown balancer strategy: ", config.Strategy)
+	return nil, ErrorBadConfiguration
+}
+
+type randomBalancer struct {
+	states []*outboundState
+}
+
+func (this *randomBalancer) PickOutbound() string {
+	states := healthyStates(this.states)
+	return states[dice.Roll(len(states))].tag
+}
+
+type roundRobinBalancer struct {
+	states []*outboundState
+	next   uint32
+}
+
+func (this *roundRobinBalancer) PickOutbound() string {
+	states := healthyStates(this.states)
+	idx := atomic.AddUint32(&this.next, 1) - 1
+	return states[int(idx%uint32(len(states)))].tag
+}
+
+type leastConnBalancer struct {
+	states []*outboundState
+}
+
+func (this *leastConnBalancer) PickOutbound() string {
+	states := healthyStates(this.states)
+	// Start from a random position so that ties are spread among the outbounds.
+	offset := dice.Roll(len(states))
+	picked := states[offset]
+	for i := 1; i < len(states); i++ {
+		state := states[(offset+i)%len(states)]
+		if state.ActiveConnections() < picked.ActiveConnections() {
+			picked = state
+		}
+	}
+	return picked.tag
+}
+
+type leastLatencyBalancer struct {
+	states []*outboundState
+}
+
+func (this *leastLatencyBalancer) PickOutbound() string {
+	states := healthyStates(this.states)
+	offset := dice.Roll(len(states))
+	picked := states[offset]
+	pickedLatency := picked.Latency()
+	for i := 1; i < len(states) && pickedLatency > 0; i++ {
+		state := states[(offset+i)%len(states)]
+		// Outbounds that have never been measured are always preferred.
+		if latency := state.Latency(); latency < pickedLatency {
+			picked = state
+			pickedLatency = latency
+		}
+	}
+	return picked.tag
+}
@@ -0,0 +1,138 @@
+package point
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/v2ray/v2ray-core/common/alloc"
+	"github.com/v2ray/v2ray-core/proxy/health"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+	"github.com/v2ray/v2ray-core/transport/ray"
+)
+
+func newTestStates(tags ...string) []*outboundState {
+	states := make([]*outboundState, len(tags))
+	for idx, tag := range tags {
+		states[idx] = newOutboundState(tag)
+	}
+	return states
+}
+
+func TestRoundRobinBalancer(t *testing.T) {
+	v2testing.Current(t)
+
+	balancer, err := newOutboundBalancer(&BalancerConfig{Strategy: BalancerStrategyRoundRobin}, newTestStates("a", "b", "c"))
+	assert.Error(err).IsNil()
+
+	assert.StringLiteral(balancer.PickOutbound()).Equals("a")
+	assert.StringLiteral(balancer.PickOutbound()).Equals("b")
+	assert.StringLiteral(balancer.PickOutbound()).Equals("c")
+	assert.StringLiteral(balancer.PickOutbound()).Equals("a")
+}
+
+func TestRandomBalancer(t *testing.T) {
+	v2testing.Current(t)
+
+	balancer, err := newOutboundBalancer(&BalancerConfig{Strategy: BalancerStrategyRandom}, newTestStates("a", "b"))
+	assert.Error(err).IsNil()
+
+	for i := 0; i < 16; i++ {
+		tag := balancer.PickOutbound()
+		assert.Bool(tag == "a" || tag == "b").IsTrue()
+	}
+}
+
+func TestLeastConnBalancer(t *testing.T) {
+	v2testing.Current(t)
+
+	states := newTestStates("a", "b")
+	balancer, err := newOutboundBalancer(&BalancerConfig{Strategy: BalancerStrategyLeastConn}, states)
+	assert.Error(err).IsNil()
+
+	_, doneA := states[0].Track(ray.NewRay())
+	assert.StringLiteral(balancer.PickOutbound()).Equals("b")
+
+	_, doneB1 := states[1].Track(ray.NewRay())
+	_, doneB2 := states[1].Track(ray.NewRay())
+	assert.StringLiteral(balancer.PickOutbound()).Equals("a")
+
+	doneB1()
+	doneB2()
+	assert.StringLiteral(balancer.PickOutbound()).Equals("b")
+	doneA()
+}
+
+func TestLeastLatencyBalancer(t *testing.T) {
+	v2testing.Current(t)
+
+	states := newTestStates("a", "b")
+	balancer, err := newOutboundBalancer(&BalancerConfig{Strategy: BalancerStrategyLeastLatency}, states)
+	assert.Error(err).IsNil()
+
+	// Measure a response through "a", and let "b" fail without any response.
+	direct := ray.NewRay()
+	link, done := states[0].Track(direct)
+	link.OutboundOutput() <- alloc.NewBuffer().Clear().Append([]byte("x"))
+	close(link.OutboundOutput())
+	done()
+	<-direct.InboundOutput()
+
+	// "b" has never been measured and is preferred.
+	assert.StringLiteral(balancer.PickOutbound()).Equals("b")
+
+	direct = ray.NewRay()
+	link, done = states[1].Track(direct)
+	close(link.OutboundOutput())
+	done()
+	_, open := <-direct.InboundOutput()
+	assert.Bool(open).IsFalse()
+
+	assert.Bool(states[1].Latency() == latencyFailurePenalty).IsTrue()
+	assert.Bool(states[0].Latency() < time.Second).IsTrue()
+	assert.StringLiteral(balancer.PickOutbound()).Equals("a")
+}
+
+func TestUnknownBalancerStrategy(t *testing.T) {
+	v2testing.Current(t)
+
+	_, err := newOutboundBalancer(&BalancerConfig{Strategy: "unknown"}, newTestStates("a"))
+	assert.Error(err).Equals(ErrorBadConfiguration)
+
+	_, err = newOutboundBalancer(&BalancerConfig{Strategy: BalancerStrategyRandom}, nil)
+	assert.Error(err).Equals(ErrorBadConfiguration)
+}
+
+type staticProber struct {
+	err error
+}
+
+func (this *staticProber) Probe(timeout time.Duration) error {
+	return this.err
+}
+
+func TestBalancerPrefersHealthyOutbound(t *testing.T) {
+	v2testing.Current(t)
+
+	states := newTestStates("a", "b")
+	states[0].checker = health.NewChecker("a", &staticProber{err: errors.New("down")}, &health.Config{})
+	states[0].checker.Check()
+	states[1].checker = health.NewChecker("b", &staticProber{}, &health.Config{})
+	states[1].checker.Check()
+
+	for _, strategy := range []string{BalancerStrategyRandom, BalancerStrategyRoundRobin, BalancerStrategyLeastConn, BalancerStrategyLeastLatency} {
+		balancer, err := newOutboundBalancer(&BalancerConfig{Strategy: strategy}, states)
+		assert.Error(err).IsNil()
+		for i := 0; i < 4; i++ {
+			assert.StringLiteral(balancer.PickOutbound()).Equals("b")
+		}
+	}
+
+	// All outbounds are used when none of them is healthy.
+	states[1].checker = states[0].checker
+	balancer, err := newOutboundBalancer(&BalancerConfig{Strategy: BalancerStrategyRoundRobin}, states)
+	assert.Error(err).IsNil()
+	assert.StringLiteral(balancer.PickOutbound()).Equals("a")
+	assert.StringLiteral(balancer.PickOutbound()).Equals("b")
+}
@@ -1,22 +1,59 @@
 package point
 
 import (
+	"bytes"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/v2ray/v2ray-core/app/api"
+	"github.com/v2ray/v2ray-core/app/dns"
+	"github.com/v2ray/v2ray-core/app/limiter"
+	"github.com/v2ray/v2ray-core/app/metrics"
+	"github.com/v2ray/v2ray-core/app/policy"
 	"github.com/v2ray/v2ray-core/app/router"
+	"github.com/v2ray/v2ray-core/app/stats"
 	"github.com/v2ray/v2ray-core/common/log"
 	v2net "github.com/v2ray/v2ray-core/common/net"
+	"github.com/v2ray/v2ray-core/proxy/health"
 )
 
 type ConnectionConfig struct {
-	Protocol string
-	Settings []byte
+	Protocol       string
+	Settings       []byte
+	SettingsConfig interface{} // Config object built from a typed config message. Settings is ignored if set.
+	Fallbacks      []string    // Tags of outbound detours to try in order when the outbound fails. Outbound only.
+}
+
+func (this *ConnectionConfig) Equals(another *ConnectionConfig) bool {
+	if this == nil || another == nil {
+		return this == another
+	}
+	return this.Protocol == another.Protocol &&
+		bytes.Equal(this.Settings, another.Settings) &&
+		reflect.DeepEqual(this.SettingsConfig, another.SettingsConfig) &&
+		reflect.DeepEqual(this.Fallbacks, another.Fallbacks)
 }
 
 type LogConfig struct {
 	AccessLog string
 	ErrorLog  string
 	LogLevel  log.LogLevel
+	Format    log.Format
+	Rotation  log.RotationConfig // Applies to both access and error log files.
+}
+
+func (this *LogConfig) Equals(another *LogConfig) bool {
+	if this == nil || another == nil {
+		return this == another
+	}
+	return *this == *another
 }
 
+const (
+	DefaultRefreshMinute = int(9999)
+)
+
 const (
 	AllocationStrategyAlways   = "always"
 	AllocationStrategyRandom   = "random"
@@ -29,18 +66,69 @@ type InboundDetourAllocationConfig struct {
 	Refresh     int    // Number of minutes before a handler is regenerated.
 }
 
+func (this *InboundDetourAllocationConfig) setDefaults() {
+	if this.Strategy == AllocationStrategyRandom {
+		if this.Refresh == 0 {
+			this.Refresh = 5
+		}
+		if this.Concurrency == 0 {
+			this.Concurrency = 3
+		}
+	}
+	if this.Refresh == 0 {
+		this.Refresh = DefaultRefreshMinute
+	}
+}
+
 type InboundDetourConfig struct {
-	Protocol   string
-	PortRange  v2net.PortRange
-	Tag        string
-	Allocation *InboundDetourAllocationConfig
-	Settings   []byte
+	Protocol       string
+	PortRange      v2net.PortRange
+	Tag            string
+	Allocation     *InboundDetourAllocationConfig
+	Settings       []byte
+	SettingsConfig interface{} // Same as in ConnectionConfig.
+}
+
+func (this *InboundDetourConfig) Equals(another *InboundDetourConfig) bool {
+	if this == nil || another == nil {
+		return this == another
+	}
+	if this.Allocation == nil || another.Allocation == nil {
+		if this.Allocation != another.Allocation {
+			return false
+		}
+	} else if *this.Allocation != *another.Allocation {
+		return false
+	}
+	return this.Protocol == another.Protocol &&
+		this.PortRange == another.PortRange &&
+		this.Tag == another.Tag &&
+		bytes.Equal(this.Settings, another.Settings) &&
+		reflect.DeepEqual(this.SettingsConfig, another.SettingsConfig)
 }
 
 type OutboundDetourConfig struct {
-	Protocol string
-	Tag      string
-	Settings []byte
+	Protocol       string
+	Tag            string
+	Settings       []byte
+	SettingsConfig interface{}    // Same as in ConnectionConfig.
+	HealthCheck    *health.Config // Health check on this outbound, used by balancers. URL is required.
+	Fallbacks      []string       // Tags of outbound detours to try in order when this one fails to connect.
+}
+
+const (
+	BalancerStrategyRandom       = "random"
+	BalancerStrategyRoundRobin   = "roundrobin"
+	BalancerStrategyLeastConn    = "leastconn"
+	BalancerStrategyLeastLatency = "leastlatency"
+)
+
+// BalancerConfig defines a group of outbound detours. Routing rules may use the tag of a balancer
+// as their outbound tag, and one of the outbounds is chosen for each connection.
+type BalancerConfig struct {
+	Tag          string
+	Strategy     string   // Strategy for choosing an outbound.
+	OutboundTags []string // Tags of outbound detours in this group.
 }
 
 type Config struct {
@@ -51,17 +139,104 @@ type Config struct {
 	OutboundConfig  *ConnectionConfig
 	InboundDetours  []*InboundDetourConfig
 	OutboundDetours []*OutboundDetourConfig
+	Balancers       []*BalancerConfig
+	ApiConfig       *api.Config
+	DnsConfig       *dns.Config
+	StatsConfig     *stats.Config
+	MetricsConfig   *metrics.Config
+	LimiterConfig   *limiter.Config
+	PolicyConfig    *policy.Config
+	DrainTimeout    time.Duration // Time to wait for active sessions on shutdown.
+	digest          string        // Digest of the loaded config files, if known.
 }
 
-type ConfigLoader func(init string) (*Config, error)
+const (
+	DefaultDrainTimeout = 10 * time.Second
+)
+
+const (
+	// StdinConfig is the config file name for reading config from standard input. A format may follow,
+	// e.g., "stdin:toml". Standard input is read only once, and reloading reuses what has been read.
+	StdinConfig = "stdin:"
+)
+
+// ConfigLoader loads a Config from the given files, which are merged in order. Directories stand for
+// the config files in them, in the order of their names.
+type ConfigLoader func(files ...string) (*Config, error)
 
 var (
 	configLoader ConfigLoader
 )
 
-func LoadConfig(init string) (*Config, error) {
+// LoadConfig loads a Config from the given files. A single file with extension SchemaConfigExtension or
+// SchemaTextConfigExtension is loaded by LoadSchemaConfig, and others by the ConfigLoader.
+func LoadConfig(files ...string) (*Config, error) {
+	if len(files) == 1 && isSchemaConfigFile(files[0]) {
+		return loadSchemaConfigFile(files[0])
+	}
 	if configLoader == nil {
 		return nil, ErrorBadConfiguration
 	}
-	return configLoader(init)
+	return configLoader(files...)
+}
+
+// ConfigValidator checks the given config files, which are merged in order as by ConfigLoader, and
+// returns all problems found in them.
+type ConfigValidator func(files ...string) []*ValidationError
+
+var (
+	configValidator ConfigValidator
+)
+
+// ValidateConfig returns all problems found in the given config files, or nil if there is none.
+func ValidateConfig(files ...string) []*ValidationError {
+	if len(files) == 1 && isSchemaConfigFile(files[0]) {
+		if _, err := loadSchemaConfigFile(files[0]); err != nil {
+			problem := &ValidationError{File: files[0], Reason: err.Error()}
+			if fieldErr, ok := err.(*FieldError); ok {
+				problem.Path = fieldErr.Field
+				problem.Reason = fieldErr.Err.Error()
+			}
+			return []*ValidationError{problem}
+		}
+		return nil
+	}
+	if configValidator == nil {
+		return []*ValidationError{{Reason: ErrorBadConfiguration.Error()}}
+	}
+	return configValidator(files...)
+}
+
+// WatchConfig loads the config from the given files on the given interval, and calls onChange when it
+// differs from the previously loaded one, starting from the given current config. Errors are logged, and
+// the previous config stays in effect. The returned function stops watching.
+func WatchConfig(current *Config, interval time.Duration, onChange func(*Config), files ...string) func() {
+	done := make(chan bool)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		lastDigest := current.digest
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			config, err := LoadConfig(files...)
+			if err != nil {
+				log.Error("Point: Failed to refresh config: ", err)
+				continue
+			}
+			if len(config.digest) > 0 && config.digest == lastDigest {
+				continue
+			}
+			lastDigest = config.digest
+			onChange(config)
+		}
+	}()
+	var stopOnce sync.Once
+	return func() {
+		stopOnce.Do(func() { close(done) })
+	}
 }
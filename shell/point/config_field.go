@@ -0,0 +1,65 @@
+// +build json
+
+package point
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// unmarshalFields unmarshals the given JSON object into the given pointer to a struct field by field, so
+// that errors name the offending fields as FieldErrors. Elements of slices are unmarshalled one by one
+// likewise. Fields are matched by their json tags, case-insensitively as encoding/json does.
+func unmarshalFields(data []byte, target interface{}) error {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	value := reflect.ValueOf(target).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		name := strings.Split(value.Type().Field(i).Tag.Get("json"), ",")[0]
+		if len(name) == 0 || name == "-" {
+			continue
+		}
+		raw, found := fields[name]
+		if !found {
+			for key, keyRaw := range fields {
+				if strings.EqualFold(key, name) {
+					raw, found = keyRaw, true
+					break
+				}
+			}
+		}
+		if !found {
+			continue
+		}
+		if err := unmarshalField(raw, value.Field(i)); err != nil {
+			return newFieldError(name, err)
+		}
+	}
+	return nil
+}
+
+func unmarshalField(raw json.RawMessage, field reflect.Value) error {
+	if field.Kind() != reflect.Slice || field.Type().Elem().Kind() == reflect.Uint8 {
+		return json.Unmarshal(raw, field.Addr().Interface())
+	}
+	var elements []json.RawMessage
+	if err := json.Unmarshal(raw, &elements); err != nil {
+		return json.Unmarshal(raw, field.Addr().Interface())
+	}
+	if elements == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	slice := reflect.MakeSlice(field.Type(), len(elements), len(elements))
+	for idx, element := range elements {
+		if err := json.Unmarshal(element, slice.Index(idx).Addr().Interface()); err != nil {
+			return newFieldError("["+strconv.Itoa(idx)+"]", err)
+		}
+	}
+	field.Set(slice)
+	return nil
+}
@@ -4,17 +4,19 @@ package point
 
 import (
 	"encoding/json"
-	"io/ioutil"
-	"os"
 	"strings"
+	"time"
 
+	"github.com/v2ray/v2ray-core/app/api"
+	"github.com/v2ray/v2ray-core/app/dns"
+	"github.com/v2ray/v2ray-core/app/limiter"
+	"github.com/v2ray/v2ray-core/app/metrics"
+	"github.com/v2ray/v2ray-core/app/policy"
 	"github.com/v2ray/v2ray-core/app/router"
+	"github.com/v2ray/v2ray-core/app/stats"
 	"github.com/v2ray/v2ray-core/common/log"
 	v2net "github.com/v2ray/v2ray-core/common/net"
-)
-
-const (
-	DefaultRefreshMinute = int(9999)
+	"github.com/v2ray/v2ray-core/proxy/health"
 )
 
 func (this *Config) UnmarshalJSON(data []byte) error {
@@ -26,9 +28,17 @@ func (this *Config) UnmarshalJSON(data []byte) error {
 		OutboundConfig  *ConnectionConfig       `json:"outbound"`
 		InboundDetours  []*InboundDetourConfig  `json:"inboundDetour"`
 		OutboundDetours []*OutboundDetourConfig `json:"outboundDetour"`
+		Balancers       []*BalancerConfig       `json:"balancers"`
+		ApiConfig       *api.Config             `json:"api"`
+		DnsConfig       *dns.Config             `json:"dns"`
+		StatsConfig     *stats.Config           `json:"stats"`
+		MetricsConfig   *metrics.Config         `json:"metrics"`
+		LimiterConfig   *limiter.Config         `json:"limits"`
+		PolicyConfig    *policy.Config          `json:"policy"`
+		DrainTimeout    *uint32                 `json:"drainTimeout"` // Seconds.
 	}
 	jsonConfig := new(JsonConfig)
-	if err := json.Unmarshal(data, jsonConfig); err != nil {
+	if err := unmarshalFields(data, jsonConfig); err != nil {
 		return err
 	}
 	this.Port = jsonConfig.Port
@@ -38,13 +48,25 @@ func (this *Config) UnmarshalJSON(data []byte) error {
 	this.OutboundConfig = jsonConfig.OutboundConfig
 	this.InboundDetours = jsonConfig.InboundDetours
 	this.OutboundDetours = jsonConfig.OutboundDetours
+	this.Balancers = jsonConfig.Balancers
+	this.ApiConfig = jsonConfig.ApiConfig
+	this.DnsConfig = jsonConfig.DnsConfig
+	this.StatsConfig = jsonConfig.StatsConfig
+	this.MetricsConfig = jsonConfig.MetricsConfig
+	this.LimiterConfig = jsonConfig.LimiterConfig
+	this.PolicyConfig = jsonConfig.PolicyConfig
+	this.DrainTimeout = DefaultDrainTimeout
+	if jsonConfig.DrainTimeout != nil {
+		this.DrainTimeout = time.Duration(*jsonConfig.DrainTimeout) * time.Second
+	}
 	return nil
 }
 
 func (this *ConnectionConfig) UnmarshalJSON(data []byte) error {
 	type JsonConnectionConfig struct {
-		Protocol string          `json:"protocol"`
-		Settings json.RawMessage `json:"settings"`
+		Protocol  string          `json:"protocol"`
+		Settings  json.RawMessage `json:"settings"`
+		Fallbacks []string        `json:"fallbacks"`
 	}
 	jsonConfig := new(JsonConnectionConfig)
 	if err := json.Unmarshal(data, jsonConfig); err != nil {
@@ -52,33 +74,50 @@ func (this *ConnectionConfig) UnmarshalJSON(data []byte) error {
 	}
 	this.Protocol = jsonConfig.Protocol
 	this.Settings = jsonConfig.Settings
+	this.Fallbacks = jsonConfig.Fallbacks
 	return nil
 }
 
 func (this *LogConfig) UnmarshalJSON(data []byte) error {
+	type JsonRotationConfig struct {
+		MaxSize    int64 `json:"maxSize"`    // MB
+		Interval   int64 `json:"interval"`   // Hours
+		MaxBackups int   `json:"maxBackups"` // Number of files
+	}
 	type JsonLogConfig struct {
-		AccessLog string `json:"access"`
-		ErrorLog  string `json:"error"`
-		LogLevel  string `json:"loglevel"`
+		AccessLog string              `json:"access"`
+		ErrorLog  string              `json:"error"`
+		LogLevel  string              `json:"loglevel"`
+		Format    string              `json:"format"`
+		Rotation  *JsonRotationConfig `json:"rotation"`
 	}
 	jsonConfig := new(JsonLogConfig)
-	if err := json.Unmarshal(data, jsonConfig); err != nil {
+	if err := unmarshalFields(data, jsonConfig); err != nil {
 		return err
 	}
 	this.AccessLog = jsonConfig.AccessLog
 	this.ErrorLog = jsonConfig.ErrorLog
 
-	level := strings.ToLower(jsonConfig.LogLevel)
-	switch level {
-	case "debug":
-		this.LogLevel = log.DebugLevel
-	case "info":
-		this.LogLevel = log.InfoLevel
-	case "error":
-		this.LogLevel = log.ErrorLevel
-	default:
-		this.LogLevel = log.WarningLevel
+	format, ok := parseLogFormat(jsonConfig.Format)
+	if !ok {
+		log.Error("Point: Unknown log format: ", jsonConfig.Format)
+		return newFieldError("format", ErrorBadConfiguration)
 	}
+	this.Format = format
+
+	if rotation := jsonConfig.Rotation; rotation != nil {
+		if rotation.MaxSize < 0 || rotation.Interval < 0 || rotation.MaxBackups < 0 {
+			log.Error("Point: Invalid log rotation.")
+			return newFieldError("rotation", ErrorBadConfiguration)
+		}
+		this.Rotation = log.RotationConfig{
+			MaxSize:    rotation.MaxSize * 1024 * 1024,
+			Interval:   time.Duration(rotation.Interval) * time.Hour,
+			MaxBackups: rotation.MaxBackups,
+		}
+	}
+
+	this.LogLevel = parseLogLevel(jsonConfig.LogLevel)
 	return nil
 }
 
@@ -95,17 +134,7 @@ func (this *InboundDetourAllocationConfig) UnmarshalJSON(data []byte) error {
 	this.Strategy = jsonConfig.Strategy
 	this.Concurrency = jsonConfig.Concurrency
 	this.Refresh = jsonConfig.RefreshMin
-	if this.Strategy == AllocationStrategyRandom {
-		if this.Refresh == 0 {
-			this.Refresh = 5
-		}
-		if this.Concurrency == 0 {
-			this.Concurrency = 3
-		}
-	}
-	if this.Refresh == 0 {
-		this.Refresh = DefaultRefreshMinute
-	}
+	this.setDefaults()
 	return nil
 }
 
@@ -118,12 +147,12 @@ func (this *InboundDetourConfig) UnmarshalJSON(data []byte) error {
 		Allocation *InboundDetourAllocationConfig `json:"allocate"`
 	}
 	jsonConfig := new(JsonInboundDetourConfig)
-	if err := json.Unmarshal(data, jsonConfig); err != nil {
+	if err := unmarshalFields(data, jsonConfig); err != nil {
 		return err
 	}
 	if jsonConfig.PortRange == nil {
 		log.Error("Point: Port range not specified in InboundDetour.")
-		return ErrorBadConfiguration
+		return newFieldError("port", ErrorBadConfiguration)
 	}
 	this.Protocol = jsonConfig.Protocol
 	this.PortRange = *jsonConfig.PortRange
@@ -141,38 +170,47 @@ func (this *InboundDetourConfig) UnmarshalJSON(data []byte) error {
 
 func (this *OutboundDetourConfig) UnmarshalJSON(data []byte) error {
 	type JsonOutboundDetourConfig struct {
-		Protocol string          `json:"protocol"`
-		Tag      string          `json:"tag"`
-		Settings json.RawMessage `json:"settings"`
+		Protocol    string          `json:"protocol"`
+		Tag         string          `json:"tag"`
+		Settings    json.RawMessage `json:"settings"`
+		HealthCheck *health.Config  `json:"healthCheck"`
+		Fallbacks   []string        `json:"fallbacks"`
 	}
 	jsonConfig := new(JsonOutboundDetourConfig)
-	if err := json.Unmarshal(data, jsonConfig); err != nil {
+	if err := unmarshalFields(data, jsonConfig); err != nil {
 		return err
 	}
 	this.Protocol = jsonConfig.Protocol
 	this.Tag = jsonConfig.Tag
 	this.Settings = jsonConfig.Settings
+	this.HealthCheck = jsonConfig.HealthCheck
+	this.Fallbacks = jsonConfig.Fallbacks
+	if this.HealthCheck != nil && len(this.HealthCheck.URL) == 0 {
+		log.Error("Point: URL not specified in health check of outbound detour: ", this.Tag)
+		return newFieldError("healthCheck.url", ErrorBadConfiguration)
+	}
 	return nil
 }
 
-func JsonLoadConfig(file string) (*Config, error) {
-	fixedFile := os.ExpandEnv(file)
-	rawConfig, err := ioutil.ReadFile(fixedFile)
-	if err != nil {
-		log.Error("Failed to read server config file (", file, "): ", file, err)
-		return nil, err
+func (this *BalancerConfig) UnmarshalJSON(data []byte) error {
+	type JsonBalancerConfig struct {
+		Tag          string   `json:"tag"`
+		Strategy     string   `json:"strategy"`
+		OutboundTags []string `json:"outbounds"`
+	}
+	jsonConfig := new(JsonBalancerConfig)
+	if err := unmarshalFields(data, jsonConfig); err != nil {
+		return err
 	}
-
-	jsonConfig := &Config{}
-	err = json.Unmarshal(rawConfig, jsonConfig)
-	if err != nil {
-		log.Error("Failed to load server config: ", err)
-		return nil, err
+	if len(jsonConfig.Tag) == 0 {
+		log.Error("Point: Tag not specified in balancer.")
+		return newFieldError("tag", ErrorBadConfiguration)
 	}
-
-	return jsonConfig, err
-}
-
-func init() {
-	configLoader = JsonLoadConfig
+	this.Tag = jsonConfig.Tag
+	this.Strategy = strings.ToLower(jsonConfig.Strategy)
+	if len(this.Strategy) == 0 {
+		this.Strategy = BalancerStrategyRandom
+	}
+	this.OutboundTags = jsonConfig.OutboundTags
+	return nil
 }
@@ -7,8 +7,10 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	_ "github.com/v2ray/v2ray-core/app/router/rules"
+	"github.com/v2ray/v2ray-core/common/log"
 	netassert "github.com/v2ray/v2ray-core/common/net/testing/assert"
 	. "github.com/v2ray/v2ray-core/shell/point"
 
@@ -75,3 +77,75 @@ func TestDefaultValueOfRandomAllocation(t *testing.T) {
 	assert.Int(inboundDetourConfig.Allocation.Concurrency).Equals(3)
 	assert.Int(inboundDetourConfig.Allocation.Refresh).Equals(5)
 }
+
+func TestBalancerConfig(t *testing.T) {
+	v2testing.Current(t)
+
+	rawJson := `{
+    "tag": "balancer",
+    "strategy": "LeastConn",
+    "outbounds": ["a", "b"]
+  }`
+
+	balancerConfig := new(BalancerConfig)
+	err := json.Unmarshal([]byte(rawJson), balancerConfig)
+	assert.Error(err).IsNil()
+	assert.StringLiteral(balancerConfig.Tag).Equals("balancer")
+	assert.StringLiteral(balancerConfig.Strategy).Equals(BalancerStrategyLeastConn)
+	assert.Int(len(balancerConfig.OutboundTags)).Equals(2)
+
+	err = json.Unmarshal([]byte(`{"outbounds": ["a"]}`), balancerConfig)
+	assert.StringLiteral(err.(*FieldError).Field).Equals("tag")
+	assert.Error(err.(*FieldError).Err).Equals(ErrorBadConfiguration)
+}
+
+func TestOutboundDetourFallbacks(t *testing.T) {
+	v2testing.Current(t)
+
+	rawJson := `{
+    "protocol": "freedom",
+    "tag": "direct",
+    "settings": {},
+    "fallbacks": ["proxy1", "proxy2"]
+  }`
+
+	detourConfig := new(OutboundDetourConfig)
+	err := json.Unmarshal([]byte(rawJson), detourConfig)
+	assert.Error(err).IsNil()
+	assert.Int(len(detourConfig.Fallbacks)).Equals(2)
+	assert.StringLiteral(detourConfig.Fallbacks[0]).Equals("proxy1")
+	assert.StringLiteral(detourConfig.Fallbacks[1]).Equals("proxy2")
+
+	outboundConfig := new(ConnectionConfig)
+	err = json.Unmarshal([]byte(`{"protocol": "vmess", "fallbacks": ["direct"]}`), outboundConfig)
+	assert.Error(err).IsNil()
+	assert.Int(len(outboundConfig.Fallbacks)).Equals(1)
+	assert.StringLiteral(outboundConfig.Fallbacks[0]).Equals("direct")
+}
+
+func TestLogConfig(t *testing.T) {
+	v2testing.Current(t)
+
+	rawJson := `{
+    "access": "/var/log/v2ray/access.log",
+    "loglevel": "info",
+    "format": "json",
+    "rotation": {
+      "maxSize": 100,
+      "interval": 24,
+      "maxBackups": 7
+    }
+  }`
+
+	logConfig := new(LogConfig)
+	err := json.Unmarshal([]byte(rawJson), logConfig)
+	assert.Error(err).IsNil()
+	assert.Bool(logConfig.Format == log.FormatJSON).IsTrue()
+	assert.Int64(logConfig.Rotation.MaxSize).Equals(100 * 1024 * 1024)
+	assert.Int64(int64(logConfig.Rotation.Interval)).Equals(int64(24 * time.Hour))
+	assert.Int(logConfig.Rotation.MaxBackups).Equals(7)
+
+	err = json.Unmarshal([]byte(`{"format": "xml"}`), logConfig)
+	assert.StringLiteral(err.(*FieldError).Field).Equals("format")
+	assert.Error(err.(*FieldError).Err).Equals(ErrorBadConfiguration)
+}
@@ -0,0 +1,262 @@
+// +build json
+
+package point
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/v2ray/v2ray-core/common/log"
+	"github.com/v2ray/v2ray-core/common/toml"
+)
+
+const (
+	remoteConfigTimeout = 30 * time.Second
+	maxRemoteConfigSize = 16 * 1024 * 1024
+)
+
+var (
+	ErrorNoConfigFile             = errors.New("No config file.")
+	ErrorUnexpectedConfigResponse = errors.New("Unexpected HTTP status from config server.")
+)
+
+// ConfigDecoder decodes a config file into a JSON document of the same structure as JSON config files.
+type ConfigDecoder func(data []byte) (map[string]interface{}, error)
+
+var (
+	configDecoders = make(map[string]ConfigDecoder)
+)
+
+// RegisterConfigDecoder registers the decoder of config files with the given extension, e.g., ".toml".
+// Files with unknown extensions are decoded as JSON.
+func RegisterConfigDecoder(extension string, decoder ConfigDecoder) {
+	configDecoders[strings.ToLower(extension)] = decoder
+}
+
+// stripJsonComments replaces "//" and "/* */" comments outside of strings with spaces. New lines are
+// kept, so that lines in errors still match.
+func stripJsonComments(data []byte) []byte {
+	result := make([]byte, len(data))
+	copy(result, data)
+	inString := false
+	for i := 0; i < len(result); i++ {
+		switch {
+		case inString:
+			if result[i] == '\\' {
+				i++
+			} else if result[i] == '"' {
+				inString = false
+			}
+		case result[i] == '"':
+			inString = true
+		case bytes.HasPrefix(result[i:], []byte("//")):
+			for ; i < len(result) && result[i] != '\n'; i++ {
+				result[i] = ' '
+			}
+		case bytes.HasPrefix(result[i:], []byte("/*")):
+			end := bytes.Index(result[i+2:], []byte("*/"))
+			if end < 0 {
+				end = len(result)
+			} else {
+				end += i + 4
+			}
+			for ; i < end; i++ {
+				if result[i] != '\n' {
+					result[i] = ' '
+				}
+			}
+			i--
+		}
+	}
+	return result
+}
+
+// decodeJsonConfig decodes a JSON config file, which may contain comments.
+func decodeJsonConfig(data []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(stripJsonComments(data)))
+	decoder.UseNumber()
+	document := make(map[string]interface{})
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+var (
+	stdinMutex sync.Mutex
+	stdinData  []byte
+	stdinRead  bool
+)
+
+// readStdin returns all data from standard input, which is read on the first call.
+func readStdin() ([]byte, error) {
+	stdinMutex.Lock()
+	defer stdinMutex.Unlock()
+
+	if !stdinRead {
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		stdinData = data
+		stdinRead = true
+	}
+	return stdinData, nil
+}
+
+func isStdinConfig(file string) bool {
+	return strings.HasPrefix(file, StdinConfig)
+}
+
+func isRemoteConfig(file string) bool {
+	lower := strings.ToLower(file)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// fetchRemoteConfig downloads a config file from the given HTTP(S) URL.
+func fetchRemoteConfig(configURL string) ([]byte, error) {
+	client := &http.Client{
+		Timeout: remoteConfigTimeout,
+	}
+	response, err := client.Get(configURL)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, response.Body)
+		return nil, ErrorUnexpectedConfigResponse
+	}
+	return ioutil.ReadAll(io.LimitReader(response.Body, maxRemoteConfigSize))
+}
+
+// expandConfigFiles returns the given files, with directories replaced by the config files in them.
+// Environment variables in file names are expanded. Standard input and URLs are kept as they are.
+func expandConfigFiles(files []string) ([]string, error) {
+	var result []string
+	for _, file := range files {
+		if isStdinConfig(file) || isRemoteConfig(file) {
+			result = append(result, file)
+			continue
+		}
+		file = os.ExpandEnv(file)
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			result = append(result, file)
+			continue
+		}
+		entries, err := ioutil.ReadDir(file)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, entry := range entries {
+			if _, found := configDecoders[strings.ToLower(filepath.Ext(entry.Name()))]; found && !entry.IsDir() {
+				names = append(names, entry.Name())
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			result = append(result, filepath.Join(file, name))
+		}
+	}
+	return result, nil
+}
+
+// readConfigFile reads the given config file, standard input, or URL, and returns its data along with the
+// extension which decides its format. The extension is of the file or the URL path, or the format after
+// "stdin:".
+func readConfigFile(file string) ([]byte, string, error) {
+	switch {
+	case isStdinConfig(file):
+		data, err := readStdin()
+		extension := ""
+		if format := strings.TrimPrefix(file, StdinConfig); len(format) > 0 {
+			extension = "." + format
+		}
+		return data, strings.ToLower(extension), err
+	case isRemoteConfig(file):
+		data, err := fetchRemoteConfig(file)
+		extension := ""
+		if parsedURL, parseErr := url.Parse(file); parseErr == nil {
+			extension = path.Ext(parsedURL.Path)
+		}
+		return data, strings.ToLower(extension), err
+	}
+	data, err := ioutil.ReadFile(file)
+	return data, strings.ToLower(filepath.Ext(file)), err
+}
+
+// decodeConfigFile reads and decodes the given config file, standard input, or URL.
+func decodeConfigFile(file string) (map[string]interface{}, error) {
+	data, extension, err := readConfigFile(file)
+	if err != nil {
+		return nil, err
+	}
+	decoder, found := configDecoders[extension]
+	if !found {
+		decoder = decodeJsonConfig
+	}
+	return decoder(data)
+}
+
+// JsonLoadConfig loads a Config from the given files, which are merged in order. See mergeConfigs for how
+// they are merged.
+func JsonLoadConfig(files ...string) (*Config, error) {
+	expanded, err := expandConfigFiles(files)
+	if err != nil {
+		log.Error("Point: Failed to read config files: ", err)
+		return nil, err
+	}
+	if len(expanded) == 0 {
+		log.Error("Point: No config file in ", strings.Join(files, ", "))
+		return nil, ErrorNoConfigFile
+	}
+
+	documents := make([]map[string]interface{}, len(expanded))
+	for idx, file := range expanded {
+		document, err := decodeConfigFile(file)
+		if err != nil {
+			log.Error("Point: Failed to read config file (", file, "): ", err)
+			return nil, err
+		}
+		documents[idx] = document
+	}
+
+	merged, err := json.Marshal(mergeConfigs(documents))
+	if err != nil {
+		return nil, err
+	}
+	config := new(Config)
+	if err := json.Unmarshal(merged, config); err != nil {
+		log.Error("Point: Failed to load server config: ", err)
+		return nil, err
+	}
+	digest := sha256.Sum256(merged)
+	config.digest = hex.EncodeToString(digest[:])
+	return config, nil
+}
+
+func init() {
+	RegisterConfigDecoder(".json", decodeJsonConfig)
+	RegisterConfigDecoder(".jsonc", decodeJsonConfig)
+	RegisterConfigDecoder(".toml", toml.Decode)
+	configLoader = JsonLoadConfig
+}
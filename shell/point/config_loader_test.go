@@ -0,0 +1,240 @@
+//go:build json
+// +build json
+
+package point_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/v2ray/v2ray-core/app/router/rules"
+	. "github.com/v2ray/v2ray-core/shell/point"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+func writeConfigFiles(files map[string]string) string {
+	dir, err := ioutil.TempDir("", "v2ray-config")
+	assert.Error(err).IsNil()
+	for name, content := range files {
+		assert.Error(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)).IsNil()
+	}
+	return dir
+}
+
+func settingsOf(data []byte) map[string]interface{} {
+	settings := make(map[string]interface{})
+	assert.Error(json.Unmarshal(data, &settings)).IsNil()
+	return settings
+}
+
+const baseConfig = `
+// Maintained by the network team.
+{
+  "port": 1080,
+  "inbound": {"protocol": "socks", "settings": {"auth": "noauth"}},
+  "outbound": {"protocol": "freedom", "settings": {}},
+  /* Detours. */
+  "inboundDetour": [
+    {"protocol": "vmess", "port": "10000", "tag": "vmess-in", "settings": {"clients": [{"id": "// not a comment"}]}}
+  ],
+  "outboundDetour": [
+    {"protocol": "freedom", "tag": "direct"},
+    {"protocol": "blackhole", "tag": "block"}
+  ],
+  "routing": {
+    "strategy": "rules",
+    "settings": {"rules": [{"type": "field", "port": "53", "outboundTag": "direct"}]}
+  }
+}`
+
+func TestLoadConfigDirectory(t *testing.T) {
+	v2testing.Current(t)
+
+	dir := writeConfigFiles(map[string]string{
+		"00-base.json": baseConfig,
+		// Maintained by the user team.
+		"10-users.toml": `
+[[inboundDetour]]
+tag = "vmess-in"
+
+[[inboundDetour.settings.clients]]
+id = "8833948b-5861-4a0f-a1d6-83c5606881ff"
+`,
+		"20-routing.jsonc": `{
+  "outboundDetour": [{"protocol": "vmess", "tag": "block"}],
+  "routing": {"settings": {"rules": [{"type": "field", "port": "80", "outboundTag": "block"}]}}
+}`,
+		"README.md": "Not a config.",
+	})
+	defer os.RemoveAll(dir)
+
+	config, err := LoadConfig(dir)
+	assert.Error(err).IsNil()
+	assert.Int(int(config.Port)).Equals(1080)
+	assert.StringLiteral(config.InboundConfig.Protocol).Equals("socks")
+
+	assert.Int(len(config.InboundDetours)).Equals(1)
+	assert.StringLiteral(config.InboundDetours[0].Protocol).Equals("vmess")
+	clients := settingsOf(config.InboundDetours[0].Settings)["clients"].([]interface{})
+	assert.Int(len(clients)).Equals(2)
+	assert.StringLiteral(clients[0].(map[string]interface{})["id"].(string)).Equals("// not a comment")
+	assert.StringLiteral(clients[1].(map[string]interface{})["id"].(string)).Equals("8833948b-5861-4a0f-a1d6-83c5606881ff")
+
+	assert.Int(len(config.OutboundDetours)).Equals(2)
+	assert.StringLiteral(config.OutboundDetours[0].Protocol).Equals("freedom")
+	assert.StringLiteral(config.OutboundDetours[1].Tag).Equals("block")
+	assert.StringLiteral(config.OutboundDetours[1].Protocol).Equals("vmess")
+
+	routerConfig := config.RouterConfig.Settings.(*rules.RouterRuleConfig)
+	assert.Int(len(routerConfig.Rules)).Equals(2)
+	assert.StringLiteral(routerConfig.Rules[0].Tag).Equals("direct")
+	assert.StringLiteral(routerConfig.Rules[1].Tag).Equals("block")
+}
+
+func TestLoadConfigFilesReplacingRules(t *testing.T) {
+	v2testing.Current(t)
+
+	dir := writeConfigFiles(map[string]string{
+		"base.json": baseConfig,
+		"override.json": `{
+  "port": 2080,
+  "routing": {"settings": {
+    "$replace": ["rules"],
+    "rules": [{"type": "field", "port": "443", "outboundTag": "block"}]
+  }}
+}`,
+	})
+	defer os.RemoveAll(dir)
+
+	config, err := LoadConfig(filepath.Join(dir, "override.json"), filepath.Join(dir, "base.json"))
+	assert.Error(err).IsNil()
+	// Files are merged in the given order.
+	assert.Int(int(config.Port)).Equals(1080)
+
+	config, err = LoadConfig(filepath.Join(dir, "base.json"), filepath.Join(dir, "override.json"))
+	assert.Error(err).IsNil()
+	assert.Int(int(config.Port)).Equals(2080)
+	routerConfig := config.RouterConfig.Settings.(*rules.RouterRuleConfig)
+	assert.Int(len(routerConfig.Rules)).Equals(1)
+	assert.StringLiteral(routerConfig.Rules[0].Tag).Equals("block")
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	v2testing.Current(t)
+
+	dir := writeConfigFiles(map[string]string{
+		"invalid.toml": "port = ",
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := LoadConfig(filepath.Join(dir, "invalid.toml"))
+	assert.Error(err).IsNotNil()
+	_, err = LoadConfig(filepath.Join(dir, "missing.json"))
+	assert.Error(err).IsNotNil()
+
+	emptyDir := writeConfigFiles(nil)
+	defer os.RemoveAll(emptyDir)
+	_, err = LoadConfig(emptyDir)
+	assert.Error(err).Equals(ErrorNoConfigFile)
+}
+
+func TestLoadConfigFromURL(t *testing.T) {
+	v2testing.Current(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/base.json":
+			writer.Write([]byte(baseConfig))
+		case "/port.toml":
+			writer.Write([]byte("port = 3080"))
+		default:
+			http.NotFound(writer, request)
+		}
+	}))
+	defer server.Close()
+
+	config, err := LoadConfig(server.URL+"/base.json", server.URL+"/port.toml")
+	assert.Error(err).IsNil()
+	assert.Int(int(config.Port)).Equals(3080)
+	assert.StringLiteral(config.InboundConfig.Protocol).Equals("socks")
+
+	_, err = LoadConfig(server.URL + "/missing.json")
+	assert.Error(err).Equals(ErrorUnexpectedConfigResponse)
+}
+
+func TestWatchConfig(t *testing.T) {
+	v2testing.Current(t)
+
+	var mutex sync.Mutex
+	port := 1080
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		writer.Write([]byte(`{"port": ` + strconv.Itoa(port) + `, "inbound": {"protocol": "socks"}, "outbound": {"protocol": "freedom"}}`))
+	}))
+	defer server.Close()
+
+	config, err := LoadConfig(server.URL)
+	assert.Error(err).IsNil()
+
+	changes := make(chan *Config, 10)
+	stop := WatchConfig(config, 20*time.Millisecond, func(config *Config) {
+		changes <- config
+	}, server.URL)
+	defer stop()
+
+	// Unchanged config is not reloaded.
+	select {
+	case <-changes:
+		t.Fatal("Unexpected config change.")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	mutex.Lock()
+	port = 2080
+	mutex.Unlock()
+	select {
+	case config := <-changes:
+		assert.Int(int(config.Port)).Equals(2080)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Config change not detected.")
+	}
+}
+
+func TestLoadConfigFieldErrors(t *testing.T) {
+	v2testing.Current(t)
+
+	dir := writeConfigFiles(map[string]string{
+		"detour.json": `{
+  "port": 1080,
+  "inbound": {"protocol": "socks"},
+  "outbound": {"protocol": "freedom"},
+  "inboundDetour": [
+    {"protocol": "vmess", "port": "10000"},
+    {"protocol": "vmess"}
+  ]
+}`,
+		"port.json":     `{"port": "1080"}`,
+		"balancer.json": `{"balancers": [{"strategy": "random", "outboundTags": ["direct"]}]}`,
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := LoadConfig(filepath.Join(dir, "detour.json"))
+	assert.StringLiteral(err.(*FieldError).Field).Equals("inboundDetour[1].port")
+	assert.Error(err.(*FieldError).Err).Equals(ErrorBadConfiguration)
+
+	_, err = LoadConfig(filepath.Join(dir, "port.json"))
+	assert.StringLiteral(err.(*FieldError).Field).Equals("port")
+
+	_, err = LoadConfig(filepath.Join(dir, "balancer.json"))
+	assert.StringLiteral(err.Error()).Equals("Invalid config at balancers[0].tag: Bad configuration.")
+}
@@ -0,0 +1,100 @@
+// +build json
+
+package point
+
+const (
+	// mergeReplaceKey is the key of the names of arrays in an object to be replaced on merging, instead of
+	// concatenated.
+	mergeReplaceKey = "$replace"
+)
+
+// mergeConfigs merges the given config documents in order, and returns the result. Objects are merged
+// key by key, and values in later documents override earlier ones. Arrays are concatenated, except that
+// objects with the same "tag" are merged, e.g., inbound and outbound detours. An object may list names
+// of its arrays under "$replace", which then replace the earlier arrays instead.
+func mergeConfigs(documents []map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for _, document := range documents {
+		result = mergeObjects(result, document)
+	}
+	return result
+}
+
+func mergeObjects(base, overlay map[string]interface{}) map[string]interface{} {
+	replaced := make(map[string]bool)
+	if names, ok := overlay[mergeReplaceKey].([]interface{}); ok {
+		for _, name := range names {
+			if name, ok := name.(string); ok {
+				replaced[name] = true
+			}
+		}
+	}
+
+	result := make(map[string]interface{}, len(base)+len(overlay))
+	for key, value := range base {
+		result[key] = value
+	}
+	for key, value := range overlay {
+		if key == mergeReplaceKey {
+			continue
+		}
+		if replaced[key] {
+			result[key] = value
+		} else {
+			result[key] = mergeValues(result[key], value)
+		}
+	}
+	return result
+}
+
+func mergeValues(base, overlay interface{}) interface{} {
+	switch overlay := overlay.(type) {
+	case map[string]interface{}:
+		if base, ok := base.(map[string]interface{}); ok {
+			return mergeObjects(base, overlay)
+		}
+		return mergeObjects(make(map[string]interface{}), overlay)
+	case []interface{}:
+		if base, ok := base.([]interface{}); ok {
+			return mergeArrays(base, overlay)
+		}
+	}
+	return overlay
+}
+
+func mergeArrays(base, overlay []interface{}) []interface{} {
+	result := make([]interface{}, len(base), len(base)+len(overlay))
+	copy(result, base)
+	for _, element := range overlay {
+		if idx := findTagged(result, element); idx >= 0 {
+			result[idx] = mergeValues(result[idx], element)
+		} else {
+			result = append(result, mergeValues(nil, element))
+		}
+	}
+	return result
+}
+
+// findTagged returns the index of the object in the given array with the same tag as the given element,
+// or -1 if there is none.
+func findTagged(array []interface{}, element interface{}) int {
+	tag := getTag(element)
+	if len(tag) == 0 {
+		return -1
+	}
+	for idx, candidate := range array {
+		if getTag(candidate) == tag {
+			return idx
+		}
+	}
+	return -1
+}
+
+func getTag(value interface{}) string {
+	if object, ok := value.(map[string]interface{}); ok {
+		if tag, ok := object["tag"].(string); ok {
+			return tag
+		}
+	}
+	return ""
+}
@@ -0,0 +1,376 @@
+package point
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/v2ray/v2ray-core/app/router"
+	"github.com/v2ray/v2ray-core/common/loader"
+	"github.com/v2ray/v2ray-core/common/log"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	"github.com/v2ray/v2ray-core/proxy/health"
+)
+
+const (
+	// ConfigVersion is the latest version of ConfigMessage. Configs of later versions are rejected.
+	ConfigVersion = 1
+
+	// Extensions of config files of ConfigMessage, in the protobuf binary and text formats.
+	SchemaConfigExtension     = ".pb"
+	SchemaTextConfigExtension = ".pbtxt"
+)
+
+// ConfigMessage is the typed schema of Config, for generating configs programmatically. It is loaded from
+// the protobuf binary or text format by LoadSchemaConfig. Proxy settings are typed messages registered in
+// the loader package, e.g., "v2ray.core.proxy.freedom.Config".
+type ConfigMessage struct {
+	Version        uint32                         `protobuf:"varint,1,opt,name=version"` // ConfigVersion if 0.
+	Port           uint32                         `protobuf:"varint,2,opt,name=port"`
+	Log            *LogConfigMessage              `protobuf:"bytes,3,opt,name=log"`
+	Inbound        *ConnectionConfigMessage       `protobuf:"bytes,4,opt,name=inbound"`
+	Outbound       *ConnectionConfigMessage       `protobuf:"bytes,5,opt,name=outbound"`
+	InboundDetour  []*InboundDetourConfigMessage  `protobuf:"bytes,6,rep,name=inbound_detour"`
+	OutboundDetour []*OutboundDetourConfigMessage `protobuf:"bytes,7,rep,name=outbound_detour"`
+	Balancer       []*BalancerConfigMessage       `protobuf:"bytes,8,rep,name=balancer"`
+	Routing        *RoutingConfigMessage          `protobuf:"bytes,9,opt,name=routing"`
+	DrainTimeout   uint32                         `protobuf:"varint,10,opt,name=drain_timeout"` // Seconds. DefaultDrainTimeout if 0.
+}
+
+type LogConfigMessage struct {
+	Access   string                    `protobuf:"bytes,1,opt,name=access"`
+	Error    string                    `protobuf:"bytes,2,opt,name=error"`
+	Level    string                    `protobuf:"bytes,3,opt,name=level"`  // "debug", "info", "warning" or "error".
+	Format   string                    `protobuf:"bytes,4,opt,name=format"` // "text" or "json".
+	Rotation *LogRotationConfigMessage `protobuf:"bytes,5,opt,name=rotation"`
+}
+
+type LogRotationConfigMessage struct {
+	MaxSize    uint32 `protobuf:"varint,1,opt,name=max_size"` // MB
+	Interval   uint32 `protobuf:"varint,2,opt,name=interval"` // Hours
+	MaxBackups uint32 `protobuf:"varint,3,opt,name=max_backups"`
+}
+
+// ConnectionConfigMessage is the config of a proxy. Proxies without typed settings, e.g., shadowsocks,
+// take their JSON settings in JsonSettings, which requires the json build tag.
+type ConnectionConfigMessage struct {
+	Protocol     string                `protobuf:"bytes,1,opt,name=protocol"`
+	Settings     *loader.TypedSettings `protobuf:"bytes,2,opt,name=settings"`
+	JsonSettings string                `protobuf:"bytes,3,opt,name=json_settings"`
+	Fallback     []string              `protobuf:"bytes,4,rep,name=fallback"` // Outbound only.
+}
+
+type InboundDetourAllocationConfigMessage struct {
+	Strategy    string `protobuf:"bytes,1,opt,name=strategy"`
+	Concurrency uint32 `protobuf:"varint,2,opt,name=concurrency"`
+	Refresh     uint32 `protobuf:"varint,3,opt,name=refresh"` // Minutes
+}
+
+type InboundDetourConfigMessage struct {
+	Protocol     string                                `protobuf:"bytes,1,opt,name=protocol"`
+	PortFrom     uint32                                `protobuf:"varint,2,opt,name=port_from"`
+	PortTo       uint32                                `protobuf:"varint,3,opt,name=port_to"` // Same as PortFrom if 0.
+	Tag          string                                `protobuf:"bytes,4,opt,name=tag"`
+	Allocation   *InboundDetourAllocationConfigMessage `protobuf:"bytes,5,opt,name=allocation"`
+	Settings     *loader.TypedSettings                 `protobuf:"bytes,6,opt,name=settings"`
+	JsonSettings string                                `protobuf:"bytes,7,opt,name=json_settings"`
+}
+
+type HealthCheckConfigMessage struct {
+	Interval   uint32 `protobuf:"varint,1,opt,name=interval"`    // Seconds
+	Timeout    uint32 `protobuf:"varint,2,opt,name=timeout"`     // Seconds
+	MaxBackoff uint32 `protobuf:"varint,3,opt,name=max_backoff"` // Seconds
+	Url        string `protobuf:"bytes,4,opt,name=url"`
+}
+
+type OutboundDetourConfigMessage struct {
+	Protocol     string                    `protobuf:"bytes,1,opt,name=protocol"`
+	Tag          string                    `protobuf:"bytes,2,opt,name=tag"`
+	Settings     *loader.TypedSettings     `protobuf:"bytes,3,opt,name=settings"`
+	JsonSettings string                    `protobuf:"bytes,4,opt,name=json_settings"`
+	HealthCheck  *HealthCheckConfigMessage `protobuf:"bytes,5,opt,name=health_check"`
+	Fallback     []string                  `protobuf:"bytes,6,rep,name=fallback"`
+}
+
+type BalancerConfigMessage struct {
+	Tag      string   `protobuf:"bytes,1,opt,name=tag"`
+	Strategy string   `protobuf:"bytes,2,opt,name=strategy"`
+	Outbound []string `protobuf:"bytes,3,rep,name=outbound"`
+}
+
+// RoutingConfigMessage is the config of the router, e.g., strategy "rules" with settings of type
+// "v2ray.core.app.router.rules.Config".
+type RoutingConfigMessage struct {
+	Strategy string                `protobuf:"bytes,1,opt,name=strategy"`
+	Settings *loader.TypedSettings `protobuf:"bytes,2,opt,name=settings"`
+}
+
+// buildSettings returns the config object of typed settings, if any.
+func buildSettings(settings *loader.TypedSettings) (interface{}, error) {
+	if settings == nil {
+		return nil, nil
+	}
+	config, err := loader.Build(settings)
+	if err != nil {
+		log.Error("Point: Failed to build settings of type ", settings.Type, ": ", err)
+		return nil, err
+	}
+	return config, nil
+}
+
+func (this *LogConfigMessage) Build() (*LogConfig, error) {
+	config := &LogConfig{
+		AccessLog: this.Access,
+		ErrorLog:  this.Error,
+		LogLevel:  parseLogLevel(this.Level),
+	}
+	format, ok := parseLogFormat(this.Format)
+	if !ok {
+		log.Error("Point: Unknown log format: ", this.Format)
+		return nil, newFieldError("format", ErrorBadConfiguration)
+	}
+	config.Format = format
+	if rotation := this.Rotation; rotation != nil {
+		config.Rotation = log.RotationConfig{
+			MaxSize:    int64(rotation.MaxSize) * 1024 * 1024,
+			Interval:   time.Duration(rotation.Interval) * time.Hour,
+			MaxBackups: int(rotation.MaxBackups),
+		}
+	}
+	return config, nil
+}
+
+func (this *ConnectionConfigMessage) Build() (*ConnectionConfig, error) {
+	settings, err := buildSettings(this.Settings)
+	if err != nil {
+		return nil, newFieldError("settings", err)
+	}
+	return &ConnectionConfig{
+		Protocol:       this.Protocol,
+		Settings:       []byte(this.JsonSettings),
+		SettingsConfig: settings,
+		Fallbacks:      this.Fallback,
+	}, nil
+}
+
+func (this *InboundDetourConfigMessage) Build() (*InboundDetourConfig, error) {
+	portTo := this.PortTo
+	if portTo == 0 {
+		portTo = this.PortFrom
+	}
+	if this.PortFrom == 0 || portTo > 65535 || this.PortFrom > portTo {
+		log.Error("Point: Invalid port range in InboundDetour: ", this.PortFrom, "-", portTo)
+		return nil, newFieldError("port_from", ErrorBadConfiguration)
+	}
+	settings, err := buildSettings(this.Settings)
+	if err != nil {
+		return nil, newFieldError("settings", err)
+	}
+	config := &InboundDetourConfig{
+		Protocol: this.Protocol,
+		PortRange: v2net.PortRange{
+			From: v2net.Port(this.PortFrom),
+			To:   v2net.Port(portTo),
+		},
+		Tag:            this.Tag,
+		Settings:       []byte(this.JsonSettings),
+		SettingsConfig: settings,
+		Allocation: &InboundDetourAllocationConfig{
+			Strategy: AllocationStrategyAlways,
+			Refresh:  DefaultRefreshMinute,
+		},
+	}
+	if allocation := this.Allocation; allocation != nil {
+		config.Allocation = &InboundDetourAllocationConfig{
+			Strategy:    allocation.Strategy,
+			Concurrency: int(allocation.Concurrency),
+			Refresh:     int(allocation.Refresh),
+		}
+		config.Allocation.setDefaults()
+	}
+	return config, nil
+}
+
+func (this *OutboundDetourConfigMessage) Build() (*OutboundDetourConfig, error) {
+	settings, err := buildSettings(this.Settings)
+	if err != nil {
+		return nil, newFieldError("settings", err)
+	}
+	config := &OutboundDetourConfig{
+		Protocol:       this.Protocol,
+		Tag:            this.Tag,
+		Settings:       []byte(this.JsonSettings),
+		SettingsConfig: settings,
+		Fallbacks:      this.Fallback,
+	}
+	if healthCheck := this.HealthCheck; healthCheck != nil {
+		if len(healthCheck.Url) == 0 {
+			log.Error("Point: URL not specified in health check of outbound detour: ", this.Tag)
+			return nil, newFieldError("health_check.url", ErrorBadConfiguration)
+		}
+		config.HealthCheck = &health.Config{
+			Interval:   time.Duration(healthCheck.Interval) * time.Second,
+			Timeout:    time.Duration(healthCheck.Timeout) * time.Second,
+			MaxBackoff: time.Duration(healthCheck.MaxBackoff) * time.Second,
+			URL:        healthCheck.Url,
+		}
+	}
+	return config, nil
+}
+
+func (this *BalancerConfigMessage) Build() (*BalancerConfig, error) {
+	if len(this.Tag) == 0 {
+		log.Error("Point: Tag not specified in balancer.")
+		return nil, newFieldError("tag", ErrorBadConfiguration)
+	}
+	config := &BalancerConfig{
+		Tag:          this.Tag,
+		Strategy:     strings.ToLower(this.Strategy),
+		OutboundTags: this.Outbound,
+	}
+	if len(config.Strategy) == 0 {
+		config.Strategy = BalancerStrategyRandom
+	}
+	return config, nil
+}
+
+func (this *RoutingConfigMessage) Build() (*router.Config, error) {
+	settings, err := buildSettings(this.Settings)
+	if err != nil {
+		return nil, newFieldError("settings", err)
+	}
+	return &router.Config{
+		Strategy: this.Strategy,
+		Settings: settings,
+	}, nil
+}
+
+// Build returns the Config of this message. Errors are FieldErrors with the names of the message fields.
+func (this *ConfigMessage) Build() (*Config, error) {
+	if this.Version > ConfigVersion {
+		log.Error("Point: Config version ", this.Version, " is not supported. Latest version is ", ConfigVersion, ".")
+		return nil, newFieldError("version", ErrorUnsupportedConfigVersion)
+	}
+	if this.Port > 65535 {
+		return nil, newFieldError("port", ErrorBadConfiguration)
+	}
+
+	config := &Config{
+		Port:         v2net.Port(this.Port),
+		DrainTimeout: DefaultDrainTimeout,
+	}
+	if this.DrainTimeout > 0 {
+		config.DrainTimeout = time.Duration(this.DrainTimeout) * time.Second
+	}
+
+	var err error
+	if this.Log != nil {
+		if config.LogConfig, err = this.Log.Build(); err != nil {
+			return nil, newFieldError("log", err)
+		}
+	}
+	if this.Inbound != nil {
+		if config.InboundConfig, err = this.Inbound.Build(); err != nil {
+			return nil, newFieldError("inbound", err)
+		}
+	}
+	if this.Outbound != nil {
+		if config.OutboundConfig, err = this.Outbound.Build(); err != nil {
+			return nil, newFieldError("outbound", err)
+		}
+	}
+	for idx, detourMessage := range this.InboundDetour {
+		detourConfig, err := detourMessage.Build()
+		if err != nil {
+			return nil, newFieldError("inbound_detour["+strconv.Itoa(idx)+"]", err)
+		}
+		config.InboundDetours = append(config.InboundDetours, detourConfig)
+	}
+	for idx, detourMessage := range this.OutboundDetour {
+		detourConfig, err := detourMessage.Build()
+		if err != nil {
+			return nil, newFieldError("outbound_detour["+strconv.Itoa(idx)+"]", err)
+		}
+		config.OutboundDetours = append(config.OutboundDetours, detourConfig)
+	}
+	for idx, balancerMessage := range this.Balancer {
+		balancerConfig, err := balancerMessage.Build()
+		if err != nil {
+			return nil, newFieldError("balancer["+strconv.Itoa(idx)+"]", err)
+		}
+		config.Balancers = append(config.Balancers, balancerConfig)
+	}
+	if this.Routing != nil {
+		if config.RouterConfig, err = this.Routing.Build(); err != nil {
+			return nil, newFieldError("routing", err)
+		}
+	}
+	return config, nil
+}
+
+// LoadSchemaConfig loads a Config from a ConfigMessage in the protobuf text format if text is true, or in
+// the binary format otherwise.
+func LoadSchemaConfig(data []byte, text bool) (*Config, error) {
+	message := new(ConfigMessage)
+	var err error
+	if text {
+		err = loader.UnmarshalText(data, message)
+	} else {
+		err = loader.Unmarshal(data, message)
+	}
+	if err != nil {
+		log.Error("Point: Failed to decode config message: ", err)
+		return nil, err
+	}
+	config, err := message.Build()
+	if err != nil {
+		log.Error("Point: Failed to load server config: ", err)
+		return nil, err
+	}
+	digest := sha256.Sum256(data)
+	config.digest = hex.EncodeToString(digest[:])
+	return config, nil
+}
+
+// isSchemaConfigFile returns true if the given file contains a ConfigMessage, by its extension.
+func isSchemaConfigFile(file string) bool {
+	extension := strings.ToLower(filepath.Ext(file))
+	return extension == SchemaConfigExtension || extension == SchemaTextConfigExtension
+}
+
+func loadSchemaConfigFile(file string) (*Config, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Error("Point: Failed to read config file (", file, "): ", err)
+		return nil, err
+	}
+	return LoadSchemaConfig(data, strings.ToLower(filepath.Ext(file)) == SchemaTextConfigExtension)
+}
+
+// parseLogLevel returns the log level of the given name, or WarningLevel if unknown.
+func parseLogLevel(level string) log.LogLevel {
+	switch strings.ToLower(level) {
+	case "debug":
+		return log.DebugLevel
+	case "info":
+		return log.InfoLevel
+	case "error":
+		return log.ErrorLevel
+	}
+	return log.WarningLevel
+}
+
+// parseLogFormat returns the log format of the given name, which is text if empty.
+func parseLogFormat(format string) (log.Format, bool) {
+	switch strings.ToLower(format) {
+	case "", "text":
+		return log.FormatText, true
+	case "json":
+		return log.FormatJSON, true
+	}
+	return log.FormatText, false
+}
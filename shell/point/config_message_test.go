@@ -0,0 +1,233 @@
+package point_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/v2ray/v2ray-core/app"
+	"github.com/v2ray/v2ray-core/app/router/rules"
+	"github.com/v2ray/v2ray-core/common/loader"
+	"github.com/v2ray/v2ray-core/common/log"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	"github.com/v2ray/v2ray-core/proxy"
+	"github.com/v2ray/v2ray-core/proxy/freedom"
+	"github.com/v2ray/v2ray-core/proxy/socks"
+	vmessin "github.com/v2ray/v2ray-core/proxy/vmess/inbound"
+	vmessout "github.com/v2ray/v2ray-core/proxy/vmess/outbound"
+	proxytesting "github.com/v2ray/v2ray-core/proxy/testing"
+	"github.com/v2ray/v2ray-core/proxy/testing/mocks"
+	. "github.com/v2ray/v2ray-core/shell/point"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+const schemaConfigText = `
+version: 1
+port: 1080
+log { level: "debug" format: "json" }
+inbound {
+  protocol: "socks"
+  settings {
+    [type.googleapis.com/v2ray.core.proxy.socks.Config] {
+      auth_type: 1
+      account { username: "user" password: "pass" }
+      udp: true
+    }
+  }
+}
+outbound {
+  protocol: "freedom"
+  settings { [v2ray.core.proxy.freedom.Config] { domain_strategy: 1 } }
+}
+inbound_detour { protocol: "socks" port_from: 2000 port_to: 2010 tag: "in" allocation { strategy: "random" } }
+outbound_detour {
+  protocol: "freedom"
+  tag: "direct"
+  health_check { url: "http://www.v2ray.com/" interval: 60 }
+}
+balancer { tag: "all" outbound: ["direct"] }
+routing {
+  strategy: "rules"
+  settings {
+    [v2ray.core.app.router.rules.Config] {
+      rule { type: "field" outbound_tag: "direct" ip: "10.0.0.0/8" }
+    }
+  }
+}
+drain_timeout: 5
+`
+
+func assertSchemaConfig(config *Config) {
+	assert.Int(int(config.Port)).Equals(1080)
+	assert.Int(int(config.LogConfig.LogLevel)).Equals(int(log.DebugLevel))
+	assert.Int(int(config.LogConfig.Format)).Equals(int(log.FormatJSON))
+	assert.Int(int(config.DrainTimeout.Seconds())).Equals(5)
+
+	socksConfig := config.InboundConfig.SettingsConfig.(*socks.Config)
+	assert.Bool(socksConfig.HasAccount("user", "pass")).IsTrue()
+	assert.Bool(socksConfig.UDPEnabled).IsTrue()
+	assert.Int(len(config.InboundConfig.Settings)).Equals(0)
+
+	freedomConfig := config.OutboundConfig.SettingsConfig.(*freedom.Config)
+	assert.Int(int(freedomConfig.DomainStrategy)).Equals(int(freedom.DomainStrategyUseIP))
+
+	assert.Int(len(config.InboundDetours)).Equals(1)
+	detourConfig := config.InboundDetours[0]
+	assert.Int(int(detourConfig.PortRange.From)).Equals(2000)
+	assert.Int(int(detourConfig.PortRange.To)).Equals(2010)
+	assert.StringLiteral(detourConfig.Allocation.Strategy).Equals(AllocationStrategyRandom)
+	assert.Int(detourConfig.Allocation.Concurrency).Equals(3)
+
+	assert.Int(len(config.OutboundDetours)).Equals(1)
+	assert.StringLiteral(config.OutboundDetours[0].HealthCheck.URL).Equals("http://www.v2ray.com/")
+	assert.Int(len(config.Balancers)).Equals(1)
+	assert.StringLiteral(config.Balancers[0].Strategy).Equals(BalancerStrategyRandom)
+
+	assert.StringLiteral(config.RouterConfig.Strategy).Equals("rules")
+	ruleConfig := config.RouterConfig.Settings.(*rules.RouterRuleConfig)
+	assert.Int(len(ruleConfig.Rules)).Equals(1)
+	assert.Bool(ruleConfig.Rules[0].Apply(v2net.TCPDestination(v2net.IPAddress([]byte{10, 1, 2, 3}), 80))).IsTrue()
+}
+
+func TestLoadSchemaConfig(t *testing.T) {
+	v2testing.Current(t)
+
+	config, err := LoadSchemaConfig([]byte(schemaConfigText), true)
+	assert.Error(err).IsNil()
+	assertSchemaConfig(config)
+
+	message := new(ConfigMessage)
+	assert.Error(loader.UnmarshalText([]byte(schemaConfigText), message)).IsNil()
+	data, err := loader.Marshal(message)
+	assert.Error(err).IsNil()
+	config, err = LoadSchemaConfig(data, false)
+	assert.Error(err).IsNil()
+	assertSchemaConfig(config)
+
+	dir, err := ioutil.TempDir("", "v2ray-config")
+	assert.Error(err).IsNil()
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.pb")
+	assert.Error(ioutil.WriteFile(file, data, 0600)).IsNil()
+	config, err = LoadConfig(file)
+	assert.Error(err).IsNil()
+	assertSchemaConfig(config)
+	assert.Int(len(ValidateConfig(file))).Equals(0)
+}
+
+func TestSchemaConfigErrors(t *testing.T) {
+	v2testing.Current(t)
+
+	_, err := LoadSchemaConfig([]byte("version: 2"), true)
+	assert.StringLiteral(err.(*FieldError).Field).Equals("version")
+	assert.Error(err.(*FieldError).Err).Equals(ErrorUnsupportedConfigVersion)
+
+	_, err = LoadSchemaConfig([]byte(`inbound_detour { protocol: "socks" }`), true)
+	assert.StringLiteral(err.(*FieldError).Field).Equals("inbound_detour[0].port_from")
+
+	_, err = LoadSchemaConfig([]byte(`outbound { protocol: "freedom" settings { type: "v2ray.core.proxy.Unknown" } }`), true)
+	assert.StringLiteral(err.(*FieldError).Field).Equals("outbound.settings")
+	assert.Error(err.(*FieldError).Err).Equals(loader.ErrorUnknownType)
+
+	_, err = LoadSchemaConfig([]byte(`log { format: "xml" }`), true)
+	assert.StringLiteral(err.(*FieldError).Field).Equals("log.format")
+
+	_, err = LoadSchemaConfig([]byte{0x0a}, false)
+	assert.Error(err).Equals(loader.ErrorTruncated)
+}
+
+func TestSchemaConfigHandlers(t *testing.T) {
+	v2testing.Current(t)
+
+	var inboundConfig, outboundConfig interface{}
+	inboundProtocol, err := proxytesting.RegisterInboundConnectionHandlerCreator("schema_ich",
+		func(space app.Space, config interface{}) (proxy.InboundHandler, error) {
+			inboundConfig = config
+			return new(recordingInboundHandler), nil
+		})
+	assert.Error(err).IsNil()
+	outboundProtocol, err := proxytesting.RegisterOutboundConnectionHandlerCreator("schema_och",
+		func(space app.Space, config interface{}) (proxy.OutboundHandler, error) {
+			outboundConfig = config
+			return new(mocks.OutboundConnectionHandler), nil
+		})
+	assert.Error(err).IsNil()
+
+	config, err := LoadSchemaConfig([]byte(strings.NewReplacer("ICH", inboundProtocol, "OCH", outboundProtocol).Replace(`
+port: 50101
+inbound { protocol: "ICH" settings { [v2ray.core.proxy.socks.Config] { udp: true } } }
+outbound { protocol: "OCH" settings { [v2ray.core.proxy.freedom.Config] { redirect_port: 53 } } }
+`)), true)
+	assert.Error(err).IsNil()
+
+	vpoint, err := NewPoint(config)
+	assert.Error(err).IsNil()
+	defer vpoint.Close()
+
+	assert.Bool(inboundConfig.(*socks.Config).UDPEnabled).IsTrue()
+	assert.Int(int(outboundConfig.(*freedom.Config).RedirectPort)).Equals(53)
+}
+
+func TestSchemaConfigVMess(t *testing.T) {
+	v2testing.Current(t)
+
+	config, err := LoadSchemaConfig([]byte(`
+port: 50102
+inbound {
+  protocol: "vmess"
+  settings {
+    [v2ray.core.proxy.vmess.inbound.Config] {
+      client {
+        user { id: "ad937d9d-6e23-4a5a-ba23-bce5092a7c51" alter_id: 4 level: 1 email: "love@v2ray.com" }
+        expiry: 1500000000
+        disabled: true
+      }
+      detour_to: "dynamic"
+      aead_only: true
+    }
+  }
+}
+outbound {
+  protocol: "vmess"
+  settings {
+    [v2ray.core.proxy.vmess.outbound.Config] {
+      receiver {
+        address: "127.0.0.1"
+        port: 37192
+        user { id: "ad937d9d-6e23-4a5a-ba23-bce5092a7c51" alter_id: 4 }
+        aead: true
+      }
+      health_check { interval: 60 }
+    }
+  }
+}
+`), true)
+	assert.Error(err).IsNil()
+
+	inboundConfig := config.InboundConfig.SettingsConfig.(*vmessin.Config)
+	assert.Int(len(inboundConfig.AllowedUsers)).Equals(1)
+	user := inboundConfig.AllowedUsers[0]
+	assert.StringLiteral(user.ID.String()).Equals("ad937d9d-6e23-4a5a-ba23-bce5092a7c51")
+	assert.Int(len(user.AlterIDs)).Equals(4)
+	assert.Int(int(user.Level)).Equals(1)
+	options := inboundConfig.UserOptions["love@v2ray.com"]
+	assert.Int64(options.Expiry.Unix()).Equals(1500000000)
+	assert.Bool(options.Disabled).IsTrue()
+	assert.StringLiteral(inboundConfig.Features.Detour.ToTag).Equals("dynamic")
+	assert.Int(int(inboundConfig.Defaults.AlterIDs)).Equals(32)
+	assert.Bool(inboundConfig.AEADOnly).IsTrue()
+
+	outboundConfig := config.OutboundConfig.SettingsConfig.(*vmessout.Config)
+	assert.Int(len(outboundConfig.Receivers)).Equals(1)
+	receiver := outboundConfig.Receivers[0]
+	assert.StringLiteral(receiver.Destination.String()).Equals("tcp:127.0.0.1:37192")
+	assert.Int(len(receiver.Accounts)).Equals(1)
+	assert.Bool(receiver.AEAD).IsTrue()
+	assert.Int(int(outboundConfig.HealthCheck.Interval.Seconds())).Equals(60)
+
+	_, err = LoadSchemaConfig([]byte(`outbound { protocol: "vmess" settings { [v2ray.core.proxy.vmess.outbound.Config] {} } }`), true)
+	assert.StringLiteral(err.(*FieldError).Field).Equals("outbound.settings")
+}
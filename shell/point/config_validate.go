@@ -0,0 +1,686 @@
+// +build json
+
+package point
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/v2ray/v2ray-core/app/router"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	"github.com/v2ray/v2ray-core/common/toml"
+	proxyrepo "github.com/v2ray/v2ray-core/proxy/repo"
+)
+
+const (
+	// positionKey is the key of the position of an object in its config file, which is added to objects
+	// for validation. Position of a key of the object is under positionKey + ":" + key.
+	positionKey = "$position"
+)
+
+var (
+	ErrorNotJsonObject = errors.New("Config is not a JSON object.")
+)
+
+// knownConfigFields are the fields of objects in the config, by their JSON paths with array indices
+// omitted. Objects at other paths, e.g., settings of proxies, are not checked for unknown fields.
+var knownConfigFields = map[string][]string{
+	"":                             {"port", "log", "routing", "inbound", "outbound", "inboundDetour", "outboundDetour", "balancers", "api", "dns", "stats", "metrics", "limits", "policy", "drainTimeout"},
+	"log":                          {"access", "error", "loglevel", "format", "rotation"},
+	"log.rotation":                 {"maxSize", "interval", "maxBackups"},
+	"inbound":                      {"protocol", "settings"},
+	"outbound":                     {"protocol", "settings", "fallbacks"},
+	"inboundDetour[]":              {"protocol", "port", "settings", "tag", "allocate"},
+	"inboundDetour[].allocate":     {"strategy", "concurrency", "refresh"},
+	"outboundDetour[]":             {"protocol", "tag", "settings", "healthCheck", "fallbacks"},
+	"outboundDetour[].healthCheck": {"interval", "timeout", "maxBackoff", "url"},
+	"balancers[]":                  {"tag", "strategy", "outbounds"},
+	"routing":                      {"strategy", "settings"},
+	"routing.settings":             {"rules", "resolveDomain", "domainStrategy"},
+	"routing.settings.rules[]":     {"type", "outboundTag", "domain", "ip", "port", "network"},
+}
+
+// configPosition is a position in a config file.
+type configPosition struct {
+	File   string
+	Line   int // 0 if unknown.
+	Column int // 0 if unknown.
+}
+
+func (this *configPosition) newError(path string, reason string) *ValidationError {
+	return &ValidationError{
+		File:   this.File,
+		Line:   this.Line,
+		Column: this.Column,
+		Path:   path,
+		Reason: reason,
+	}
+}
+
+// positionDecoder decodes a JSON config file, and records positions of objects and their keys under
+// positionKey.
+type positionDecoder struct {
+	file       string
+	data       []byte
+	lineStarts []int
+	decoder    *json.Decoder
+}
+
+func newPositionDecoder(file string, data []byte) *positionDecoder {
+	data = stripJsonComments(data)
+	lineStarts := []int{0}
+	for idx, b := range data {
+		if b == '\n' {
+			lineStarts = append(lineStarts, idx+1)
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return &positionDecoder{
+		file:       file,
+		data:       data,
+		lineStarts: lineStarts,
+		decoder:    decoder,
+	}
+}
+
+func (this *positionDecoder) position(offset int64) *configPosition {
+	line := sort.Search(len(this.lineStarts), func(idx int) bool {
+		return int64(this.lineStarts[idx]) > offset
+	})
+	return &configPosition{
+		File:   this.file,
+		Line:   line,
+		Column: int(offset) - this.lineStarts[line-1] + 1,
+	}
+}
+
+// nextOffset returns the offset of the next token.
+func (this *positionDecoder) nextOffset() int64 {
+	offset := this.decoder.InputOffset()
+	for offset < int64(len(this.data)) && strings.IndexByte(" \t\r\n,:", this.data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+func (this *positionDecoder) decodeValue() (interface{}, error) {
+	offset := this.nextOffset()
+	token, err := this.decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil
+	}
+	switch delim {
+	case '{':
+		object := map[string]interface{}{
+			positionKey: this.position(offset),
+		}
+		for this.decoder.More() {
+			keyOffset := this.nextOffset()
+			key, err := this.decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := this.decodeValue()
+			if err != nil {
+				return nil, err
+			}
+			object[key.(string)] = value
+			object[positionKey+":"+key.(string)] = this.position(keyOffset)
+		}
+		_, err = this.decoder.Token()
+		return object, err
+	case '[':
+		array := make([]interface{}, 0)
+		for this.decoder.More() {
+			value, err := this.decodeValue()
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		_, err = this.decoder.Token()
+		return array, err
+	}
+	return nil, &json.SyntaxError{Offset: offset}
+}
+
+// decode returns the config document in the file, or a ValidationError.
+func (this *positionDecoder) decode() (map[string]interface{}, error) {
+	value, err := this.decodeValue()
+	switch err := err.(type) {
+	case nil:
+	case *json.SyntaxError:
+		offset := err.Offset
+		if offset > 0 {
+			// Offset of syntax errors is after the offending byte.
+			offset--
+		}
+		return nil, this.position(offset).newError("", err.Error())
+	default:
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return nil, this.position(int64(len(this.data))).newError("", "Unexpected end of JSON input.")
+		}
+		return nil, this.position(this.nextOffset()).newError("", err.Error())
+	}
+	document, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, this.position(0).newError("", ErrorNotJsonObject.Error())
+	}
+	return document, nil
+}
+
+// addFilePositions adds the given file as position to all objects in the given value.
+func addFilePositions(value interface{}, file string) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for _, field := range value {
+			addFilePositions(field, file)
+		}
+		value[positionKey] = &configPosition{File: file}
+	case []interface{}:
+		for _, element := range value {
+			addFilePositions(element, file)
+		}
+	}
+}
+
+// decodeConfigWithPositions decodes the given config file, with positions of objects in it. Positions are
+// exact in JSON files, while only the file is known for other formats.
+func decodeConfigWithPositions(file string) (map[string]interface{}, error) {
+	data, extension, err := readConfigFile(file)
+	if err != nil {
+		return nil, &ValidationError{File: file, Reason: err.Error()}
+	}
+	decoder, found := configDecoders[extension]
+	if !found || extension == ".json" || extension == ".jsonc" {
+		return newPositionDecoder(file, data).decode()
+	}
+	document, err := decoder(data)
+	if err != nil {
+		if syntaxErr, ok := err.(*toml.SyntaxError); ok {
+			return nil, &ValidationError{File: file, Line: syntaxErr.Line, Reason: syntaxErr.Message}
+		}
+		return nil, &ValidationError{File: file, Reason: err.Error()}
+	}
+	addFilePositions(document, file)
+	return document, nil
+}
+
+func isPositionKey(key string) bool {
+	return strings.HasPrefix(key, positionKey)
+}
+
+// stripPositions returns a copy of the given value without positions.
+func stripPositions(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, field := range value {
+			if !isPositionKey(key) {
+				result[key] = stripPositions(field)
+			}
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for idx, element := range value {
+			result[idx] = stripPositions(element)
+		}
+		return result
+	}
+	return value
+}
+
+func findField(object map[string]interface{}, name string) (string, bool) {
+	if _, found := object[name]; found {
+		return name, true
+	}
+	for key := range object {
+		if !isPositionKey(key) && strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinPath(path string, key string) string {
+	if len(path) == 0 || strings.HasPrefix(key, "[") {
+		return path + key
+	}
+	return path + "." + key
+}
+
+func indexPath(path string, idx int) string {
+	return path + "[" + strconv.Itoa(idx) + "]"
+}
+
+// splitPath splits the given JSON path into keys and indices, e.g., "a[1].b" into "a", "[1]", "b".
+func splitPath(path string) []string {
+	var segments []string
+	for len(path) > 0 {
+		end := strings.IndexAny(path[1:], ".[")
+		if end < 0 {
+			end = len(path)
+		} else {
+			end++
+		}
+		segments = append(segments, strings.TrimPrefix(path[:end], "."))
+		path = path[end:]
+	}
+	return segments
+}
+
+func portRangeString(portRange v2net.PortRange) string {
+	if portRange.From == portRange.To {
+		return "Port " + portRange.From.String()
+	}
+	return "Ports " + portRange.From.String() + "-" + portRange.To.String()
+}
+
+// configChecker finds problems in a merged config document.
+type configChecker struct {
+	document map[string]interface{}
+	problems []*ValidationError
+	removed  []string // Paths of the fields left out in loading the config.
+}
+
+// locate returns the position of the given JSON path, or its closest parent with known position.
+func (this *configChecker) locate(path string) *configPosition {
+	var current interface{} = this.document
+	position, _ := this.document[positionKey].(*configPosition)
+	for _, segment := range splitPath(path) {
+		switch value := current.(type) {
+		case map[string]interface{}:
+			key, found := findField(value, segment)
+			if !found {
+				return position
+			}
+			if keyPosition, ok := value[positionKey+":"+key].(*configPosition); ok {
+				position = keyPosition
+			}
+			current = value[key]
+		case []interface{}:
+			idx, err := strconv.Atoi(strings.Trim(segment, "[]"))
+			if err != nil || idx < 0 || idx >= len(value) {
+				return position
+			}
+			current = value[idx]
+			if object, ok := current.(map[string]interface{}); ok {
+				if objectPosition, ok := object[positionKey].(*configPosition); ok {
+					position = objectPosition
+				}
+			}
+		default:
+			return position
+		}
+	}
+	return position
+}
+
+func (this *configChecker) report(path string, reason string) {
+	position := this.locate(path)
+	if position == nil {
+		position = new(configPosition)
+	}
+	this.problems = append(this.problems, position.newError(path, reason))
+}
+
+// checkFields reports unknown fields in the given value at the given path. Pattern is the path with
+// array indices omitted.
+func (this *configChecker) checkFields(path string, pattern string, value interface{}) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		known, checked := knownConfigFields[pattern]
+		for _, key := range sortedKeys(value) {
+			if isPositionKey(key) || key == mergeReplaceKey {
+				continue
+			}
+			if checked && !containsFold(known, key) {
+				this.report(joinPath(path, key), "Unknown field \""+key+"\".")
+				continue
+			}
+			this.checkFields(joinPath(path, key), joinPath(pattern, key), value[key])
+		}
+	case []interface{}:
+		for idx, element := range value {
+			this.checkFields(indexPath(path, idx), pattern+"[]", element)
+		}
+	}
+}
+
+func containsFold(names []string, name string) bool {
+	for _, candidate := range names {
+		if strings.EqualFold(candidate, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// routingRules returns the routing rules in the document.
+func (this *configChecker) routingRules() (string, map[string]interface{}, []interface{}) {
+	routing, _ := this.document["routing"].(map[string]interface{})
+	strategy, _ := routing["strategy"].(string)
+	settings, _ := routing["settings"].(map[string]interface{})
+	rules, _ := settings["rules"].([]interface{})
+	return strategy, settings, rules
+}
+
+// checkRules reports routing rules which fail to parse, and returns whether there is any.
+func (this *configChecker) checkRules() bool {
+	strategy, settings, rules := this.routingRules()
+	found := false
+	for idx, rule := range rules {
+		single := stripPositions(settings).(map[string]interface{})
+		single["rules"] = []interface{}{stripPositions(rule)}
+		data, err := json.Marshal(single)
+		if err != nil {
+			continue
+		}
+		if _, err := router.CreateRouterConfig(strategy, data); err != nil {
+			this.report(indexPath("routing.settings.rules", idx), err.Error())
+			found = true
+		}
+	}
+	return found
+}
+
+// reportLoadError reports the error in loading the config.
+func (this *configChecker) reportLoadError(err error) {
+	fieldErr, ok := err.(*FieldError)
+	if !ok {
+		this.report("", err.Error())
+		return
+	}
+	if fieldErr.Field == "routing" && this.checkRules() {
+		return
+	}
+	this.report(fieldErr.Field, fieldErr.Err.Error())
+}
+
+// loadConfig loads the config from the document. Fields failing to load are reported and left out, so
+// that the rest of the config can still be checked. Elements of arrays are left out as nil.
+func (this *configChecker) loadConfig() (*Config, error) {
+	document := stripPositions(this.document).(map[string]interface{})
+	for {
+		merged, err := json.Marshal(document)
+		if err != nil {
+			this.report("", err.Error())
+			return nil, err
+		}
+		config := new(Config)
+		err = json.Unmarshal(merged, config)
+		if err == nil {
+			return config, nil
+		}
+		this.reportLoadError(err)
+		fieldErr, ok := err.(*FieldError)
+		if !ok || !removeField(document, fieldErr.Field) {
+			return nil, err
+		}
+		this.removed = append(this.removed, fieldErr.Field)
+	}
+}
+
+// removeField removes the top level field of the given path from the document, or the element of it
+// if the path is in an element of an array. It returns whether anything is removed.
+func removeField(document map[string]interface{}, path string) bool {
+	segments := splitPath(path)
+	key, found := findField(document, segments[0])
+	if !found {
+		return false
+	}
+	if elements, ok := document[key].([]interface{}); ok && len(segments) > 1 {
+		idx, err := strconv.Atoi(strings.Trim(segments[1], "[]"))
+		if err == nil && idx >= 0 && idx < len(elements) && elements[idx] != nil {
+			elements[idx] = nil
+			return true
+		}
+	}
+	delete(document, key)
+	return true
+}
+
+// isRemoved returns whether the given path is left out in loading the config.
+func (this *configChecker) isRemoved(path string) bool {
+	for _, removed := range this.removed {
+		segments := splitPath(removed)
+		if strings.EqualFold(segments[0], path) {
+			return true
+		}
+	}
+	return false
+}
+
+// rawTag returns the tag of the given element of the given array in the document.
+func (this *configChecker) rawTag(field string, idx int) string {
+	key, _ := findField(this.document, field)
+	elements, _ := this.document[key].([]interface{})
+	if idx >= len(elements) {
+		return ""
+	}
+	element, _ := elements[idx].(map[string]interface{})
+	tagKey, _ := findField(element, "tag")
+	tag, _ := element[tagKey].(string)
+	return tag
+}
+
+func (this *configChecker) checkProtocol(path string, inbound bool, protocol string, settings []byte) {
+	if len(protocol) == 0 {
+		this.report(joinPath(path, "protocol"), "Protocol not specified.")
+		return
+	}
+	var err error
+	kind := "outbound"
+	if inbound {
+		err = proxyrepo.ValidateInboundConfig(protocol, settings)
+		kind = "inbound"
+	} else {
+		err = proxyrepo.ValidateOutboundConfig(protocol, settings)
+	}
+	if err == proxyrepo.ErrorProxyNotFound {
+		this.report(joinPath(path, "protocol"), "Unknown "+kind+" protocol \""+protocol+"\".")
+	} else if err != nil {
+		this.report(joinPath(path, "settings"), err.Error())
+	}
+}
+
+// checkConfig reports problems in the loaded config.
+func (this *configChecker) checkConfig(config *Config) {
+	if config.Port == 0 && !this.isRemoved("port") {
+		this.report("port", "Port not specified.")
+	}
+	if config.InboundConfig == nil {
+		if !this.isRemoved("inbound") {
+			this.report("inbound", "Inbound not specified.")
+		}
+	} else {
+		this.checkProtocol("inbound", true, config.InboundConfig.Protocol, config.InboundConfig.Settings)
+	}
+	if config.OutboundConfig == nil {
+		if !this.isRemoved("outbound") {
+			this.report("outbound", "Outbound not specified.")
+		}
+	} else {
+		this.checkProtocol("outbound", false, config.OutboundConfig.Protocol, config.OutboundConfig.Settings)
+	}
+
+	inboundTags := make(map[string]string)
+	for idx, detourConfig := range config.InboundDetours {
+		path := indexPath("inboundDetour", idx)
+		if detourConfig == nil {
+			this.checkTag(inboundTags, path, this.rawTag("inboundDetour", idx))
+			continue
+		}
+		this.checkProtocol(path, true, detourConfig.Protocol, detourConfig.Settings)
+		this.checkTag(inboundTags, path, detourConfig.Tag)
+	}
+
+	outboundTags := make(map[string]string)
+	detourTags := make(map[string]bool)
+	for idx, detourConfig := range config.OutboundDetours {
+		path := indexPath("outboundDetour", idx)
+		if detourConfig == nil {
+			tag := this.rawTag("outboundDetour", idx)
+			this.checkTag(outboundTags, path, tag)
+			detourTags[tag] = true
+			continue
+		}
+		this.checkProtocol(path, false, detourConfig.Protocol, detourConfig.Settings)
+		this.checkTag(outboundTags, path, detourConfig.Tag)
+		detourTags[detourConfig.Tag] = true
+	}
+	if config.OutboundConfig != nil {
+		for tagIdx, tag := range config.OutboundConfig.Fallbacks {
+			if !detourTags[tag] {
+				this.report(indexPath("outbound.fallbacks", tagIdx), "Invalid fallback \""+tag+"\".")
+			}
+		}
+	}
+	for idx, detourConfig := range config.OutboundDetours {
+		if detourConfig == nil {
+			continue
+		}
+		for tagIdx, tag := range detourConfig.Fallbacks {
+			if !detourTags[tag] || tag == detourConfig.Tag {
+				this.report(indexPath(indexPath("outboundDetour", idx)+".fallbacks", tagIdx), "Invalid fallback \""+tag+"\".")
+			}
+		}
+	}
+	for idx, balancerConfig := range config.Balancers {
+		path := indexPath("balancers", idx)
+		if balancerConfig == nil {
+			this.checkTag(outboundTags, path, this.rawTag("balancers", idx))
+			continue
+		}
+		this.checkTag(outboundTags, path, balancerConfig.Tag)
+		for tagIdx, tag := range balancerConfig.OutboundTags {
+			if !detourTags[tag] {
+				this.report(indexPath(path+".outbounds", tagIdx), "Unknown outbound detour \""+tag+"\".")
+			}
+		}
+	}
+
+	_, _, rules := this.routingRules()
+	for idx, rule := range rules {
+		rule, _ := rule.(map[string]interface{})
+		key, found := findField(rule, "outboundTag")
+		if !found {
+			continue
+		}
+		tag, _ := rule[key].(string)
+		if _, found := outboundTags[tag]; len(tag) > 0 && !found {
+			this.report(indexPath("routing.settings.rules", idx)+".outboundTag", "Unknown outbound tag \""+tag+"\".")
+		}
+	}
+
+	this.checkPorts(config)
+}
+
+// checkTag reports the given tag if it is in the given tags, which map tags to their paths.
+func (this *configChecker) checkTag(tags map[string]string, path string, tag string) {
+	if len(tag) == 0 {
+		return
+	}
+	if first, found := tags[tag]; found {
+		this.report(path+".tag", "Duplicate tag \""+tag+"\", also used by "+first+".")
+		return
+	}
+	tags[tag] = path
+}
+
+// checkPorts reports ports used by more than one listener.
+func (this *configChecker) checkPorts(config *Config) {
+	type portUse struct {
+		path      string
+		portRange v2net.PortRange
+	}
+	var uses []portUse
+	if config.Port > 0 {
+		uses = append(uses, portUse{"port", v2net.PortRange{From: config.Port, To: config.Port}})
+	}
+	for idx, detourConfig := range config.InboundDetours {
+		if detourConfig == nil {
+			continue
+		}
+		uses = append(uses, portUse{indexPath("inboundDetour", idx) + ".port", detourConfig.PortRange})
+	}
+	if config.ApiConfig != nil && config.ApiConfig.DirectPort > 0 {
+		port := config.ApiConfig.DirectPort
+		uses = append(uses, portUse{"api.port", v2net.PortRange{From: port, To: port}})
+	}
+	if config.MetricsConfig != nil && config.MetricsConfig.Port > 0 {
+		port := config.MetricsConfig.Port
+		uses = append(uses, portUse{"metrics.port", v2net.PortRange{From: port, To: port}})
+	}
+	for idx, use := range uses {
+		for _, previous := range uses[:idx] {
+			if use.portRange.From <= previous.portRange.To && previous.portRange.From <= use.portRange.To {
+				this.report(use.path, portRangeString(use.portRange)+" collides with "+previous.path+".")
+				break
+			}
+		}
+	}
+}
+
+// JsonValidateConfig checks the given config files, which are merged in order as by JsonLoadConfig, and
+// returns all problems found in them. Besides errors in loading the config, it finds unknown fields,
+// unknown protocols, duplicate tags, references to unknown tags, and port collisions.
+func JsonValidateConfig(files ...string) []*ValidationError {
+	expanded, err := expandConfigFiles(files)
+	if err != nil {
+		return []*ValidationError{{Reason: err.Error()}}
+	}
+	if len(expanded) == 0 {
+		return []*ValidationError{{File: strings.Join(files, ", "), Reason: ErrorNoConfigFile.Error()}}
+	}
+
+	var problems []*ValidationError
+	documents := make([]map[string]interface{}, 0, len(expanded))
+	for _, file := range expanded {
+		document, err := decodeConfigWithPositions(file)
+		if err != nil {
+			problems = append(problems, err.(*ValidationError))
+			continue
+		}
+		documents = append(documents, document)
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	checker := &configChecker{
+		document: mergeConfigs(documents),
+	}
+	checker.checkFields("", "", checker.document)
+
+	config, err := checker.loadConfig()
+	if err != nil {
+		return checker.problems
+	}
+	checker.checkConfig(config)
+	return checker.problems
+}
+
+func init() {
+	configValidator = JsonValidateConfig
+}
@@ -0,0 +1,192 @@
+// +build json
+
+package point_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/v2ray/v2ray-core/app"
+	"github.com/v2ray/v2ray-core/proxy"
+	proxytesting "github.com/v2ray/v2ray-core/proxy/testing"
+	. "github.com/v2ray/v2ray-core/shell/point"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+func registerValidationProtocols() (string, string) {
+	inboundProtocol, err := proxytesting.RegisterInboundConnectionHandlerCreator("validate_ich",
+		func(space app.Space, config interface{}) (proxy.InboundHandler, error) {
+			return nil, nil
+		})
+	assert.Error(err).IsNil()
+	outboundProtocol, err := proxytesting.RegisterOutboundConnectionHandlerCreator("validate_och",
+		func(space app.Space, config interface{}) (proxy.OutboundHandler, error) {
+			return nil, nil
+		})
+	assert.Error(err).IsNil()
+	return inboundProtocol, outboundProtocol
+}
+
+func validateConfig(files map[string]string, names ...string) []string {
+	dir := writeConfigFiles(files)
+	defer os.RemoveAll(dir)
+
+	paths := make([]string, len(names))
+	for idx, name := range names {
+		paths[idx] = filepath.Join(dir, name)
+	}
+	var problems []string
+	for _, problem := range ValidateConfig(paths...) {
+		problems = append(problems, strings.TrimPrefix(problem.Error(), dir+string(filepath.Separator)))
+	}
+	return problems
+}
+
+func TestValidateConfig(t *testing.T) {
+	v2testing.Current(t)
+
+	inboundProtocol, outboundProtocol := registerValidationProtocols()
+	replacer := strings.NewReplacer("ICH", inboundProtocol, "OCH", outboundProtocol)
+
+	problems := validateConfig(map[string]string{
+		"base.json": replacer.Replace(`{
+  "port": 1080,
+  "inbound": {"protocol": "ICH"},
+  "outbound": {"fallbacks": ["direct", "missing"], "protocol": "OCH"},
+  "inboundDetour": [
+    {"port": "1080", "tag": "in", "protocol": "ICH"},
+    {"protocol": "unknown", "port": "3000", "tag": "in"}
+  ],
+  "outboundDetour": [
+    {"protocol": "OCH", "tag": "direct"}
+  ]
+}`),
+		"routing.json": replacer.Replace(`{
+  "outboundDetour": [
+    {"tag": "block", "fallbacks": ["missing"], "protocol": "OCH"}
+  ],
+  "balancers": [{"tag": "direct", "outbounds": ["block"]}],
+  "routing": {
+    "strategy": "rules",
+    "settings": {"rules": [
+      {"type": "field", "port": "53", "outboundTag": "direct"},
+      {"type": "field", "port": "80", "outboundTag": "missing", "domains": ["a.com"]}
+    ]}
+  }
+}`),
+	}, "base.json", "routing.json")
+
+	assert.StringLiteral(strings.Join(problems, "\n")).Equals(strings.Join([]string{
+		"routing.json:10:65: routing.settings.rules[1].domains: Unknown field \"domains\".",
+		"base.json:7:6: inboundDetour[1].protocol: Unknown inbound protocol \"unknown\".",
+		"base.json:7:45: inboundDetour[1].tag: Duplicate tag \"in\", also used by inboundDetour[0].",
+		"base.json:4:16: outbound.fallbacks[1]: Invalid fallback \"missing\".",
+		"routing.json:3:22: outboundDetour[1].fallbacks[0]: Invalid fallback \"missing\".",
+		"routing.json:5:18: balancers[0].tag: Duplicate tag \"direct\", also used by outboundDetour[0].",
+		"routing.json:10:39: routing.settings.rules[1].outboundTag: Unknown outbound tag \"missing\".",
+		"base.json:6:6: inboundDetour[0].port: Port 1080 collides with port.",
+	}, "\n"))
+}
+
+func TestValidateConfigOK(t *testing.T) {
+	v2testing.Current(t)
+
+	inboundProtocol, outboundProtocol := registerValidationProtocols()
+	problems := validateConfig(map[string]string{
+		"config.toml": `
+port = 1080
+inbound = { protocol = "` + inboundProtocol + `" }
+outbound = { protocol = "` + outboundProtocol + `" }
+`,
+	}, "config.toml")
+	assert.Int(len(problems)).Equals(0)
+}
+
+func TestValidateConfigLoadErrors(t *testing.T) {
+	v2testing.Current(t)
+
+	problems := validateConfig(map[string]string{
+		"syntax.json": "{\n  \"port\": 1080,\n  \"inbound\": {\"protocol\" \"socks\"}\n}",
+	}, "syntax.json")
+	assert.Int(len(problems)).Equals(1)
+	assert.Bool(strings.HasPrefix(problems[0], "syntax.json:3:26: ")).IsTrue()
+
+	problems = validateConfig(map[string]string{
+		"syntax.toml": "port = 1080\ninbound = ",
+	}, "syntax.toml")
+	assert.Int(len(problems)).Equals(1)
+	assert.Bool(strings.HasPrefix(problems[0], "syntax.toml:2: ")).IsTrue()
+
+	problems = validateConfig(map[string]string{
+		"port.json": "{\n  \"port\": 1080,\n  \"inboundDetour\": [\n    {\"protocol\": \"socks\", \"port\": \"a\"}\n  ]\n}",
+	}, "port.json")
+	assert.StringLiteral(strings.Join(problems, "\n")).Equals(strings.Join([]string{
+		"port.json:4:27: inboundDetour[0].port: Invalid port range.",
+		"port.json:1:1: inbound: Inbound not specified.",
+		"port.json:1:1: outbound: Outbound not specified.",
+	}, "\n"))
+
+	problems = validateConfig(map[string]string{
+		"rules.json": `{
+  "routing": {
+    "strategy": "rules",
+    "settings": {"rules": [
+      {"type": "field", "port": "53", "outboundTag": "direct"},
+      {"type": "chinaports", "outboundTag": "direct"}
+    ]}
+  }
+}`,
+	}, "rules.json")
+	assert.StringLiteral(strings.Join(problems, "\n")).Equals(strings.Join([]string{
+		"rules.json:6:7: routing.settings.rules[1]: Unknown rule type.",
+		"rules.json:1:1: port: Port not specified.",
+		"rules.json:1:1: inbound: Inbound not specified.",
+		"rules.json:1:1: outbound: Outbound not specified.",
+		"rules.json:5:39: routing.settings.rules[0].outboundTag: Unknown outbound tag \"direct\".",
+		"rules.json:6:30: routing.settings.rules[1].outboundTag: Unknown outbound tag \"direct\".",
+	}, "\n"))
+}
+
+func TestValidateConfigAfterLoadErrors(t *testing.T) {
+	v2testing.Current(t)
+
+	inboundProtocol, outboundProtocol := registerValidationProtocols()
+	replacer := strings.NewReplacer("ICH", inboundProtocol, "OCH", outboundProtocol)
+
+	problems := validateConfig(map[string]string{
+		"config.json": replacer.Replace(`{
+  "port": 1080,
+  "inbound": {"protocol": "ICH"},
+  "outbound": {"fallbacks": ["missing"], "protocol": "OCH"},
+  "inboundDetour": [
+    {"port": "a", "tag": "in", "protocol": "ICH"},
+    {"protocol": "unknown", "port": "1080", "tag": "in"}
+  ],
+  "outboundDetour": [
+    {"tag": "direct", "protocol": "OCH"},
+    {"tag": "direct", "protocol": "OCH"}
+  ],
+  "routing": {
+    "strategy": "rules",
+    "settings": {"rules": [
+      {"type": "chinaports", "outboundTag": "direct"},
+      {"type": "field", "port": "53", "outboundTag": "missing"}
+    ]}
+  }
+}`),
+	}, "config.json")
+
+	assert.StringLiteral(strings.Join(problems, "\n")).Equals(strings.Join([]string{
+		"config.json:16:7: routing.settings.rules[0]: Unknown rule type.",
+		"config.json:6:6: inboundDetour[0].port: Invalid port range.",
+		"config.json:7:6: inboundDetour[1].protocol: Unknown inbound protocol \"unknown\".",
+		"config.json:7:45: inboundDetour[1].tag: Duplicate tag \"in\", also used by inboundDetour[0].",
+		"config.json:11:6: outboundDetour[1].tag: Duplicate tag \"direct\", also used by outboundDetour[0].",
+		"config.json:4:16: outbound.fallbacks[0]: Invalid fallback \"missing\".",
+		"config.json:17:39: routing.settings.rules[1].outboundTag: Unknown outbound tag \"missing\".",
+		"config.json:7:29: inboundDetour[1].port: Port 1080 collides with port.",
+	}, "\n"))
+}
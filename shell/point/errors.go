@@ -2,8 +2,66 @@ package point
 
 import (
 	"errors"
+	"strconv"
+	"strings"
 )
 
 var (
-	ErrorBadConfiguration = errors.New("Bad configuration.")
+	ErrorBadConfiguration           = errors.New("Bad configuration.")
+	ErrorTagNotFound                = errors.New("Tag not found.")
+	ErrorTagExists                  = errors.New("Tag already exists.")
+	ErrorTagInUse                   = errors.New("Tag is in use.")
+	ErrorUserManagementNotSupported = errors.New("Inbound handler doesn't support user management.")
+	ErrorStatsNotEnabled            = errors.New("Stats is not enabled.")
+	ErrorLimiterNotEnabled          = errors.New("Limiter is not enabled.")
+	ErrorUnsupportedConfigVersion   = errors.New("Unsupported config version.")
 )
+
+// FieldError is an error in a field of the config, e.g., "inboundDetour[1].port".
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (this *FieldError) Error() string {
+	return "Invalid config at " + this.Field + ": " + this.Err.Error()
+}
+
+// newFieldError returns an error in the given field, which contains the given error. Fields of nested
+// FieldErrors are appended to the given field.
+func newFieldError(field string, err error) *FieldError {
+	if inner, ok := err.(*FieldError); ok {
+		if strings.HasPrefix(inner.Field, "[") {
+			return &FieldError{Field: field + inner.Field, Err: inner.Err}
+		}
+		return &FieldError{Field: field + "." + inner.Field, Err: inner.Err}
+	}
+	return &FieldError{Field: field, Err: err}
+}
+
+// ValidationError is a problem in config files, found by ValidateConfig.
+type ValidationError struct {
+	File   string // Config file of the problem, empty if unknown.
+	Line   int    // Line in the file, starting from 1. 0 if unknown.
+	Column int    // Column in the line, in bytes starting from 1. 0 if unknown.
+	Path   string // JSON path of the problem in the merged config, e.g., "inboundDetour[1].port".
+	Reason string
+}
+
+func (this *ValidationError) Error() string {
+	message := ""
+	if len(this.File) > 0 {
+		message = this.File
+		if this.Line > 0 {
+			message += ":" + strconv.Itoa(this.Line)
+			if this.Column > 0 {
+				message += ":" + strconv.Itoa(this.Column)
+			}
+		}
+		message += ": "
+	}
+	if len(this.Path) > 0 {
+		message += this.Path + ": "
+	}
+	return message + this.Reason
+}
@@ -0,0 +1,79 @@
+package point
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/v2ray/v2ray-core/app"
+	"github.com/v2ray/v2ray-core/app/dns"
+	"github.com/v2ray/v2ray-core/common/alloc"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	"github.com/v2ray/v2ray-core/proxy"
+	proxytesting "github.com/v2ray/v2ray-core/proxy/testing"
+	"github.com/v2ray/v2ray-core/proxy/testing/mocks"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+func TestFakeIPRestoredToDomain(t *testing.T) {
+	v2testing.Current(t)
+
+	inboundProtocol, err := proxytesting.RegisterInboundConnectionHandlerCreator("fakeip_ich",
+		func(space app.Space, config interface{}) (proxy.InboundHandler, error) {
+			return new(mocks.InboundConnectionHandler), nil
+		})
+	assert.Error(err).IsNil()
+
+	och := &mocks.OutboundConnectionHandler{
+		ConnInput:  bytes.NewReader(nil),
+		ConnOutput: new(bytes.Buffer),
+	}
+	outboundProtocol, err := proxytesting.RegisterOutboundConnectionHandlerCreator("fakeip_och",
+		func(space app.Space, config interface{}) (proxy.OutboundHandler, error) {
+			return och, nil
+		})
+	assert.Error(err).IsNil()
+
+	_, ipPool, err := net.ParseCIDR("198.18.0.0/15")
+	assert.Error(err).IsNil()
+	vpoint, err := NewPoint(&Config{
+		Port:           v2net.Port(50091),
+		InboundConfig:  &ConnectionConfig{Protocol: inboundProtocol},
+		OutboundConfig: &ConnectionConfig{Protocol: outboundProtocol},
+		DnsConfig: &dns.Config{
+			FakeIP: &dns.FakeIPConfig{IPPool: ipPool, PoolSize: 16},
+		},
+	})
+	assert.Error(err).IsNil()
+
+	ips := vpoint.fakeDNS.GetFake("v2ray.com")
+	assert.Int(len(ips)).Equals(1)
+
+	for _, testCase := range []struct {
+		dest     v2net.Destination
+		expected v2net.Destination
+	}{
+		{
+			dest:     v2net.TCPDestination(v2net.IPAddress(ips[0]), 443),
+			expected: v2net.TCPDestination(v2net.DomainAddress("v2ray.com"), 443),
+		},
+		{
+			dest:     v2net.UDPDestination(v2net.IPAddress(ips[0]), 53),
+			expected: v2net.UDPDestination(v2net.DomainAddress("v2ray.com"), 53),
+		},
+		{
+			// Not handed out yet.
+			dest:     v2net.TCPDestination(v2net.IPAddress([]byte{198, 18, 0, 2}), 443),
+			expected: v2net.TCPDestination(v2net.IPAddress([]byte{198, 18, 0, 2}), 443),
+		},
+	} {
+		packet := v2net.NewPacket(testCase.dest, alloc.NewBuffer().Clear().Append([]byte("request")), false)
+		link := vpoint.DispatchToOutbound(nil, packet)
+		close(link.InboundInput())
+		for chunk := range link.InboundOutput() {
+			chunk.Release()
+		}
+		assert.StringLiteral(och.Destination.String()).Equals(testCase.expected.String())
+	}
+}
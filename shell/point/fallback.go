@@ -0,0 +1,117 @@
+package point
+
+import (
+	"sync/atomic"
+
+	"github.com/v2ray/v2ray-core/common/alloc"
+	"github.com/v2ray/v2ray-core/transport/ray"
+)
+
+// fallbackRay forwards the input of the original ray to an outbound handler, and the response of the
+// handler back to the original ray. Unless there is any response, the original ray is left open when the
+// outbound handler finishes, so that the request can be dispatched to another outbound handler.
+type fallbackRay struct {
+	input     chan *alloc.Buffer
+	output    chan *alloc.Buffer
+	done      <-chan struct{}
+	stop      chan struct{}
+	left      chan *alloc.Buffer
+	consumed  int32
+	responded chan bool
+}
+
+// newFallbackRay returns a fallbackRay on the given ray. The given pending chunk, if any, is forwarded
+// before the rest of the input.
+func newFallbackRay(link ray.OutboundRay, pending *alloc.Buffer) *fallbackRay {
+	this := &fallbackRay{
+		input:     make(chan *alloc.Buffer),
+		output:    make(chan *alloc.Buffer, 16),
+		done:      link.Done(),
+		stop:      make(chan struct{}),
+		left:      make(chan *alloc.Buffer, 1),
+		responded: make(chan bool, 1),
+	}
+	go this.forward(link.OutboundInput(), pending)
+	go func(output chan<- *alloc.Buffer) {
+		responded := false
+		for chunk := range this.output {
+			responded = true
+			output <- chunk
+		}
+		if responded {
+			close(output)
+		}
+		this.responded <- responded
+	}(link.OutboundOutput())
+	return this
+}
+
+// forward passes the input to the outbound handler one chunk at a time, until the fallbackRay is
+// finished. The chunk read but not taken by the handler is left for the next attempt.
+func (this *fallbackRay) forward(source <-chan *alloc.Buffer, pending *alloc.Buffer) {
+	defer func() {
+		this.left <- pending
+	}()
+	for {
+		if pending == nil {
+			select {
+			case chunk, open := <-source:
+				if !open {
+					close(this.input)
+					<-this.stop
+					return
+				}
+				pending = chunk
+				continue
+			case <-this.stop:
+				return
+			}
+		}
+		select {
+		case this.input <- pending:
+			pending = nil
+			atomic.StoreInt32(&this.consumed, 1)
+		case <-this.stop:
+			return
+		}
+	}
+}
+
+func (this *fallbackRay) OutboundInput() <-chan *alloc.Buffer {
+	return this.input
+}
+
+func (this *fallbackRay) OutboundOutput() chan<- *alloc.Buffer {
+	return this.output
+}
+
+func (this *fallbackRay) Done() <-chan struct{} {
+	return this.done
+}
+
+// Responded waits until the outbound handler closes its output, and returns whether there was any
+// response.
+func (this *fallbackRay) Responded() bool {
+	return <-this.responded
+}
+
+// Finish stops forwarding the input. It returns the chunk read from the original ray but not taken by
+// the outbound handler, and whether the handler has taken any input.
+func (this *fallbackRay) Finish() (*alloc.Buffer, bool) {
+	close(this.stop)
+	return <-this.left, atomic.LoadInt32(&this.consumed) != 0
+}
+
+// copyChunk returns a copy of the given chunk that can be released independently.
+func copyChunk(chunk *alloc.Buffer) *alloc.Buffer {
+	if chunk == nil {
+		return nil
+	}
+	var buffer *alloc.Buffer
+	if chunk.Len() <= 4*1024 {
+		buffer = alloc.NewBuffer()
+	} else {
+		buffer = alloc.NewLargeBuffer()
+	}
+	return buffer.Clear().Append(chunk.Value)
+}
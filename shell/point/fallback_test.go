@@ -0,0 +1,187 @@
+package point
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/v2ray/v2ray-core/common/alloc"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	"github.com/v2ray/v2ray-core/proxy/testing/mocks"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+	"github.com/v2ray/v2ray-core/transport/ray"
+)
+
+type failingOutboundHandler struct {
+	attempts int
+}
+
+func (this *failingOutboundHandler) Dispatch(packet v2net.Packet, link ray.OutboundRay) error {
+	this.attempts++
+	packet.Chunk().Release()
+	close(link.OutboundOutput())
+	return errors.New("Failed to connect.")
+}
+
+func (this *failingOutboundHandler) Close() {
+}
+
+func TestFallbackOnDialFailure(t *testing.T) {
+	v2testing.Current(t)
+
+	failing := &failingOutboundHandler{}
+	connOutput := new(bytes.Buffer)
+	working := &mocks.OutboundConnectionHandler{
+		ConnInput:  bytes.NewReader([]byte("response")),
+		ConnOutput: connOutput,
+	}
+
+	dest := v2net.TCPDestination(v2net.DomainAddress("v2ray.com"), 80)
+	packet := v2net.NewPacket(dest, alloc.NewBuffer().Clear().Append([]byte("request")), false)
+	direct := ray.NewRay()
+
+	point := new(Point)
+	point.FilterPacketAndDispatch(packet, direct, failing, failing, working)
+
+	assert.Int(failing.attempts).Equals(2)
+	assert.StringLiteral(connOutput.String()).Equals("request")
+	assert.StringLiteral(working.Destination.String()).Equals(dest.String())
+
+	response := new(bytes.Buffer)
+	for chunk := range direct.InboundOutput() {
+		response.Write(chunk.Value)
+		chunk.Release()
+	}
+	assert.StringLiteral(response.String()).Equals("response")
+}
+
+func TestNoFallbackAfterSuccess(t *testing.T) {
+	v2testing.Current(t)
+
+	failing := &failingOutboundHandler{}
+	working := &mocks.OutboundConnectionHandler{
+		ConnInput:  bytes.NewReader([]byte("response")),
+		ConnOutput: new(bytes.Buffer),
+	}
+
+	dest := v2net.TCPDestination(v2net.DomainAddress("v2ray.com"), 80)
+	packet := v2net.NewPacket(dest, alloc.NewBuffer().Clear().Append([]byte("request")), false)
+	direct := ray.NewRay()
+
+	point := new(Point)
+	point.FilterPacketAndDispatch(packet, direct, working, failing)
+
+	assert.Int(failing.attempts).Equals(0)
+	response := new(bytes.Buffer)
+	for chunk := range direct.InboundOutput() {
+		response.Write(chunk.Value)
+		chunk.Release()
+	}
+	assert.StringLiteral(response.String()).Equals("response")
+}
+
+func TestNoFallbackOnNoResponse(t *testing.T) {
+	v2testing.Current(t)
+
+	// Closes the connection without any response, after the request may have reached the server.
+	silent := &mocks.OutboundConnectionHandler{
+		ConnInput:  bytes.NewReader(nil),
+		ConnOutput: new(bytes.Buffer),
+	}
+	failing := &failingOutboundHandler{}
+
+	dest := v2net.TCPDestination(v2net.DomainAddress("v2ray.com"), 80)
+	packet := v2net.NewPacket(dest, alloc.NewBuffer().Clear().Append([]byte("request")), false)
+	direct := ray.NewRay()
+
+	point := new(Point)
+	point.FilterPacketAndDispatch(packet, direct, silent, failing)
+
+	assert.Int(failing.attempts).Equals(0)
+	_, open := <-direct.InboundOutput()
+	assert.Bool(open).IsFalse()
+}
+
+// inputFailingOutboundHandler fails after taking a chunk of input.
+type inputFailingOutboundHandler struct {
+}
+
+func (this *inputFailingOutboundHandler) Dispatch(packet v2net.Packet, link ray.OutboundRay) error {
+	packet.Chunk().Release()
+	if chunk, open := <-link.OutboundInput(); open {
+		chunk.Release()
+	}
+	close(link.OutboundOutput())
+	return errors.New("Connection reset.")
+}
+
+func (this *inputFailingOutboundHandler) Close() {
+}
+
+func TestNoFallbackAfterInput(t *testing.T) {
+	v2testing.Current(t)
+
+	failing := &failingOutboundHandler{}
+	dest := v2net.TCPDestination(v2net.DomainAddress("v2ray.com"), 80)
+	packet := v2net.NewPacket(dest, alloc.NewBuffer().Clear().Append([]byte("request")), true)
+	direct := ray.NewRay()
+	direct.InboundInput() <- alloc.NewBuffer().Clear().Append([]byte("more"))
+	close(direct.InboundInput())
+
+	point := new(Point)
+	point.FilterPacketAndDispatch(packet, direct, &inputFailingOutboundHandler{}, failing)
+
+	assert.Int(failing.attempts).Equals(0)
+	_, open := <-direct.InboundOutput()
+	assert.Bool(open).IsFalse()
+}
+
+func TestFallbackKeepsInput(t *testing.T) {
+	v2testing.Current(t)
+
+	failing := &failingOutboundHandler{}
+	connOutput := new(bytes.Buffer)
+	working := &mocks.OutboundConnectionHandler{
+		ConnInput:  bytes.NewReader([]byte("response")),
+		ConnOutput: connOutput,
+	}
+
+	dest := v2net.TCPDestination(v2net.DomainAddress("v2ray.com"), 80)
+	packet := v2net.NewPacket(dest, alloc.NewBuffer().Clear().Append([]byte("request")), true)
+	direct := ray.NewRay()
+	go func() {
+		direct.InboundInput() <- alloc.NewBuffer().Clear().Append([]byte(" more"))
+		close(direct.InboundInput())
+	}()
+
+	point := new(Point)
+	point.FilterPacketAndDispatch(packet, direct, failing, failing, working)
+
+	assert.Int(failing.attempts).Equals(2)
+	assert.StringLiteral(connOutput.String()).Equals("request more")
+
+	response := new(bytes.Buffer)
+	for chunk := range direct.InboundOutput() {
+		response.Write(chunk.Value)
+		chunk.Release()
+	}
+	assert.StringLiteral(response.String()).Equals("response")
+}
+
+func TestNoFallbackAfterCancel(t *testing.T) {
+	v2testing.Current(t)
+
+	failing := &failingOutboundHandler{}
+	dest := v2net.TCPDestination(v2net.DomainAddress("v2ray.com"), 80)
+	packet := v2net.NewPacket(dest, alloc.NewBuffer().Clear().Append([]byte("request")), false)
+	direct := ray.NewRay()
+	direct.Cancel()
+
+	point := new(Point)
+	point.FilterPacketAndDispatch(packet, direct, failing, failing)
+
+	assert.Int(failing.attempts).Equals(1)
+	_, open := <-direct.InboundOutput()
+	assert.Bool(open).IsFalse()
+}
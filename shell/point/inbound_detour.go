@@ -8,4 +8,6 @@ type InboundDetourHandler interface {
 	Start() error
 	Close()
 	GetConnectionHandler() (proxy.InboundHandler, int)
+	// GetAllConnectionHandlers returns all inbound handlers of the detour, in use or not.
+	GetAllConnectionHandlers() []proxy.InboundHandler
 }
@@ -7,7 +7,6 @@ import (
 	v2net "github.com/v2ray/v2ray-core/common/net"
 	"github.com/v2ray/v2ray-core/common/retry"
 	"github.com/v2ray/v2ray-core/proxy"
-	proxyrepo "github.com/v2ray/v2ray-core/proxy/repo"
 )
 
 type InboundConnectionHandlerWithPort struct {
@@ -30,8 +29,7 @@ func NewInboundDetourHandlerAlways(space app.Space, config *InboundDetourConfig)
 	ports := config.PortRange
 	handler.ich = make([]*InboundConnectionHandlerWithPort, 0, ports.To-ports.From+1)
 	for i := ports.From; i <= ports.To; i++ {
-		ichConfig := config.Settings
-		ich, err := proxyrepo.CreateInboundHandler(config.Protocol, space, ichConfig)
+		ich, err := newInboundHandler(config.Protocol, space, config.Settings, config.SettingsConfig)
 		if err != nil {
 			log.Error("Failed to create inbound connection handler: ", err)
 			return nil, err
@@ -49,6 +47,14 @@ func (this *InboundDetourHandlerAlways) GetConnectionHandler() (proxy.InboundHan
 	return ich.handler, this.config.Allocation.Refresh
 }
 
+func (this *InboundDetourHandlerAlways) GetAllConnectionHandlers() []proxy.InboundHandler {
+	handlers := make([]proxy.InboundHandler, len(this.ich))
+	for idx, ich := range this.ich {
+		handlers[idx] = ich.handler
+	}
+	return handlers
+}
+
 func (this *InboundDetourHandlerAlways) Close() {
 	for _, ich := range this.ich {
 		ich.handler.Close()
@@ -10,7 +10,6 @@ import (
 	v2net "github.com/v2ray/v2ray-core/common/net"
 	"github.com/v2ray/v2ray-core/common/retry"
 	"github.com/v2ray/v2ray-core/proxy"
-	proxyrepo "github.com/v2ray/v2ray-core/proxy/repo"
 )
 
 type InboundDetourHandlerDynamic struct {
@@ -21,6 +20,7 @@ type InboundDetourHandlerDynamic struct {
 	ichInUse    []proxy.InboundHandler
 	ich2Recycle []proxy.InboundHandler
 	lastRefresh time.Time
+	closed      chan bool
 }
 
 func NewInboundDetourHandlerDynamic(space app.Space, config *InboundDetourConfig) (*InboundDetourHandlerDynamic, error) {
@@ -28,11 +28,12 @@ func NewInboundDetourHandlerDynamic(space app.Space, config *InboundDetourConfig
 		space:      space,
 		config:     config,
 		portsInUse: make(map[v2net.Port]bool),
+		closed:     make(chan bool),
 	}
 	ichCount := config.Allocation.Concurrency
 	ichArray := make([]proxy.InboundHandler, ichCount*2)
 	for idx := range ichArray {
-		ich, err := proxyrepo.CreateInboundHandler(config.Protocol, space, config.Settings)
+		ich, err := newInboundHandler(config.Protocol, space, config.Settings, config.SettingsConfig)
 		if err != nil {
 			log.Error("Point: Failed to create inbound connection handler: ", err)
 			return nil, err
@@ -67,9 +68,24 @@ func (this *InboundDetourHandlerDynamic) GetConnectionHandler() (proxy.InboundHa
 	return ich, int(until)
 }
 
+func (this *InboundDetourHandlerDynamic) GetAllConnectionHandlers() []proxy.InboundHandler {
+	this.RLock()
+	defer this.RUnlock()
+	handlers := make([]proxy.InboundHandler, 0, len(this.ichInUse)+len(this.ich2Recycle))
+	handlers = append(handlers, this.ichInUse...)
+	handlers = append(handlers, this.ich2Recycle...)
+	return handlers
+}
+
 func (this *InboundDetourHandlerDynamic) Close() {
 	this.Lock()
 	defer this.Unlock()
+	select {
+	case <-this.closed:
+		return
+	default:
+		close(this.closed)
+	}
 	for _, ich := range this.ichInUse {
 		ich.Close()
 	}
@@ -120,8 +136,15 @@ func (this *InboundDetourHandlerDynamic) Start() error {
 	}
 
 	go func() {
-		for range time.Tick(time.Duration(this.config.Allocation.Refresh) * time.Minute) {
-			this.refresh()
+		ticker := time.NewTicker(time.Duration(this.config.Allocation.Refresh) * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-this.closed:
+				return
+			case <-ticker.C:
+				this.refresh()
+			}
 		}
 	}()
 
@@ -0,0 +1,291 @@
+package point
+
+import (
+	"time"
+
+	"github.com/v2ray/v2ray-core/common/log"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+	"github.com/v2ray/v2ray-core/proxy"
+)
+
+// Configuration of a running Point server is changed by replacing this.config with a modified copy,
+// so that it always reflects the running handlers, and remains the base of diffing on reload. Users
+// changed through the API are not part of the config. The changes are recorded by inbound tag instead,
+// and applied again to the inbound handlers recreated on reload.
+
+// AddInboundDetour creates and starts a new inbound detour. The detour must have a unique tag.
+func (this *Point) AddInboundDetour(detourConfig *InboundDetourConfig) error {
+	this.reloading.Lock()
+	defer this.reloading.Unlock()
+
+	if len(detourConfig.Tag) == 0 {
+		return ErrorBadConfiguration
+	}
+
+	this.RLock()
+	_, found := this.taggedIdh[detourConfig.Tag]
+	this.RUnlock()
+	if found {
+		return ErrorTagExists
+	}
+
+	detourHandler, err := this.createInboundDetourHandler(detourConfig)
+	if err != nil {
+		return err
+	}
+	if err := detourHandler.Start(); err != nil {
+		detourHandler.Close()
+		return err
+	}
+
+	this.Lock()
+	config := *this.config
+	config.InboundDetours = append(append([]*InboundDetourConfig{}, config.InboundDetours...), detourConfig)
+	this.config = &config
+	this.idh = append(append([]InboundDetourHandler{}, this.idh...), detourHandler)
+	this.taggedIdh[detourConfig.Tag] = detourHandler
+	this.Unlock()
+	return nil
+}
+
+// RemoveInboundDetour stops the inbound detour with the given tag. Connections in progress are not
+// affected.
+func (this *Point) RemoveInboundDetour(tag string) error {
+	this.reloading.Lock()
+	defer this.reloading.Unlock()
+
+	this.Lock()
+	idx := -1
+	for i, detourConfig := range this.config.InboundDetours {
+		if len(tag) > 0 && detourConfig.Tag == tag {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		this.Unlock()
+		return ErrorTagNotFound
+	}
+	detourHandler := this.idh[idx]
+
+	config := *this.config
+	config.InboundDetours = make([]*InboundDetourConfig, 0, len(this.config.InboundDetours)-1)
+	config.InboundDetours = append(config.InboundDetours, this.config.InboundDetours[:idx]...)
+	config.InboundDetours = append(config.InboundDetours, this.config.InboundDetours[idx+1:]...)
+	this.config = &config
+
+	idh := make([]InboundDetourHandler, 0, len(this.idh)-1)
+	idh = append(idh, this.idh[:idx]...)
+	this.idh = append(idh, this.idh[idx+1:]...)
+	delete(this.taggedIdh, tag)
+	this.Unlock()
+	delete(this.userChanges, tag)
+
+	detourHandler.Close()
+	return nil
+}
+
+// AddOutboundDetour creates a new outbound detour. The detour must have a unique tag.
+func (this *Point) AddOutboundDetour(detourConfig *OutboundDetourConfig) error {
+	this.reloading.Lock()
+	defer this.reloading.Unlock()
+
+	if len(detourConfig.Tag) == 0 {
+		return ErrorBadConfiguration
+	}
+
+	oldRouting := this.getRouting()
+	routing, err := oldRouting.withOutbound(this.space, detourConfig)
+	if err != nil {
+		return err
+	}
+
+	this.Lock()
+	config := *this.config
+	config.OutboundDetours = append(append([]*OutboundDetourConfig{}, config.OutboundDetours...), detourConfig)
+	this.config = &config
+	this.routing = routing
+	this.retireRouting(oldRouting)
+	this.Unlock()
+	return nil
+}
+
+// RemoveOutboundDetour removes the outbound detour with the given tag. Connections in progress keep
+// using the removed outbound detour, which is closed once they finish.
+func (this *Point) RemoveOutboundDetour(tag string) error {
+	this.reloading.Lock()
+	defer this.reloading.Unlock()
+
+	oldRouting := this.getRouting()
+	routing, err := oldRouting.withoutOutbound(tag)
+	if err != nil {
+		return err
+	}
+
+	this.Lock()
+	config := *this.config
+	config.OutboundDetours = make([]*OutboundDetourConfig, 0, len(this.config.OutboundDetours))
+	for _, detourConfig := range this.config.OutboundDetours {
+		if detourConfig.Tag != tag {
+			config.OutboundDetours = append(config.OutboundDetours, detourConfig)
+		}
+	}
+	this.config = &config
+	this.routing = routing
+	this.retireRouting(oldRouting)
+	this.Unlock()
+	return nil
+}
+
+// getUserManagers returns all handlers of the inbound with the given tag. Empty tag stands for the
+// default inbound.
+func (this *Point) getUserManagers(inboundTag string) ([]proxy.UserManager, error) {
+	this.RLock()
+	var handlers []proxy.InboundHandler
+	if len(inboundTag) == 0 {
+		handlers = []proxy.InboundHandler{this.ich}
+	} else if detourHandler, found := this.taggedIdh[inboundTag]; found {
+		handlers = detourHandler.GetAllConnectionHandlers()
+	}
+	this.RUnlock()
+
+	if len(handlers) == 0 {
+		return nil, ErrorTagNotFound
+	}
+	managers := make([]proxy.UserManager, len(handlers))
+	for idx, handler := range handlers {
+		manager, ok := handler.(proxy.UserManager)
+		if !ok {
+			return nil, ErrorUserManagementNotSupported
+		}
+		managers[idx] = manager
+	}
+	return managers, nil
+}
+
+// Kinds of userChange.
+const (
+	userAdded = iota
+	userRemoved
+	userExpirySet
+	userEnabledSet
+)
+
+// userChange is a change of users of an inbound made through the API.
+type userChange struct {
+	kind  int
+	email string
+	apply func(manager proxy.UserManager) error
+}
+
+// changeUsers applies the given change to all handlers of the inbound with the given tag, and records
+// it for reload.
+func (this *Point) changeUsers(inboundTag string, change *userChange) error {
+	this.reloading.Lock()
+	defer this.reloading.Unlock()
+
+	managers, err := this.getUserManagers(inboundTag)
+	if err != nil {
+		return err
+	}
+	for _, manager := range managers {
+		if err := change.apply(manager); err != nil {
+			return err
+		}
+	}
+
+	// Only the latest change of each kind matters, and adding or removing a user overrides all earlier
+	// changes of the user.
+	changes := make([]*userChange, 0, len(this.userChanges[inboundTag])+1)
+	for _, earlier := range this.userChanges[inboundTag] {
+		if len(change.email) > 0 && earlier.email == change.email &&
+			(earlier.kind == change.kind || change.kind == userAdded || change.kind == userRemoved) {
+			continue
+		}
+		changes = append(changes, earlier)
+	}
+	this.userChanges[inboundTag] = append(changes, change)
+	return nil
+}
+
+// applyUserChanges applies the recorded user changes of the inbound with the given tag to the given
+// handlers, which are recreated on reload.
+func (this *Point) applyUserChanges(inboundTag string, handlers []proxy.InboundHandler) {
+	changes := this.userChanges[inboundTag]
+	if len(changes) == 0 {
+		return
+	}
+	for _, handler := range handlers {
+		manager, ok := handler.(proxy.UserManager)
+		if !ok {
+			log.Warning("Point: Unable to keep users of inbound [", inboundTag, "]: ", ErrorUserManagementNotSupported)
+			return
+		}
+		for _, change := range changes {
+			if err := change.apply(manager); err != nil && err != proxy.ErrorUserNotFound {
+				log.Warning("Point: Failed to keep user [", change.email, "] of inbound [", inboundTag, "]: ", err)
+			}
+		}
+	}
+}
+
+// AddUser adds a user to the inbound with the given tag. Empty tag stands for the default inbound.
+func (this *Point) AddUser(inboundTag string, user *proto.User) error {
+	return this.changeUsers(inboundTag, &userChange{
+		kind:  userAdded,
+		email: user.Email,
+		apply: func(manager proxy.UserManager) error {
+			return manager.AddUser(user)
+		},
+	})
+}
+
+// RemoveUser removes a user from the inbound with the given tag. Empty tag stands for the default
+// inbound.
+func (this *Point) RemoveUser(inboundTag string, email string) error {
+	return this.changeUsers(inboundTag, &userChange{
+		kind:  userRemoved,
+		email: email,
+		apply: func(manager proxy.UserManager) error {
+			return manager.RemoveUser(email)
+		},
+	})
+}
+
+// SetUserExpiry sets the time after which the user is removed from the inbound with the given tag.
+// Zero time means never. Empty tag stands for the default inbound.
+func (this *Point) SetUserExpiry(inboundTag string, email string, expiry time.Time) error {
+	return this.changeUsers(inboundTag, &userChange{
+		kind:  userExpirySet,
+		email: email,
+		apply: func(manager proxy.UserManager) error {
+			return manager.SetUserExpiry(email, expiry)
+		},
+	})
+}
+
+// SetUserEnabled enables or disables a user of the inbound with the given tag. Empty tag stands for
+// the default inbound.
+func (this *Point) SetUserEnabled(inboundTag string, email string, enabled bool) error {
+	return this.changeUsers(inboundTag, &userChange{
+		kind:  userEnabledSet,
+		email: email,
+		apply: func(manager proxy.UserManager) error {
+			return manager.SetUserEnabled(email, enabled)
+		},
+	})
+}
+
+// TakeDetour returns the tag of routing target for the given destination, or empty for the default
+// outbound.
+func (this *Point) TakeDetour(dest v2net.Destination) string {
+	return this.getRouting().TakeDetour(dest)
+}
+
+// GetConfig returns the configuration of the running Point server. It must not be modified.
+func (this *Point) GetConfig() *Config {
+	this.RLock()
+	defer this.RUnlock()
+	return this.config
+}
@@ -0,0 +1,383 @@
+package point
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/v2ray/v2ray-core/app"
+	"github.com/v2ray/v2ray-core/app/router"
+	"github.com/v2ray/v2ray-core/common/log"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	"github.com/v2ray/v2ray-core/proxy"
+	"github.com/v2ray/v2ray-core/proxy/health"
+)
+
+const (
+	defaultInboundTag  = "vpoint-default-inbound"
+	defaultOutboundTag = "vpoint-default-outbound"
+)
+
+// outboundRouting contains all outbound handlers of a Point, and decides which of them handles a
+// connection. It is not modified once created, and is replaced as a whole when configuration reloads.
+type outboundRouting struct {
+	sessions  *sync.WaitGroup // Sessions dispatched with this routing.
+	och       proxy.OutboundHandler
+	odh       map[string]proxy.OutboundHandler
+	fallbacks map[string][]proxy.OutboundHandler
+	ods       map[string]*outboundState
+	checkers  map[string]*health.Checker
+	balancers map[string]OutboundBalancer
+	router    router.Router
+}
+
+// newOutboundRouting creates all outbound handlers in the given config. Handlers already created are
+// closed if any error occurs.
+func newOutboundRouting(space *app.SpaceController, pConfig *Config) (_ *outboundRouting, err error) {
+	routing := &outboundRouting{
+		sessions: new(sync.WaitGroup),
+	}
+	defer func() {
+		if err != nil && routing.och != nil {
+			routing.CloseHandlers()
+		}
+	}()
+
+	ochConfig := pConfig.OutboundConfig
+	och, err := newOutboundHandler(ochConfig.Protocol, space.ForContext(defaultOutboundTag), ochConfig.Settings, ochConfig.SettingsConfig)
+	if err != nil {
+		log.Error("Failed to create outbound connection handler: ", err)
+		return nil, err
+	}
+	routing.och = och
+
+	outboundDetours := pConfig.OutboundDetours
+	if len(outboundDetours) > 0 {
+		routing.odh = make(map[string]proxy.OutboundHandler)
+		for _, detourConfig := range outboundDetours {
+			detourHandler, err := newOutboundHandler(detourConfig.Protocol, space.ForContext(detourConfig.Tag), detourConfig.Settings, detourConfig.SettingsConfig)
+			if err != nil {
+				log.Error("Failed to create detour outbound connection handler: ", err)
+				return nil, err
+			}
+			routing.odh[detourConfig.Tag] = detourHandler
+		}
+	}
+
+	routing.fallbacks = make(map[string][]proxy.OutboundHandler)
+	if err := routing.setFallbacks(defaultOutboundTag, ochConfig.Fallbacks); err != nil {
+		return nil, err
+	}
+	for _, detourConfig := range outboundDetours {
+		if err := routing.setFallbacks(detourConfig.Tag, detourConfig.Fallbacks); err != nil {
+			return nil, err
+		}
+	}
+
+	routing.checkers = make(map[string]*health.Checker)
+	for _, detourConfig := range outboundDetours {
+		if detourConfig.HealthCheck == nil {
+			continue
+		}
+		prober, err := health.NewOutboundProber(routing.odh[detourConfig.Tag], detourConfig.HealthCheck.URL)
+		if err != nil {
+			log.Error("Point: Invalid health check on outbound detour [", detourConfig.Tag, "]: ", err)
+			return nil, ErrorBadConfiguration
+		}
+		routing.checkers[detourConfig.Tag] = health.NewChecker(detourConfig.Tag, prober, detourConfig.HealthCheck)
+	}
+
+	if len(pConfig.Balancers) > 0 {
+		routing.ods = make(map[string]*outboundState)
+		routing.balancers = make(map[string]OutboundBalancer)
+		for _, balancerConfig := range pConfig.Balancers {
+			if _, found := routing.odh[balancerConfig.Tag]; found {
+				log.Error("Point: Balancer tag conflicts with an outbound detour: ", balancerConfig.Tag)
+				return nil, ErrorBadConfiguration
+			}
+			if _, found := routing.balancers[balancerConfig.Tag]; found {
+				log.Error("Point: Duplicate balancer tag: ", balancerConfig.Tag)
+				return nil, ErrorBadConfiguration
+			}
+			states := make([]*outboundState, 0, len(balancerConfig.OutboundTags))
+			for _, tag := range balancerConfig.OutboundTags {
+				if _, found := routing.odh[tag]; !found {
+					log.Error("Point: Balancer [", balancerConfig.Tag, "] refers to an unknown outbound detour: ", tag)
+					return nil, ErrorBadConfiguration
+				}
+				state, found := routing.ods[tag]
+				if !found {
+					state = newOutboundState(tag)
+					state.checker = routing.checkers[tag]
+					routing.ods[tag] = state
+				}
+				states = append(states, state)
+			}
+			balancer, err := newOutboundBalancer(balancerConfig, states)
+			if err != nil {
+				return nil, err
+			}
+			routing.balancers[balancerConfig.Tag] = balancer
+		}
+	}
+
+	routerConfig := pConfig.RouterConfig
+	if routerConfig != nil {
+		r, err := router.CreateRouter(routerConfig.Strategy, routerConfig.Settings, space.ForContext("router"))
+		if err != nil {
+			log.Error("Failed to create router: ", err)
+			return nil, ErrorBadConfiguration
+		}
+		routing.router = r
+	}
+
+	return routing, nil
+}
+
+// Start starts health checking on outbound detours, as well as in outbound handlers which check
+// their own servers.
+func (this *outboundRouting) Start() {
+	for _, checker := range this.checkers {
+		checker.Start()
+	}
+	for _, handler := range this.handlers() {
+		startHealthCheck(handler)
+	}
+}
+
+// Close stops health checking on outbound detours and in outbound handlers. Outbound handlers are
+// not closed, so connections in progress are able to finish.
+func (this *outboundRouting) Close() {
+	for _, checker := range this.checkers {
+		checker.Close()
+	}
+	for _, handler := range this.handlers() {
+		stopHealthCheck(handler)
+	}
+}
+
+// handlers returns the default outbound handler followed by all outbound detour handlers.
+func (this *outboundRouting) handlers() []proxy.OutboundHandler {
+	handlers := make([]proxy.OutboundHandler, 0, len(this.odh)+1)
+	handlers = append(handlers, this.och)
+	for _, handler := range this.odh {
+		handlers = append(handlers, handler)
+	}
+	return handlers
+}
+
+func startHealthCheck(handler proxy.OutboundHandler) {
+	if checkingHandler, ok := handler.(proxy.HealthCheckingHandler); ok {
+		checkingHandler.StartHealthCheck()
+	}
+}
+
+func stopHealthCheck(handler proxy.OutboundHandler) {
+	if checkingHandler, ok := handler.(proxy.HealthCheckingHandler); ok {
+		checkingHandler.StopHealthCheck()
+	}
+}
+
+// CloseHandlers closes all outbound handlers, along with their connections in progress.
+func (this *outboundRouting) CloseHandlers() {
+	this.och.Close()
+	for _, handler := range this.odh {
+		handler.Close()
+	}
+}
+
+// setFallbacks sets the outbound detours of the given tags as fallbacks of the outbound with the
+// given tag, which is defaultOutboundTag for the default outbound.
+func (this *outboundRouting) setFallbacks(outboundTag string, fallbackTags []string) error {
+	if len(fallbackTags) == 0 {
+		return nil
+	}
+	chain := make([]proxy.OutboundHandler, 0, len(fallbackTags))
+	for _, tag := range fallbackTags {
+		handler, found := this.odh[tag]
+		if !found || tag == outboundTag {
+			log.Error("Point: Invalid fallback [", tag, "] of outbound: ", outboundTag)
+			return ErrorBadConfiguration
+		}
+		chain = append(chain, handler)
+	}
+	this.fallbacks[outboundTag] = chain
+	return nil
+}
+
+// PickDispatchers returns the tag of outbound handler for the given destination, empty for the
+// default outbound, along with the outbound handler followed by its fallbacks. The returned
+// outboundState is not nil if the connection needs to be tracked.
+func (this *outboundRouting) PickDispatchers(dest v2net.Destination) (string, []proxy.OutboundHandler, *outboundState) {
+	pickedTag := ""
+	dispatcher := this.och
+	fallbacks := this.fallbacks[defaultOutboundTag]
+	var state *outboundState
+
+	if this.router != nil {
+		if tag, err := this.router.TakeDetour(dest); err == nil {
+			if balancer, found := this.balancers[tag]; found {
+				picked := balancer.PickOutbound()
+				log.Info("Point: Balancer [", tag, "] picked [", picked, "] for [", dest, "]")
+				tag = picked
+			}
+			if handler, found := this.odh[tag]; found {
+				log.Info("Point: Taking detour [", tag, "] for [", dest, "]", tag, dest)
+				pickedTag = tag
+				dispatcher = handler
+				fallbacks = this.fallbacks[tag]
+				state = this.ods[tag]
+			} else {
+				log.Warning("Point: Unable to find routing destination: ", tag)
+			}
+		}
+	}
+
+	return pickedTag, append([]proxy.OutboundHandler{dispatcher}, fallbacks...), state
+}
+
+// GetHandler returns the outbound handler of the given tag, or nil if there is none. Empty tag means
+// the default outbound.
+func (this *outboundRouting) GetHandler(tag string) proxy.OutboundHandler {
+	if len(tag) == 0 || tag == defaultOutboundTag {
+		return this.och
+	}
+	return this.odh[tag]
+}
+
+// HealthStatus returns the health state of all outbound detours with health check enabled, followed by
+// the servers checked by outbound handlers themselves, e.g., VMess receivers. Servers of outbound
+// detours are named with the tag of the detour as prefix, e.g., "tag/vmess:1.2.3.4:443".
+func (this *outboundRouting) HealthStatus() []*health.Status {
+	statusList := make([]*health.Status, 0, len(this.checkers))
+	for _, checker := range this.checkers {
+		statusList = append(statusList, checker.Status())
+	}
+	sort.Sort(statusByName(statusList))
+
+	handlerStatusList := reportHealth("", this.och)
+	for tag, handler := range this.odh {
+		handlerStatusList = append(handlerStatusList, reportHealth(tag+"/", handler)...)
+	}
+	sort.Sort(statusByName(handlerStatusList))
+	return append(statusList, handlerStatusList...)
+}
+
+// reportHealth returns the health state reported by the given handler, if it is a health.Reporter, with
+// the given prefix added to the names.
+func reportHealth(prefix string, handler proxy.OutboundHandler) []*health.Status {
+	reporter, ok := handler.(health.Reporter)
+	if !ok {
+		return nil
+	}
+	statusList := reporter.HealthStatus()
+	for _, status := range statusList {
+		status.Name = prefix + status.Name
+	}
+	return statusList
+}
+
+type statusByName []*health.Status
+
+func (this statusByName) Len() int           { return len(this) }
+func (this statusByName) Less(i, j int) bool { return this[i].Name < this[j].Name }
+func (this statusByName) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+
+// TakeDetour returns the tag of routing target for the given destination, or empty for the default
+// outbound.
+func (this *outboundRouting) TakeDetour(dest v2net.Destination) string {
+	if this.router == nil {
+		return ""
+	}
+	tag, err := this.router.TakeDetour(dest)
+	if err != nil {
+		return ""
+	}
+	return tag
+}
+
+func (this *outboundRouting) clone() *outboundRouting {
+	routing := *this
+	routing.sessions = new(sync.WaitGroup)
+	routing.odh = make(map[string]proxy.OutboundHandler)
+	for tag, handler := range this.odh {
+		routing.odh[tag] = handler
+	}
+	routing.fallbacks = make(map[string][]proxy.OutboundHandler)
+	for tag, chain := range this.fallbacks {
+		routing.fallbacks[tag] = chain
+	}
+	routing.checkers = make(map[string]*health.Checker)
+	for tag, checker := range this.checkers {
+		routing.checkers[tag] = checker
+	}
+	return &routing
+}
+
+// withOutbound returns a copy of this routing with the given outbound detour added. Health check of
+// the new outbound detour is started if configured, along with health check in the handler.
+func (this *outboundRouting) withOutbound(space *app.SpaceController, detourConfig *OutboundDetourConfig) (*outboundRouting, error) {
+	if _, found := this.odh[detourConfig.Tag]; found {
+		return nil, ErrorTagExists
+	}
+	if _, found := this.balancers[detourConfig.Tag]; found {
+		return nil, ErrorTagExists
+	}
+
+	routing := this.clone()
+	handler, err := newOutboundHandler(detourConfig.Protocol, space.ForContext(detourConfig.Tag), detourConfig.Settings, detourConfig.SettingsConfig)
+	if err != nil {
+		log.Error("Failed to create detour outbound connection handler: ", err)
+		return nil, err
+	}
+	routing.odh[detourConfig.Tag] = handler
+
+	if err := routing.setFallbacks(detourConfig.Tag, detourConfig.Fallbacks); err != nil {
+		handler.Close()
+		return nil, err
+	}
+
+	if detourConfig.HealthCheck != nil {
+		prober, err := health.NewOutboundProber(handler, detourConfig.HealthCheck.URL)
+		if err != nil {
+			log.Error("Point: Invalid health check on outbound detour [", detourConfig.Tag, "]: ", err)
+			handler.Close()
+			return nil, ErrorBadConfiguration
+		}
+		checker := health.NewChecker(detourConfig.Tag, prober, detourConfig.HealthCheck)
+		checker.Start()
+		routing.checkers[detourConfig.Tag] = checker
+	}
+	startHealthCheck(handler)
+
+	return routing, nil
+}
+
+// withoutOutbound returns a copy of this routing with the given outbound detour removed. Outbound
+// detours used by balancers or as fallbacks can't be removed. The removed handler is not closed, as
+// connections in progress may still use it.
+func (this *outboundRouting) withoutOutbound(tag string) (*outboundRouting, error) {
+	handler, found := this.odh[tag]
+	if !found {
+		return nil, ErrorTagNotFound
+	}
+	if _, found := this.ods[tag]; found {
+		return nil, ErrorTagInUse
+	}
+	for _, chain := range this.fallbacks {
+		for _, fallback := range chain {
+			if fallback == handler {
+				return nil, ErrorTagInUse
+			}
+		}
+	}
+
+	routing := this.clone()
+	delete(routing.odh, tag)
+	delete(routing.fallbacks, tag)
+	if checker, found := routing.checkers[tag]; found {
+		checker.Close()
+		delete(routing.checkers, tag)
+	}
+	stopHealthCheck(handler)
+	return routing, nil
+}
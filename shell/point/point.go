@@ -5,100 +5,119 @@
 package point
 
 import (
+	"sync"
+	"time"
+
 	"github.com/v2ray/v2ray-core/app"
+	"github.com/v2ray/v2ray-core/app/api"
 	"github.com/v2ray/v2ray-core/app/dispatcher"
+	"github.com/v2ray/v2ray-core/app/dns"
+	"github.com/v2ray/v2ray-core/app/limiter"
+	"github.com/v2ray/v2ray-core/app/metrics"
+	"github.com/v2ray/v2ray-core/app/policy"
 	"github.com/v2ray/v2ray-core/app/proxyman"
-	"github.com/v2ray/v2ray-core/app/router"
+	"github.com/v2ray/v2ray-core/app/stats"
+	"github.com/v2ray/v2ray-core/common/alloc"
 	"github.com/v2ray/v2ray-core/common/log"
 	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
 	"github.com/v2ray/v2ray-core/common/retry"
+	"github.com/v2ray/v2ray-core/common/serial"
 	"github.com/v2ray/v2ray-core/proxy"
+	"github.com/v2ray/v2ray-core/proxy/health"
 	proxyrepo "github.com/v2ray/v2ray-core/proxy/repo"
 	"github.com/v2ray/v2ray-core/transport/ray"
 )
 
 // Point shell of V2Ray.
 type Point struct {
+	sync.RWMutex
+	config    *Config
 	port      v2net.Port
 	ich       proxy.InboundHandler
-	och       proxy.OutboundHandler
 	idh       []InboundDetourHandler
 	taggedIdh map[string]InboundDetourHandler
-	odh       map[string]proxy.OutboundHandler
-	router    router.Router
+	routing   *outboundRouting
 	space     *app.SpaceController
+	apiServer *api.ApiServer
+	stats     *stats.StatsManager
+	metrics   *metrics.MetricsServer
+	limiter   *limiter.Limiter
+	policy    *policy.PolicyManager
+	fakeDNS   dns.FakeIPServer // Nil if fake IP is not enabled.
+	sessions  *sessionManager
+	retired   map[*outboundRouting]bool // Replaced routings with sessions in progress.
+	reloading sync.Mutex
+	// Changes of users through the API by inbound tag, empty for the default inbound. Guarded by
+	// reloading.
+	userChanges map[string][]*userChange
 }
 
 // NewPoint returns a new Point server based on given configuration.
 // The server is not started at this point.
 func NewPoint(pConfig *Config) (*Point, error) {
 	var vpoint = new(Point)
+	vpoint.config = pConfig
 	vpoint.port = pConfig.Port
+	vpoint.sessions = newSessionManager()
+	vpoint.retired = make(map[*outboundRouting]bool)
+	vpoint.userChanges = make(map[string][]*userChange)
 
-	if pConfig.LogConfig != nil {
-		logConfig := pConfig.LogConfig
-		if len(logConfig.AccessLog) > 0 {
-			err := log.InitAccessLogger(logConfig.AccessLog)
-			if err != nil {
-				return nil, err
-			}
-		}
-
-		if len(logConfig.ErrorLog) > 0 {
-			err := log.InitErrorLogger(logConfig.ErrorLog)
-			if err != nil {
-				return nil, err
-			}
-		}
-
-		log.SetLogLevel(logConfig.LogLevel)
+	if err := applyLogConfig(pConfig.LogConfig); err != nil {
+		return nil, err
 	}
 
 	vpoint.space = app.NewController()
 	vpoint.space.Bind(dispatcher.APP_ID, vpoint)
 	vpoint.space.Bind(proxyman.APP_ID_INBOUND_MANAGER, vpoint)
-
-	ichConfig := pConfig.InboundConfig.Settings
-	ich, err := proxyrepo.CreateInboundHandler(pConfig.InboundConfig.Protocol, vpoint.space.ForContext("vpoint-default-inbound"), ichConfig)
-	if err != nil {
-		log.Error("Failed to create inbound connection handler: ", err)
-		return nil, err
+	vpoint.policy = policy.NewPolicyManager(pConfig.PolicyConfig)
+	vpoint.space.Bind(policy.APP_ID, vpoint.policy)
+	if pConfig.ApiConfig != nil {
+		vpoint.apiServer = api.NewApiServer(pConfig.ApiConfig)
+		if err := vpoint.apiServer.Register("Point", &apiService{point: vpoint}); err != nil {
+			log.Error("Point: Failed to register API: ", err)
+			return nil, err
+		}
+		vpoint.space.Bind(api.APP_ID, vpoint.apiServer)
+	}
+	if pConfig.DnsConfig != nil {
+		dnsServer := dns.NewCacheServer(vpoint.space.ForContext("dns"), pConfig.DnsConfig)
+		vpoint.space.Bind(dns.APP_ID, dnsServer)
+		if pConfig.DnsConfig.FakeIP != nil {
+			vpoint.fakeDNS = dnsServer
+		}
+	}
+	if pConfig.StatsConfig != nil {
+		vpoint.stats = stats.NewStatsManager(pConfig.StatsConfig)
+		vpoint.space.Bind(stats.APP_ID, vpoint.stats)
+	}
+	if pConfig.MetricsConfig != nil {
+		vpoint.metrics = metrics.NewMetricsServer(pConfig.MetricsConfig)
+		vpoint.space.Bind(metrics.APP_ID, vpoint.metrics)
+	}
+	if pConfig.LimiterConfig != nil {
+		l, err := limiter.NewLimiter(pConfig.LimiterConfig)
+		if err != nil {
+			return nil, err
+		}
+		vpoint.limiter = l
+		vpoint.space.Bind(limiter.APP_ID, vpoint.limiter)
 	}
-	vpoint.ich = ich
 
-	ochConfig := pConfig.OutboundConfig.Settings
-	och, err := proxyrepo.CreateOutboundHandler(pConfig.OutboundConfig.Protocol, vpoint.space.ForContext("vpoint-default-outbound"), ochConfig)
+	ich, err := vpoint.createInboundHandler(pConfig.InboundConfig)
 	if err != nil {
-		log.Error("Failed to create outbound connection handler: ", err)
 		return nil, err
 	}
-	vpoint.och = och
+	vpoint.ich = ich
 
 	vpoint.taggedIdh = make(map[string]InboundDetourHandler)
 	detours := pConfig.InboundDetours
 	if len(detours) > 0 {
 		vpoint.idh = make([]InboundDetourHandler, len(detours))
 		for idx, detourConfig := range detours {
-			allocConfig := detourConfig.Allocation
-			var detourHandler InboundDetourHandler
-			switch allocConfig.Strategy {
-			case AllocationStrategyAlways:
-				dh, err := NewInboundDetourHandlerAlways(vpoint.space.ForContext(detourConfig.Tag), detourConfig)
-				if err != nil {
-					log.Error("Point: Failed to create detour handler: ", err)
-					return nil, ErrorBadConfiguration
-				}
-				detourHandler = dh
-			case AllocationStrategyRandom:
-				dh, err := NewInboundDetourHandlerDynamic(vpoint.space.ForContext(detourConfig.Tag), detourConfig)
-				if err != nil {
-					log.Error("Point: Failed to create detour handler: ", err)
-					return nil, ErrorBadConfiguration
-				}
-				detourHandler = dh
-			default:
-				log.Error("Point: Unknown allocation strategy: ", allocConfig.Strategy)
-				return nil, ErrorBadConfiguration
+			detourHandler, err := vpoint.createInboundDetourHandler(detourConfig)
+			if err != nil {
+				return nil, err
 			}
 			vpoint.idh[idx] = detourHandler
 			if len(detourConfig.Tag) > 0 {
@@ -107,39 +126,149 @@ func NewPoint(pConfig *Config) (*Point, error) {
 		}
 	}
 
-	outboundDetours := pConfig.OutboundDetours
-	if len(outboundDetours) > 0 {
-		vpoint.odh = make(map[string]proxy.OutboundHandler)
-		for _, detourConfig := range outboundDetours {
-			detourHandler, err := proxyrepo.CreateOutboundHandler(detourConfig.Protocol, vpoint.space.ForContext(detourConfig.Tag), detourConfig.Settings)
-			if err != nil {
-				log.Error("Failed to create detour outbound connection handler: ", err)
-				return nil, err
-			}
-			vpoint.odh[detourConfig.Tag] = detourHandler
+	routing, err := newOutboundRouting(vpoint.space, pConfig)
+	if err != nil {
+		return nil, err
+	}
+	vpoint.routing = routing
+
+	return vpoint, nil
+}
+
+func applyLogConfig(logConfig *LogConfig) error {
+	if logConfig == nil {
+		return nil
+	}
+
+	log.SetFormat(logConfig.Format)
+	if len(logConfig.AccessLog) > 0 {
+		err := log.InitAccessLogger(logConfig.AccessLog, logConfig.Rotation)
+		if err != nil {
+			return err
 		}
 	}
 
-	routerConfig := pConfig.RouterConfig
-	if routerConfig != nil {
-		r, err := router.CreateRouter(routerConfig.Strategy, routerConfig.Settings)
+	if len(logConfig.ErrorLog) > 0 {
+		err := log.InitErrorLogger(logConfig.ErrorLog, logConfig.Rotation)
 		if err != nil {
-			log.Error("Failed to create router: ", err)
-			return nil, ErrorBadConfiguration
+			return err
 		}
-		vpoint.router = r
 	}
 
-	return vpoint, nil
+	log.SetLogLevel(logConfig.LogLevel)
+	return nil
+}
+
+// newInboundHandler creates an inbound handler with the config object built from a typed config message if
+// there is one, or with the raw settings otherwise.
+func newInboundHandler(protocol string, space app.Space, settings []byte, settingsConfig interface{}) (proxy.InboundHandler, error) {
+	if settingsConfig != nil {
+		return proxyrepo.CreateInboundHandlerFromConfig(protocol, space, settingsConfig)
+	}
+	return proxyrepo.CreateInboundHandler(protocol, space, settings)
+}
+
+func newOutboundHandler(protocol string, space app.Space, settings []byte, settingsConfig interface{}) (proxy.OutboundHandler, error) {
+	if settingsConfig != nil {
+		return proxyrepo.CreateOutboundHandlerFromConfig(protocol, space, settingsConfig)
+	}
+	return proxyrepo.CreateOutboundHandler(protocol, space, settings)
+}
+
+func (this *Point) createInboundHandler(config *ConnectionConfig) (proxy.InboundHandler, error) {
+	ich, err := newInboundHandler(config.Protocol, this.space.ForContext(defaultInboundTag), config.Settings, config.SettingsConfig)
+	if err != nil {
+		log.Error("Failed to create inbound connection handler: ", err)
+		return nil, err
+	}
+	return ich, nil
+}
+
+func (this *Point) createInboundDetourHandler(detourConfig *InboundDetourConfig) (InboundDetourHandler, error) {
+	allocConfig := detourConfig.Allocation
+	switch allocConfig.Strategy {
+	case AllocationStrategyAlways:
+		dh, err := NewInboundDetourHandlerAlways(this.space.ForContext(detourConfig.Tag), detourConfig)
+		if err != nil {
+			log.Error("Point: Failed to create detour handler: ", err)
+			return nil, ErrorBadConfiguration
+		}
+		return dh, nil
+	case AllocationStrategyRandom:
+		dh, err := NewInboundDetourHandlerDynamic(this.space.ForContext(detourConfig.Tag), detourConfig)
+		if err != nil {
+			log.Error("Point: Failed to create detour handler: ", err)
+			return nil, ErrorBadConfiguration
+		}
+		return dh, nil
+	}
+	log.Error("Point: Unknown allocation strategy: ", allocConfig.Strategy)
+	return nil, ErrorBadConfiguration
 }
 
 func (this *Point) Close() {
+	this.closeInbounds()
+	this.sessions.CancelAll()
+
+	this.Lock()
+	this.routing.Close()
+	this.routing.CloseHandlers()
+	this.closeRetiredRoutings()
+	this.Unlock()
+
+	if this.apiServer != nil {
+		this.apiServer.Close()
+	}
+	if this.stats != nil {
+		this.stats.Close()
+	}
+	if this.metrics != nil {
+		this.metrics.Close()
+	}
+	if this.limiter != nil {
+		this.limiter.Close()
+	}
+}
+
+// Shutdown stops accepting new connections, and waits up to the given timeout for active sessions to
+// finish before closing the Point server.
+func (this *Point) Shutdown(timeout time.Duration) {
+	this.closeInbounds()
+	if active := this.sessions.Count(); active > 0 {
+		log.Warning("Point: Waiting for ", active, " active sessions to finish.")
+		if !this.sessions.Wait(timeout) {
+			log.Warning("Point: Closing ", this.sessions.Count(), " sessions in progress.")
+		}
+	}
+	this.Close()
+}
+
+// ActiveSessions returns the number of sessions in progress.
+func (this *Point) ActiveSessions() int {
+	return this.sessions.Count()
+}
+
+func (this *Point) closeInbounds() {
+	this.RLock()
+	defer this.RUnlock()
+
 	this.ich.Close()
 	for _, idh := range this.idh {
 		idh.Close()
 	}
 }
 
+func (this *Point) listen(ich proxy.InboundHandler, port v2net.Port) error {
+	return retry.Timed(100 /* times */, 100 /* ms */).On(func() error {
+		err := ich.Listen(port)
+		if err != nil {
+			return err
+		}
+		log.Warning("Point server started on port ", port)
+		return nil
+	})
+}
+
 // Start starts the Point server, and return any error during the process.
 // In the case of any errors, the state of the server is unpredicatable.
 func (this *Point) Start() error {
@@ -148,53 +277,414 @@ func (this *Point) Start() error {
 		return ErrorBadConfiguration
 	}
 
-	err := retry.Timed(100 /* times */, 100 /* ms */).On(func() error {
-		err := this.ich.Listen(this.port)
+	err := this.listen(this.ich, this.port)
+	if err != nil {
+		return err
+	}
+
+	for _, detourHandler := range this.idh {
+		err := detourHandler.Start()
 		if err != nil {
 			return err
 		}
-		log.Warning("Point server started on port ", this.port)
-		return nil
-	})
+	}
+
+	this.routing.Start()
+
+	if this.stats != nil {
+		this.stats.Start()
+	}
+
+	if this.limiter != nil {
+		this.limiter.Start()
+	}
+
+	if this.apiServer != nil {
+		if err := this.apiServer.Start(); err != nil {
+			return err
+		}
+	}
+
+	if this.metrics != nil {
+		if err := this.metrics.Start(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reload applies a new configuration to a running Point server. Inbounds whose configuration is not
+// changed keep running, changed inbounds are restarted, and all outbounds together with routing are
+// replaced at once. Connections in progress keep using the handlers they started with, and the old
+// handlers are closed once those connections finish.
+// If any error occurs before the new configuration is applied, the Point server is not changed.
+func (this *Point) Reload(pConfig *Config) error {
+	this.reloading.Lock()
+	defer this.reloading.Unlock()
+
+	if pConfig.Port <= 0 {
+		log.Error("Invalid port ", pConfig.Port)
+		return ErrorBadConfiguration
+	}
+
+	this.RLock()
+	oldConfig := this.config
+	oldIch := this.ich
+	oldIdh := this.idh
+	this.RUnlock()
+
+	routing, err := newOutboundRouting(this.space, pConfig)
 	if err != nil {
 		return err
 	}
 
-	for _, detourHandler := range this.idh {
-		err := detourHandler.Start()
+	ich := oldIch
+	restartIch := pConfig.Port != oldConfig.Port || !pConfig.InboundConfig.Equals(oldConfig.InboundConfig)
+	idh := make([]InboundDetourHandler, len(pConfig.InboundDetours))
+	newIdh := make([]bool, len(pConfig.InboundDetours))
+	reused := make([]bool, len(oldIdh))
+	taggedIdh := make(map[string]InboundDetourHandler)
+
+	// closeNew closes everything created for the new configuration, when it can't be applied.
+	closeNew := func() {
+		routing.CloseHandlers()
+		if restartIch && ich != nil {
+			ich.Close()
+		}
+		for idx, detourHandler := range idh {
+			if newIdh[idx] {
+				detourHandler.Close()
+			}
+		}
+	}
+
+	if restartIch {
+		ich, err = this.createInboundHandler(pConfig.InboundConfig)
 		if err != nil {
+			closeNew()
+			return err
+		}
+		this.applyUserChanges("", []proxy.InboundHandler{ich})
+	}
+
+	for idx, detourConfig := range pConfig.InboundDetours {
+		for oldIdx, oldDetourConfig := range oldConfig.InboundDetours {
+			if !reused[oldIdx] && detourConfig.Equals(oldDetourConfig) {
+				idh[idx] = oldIdh[oldIdx]
+				reused[oldIdx] = true
+				break
+			}
+		}
+		if idh[idx] == nil {
+			detourHandler, err := this.createInboundDetourHandler(detourConfig)
+			if err != nil {
+				closeNew()
+				return err
+			}
+			idh[idx] = detourHandler
+			newIdh[idx] = true
+			if len(detourConfig.Tag) > 0 {
+				this.applyUserChanges(detourConfig.Tag, detourHandler.GetAllConnectionHandlers())
+			}
+		}
+		if len(detourConfig.Tag) > 0 {
+			taggedIdh[detourConfig.Tag] = idh[idx]
+		}
+	}
+
+	logChanged := !oldConfig.LogConfig.Equals(pConfig.LogConfig)
+	if logChanged {
+		if err := applyLogConfig(pConfig.LogConfig); err != nil {
+			closeNew()
 			return err
 		}
 	}
 
+	// Start listening before the new configuration is applied. The old inbound has to be closed first
+	// if it listens on the same port, and is restarted if the new one fails.
+	samePort := pConfig.Port == oldConfig.Port
+	if restartIch {
+		if samePort {
+			oldIch.Close()
+		}
+		if err := this.listen(ich, pConfig.Port); err != nil {
+			if samePort {
+				if err := oldIch.Listen(oldConfig.Port); err != nil {
+					log.Error("Point: Failed to restart inbound on port ", oldConfig.Port, ": ", err)
+				}
+			}
+			if logChanged {
+				applyLogConfig(oldConfig.LogConfig)
+			}
+			closeNew()
+			return err
+		}
+	}
+
+	this.policy.Update(pConfig.PolicyConfig)
+
+	this.Lock()
+	oldRouting := this.routing
+	this.config = pConfig
+	this.port = pConfig.Port
+	this.ich = ich
+	this.idh = idh
+	this.taggedIdh = taggedIdh
+	this.routing = routing
+	this.retireRouting(oldRouting)
+	this.Unlock()
+	for tag := range this.userChanges {
+		if _, found := taggedIdh[tag]; len(tag) > 0 && !found {
+			delete(this.userChanges, tag)
+		}
+	}
+
+	oldRouting.Close()
+	routing.Start()
+
+	for oldIdx, detourHandler := range oldIdh {
+		if !reused[oldIdx] {
+			detourHandler.Close()
+		}
+	}
+
+	if restartIch && !samePort {
+		oldIch.Close()
+	}
+
+	for idx, detourHandler := range idh {
+		if newIdh[idx] {
+			if err := detourHandler.Start(); err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Warning("Point: Configuration reloaded.")
 	return nil
 }
 
+func (this *Point) getRouting() *outboundRouting {
+	this.RLock()
+	defer this.RUnlock()
+	return this.routing
+}
+
+// acquireRouting returns the current routing, and counts a session dispatched with it. The session
+// must be marked done on the sessions of the routing once it finishes.
+func (this *Point) acquireRouting() *outboundRouting {
+	this.RLock()
+	defer this.RUnlock()
+	this.routing.sessions.Add(1)
+	return this.routing
+}
+
+// retireRouting keeps the given routing, which is just replaced, until the sessions dispatched with
+// it finish, and then closes its outbound handlers that are no longer used. Caller must hold the
+// lock.
+func (this *Point) retireRouting(routing *outboundRouting) {
+	this.retired[routing] = true
+	go func() {
+		routing.sessions.Wait()
+
+		this.Lock()
+		if !this.retired[routing] {
+			// Closed along with the Point.
+			this.Unlock()
+			return
+		}
+		delete(this.retired, routing)
+		handlers := this.unusedHandlers(routing)
+		this.Unlock()
+
+		for _, handler := range handlers {
+			handler.Close()
+		}
+	}()
+}
+
+// unusedHandlers returns the outbound handlers of the given routing which are used by neither the
+// current routing nor any other retired routing. Caller must hold the lock.
+func (this *Point) unusedHandlers(routing *outboundRouting) []proxy.OutboundHandler {
+	used := make(map[proxy.OutboundHandler]bool)
+	for _, handler := range this.routing.handlers() {
+		used[handler] = true
+	}
+	for retired := range this.retired {
+		if retired == routing {
+			continue
+		}
+		for _, handler := range retired.handlers() {
+			used[handler] = true
+		}
+	}
+
+	var unused []proxy.OutboundHandler
+	for _, handler := range routing.handlers() {
+		if !used[handler] {
+			unused = append(unused, handler)
+			used[handler] = true
+		}
+	}
+	return unused
+}
+
+// closeRetiredRoutings closes the outbound handlers of all retired routings without waiting for
+// their sessions. Caller must hold the lock.
+func (this *Point) closeRetiredRoutings() {
+	retired := this.retired
+	this.retired = make(map[*outboundRouting]bool)
+	closed := make(map[proxy.OutboundHandler]bool)
+	for _, handler := range this.routing.handlers() {
+		closed[handler] = true
+	}
+	for routing := range retired {
+		for _, handler := range routing.handlers() {
+			if !closed[handler] {
+				handler.Close()
+				closed[handler] = true
+			}
+		}
+	}
+}
+
+// HealthStatus returns the health state of all outbound detours with health check enabled, and of the
+// servers checked by outbound handlers themselves.
+func (this *Point) HealthStatus() []*health.Status {
+	return this.getRouting().HealthStatus()
+}
+
 // Dispatches a Packet to an OutboundConnection.
 // The packet will be passed through the router (if configured), and then sent to an outbound
 // connection with matching tag.
 func (this *Point) DispatchToOutbound(context app.Context, packet v2net.Packet) ray.InboundRay {
-	direct := ray.NewRay()
-	dest := packet.Destination()
+	return this.DispatchToOutboundForUser(context, nil, nil, packet)
+}
+
+// DispatchToOutboundForUser dispatches a Packet the same way as DispatchToOutbound, and accounts the
+// traffic to the given user, if not nil. The connection is logged with the given source once it
+// finishes. Fake IPs in the destination are replaced by their domains first.
+func (this *Point) DispatchToOutboundForUser(context app.Context, source serial.String, user *proto.User, packet v2net.Packet) ray.InboundRay {
+	if this.fakeDNS != nil {
+		if dest := dns.RestoreDomain(this.fakeDNS, packet.Destination()); dest != packet.Destination() {
+			packet = v2net.NewPacket(dest, packet.Chunk(), packet.MoreChunks())
+		}
+	}
+	level := proto.UserLevelUntrusted
+	if user != nil {
+		level = user.Level
+	}
+	userPolicy := this.policy.ForLevel(level)
+	direct := ray.NewRayWithBufferSize(userPolicy.BufferSize)
 
-	dispatcher := this.och
+	if this.apiServer != nil && len(this.apiServer.Tag()) > 0 && context != nil && context.CallerTag() == this.apiServer.Tag() {
+		go this.FilterPacketAndDispatch(packet, direct, this.apiServer)
+		return direct
+	}
 
-	if this.router != nil {
-		if tag, err := this.router.TakeDetour(dest); err == nil {
-			if handler, found := this.odh[tag]; found {
-				log.Info("Point: Taking detour [", tag, "] for [", dest, "]", tag, dest)
-				dispatcher = handler
-			} else {
-				log.Warning("Point: Unable to find routing destination: ", tag)
-			}
+	routing := this.acquireRouting()
+	tag, dispatchers, state := routing.PickDispatchers(packet.Destination())
+	access := &log.AccessEntry{
+		From:        source,
+		To:          packet.Destination(),
+		Status:      log.AccessAccepted,
+		OutboundTag: tag,
+	}
+	if context != nil {
+		access.InboundTag = context.CallerTag()
+	}
+	if len(access.OutboundTag) == 0 {
+		access.OutboundTag = defaultOutboundTag
+	}
+	if user != nil {
+		access.Email = user.Email
+	}
+	if chunk := packet.Chunk(); chunk != nil {
+		access.Uplink = int64(chunk.Len())
+	}
+	link := this.sessions.Track(direct, userPolicy, func(session *activityRay) {
+		uplink, downlink, duration := session.Traffic()
+		access.Uplink += uplink
+		access.Downlink = downlink
+		access.Duration = duration
+		log.AccessDetails(access)
+		routing.sessions.Done()
+	})
+	if this.stats != nil {
+		statsUser := user
+		if !userPolicy.StatsEnabled {
+			statsUser = nil
 		}
+		link = stats.Track(packet, link, this.getCounters(context, statsUser, tag)...)
+	}
+	if this.limiter != nil && user != nil {
+		link = this.limiter.Track(user, link)
+	}
+	if state == nil {
+		go this.FilterPacketAndDispatch(packet, link, dispatchers...)
+		return direct
 	}
 
-	go this.FilterPacketAndDispatch(packet, direct, dispatcher)
+	link, done := state.Track(link)
+	go func() {
+		defer done()
+		this.FilterPacketAndDispatch(packet, link, dispatchers...)
+	}()
 	return direct
 }
 
-func (this *Point) FilterPacketAndDispatch(packet v2net.Packet, link ray.OutboundRay, dispatcher proxy.OutboundHandler) {
+// getCounters returns the stats counters of the given user, the calling inbound and the given
+// outbound.
+func (this *Point) getCounters(context app.Context, user *proto.User, outboundTag string) []*stats.Counter {
+	counters := make([]*stats.Counter, 0, 3)
+	if user != nil && len(user.Email) > 0 {
+		counters = append(counters, this.stats.GetCounter(stats.KindUser, user.Email))
+	}
+	if context != nil && len(context.CallerTag()) > 0 {
+		counters = append(counters, this.stats.GetCounter(stats.KindInbound, context.CallerTag()))
+	}
+	if len(outboundTag) == 0 {
+		outboundTag = defaultOutboundTag
+	}
+	counters = append(counters, this.stats.GetCounter(stats.KindOutbound, outboundTag))
+	return counters
+}
+
+// Stats returns the stats manager of this Point server, or nil if stats is not enabled.
+func (this *Point) Stats() *stats.StatsManager {
+	return this.stats
+}
+
+// DispatchToTaggedOutbound dispatches a Packet to the outbound handler of the given tag directly,
+// bypassing the router. Empty tag means the default outbound.
+func (this *Point) DispatchToTaggedOutbound(context app.Context, tag string, packet v2net.Packet) ray.InboundRay {
+	direct := ray.NewRay()
+	routing := this.acquireRouting()
+	handler := routing.GetHandler(tag)
+	if handler == nil {
+		routing.sessions.Done()
+		log.Error("Point: Unable to find outbound handler: ", tag)
+		close(direct.OutboundOutput())
+		go func() {
+			for chunk := range direct.OutboundInput() {
+				chunk.Release()
+			}
+		}()
+		return direct
+	}
+	link := this.sessions.Track(direct, this.policy.ForLevel(proto.UserLevelUntrusted), func(*activityRay) {
+		routing.sessions.Done()
+	})
+	go this.FilterPacketAndDispatch(packet, link, handler)
+	return direct
+}
+
+// FilterPacketAndDispatch dispatches the packet to the first dispatcher. If the dispatcher fails, e.g.,
+// on a dial failure, before taking any input beyond the packet, the packet is dispatched to the next
+// dispatcher in turn. Once a dispatcher succeeds, responds or takes more input, the request may have
+// reached the server, so it is never dispatched again.
+func (this *Point) FilterPacketAndDispatch(packet v2net.Packet, link ray.OutboundRay, dispatchers ...proxy.OutboundHandler) {
 	// Filter empty packets
 	chunk := packet.Chunk()
 	moreChunks := packet.MoreChunks()
@@ -213,11 +703,56 @@ func (this *Point) FilterPacketAndDispatch(packet v2net.Packet, link ray.Outboun
 		packet = v2net.NewPacket(packet.Destination(), chunk, moreChunks)
 	}
 
-	dispatcher.Dispatch(packet, link)
+	var pending *alloc.Buffer
+	last := len(dispatchers) - 1
+	for idx, dispatcher := range dispatchers {
+		if idx == last && pending == nil {
+			dispatcher.Dispatch(packet, link)
+			return
+		}
+		var fallback bool
+		pending, fallback = tryDispatch(dispatcher, packet, chunk, pending, link, idx < last)
+		if !fallback {
+			break
+		}
+	}
+	if pending != nil {
+		pending.Release()
+	}
+	chunk.Release()
+}
+
+// tryDispatch dispatches a copy of the given chunk, followed by the given pending chunk and the rest of
+// the input, to the given dispatcher. It returns the chunk read from the input but not taken by the
+// dispatcher, and whether to fall back to the next dispatcher. Unless falling back, the output of the
+// given ray is closed.
+func tryDispatch(dispatcher proxy.OutboundHandler, packet v2net.Packet, chunk *alloc.Buffer, pending *alloc.Buffer, link ray.OutboundRay, canFallback bool) (*alloc.Buffer, bool) {
+	attempt := newFallbackRay(link, pending)
+	err := dispatcher.Dispatch(v2net.NewPacket(packet.Destination(), copyChunk(chunk), packet.MoreChunks()), attempt)
+	responded := attempt.Responded()
+	pending, consumed := attempt.Finish()
+	if responded {
+		return pending, false
+	}
+	if err == nil || consumed || !canFallback {
+		close(link.OutboundOutput())
+		return pending, false
+	}
+	select {
+	case <-link.Done():
+		// The inbound connection is gone, so there is no point in trying further.
+		close(link.OutboundOutput())
+		return pending, false
+	default:
+	}
+	log.Warning("Point: Failed to dispatch to [", packet.Destination(), "], trying next outbound: ", err)
+	return pending, true
 }
 
 func (this *Point) GetHandler(context app.Context, tag string) (proxy.InboundHandler, int) {
+	this.RLock()
 	handler, found := this.taggedIdh[tag]
+	this.RUnlock()
 	if !found {
 		log.Warning("Point: Unable to find an inbound handler with tag: ", tag)
 		return nil, 0
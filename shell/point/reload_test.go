@@ -0,0 +1,368 @@
+package point_test
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/v2ray/v2ray-core/app"
+	"github.com/v2ray/v2ray-core/common/alloc"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	"github.com/v2ray/v2ray-core/proxy"
+	"github.com/v2ray/v2ray-core/proxy/health"
+	proxytesting "github.com/v2ray/v2ray-core/proxy/testing"
+	"github.com/v2ray/v2ray-core/proxy/testing/mocks"
+	. "github.com/v2ray/v2ray-core/shell/point"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+type recordingInboundHandler struct {
+	port   v2net.Port
+	closed bool
+}
+
+func (this *recordingInboundHandler) Listen(port v2net.Port) error {
+	this.port = port
+	this.closed = false
+	return nil
+}
+
+func (this *recordingInboundHandler) Close() {
+	this.closed = true
+}
+
+func (this *recordingInboundHandler) Port() v2net.Port {
+	return this.port
+}
+
+// recordingOutboundHandler is an OutboundHandler which checks health of its servers, and records
+// whether health checking is running and whether it is closed.
+type recordingOutboundHandler struct {
+	mocks.OutboundConnectionHandler
+	sync.Mutex
+	checking bool
+	closed   bool
+}
+
+func (this *recordingOutboundHandler) StartHealthCheck() {
+	this.Lock()
+	defer this.Unlock()
+	this.checking = true
+}
+
+func (this *recordingOutboundHandler) StopHealthCheck() {
+	this.Lock()
+	defer this.Unlock()
+	this.checking = false
+}
+
+func (this *recordingOutboundHandler) Close() {
+	this.Lock()
+	defer this.Unlock()
+	this.closed = true
+}
+
+func (this *recordingOutboundHandler) HealthStatus() []*health.Status {
+	return []*health.Status{{Name: "server", Healthy: this.IsChecking()}}
+}
+
+func (this *recordingOutboundHandler) IsChecking() bool {
+	this.Lock()
+	defer this.Unlock()
+	return this.checking
+}
+
+func (this *recordingOutboundHandler) IsClosed() bool {
+	this.Lock()
+	defer this.Unlock()
+	return this.closed
+}
+
+func dispatchAndRead(vpoint *Point) string {
+	dest := v2net.TCPDestination(v2net.DomainAddress("v2ray.com"), 80)
+	link := vpoint.DispatchToOutbound(nil, v2net.NewPacket(dest, alloc.NewBuffer().Clear().Append([]byte("request")), false))
+	close(link.InboundInput())
+	response := new(bytes.Buffer)
+	for chunk := range link.InboundOutput() {
+		response.Write(chunk.Value)
+		chunk.Release()
+	}
+	return response.String()
+}
+
+func TestReload(t *testing.T) {
+	v2testing.Current(t)
+
+	inbounds := make([]*recordingInboundHandler, 0, 4)
+	inboundProtocol, err := proxytesting.RegisterInboundConnectionHandlerCreator("reload_ich",
+		func(space app.Space, config interface{}) (proxy.InboundHandler, error) {
+			ich := new(recordingInboundHandler)
+			inbounds = append(inbounds, ich)
+			return ich, nil
+		})
+	assert.Error(err).IsNil()
+
+	newOutboundProtocol := func(response string) string {
+		protocol, err := proxytesting.RegisterOutboundConnectionHandlerCreator("reload_och",
+			func(space app.Space, config interface{}) (proxy.OutboundHandler, error) {
+				return &mocks.OutboundConnectionHandler{
+					ConnInput:  bytes.NewReader([]byte(response)),
+					ConnOutput: new(bytes.Buffer),
+				}, nil
+			})
+		assert.Error(err).IsNil()
+		return protocol
+	}
+
+	config := &Config{
+		Port:           v2net.Port(50001),
+		InboundConfig:  &ConnectionConfig{Protocol: inboundProtocol},
+		OutboundConfig: &ConnectionConfig{Protocol: newOutboundProtocol("old")},
+		InboundDetours: []*InboundDetourConfig{
+			{
+				Protocol:   inboundProtocol,
+				PortRange:  v2net.PortRange{From: 50002, To: 50002},
+				Tag:        "detour",
+				Allocation: &InboundDetourAllocationConfig{Strategy: AllocationStrategyAlways},
+			},
+		},
+	}
+
+	vpoint, err := NewPoint(config)
+	assert.Error(err).IsNil()
+	assert.Error(vpoint.Start()).IsNil()
+	assert.Int(len(inbounds)).Equals(2)
+	assert.StringLiteral(dispatchAndRead(vpoint)).Equals("old")
+
+	// Only outbound is changed. Inbounds keep running.
+	config = &Config{
+		Port:           config.Port,
+		InboundConfig:  config.InboundConfig,
+		OutboundConfig: &ConnectionConfig{Protocol: newOutboundProtocol("new")},
+		InboundDetours: config.InboundDetours,
+	}
+	assert.Error(vpoint.Reload(config)).IsNil()
+	assert.Int(len(inbounds)).Equals(2)
+	assert.Bool(inbounds[0].closed).IsFalse()
+	assert.Bool(inbounds[1].closed).IsFalse()
+	assert.StringLiteral(dispatchAndRead(vpoint)).Equals("new")
+
+	// Port of the main inbound is changed, and the inbound detour is removed.
+	config = &Config{
+		Port:           v2net.Port(50003),
+		InboundConfig:  config.InboundConfig,
+		OutboundConfig: config.OutboundConfig,
+	}
+	assert.Error(vpoint.Reload(config)).IsNil()
+	assert.Int(len(inbounds)).Equals(3)
+	assert.Bool(inbounds[0].closed).IsTrue()
+	assert.Bool(inbounds[1].closed).IsTrue()
+	assert.Bool(inbounds[2].closed).IsFalse()
+	netPort := inbounds[2].Port()
+	assert.Int(int(netPort)).Equals(50003)
+
+	// Invalid configuration is rejected without changing the running server.
+	config = &Config{
+		Port:           v2net.Port(50004),
+		InboundConfig:  config.InboundConfig,
+		OutboundConfig: &ConnectionConfig{Protocol: "reload_not_exist"},
+	}
+	assert.Error(vpoint.Reload(config)).IsNotNil()
+	assert.Int(len(inbounds)).Equals(3)
+	assert.Bool(inbounds[2].closed).IsFalse()
+	assert.StringLiteral(dispatchAndRead(vpoint)).Equals("new")
+
+	vpoint.Close()
+	assert.Bool(inbounds[2].closed).IsTrue()
+}
+
+func TestOutboundHealthCheckStartsWithPoint(t *testing.T) {
+	v2testing.Current(t)
+
+	inboundProtocol, err := proxytesting.RegisterInboundConnectionHandlerCreator("health_ich",
+		func(space app.Space, config interface{}) (proxy.InboundHandler, error) {
+			return new(recordingInboundHandler), nil
+		})
+	assert.Error(err).IsNil()
+
+	outbounds := make([]*recordingOutboundHandler, 0, 2)
+	outboundProtocol, err := proxytesting.RegisterOutboundConnectionHandlerCreator("health_och",
+		func(space app.Space, config interface{}) (proxy.OutboundHandler, error) {
+			och := new(recordingOutboundHandler)
+			outbounds = append(outbounds, och)
+			return och, nil
+		})
+	assert.Error(err).IsNil()
+
+	vpoint, err := NewPoint(&Config{
+		Port:            v2net.Port(50011),
+		InboundConfig:   &ConnectionConfig{Protocol: inboundProtocol},
+		OutboundConfig:  &ConnectionConfig{Protocol: outboundProtocol},
+		OutboundDetours: []*OutboundDetourConfig{{Protocol: outboundProtocol, Tag: "detour"}},
+	})
+	assert.Error(err).IsNil()
+	assert.Int(len(outbounds)).Equals(2)
+	for _, och := range outbounds {
+		assert.Bool(och.IsChecking()).IsFalse()
+	}
+
+	assert.Error(vpoint.Start()).IsNil()
+	for _, och := range outbounds {
+		assert.Bool(och.IsChecking()).IsTrue()
+	}
+	statusList := vpoint.HealthStatus()
+	assert.Int(len(statusList)).Equals(2)
+	assert.StringLiteral(statusList[0].Name).Equals("detour/server")
+	assert.StringLiteral(statusList[1].Name).Equals("server")
+	assert.Bool(statusList[1].Healthy).IsTrue()
+
+	vpoint.Close()
+	for _, och := range outbounds {
+		assert.Bool(och.IsChecking()).IsFalse()
+		assert.Bool(och.IsClosed()).IsTrue()
+	}
+}
+
+func waitForClosed(och *recordingOutboundHandler) bool {
+	for i := 0; i < 100 && !och.IsClosed(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return och.IsClosed()
+}
+
+func TestReloadClosesOutboundsAfterSessions(t *testing.T) {
+	v2testing.Current(t)
+
+	inboundProtocol, err := proxytesting.RegisterInboundConnectionHandlerCreator("drain_ich",
+		func(space app.Space, config interface{}) (proxy.InboundHandler, error) {
+			return new(recordingInboundHandler), nil
+		})
+	assert.Error(err).IsNil()
+
+	outbounds := make([]*recordingOutboundHandler, 0, 4)
+	responses := make([]*io.PipeWriter, 0, 4)
+	outboundProtocol, err := proxytesting.RegisterOutboundConnectionHandlerCreator("drain_och",
+		func(space app.Space, config interface{}) (proxy.OutboundHandler, error) {
+			reader, writer := io.Pipe()
+			och := new(recordingOutboundHandler)
+			och.ConnInput = reader
+			och.ConnOutput = new(bytes.Buffer)
+			outbounds = append(outbounds, och)
+			responses = append(responses, writer)
+			return och, nil
+		})
+	assert.Error(err).IsNil()
+
+	config := &Config{
+		Port:           v2net.Port(50012),
+		InboundConfig:  &ConnectionConfig{Protocol: inboundProtocol},
+		OutboundConfig: &ConnectionConfig{Protocol: outboundProtocol},
+	}
+	vpoint, err := NewPoint(config)
+	assert.Error(err).IsNil()
+	assert.Error(vpoint.Start()).IsNil()
+
+	dest := v2net.TCPDestination(v2net.DomainAddress("v2ray.com"), 80)
+	link := vpoint.DispatchToOutbound(nil, v2net.NewPacket(dest, alloc.NewBuffer().Clear().Append([]byte("request")), false))
+	close(link.InboundInput())
+
+	// The old outbound is kept while its session is in progress.
+	assert.Error(vpoint.Reload(config)).IsNil()
+	assert.Int(len(outbounds)).Equals(2)
+	time.Sleep(100 * time.Millisecond)
+	assert.Bool(outbounds[0].IsClosed()).IsFalse()
+
+	responses[0].Write([]byte("old"))
+	responses[0].Close()
+	response := new(bytes.Buffer)
+	for chunk := range link.InboundOutput() {
+		response.Write(chunk.Value)
+		chunk.Release()
+	}
+	assert.StringLiteral(response.String()).Equals("old")
+	assert.Bool(waitForClosed(outbounds[0])).IsTrue()
+	assert.Bool(outbounds[1].IsClosed()).IsFalse()
+
+	// Removed outbound detours are closed as well.
+	assert.Error(vpoint.AddOutboundDetour(&OutboundDetourConfig{Protocol: outboundProtocol, Tag: "detour"})).IsNil()
+	assert.Error(vpoint.RemoveOutboundDetour("detour")).IsNil()
+	assert.Bool(waitForClosed(outbounds[2])).IsTrue()
+	assert.Bool(outbounds[1].IsClosed()).IsFalse()
+
+	// Outbounds with sessions in progress are closed along with the Point.
+	link = vpoint.DispatchToOutbound(nil, v2net.NewPacket(dest, alloc.NewBuffer().Clear().Append([]byte("request")), false))
+	close(link.InboundInput())
+	assert.Error(vpoint.Reload(config)).IsNil()
+	assert.Bool(outbounds[1].IsClosed()).IsFalse()
+	vpoint.Close()
+	assert.Bool(outbounds[1].IsClosed()).IsTrue()
+	assert.Bool(outbounds[3].IsClosed()).IsTrue()
+	responses[1].Close()
+}
+
+func TestReloadFailureClosesNewHandlers(t *testing.T) {
+	v2testing.Current(t)
+
+	inbounds := make([]*recordingInboundHandler, 0, 2)
+	inboundProtocol, err := proxytesting.RegisterInboundConnectionHandlerCreator("reload_fail_ich",
+		func(space app.Space, config interface{}) (proxy.InboundHandler, error) {
+			ich := new(recordingInboundHandler)
+			inbounds = append(inbounds, ich)
+			return ich, nil
+		})
+	assert.Error(err).IsNil()
+
+	outbounds := make([]*recordingOutboundHandler, 0, 3)
+	outboundProtocol, err := proxytesting.RegisterOutboundConnectionHandlerCreator("reload_fail_och",
+		func(space app.Space, config interface{}) (proxy.OutboundHandler, error) {
+			och := new(recordingOutboundHandler)
+			outbounds = append(outbounds, och)
+			return och, nil
+		})
+	assert.Error(err).IsNil()
+
+	config := &Config{
+		Port:           v2net.Port(50013),
+		InboundConfig:  &ConnectionConfig{Protocol: inboundProtocol},
+		OutboundConfig: &ConnectionConfig{Protocol: outboundProtocol},
+	}
+	vpoint, err := NewPoint(config)
+	assert.Error(err).IsNil()
+	assert.Error(vpoint.Start()).IsNil()
+	defer vpoint.Close()
+
+	// An outbound detour fails after the default outbound is created.
+	assert.Error(vpoint.Reload(&Config{
+		Port:            config.Port,
+		InboundConfig:   config.InboundConfig,
+		OutboundConfig:  config.OutboundConfig,
+		OutboundDetours: []*OutboundDetourConfig{{Protocol: "reload_fail_not_exist", Tag: "detour"}},
+	})).IsNotNil()
+	assert.Int(len(outbounds)).Equals(2)
+	assert.Bool(outbounds[1].IsClosed()).IsTrue()
+
+	// An inbound detour fails after the outbounds and the main inbound are created.
+	assert.Error(vpoint.Reload(&Config{
+		Port:           v2net.Port(50014),
+		InboundConfig:  config.InboundConfig,
+		OutboundConfig: config.OutboundConfig,
+		InboundDetours: []*InboundDetourConfig{
+			{
+				Protocol:   inboundProtocol,
+				PortRange:  v2net.PortRange{From: 50015, To: 50015},
+				Allocation: &InboundDetourAllocationConfig{Strategy: "reload_fail_not_exist"},
+			},
+		},
+	})).IsNotNil()
+	assert.Int(len(outbounds)).Equals(3)
+	assert.Bool(outbounds[2].IsClosed()).IsTrue()
+	assert.Int(len(inbounds)).Equals(2)
+	assert.Bool(inbounds[1].closed).IsTrue()
+
+	assert.Bool(outbounds[0].IsClosed()).IsFalse()
+	assert.Bool(inbounds[0].closed).IsFalse()
+	assert.Int(int(inbounds[0].Port())).Equals(50013)
+}
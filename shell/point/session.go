@@ -0,0 +1,111 @@
+package point
+
+import (
+	"sync"
+	"time"
+
+	"github.com/v2ray/v2ray-core/app/policy"
+	"github.com/v2ray/v2ray-core/transport/ray"
+)
+
+// sessionManager keeps track of all active sessions of a Point, so that they can be drained or
+// canceled on shutdown.
+type sessionManager struct {
+	sync.Mutex
+	sessions map[*activityRay]bool
+	changed  chan bool // Closed when a session finishes, if anyone is waiting.
+	closed   bool
+}
+
+func newSessionManager() *sessionManager {
+	return &sessionManager{
+		sessions: make(map[*activityRay]bool),
+	}
+}
+
+// Track returns an OutboundRay on top of the given one, which is tracked until both directions are
+// closed. onDone, if not nil, is called with the finished session. Sessions tracked after CancelAll
+// are canceled immediately.
+func (this *sessionManager) Track(link ray.OutboundRay, sessionPolicy *policy.Policy, onDone func(*activityRay)) ray.OutboundRay {
+	var session *activityRay
+	session = newActivityRay(func() {
+		if onDone != nil {
+			onDone(session)
+		}
+		this.remove(session)
+	})
+
+	// The session is added before it starts, so that it is never removed before added.
+	this.Lock()
+	closed := this.closed
+	if !closed {
+		this.sessions[session] = true
+	}
+	this.Unlock()
+
+	session.run(link, sessionPolicy)
+	if closed {
+		session.Cancel()
+	}
+	return session
+}
+
+func (this *sessionManager) remove(session *activityRay) {
+	this.Lock()
+	defer this.Unlock()
+
+	delete(this.sessions, session)
+	if this.changed != nil {
+		close(this.changed)
+		this.changed = nil
+	}
+}
+
+// Count returns the number of active sessions.
+func (this *sessionManager) Count() int {
+	this.Lock()
+	defer this.Unlock()
+
+	return len(this.sessions)
+}
+
+// Wait waits until all sessions finish, and returns false if there are still active sessions after
+// the given timeout.
+func (this *sessionManager) Wait(timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		this.Lock()
+		if len(this.sessions) == 0 {
+			this.Unlock()
+			return true
+		}
+		if this.changed == nil {
+			this.changed = make(chan bool)
+		}
+		changed := this.changed
+		this.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return false
+		}
+	}
+}
+
+// CancelAll cancels all active sessions, as well as those tracked afterwards.
+func (this *sessionManager) CancelAll() {
+	this.Lock()
+	this.closed = true
+	sessions := make([]*activityRay, 0, len(this.sessions))
+	for session := range this.sessions {
+		sessions = append(sessions, session)
+	}
+	this.Unlock()
+
+	for _, session := range sessions {
+		session.Cancel()
+	}
+}
@@ -0,0 +1,114 @@
+package point_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/v2ray/v2ray-core/app"
+	"github.com/v2ray/v2ray-core/common/alloc"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	"github.com/v2ray/v2ray-core/proxy"
+	proxytesting "github.com/v2ray/v2ray-core/proxy/testing"
+	"github.com/v2ray/v2ray-core/proxy/testing/mocks"
+	. "github.com/v2ray/v2ray-core/shell/point"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+	"github.com/v2ray/v2ray-core/transport/ray"
+)
+
+type closingOutboundHandler struct {
+	mocks.OutboundConnectionHandler
+	closed bool
+}
+
+func (this *closingOutboundHandler) Close() {
+	this.closed = true
+}
+
+func newShutdownPoint(name string) (*Point, *recordingInboundHandler, *closingOutboundHandler) {
+	ich := new(recordingInboundHandler)
+	inboundProtocol, err := proxytesting.RegisterInboundConnectionHandlerCreator(name+"_ich",
+		func(space app.Space, config interface{}) (proxy.InboundHandler, error) {
+			return ich, nil
+		})
+	assert.Error(err).IsNil()
+
+	och := &closingOutboundHandler{
+		OutboundConnectionHandler: mocks.OutboundConnectionHandler{
+			ConnInput:  bytes.NewReader([]byte("response")),
+			ConnOutput: new(bytes.Buffer),
+		},
+	}
+	outboundProtocol, err := proxytesting.RegisterOutboundConnectionHandlerCreator(name+"_och",
+		func(space app.Space, config interface{}) (proxy.OutboundHandler, error) {
+			return och, nil
+		})
+	assert.Error(err).IsNil()
+
+	vpoint, err := NewPoint(&Config{
+		Port:           v2net.Port(50061),
+		InboundConfig:  &ConnectionConfig{Protocol: inboundProtocol},
+		OutboundConfig: &ConnectionConfig{Protocol: outboundProtocol},
+	})
+	assert.Error(err).IsNil()
+	assert.Error(vpoint.Start()).IsNil()
+	return vpoint, ich, och
+}
+
+func dispatchSession(vpoint *Point) ray.InboundRay {
+	dest := v2net.TCPDestination(v2net.DomainAddress("v2ray.com"), 80)
+	packet := v2net.NewPacket(dest, alloc.NewBuffer().Clear().Append([]byte("request")), true)
+	return vpoint.DispatchToOutbound(nil, packet)
+}
+
+func TestShutdownDrainsSessions(t *testing.T) {
+	v2testing.Current(t)
+
+	vpoint, ich, och := newShutdownPoint("drain")
+	link := dispatchSession(vpoint)
+	assert.Int(vpoint.ActiveSessions()).Equals(1)
+
+	shutdown := make(chan bool)
+	go func() {
+		vpoint.Shutdown(time.Minute)
+		close(shutdown)
+	}()
+
+	// The session finishes as usual, once the client is done.
+	time.Sleep(100 * time.Millisecond)
+	close(link.InboundInput())
+	response := new(bytes.Buffer)
+	for chunk := range link.InboundOutput() {
+		response.Write(chunk.Value)
+		chunk.Release()
+	}
+	assert.StringLiteral(response.String()).Equals("response")
+
+	select {
+	case <-shutdown:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown didn't return after all sessions finished.")
+	}
+	assert.Int(vpoint.ActiveSessions()).Equals(0)
+	assert.Bool(ich.closed).IsTrue()
+	assert.Bool(och.closed).IsTrue()
+}
+
+func TestShutdownClosesSessionsAfterTimeout(t *testing.T) {
+	v2testing.Current(t)
+
+	vpoint, _, och := newShutdownPoint("force")
+	link := dispatchSession(vpoint)
+
+	start := time.Now()
+	vpoint.Shutdown(200 * time.Millisecond)
+	assert.Bool(time.Since(start) >= 200*time.Millisecond).IsTrue()
+	assert.Bool(och.closed).IsTrue()
+
+	// The session is canceled, and the client sees the end of response.
+	for chunk := range link.InboundOutput() {
+		chunk.Release()
+	}
+	close(link.InboundInput())
+}
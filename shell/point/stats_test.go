@@ -0,0 +1,86 @@
+package point_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/v2ray/v2ray-core/app"
+	"github.com/v2ray/v2ray-core/app/policy"
+	"github.com/v2ray/v2ray-core/app/stats"
+	apptesting "github.com/v2ray/v2ray-core/app/testing"
+	"github.com/v2ray/v2ray-core/common/alloc"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	proto "github.com/v2ray/v2ray-core/common/protocol"
+	"github.com/v2ray/v2ray-core/proxy"
+	proxytesting "github.com/v2ray/v2ray-core/proxy/testing"
+	"github.com/v2ray/v2ray-core/proxy/testing/mocks"
+	. "github.com/v2ray/v2ray-core/shell/point"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+)
+
+func TestStats(t *testing.T) {
+	v2testing.Current(t)
+
+	inboundProtocol, err := proxytesting.RegisterInboundConnectionHandlerCreator("stats_ich",
+		func(space app.Space, config interface{}) (proxy.InboundHandler, error) {
+			return new(recordingInboundHandler), nil
+		})
+	assert.Error(err).IsNil()
+
+	outboundProtocol, err := proxytesting.RegisterOutboundConnectionHandlerCreator("stats_och",
+		func(space app.Space, config interface{}) (proxy.OutboundHandler, error) {
+			return &mocks.OutboundConnectionHandler{
+				ConnInput:  bytes.NewReader([]byte("response")),
+				ConnOutput: new(bytes.Buffer),
+			}, nil
+		})
+	assert.Error(err).IsNil()
+
+	vpoint, err := NewPoint(&Config{
+		Port:           v2net.Port(50041),
+		InboundConfig:  &ConnectionConfig{Protocol: inboundProtocol},
+		OutboundConfig: &ConnectionConfig{Protocol: outboundProtocol},
+		StatsConfig:    &stats.Config{},
+		PolicyConfig: &policy.Config{
+			Levels: map[proto.UserLevel]*policy.Policy{
+				proto.UserLevel(1): {StatsEnabled: false},
+			},
+		},
+	})
+	assert.Error(err).IsNil()
+
+	user := &proto.User{Email: "love@v2ray.com"}
+	dest := v2net.TCPDestination(v2net.DomainAddress("v2ray.com"), 80)
+	packet := v2net.NewPacket(dest, alloc.NewBuffer().Clear().Append([]byte("request")), false)
+	link := vpoint.DispatchToOutboundForUser(&apptesting.Context{CallerTagValue: "in"}, nil, user, packet)
+	close(link.InboundInput())
+	for chunk := range link.InboundOutput() {
+		chunk.Release()
+	}
+
+	allStats := vpoint.Stats().Query("", "", false)
+	assert.Int(len(allStats)).Equals(3)
+	assert.StringLiteral(allStats[0].Name).Equals("in")
+	assert.StringLiteral(allStats[1].Name).Equals("vpoint-default-outbound")
+	assert.StringLiteral(allStats[2].Name).Equals("love@v2ray.com")
+	for _, stat := range allStats {
+		assert.Int64(stat.Uplink).Equals(7)
+		assert.Int64(stat.Downlink).Equals(8)
+		assert.Int64(stat.ActiveConnections).Equals(0)
+		assert.Int64(stat.TotalConnections).Equals(1)
+	}
+
+	// Traffic of users whose policy disables stats is not counted per user.
+	user = &proto.User{Level: proto.UserLevel(1), Email: "nostats@v2ray.com"}
+	packet = v2net.NewPacket(dest, alloc.NewBuffer().Clear().Append([]byte("request")), false)
+	link = vpoint.DispatchToOutboundForUser(&apptesting.Context{CallerTagValue: "in"}, nil, user, packet)
+	close(link.InboundInput())
+	for chunk := range link.InboundOutput() {
+		chunk.Release()
+	}
+
+	userStats := vpoint.Stats().Query(stats.KindUser, "", false)
+	assert.Int(len(userStats)).Equals(1)
+	assert.StringLiteral(userStats[0].Name).Equals("love@v2ray.com")
+}
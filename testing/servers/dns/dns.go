@@ -0,0 +1,237 @@
+package dns
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	dnsMessageType = "application/dns-message"
+)
+
+// NewTLSConfig returns a TLS config with a self-signed certificate for 127.0.0.1.
+func NewTLSConfig() (*tls.Config, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.IP([]byte{127, 0, 0, 1})},
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{certificate},
+			PrivateKey:  key,
+		}},
+	}, nil
+}
+
+// Server is a stub DNS server, which answers A and AAAA queries with static records over both UDP and
+// TCP on the same port. It also serves DNS over HTTPS as a http.Handler.
+type Server struct {
+	Port        v2net.Port
+	Records     map[string][]net.IP // IPs of domains, without trailing dot.
+	TTL         uint32
+	Silent      bool        // Never answers if true.
+	TLSConfig   *tls.Config // Serves DNS over TLS instead of TCP if not nil.
+	queries     int32
+	connections int32
+	methodMutex sync.Mutex
+	lastMethod  string
+	udpConn     *net.UDPConn
+	tcp         net.Listener
+}
+
+func (server *Server) Start() (v2net.Destination, error) {
+	localAddr := &net.UDPAddr{
+		IP:   []byte{127, 0, 0, 1},
+		Port: int(server.Port),
+	}
+	udpConn, err := net.ListenUDP("udp", localAddr)
+	if err != nil {
+		return nil, err
+	}
+	tcpListener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: localAddr.IP, Port: localAddr.Port})
+	if err != nil {
+		udpConn.Close()
+		return nil, err
+	}
+	server.udpConn = udpConn
+	server.tcp = tcpListener
+	if server.TLSConfig != nil {
+		server.tcp = tls.NewListener(tcpListener, server.TLSConfig)
+	}
+	go server.serveUDP()
+	go server.serveTCP()
+	return v2net.UDPDestination(v2net.IPAddress(localAddr.IP), server.Port), nil
+}
+
+// Queries returns the number of queries received.
+func (server *Server) Queries() int {
+	return int(atomic.LoadInt32(&server.queries))
+}
+
+// Connections returns the number of TCP or TLS connections accepted.
+func (server *Server) Connections() int {
+	return int(atomic.LoadInt32(&server.connections))
+}
+
+// LastHTTPMethod returns the method of the last DNS over HTTPS request.
+func (server *Server) LastHTTPMethod() string {
+	server.methodMutex.Lock()
+	defer server.methodMutex.Unlock()
+
+	return server.lastMethod
+}
+
+func (server *Server) serveUDP() {
+	buffer := make([]byte, 2048)
+	for {
+		nBytes, addr, err := server.udpConn.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+		if response := server.answer(buffer[:nBytes]); response != nil {
+			server.udpConn.WriteToUDP(response, addr)
+		}
+	}
+}
+
+func (server *Server) serveTCP() {
+	for {
+		conn, err := server.tcp.Accept()
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(&server.connections, 1)
+		go server.handleTCPConnection(conn)
+	}
+}
+
+func (server *Server) handleTCPConnection(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var length uint16
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			return
+		}
+		query := make([]byte, length)
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+		response := server.answer(query)
+		if response == nil {
+			continue
+		}
+		conn.Write(append([]byte{byte(len(response) >> 8), byte(len(response))}, response...))
+	}
+}
+
+func (server *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	server.methodMutex.Lock()
+	server.lastMethod = request.Method
+	server.methodMutex.Unlock()
+
+	var query []byte
+	var err error
+	switch request.Method {
+	case "GET":
+		query, err = base64.RawURLEncoding.DecodeString(request.URL.Query().Get("dns"))
+	case "POST":
+		if request.Header.Get("Content-Type") != dnsMessageType {
+			http.Error(writer, "Unsupported content type.", http.StatusUnsupportedMediaType)
+			return
+		}
+		query, err = ioutil.ReadAll(request.Body)
+	default:
+		http.Error(writer, "Unsupported method.", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	response := server.answer(query)
+	if response == nil {
+		http.Error(writer, "No answer.", http.StatusServiceUnavailable)
+		return
+	}
+	writer.Header().Set("Content-Type", dnsMessageType)
+	writer.Write(response)
+}
+
+func (server *Server) answer(query []byte) []byte {
+	atomic.AddInt32(&server.queries, 1)
+	if server.Silent {
+		return nil
+	}
+
+	message := new(dnsmessage.Message)
+	if err := message.Unpack(query); err != nil || len(message.Questions) != 1 {
+		return nil
+	}
+	question := message.Questions[0]
+	message.Header.Response = true
+	message.Header.RecursionAvailable = true
+
+	ips, found := server.Records[strings.TrimSuffix(question.Name.String(), ".")]
+	if !found {
+		message.Header.RCode = dnsmessage.RCodeNameError
+	}
+	for _, ip := range ips {
+		header := dnsmessage.ResourceHeader{
+			Name:  question.Name,
+			Type:  question.Type,
+			Class: dnsmessage.ClassINET,
+			TTL:   server.TTL,
+		}
+		if ip4 := ip.To4(); ip4 != nil && question.Type == dnsmessage.TypeA {
+			resource := &dnsmessage.AResource{}
+			copy(resource.A[:], ip4)
+			message.Answers = append(message.Answers, dnsmessage.Resource{Header: header, Body: resource})
+		} else if ip.To4() == nil && question.Type == dnsmessage.TypeAAAA {
+			resource := &dnsmessage.AAAAResource{}
+			copy(resource.AAAA[:], ip)
+			message.Answers = append(message.Answers, dnsmessage.Resource{Header: header, Body: resource})
+		}
+	}
+
+	response, err := message.Pack()
+	if err != nil {
+		return nil
+	}
+	return response
+}
+
+func (server *Server) Close() {
+	server.udpConn.Close()
+	server.tcp.Close()
+}
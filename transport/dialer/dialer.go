@@ -3,38 +3,191 @@ package dialer
 import (
 	"errors"
 	"net"
+	"sync"
 	"time"
 
 	v2net "github.com/v2ray/v2ray-core/common/net"
 )
 
 var (
-	ErrorInvalidHost = errors.New("Invalid Host.")
+	ErrorInvalidHost    = errors.New("Invalid Host.")
+	ErrorCanceled       = errors.New("Dial canceled.")
+	ErrorResolveFailure = errors.New("Failed to resolve domain.")
 )
 
-func Dial(dest v2net.Destination) (net.Conn, error) {
-	if dest.Address().IsDomain() {
-		dialer := &net.Dialer{
-			Timeout:   time.Second * 60,
-			DualStack: true,
+// Resolver resolves domains into IP addresses.
+type Resolver interface {
+	Get(domain string) []net.IP
+}
+
+const (
+	// FallbackDelay is the time to wait for a connection to an IP before trying the next IP in parallel.
+	FallbackDelay = 300 * time.Millisecond
+)
+
+// Dial connects to the given destination. Domains are resolved by the given resolver, and IPs are tried
+// in order. Nil resolver means the system resolver. Dialing is aborted with ErrorCanceled once the given
+// channel is closed. Nil channel means never.
+func Dial(dest v2net.Destination, resolver Resolver, cancel <-chan struct{}) (net.Conn, error) {
+	if !dest.Address().IsDomain() || resolver == nil {
+		return dial(dest, cancel)
+	}
+
+	ips := resolver.Get(dest.Address().Domain())
+	if len(ips) == 0 {
+		return nil, ErrorResolveFailure
+	}
+	return DialIPs(ips, dest, cancel)
+}
+
+// DialIPs connects to the port of the given destination on the given IPs, in the manner of happy eyeballs
+// (RFC 8305). IPs of both families are tried alternately, starting with the family of the first IP. If
+// an attempt takes longer than FallbackDelay, the next IP is tried in parallel, and the first established
+// connection wins.
+func DialIPs(ips []net.IP, dest v2net.Destination, cancel <-chan struct{}) (net.Conn, error) {
+	var dests []v2net.Destination
+	for _, ip := range interleave(ips) {
+		address := v2net.IPAddress(ip)
+		if address == nil {
+			continue
 		}
-		network := "tcp"
 		if dest.IsUDP() {
-			network = "udp"
+			dests = append(dests, v2net.UDPDestination(address, dest.Port()))
+		} else {
+			dests = append(dests, v2net.TCPDestination(address, dest.Port()))
 		}
-		return dialer.Dial(network, dest.NetAddr())
+	}
+	if len(dests) == 0 {
+		return nil, ErrorInvalidHost
+	}
+	if len(dests) == 1 {
+		return dial(dests[0], cancel)
 	}
 
-	ip := dest.Address().IP()
-	if dest.IsTCP() {
-		return net.DialTCP("tcp", nil, &net.TCPAddr{
-			IP:   ip,
-			Port: int(dest.Port()),
-		})
-	} else {
-		return net.DialUDP("udp", nil, &net.UDPAddr{
-			IP:   ip,
-			Port: int(dest.Port()),
+	// Pending attempts are canceled once a connection is established, or dialing is canceled.
+	attemptCancel := make(chan struct{})
+	var cancelOnce sync.Once
+	stopAttempts := func() {
+		cancelOnce.Do(func() {
+			close(attemptCancel)
 		})
 	}
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-cancel:
+			stopAttempts()
+		case <-finished:
+		}
+	}()
+
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan *dialResult, len(dests))
+	started, failed := 0, 0
+	startNext := func() {
+		go func(dest v2net.Destination) {
+			conn, err := dial(dest, attemptCancel)
+			results <- &dialResult{conn: conn, err: err}
+		}(dests[started])
+		started++
+	}
+
+	startNext()
+	timer := time.NewTimer(FallbackDelay)
+	defer timer.Stop()
+	var err error
+	for failed < started {
+		select {
+		case result := <-results:
+			if result.err == nil {
+				stopAttempts()
+				// Close connections established by other attempts meanwhile.
+				go func(pending int) {
+					for i := 0; i < pending; i++ {
+						if result := <-results; result.conn != nil {
+							result.conn.Close()
+						}
+					}
+				}(started - failed - 1)
+				return result.conn, nil
+			}
+			failed++
+			err = result.err
+			if err == ErrorCanceled {
+				stopAttempts()
+				return nil, err
+			}
+			if started < len(dests) {
+				// Try the next IP right away on failure.
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				startNext()
+				timer.Reset(FallbackDelay)
+			}
+		case <-timer.C:
+			if started < len(dests) {
+				startNext()
+				timer.Reset(FallbackDelay)
+			}
+		}
+	}
+	return nil, err
+}
+
+// interleave returns the given IPs with IPv4 and IPv6 alternating, starting with the family of the first
+// IP. The order of IPs of the same family is kept.
+func interleave(ips []net.IP) []net.IP {
+	var first, second []net.IP
+	firstIsIPv4 := len(ips) > 0 && ips[0].To4() != nil
+	for _, ip := range ips {
+		if (ip.To4() != nil) == firstIsIPv4 {
+			first = append(first, ip)
+		} else {
+			second = append(second, ip)
+		}
+	}
+	result := make([]net.IP, 0, len(ips))
+	for len(first) > 0 || len(second) > 0 {
+		if len(first) > 0 {
+			result = append(result, first[0])
+			first = first[1:]
+		}
+		if len(second) > 0 {
+			result = append(result, second[0])
+			second = second[1:]
+		}
+	}
+	return result
+}
+
+func dial(dest v2net.Destination, cancel <-chan struct{}) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout: time.Second * 60,
+		Cancel:  cancel,
+	}
+	if dest.Address().IsDomain() {
+		dialer.DualStack = true
+	}
+	network := "tcp"
+	if dest.IsUDP() {
+		network = "udp"
+	}
+	conn, err := dialer.Dial(network, dest.NetAddr())
+	if err != nil {
+		select {
+		case <-cancel:
+			return nil, ErrorCanceled
+		default:
+		}
+		return nil, err
+	}
+	return conn, nil
 }
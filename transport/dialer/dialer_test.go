@@ -1,7 +1,9 @@
 package dialer_test
 
 import (
+	"net"
 	"testing"
+	"time"
 
 	v2net "github.com/v2ray/v2ray-core/common/net"
 	v2nettesting "github.com/v2ray/v2ray-core/common/net/testing"
@@ -21,8 +23,70 @@ func TestDialDomain(t *testing.T) {
 	assert.Error(err).IsNil()
 	defer server.Close()
 
-	conn, err := Dial(v2net.TCPDestination(v2net.DomainAddress("local.v2ray.com"), dest.Port()))
+	conn, err := Dial(v2net.TCPDestination(v2net.DomainAddress("local.v2ray.com"), dest.Port()), nil, nil)
 	assert.Error(err).IsNil()
 	assert.StringLiteral(conn.RemoteAddr().String()).Equals("127.0.0.1:" + dest.Port().String())
 	conn.Close()
 }
+
+func TestDialCanceled(t *testing.T) {
+	v2testing.Current(t)
+
+	cancel := make(chan struct{})
+	close(cancel)
+	_, err := Dial(v2net.TCPDestination(v2net.IPAddress([]byte{127, 0, 0, 1}), 128), nil, cancel)
+	assert.Error(err).Equals(ErrorCanceled)
+}
+
+type staticResolver struct {
+	ips map[string][]net.IP
+}
+
+func (this *staticResolver) Get(domain string) []net.IP {
+	return this.ips[domain]
+}
+
+func TestDialWithResolver(t *testing.T) {
+	v2testing.Current(t)
+
+	server := &tcp.Server{
+		Port: v2nettesting.PickPort(),
+	}
+	dest, err := server.Start()
+	assert.Error(err).IsNil()
+	defer server.Close()
+
+	resolver := &staticResolver{
+		ips: map[string][]net.IP{
+			"v2ray.test": {net.IP([]byte{127, 0, 0, 1})},
+		},
+	}
+	conn, err := Dial(v2net.TCPDestination(v2net.DomainAddress("v2ray.test"), dest.Port()), resolver, nil)
+	assert.Error(err).IsNil()
+	assert.StringLiteral(conn.RemoteAddr().String()).Equals("127.0.0.1:" + dest.Port().String())
+	conn.Close()
+
+	_, err = Dial(v2net.TCPDestination(v2net.DomainAddress("unknown.test"), dest.Port()), resolver, nil)
+	assert.Error(err).Equals(ErrorResolveFailure)
+}
+
+func TestDialIPsFallsBack(t *testing.T) {
+	v2testing.Current(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Error(err).IsNil()
+	defer listener.Close()
+	port := v2net.Port(listener.Addr().(*net.TCPAddr).Port)
+	dest := v2net.TCPDestination(v2net.DomainAddress("v2ray.test"), port)
+
+	// Nothing listens on 127.0.0.2.
+	start := time.Now()
+	conn, err := DialIPs([]net.IP{net.IP([]byte{127, 0, 0, 2}), net.IP([]byte{127, 0, 0, 1})}, dest, nil)
+	assert.Error(err).IsNil()
+	assert.StringLiteral(conn.RemoteAddr().String()).Equals("127.0.0.1:" + port.String())
+	assert.Bool(time.Since(start) < FallbackDelay).IsTrue()
+	conn.Close()
+
+	_, err = DialIPs([]net.IP{net.IP([]byte{127, 0, 0, 2}), net.IP([]byte{127, 0, 0, 3})}, dest, nil)
+	assert.Error(err).IsNotNil()
+}
@@ -4,10 +4,15 @@ import (
 	"sync"
 
 	"github.com/v2ray/v2ray-core/app/dispatcher"
+	"github.com/v2ray/v2ray-core/common/metrics"
 	v2net "github.com/v2ray/v2ray-core/common/net"
 	"github.com/v2ray/v2ray-core/transport/ray"
 )
 
+var (
+	activeUDPSessions = metrics.NewGauge("v2ray_udp_sessions_active", "Number of active UDP sessions.")
+)
+
 type UDPResponseCallback func(packet v2net.Packet)
 
 type connEntry struct {
@@ -19,6 +24,7 @@ type UDPServer struct {
 	sync.RWMutex
 	conns            map[string]*connEntry
 	packetDispatcher dispatcher.PacketDispatcher
+	closed           bool
 }
 
 func NewUDPServer(packetDispatcher dispatcher.PacketDispatcher) *UDPServer {
@@ -31,6 +37,10 @@ func NewUDPServer(packetDispatcher dispatcher.PacketDispatcher) *UDPServer {
 func (this *UDPServer) locateExistingAndDispatch(dest string, packet v2net.Packet) bool {
 	this.RLock()
 	defer this.RUnlock()
+	if this.closed {
+		packet.Chunk().Release()
+		return true
+	}
 	if entry, found := this.conns[dest]; found {
 		entry.inboundRay.InboundInput() <- packet.Chunk()
 		return true
@@ -45,20 +55,45 @@ func (this *UDPServer) Dispatch(source v2net.Destination, packet v2net.Packet, c
 	}
 
 	this.Lock()
-	inboundRay := this.packetDispatcher.DispatchToOutbound(v2net.NewPacket(packet.Destination(), packet.Chunk(), true))
-	this.conns[destString] = &connEntry{
+	if this.closed {
+		this.Unlock()
+		packet.Chunk().Release()
+		return
+	}
+	inboundRay := dispatcher.DispatchToOutboundForUser(this.packetDispatcher, source, nil, v2net.NewPacket(packet.Destination(), packet.Chunk(), true))
+	entry := &connEntry{
 		inboundRay: inboundRay,
 		callback:   callback,
 	}
+	this.conns[destString] = entry
 	this.Unlock()
-	go this.handleConnection(destString, inboundRay, source, callback)
+	activeUDPSessions.Inc()
+	go this.handleConnection(destString, entry, source, callback)
 }
 
-func (this *UDPServer) handleConnection(destString string, inboundRay ray.InboundRay, source v2net.Destination, callback UDPResponseCallback) {
-	for buffer := range inboundRay.InboundOutput() {
+func (this *UDPServer) handleConnection(destString string, entry *connEntry, source v2net.Destination, callback UDPResponseCallback) {
+	for buffer := range entry.inboundRay.InboundOutput() {
 		callback(v2net.NewPacket(source, buffer, false))
 	}
 	this.Lock()
-	delete(this.conns, destString)
+	// The input is already closed if the entry has been removed by Close.
+	if this.conns[destString] == entry {
+		delete(this.conns, destString)
+		close(entry.inboundRay.InboundInput())
+	}
 	this.Unlock()
+	activeUDPSessions.Dec()
+}
+
+// Close closes the input of all sessions, and cancels them. Packets dispatched afterwards are dropped.
+func (this *UDPServer) Close() {
+	this.Lock()
+	defer this.Unlock()
+
+	this.closed = true
+	for destString, entry := range this.conns {
+		close(entry.inboundRay.InboundInput())
+		entry.inboundRay.Cancel()
+		delete(this.conns, destString)
+	}
 }
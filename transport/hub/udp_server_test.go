@@ -0,0 +1,37 @@
+package hub_test
+
+import (
+	"testing"
+
+	testdispatcher "github.com/v2ray/v2ray-core/app/dispatcher/testing"
+	"github.com/v2ray/v2ray-core/common/alloc"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+	v2testing "github.com/v2ray/v2ray-core/testing"
+	"github.com/v2ray/v2ray-core/testing/assert"
+	. "github.com/v2ray/v2ray-core/transport/hub"
+)
+
+func TestUDPServerClose(t *testing.T) {
+	v2testing.Current(t)
+
+	packetDispatcher := testdispatcher.NewTestPacketDispatcher(nil)
+	server := NewUDPServer(packetDispatcher)
+
+	source := v2net.UDPDestination(v2net.IPAddress([]byte{127, 0, 0, 1}), 50071)
+	dest := v2net.UDPDestination(v2net.IPAddress([]byte{8, 8, 8, 8}), 53)
+	responses := make(chan string, 16)
+	callback := func(packet v2net.Packet) {
+		responses <- string(packet.Chunk().Value)
+		packet.Chunk().Release()
+	}
+
+	server.Dispatch(source, v2net.NewPacket(dest, alloc.NewBuffer().Clear().Append([]byte("first")), false), callback)
+	server.Dispatch(source, v2net.NewPacket(dest, alloc.NewBuffer().Clear().Append([]byte("second")), false), callback)
+	assert.StringLiteral(<-responses).Equals("Processed: second")
+	assert.Int(len(packetDispatcher.LastPacket)).Equals(1)
+
+	server.Close()
+	server.Dispatch(source, v2net.NewPacket(dest, alloc.NewBuffer().Clear().Append([]byte("third")), false), callback)
+	assert.Int(len(packetDispatcher.LastPacket)).Equals(1)
+	assert.Int(len(responses)).Equals(0)
+}
@@ -0,0 +1,181 @@
+package ray
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/v2ray/v2ray-core/common/alloc"
+	v2net "github.com/v2ray/v2ray-core/common/net"
+)
+
+var (
+	ErrorConnClosed = errors.New("Connection closed.")
+)
+
+type timeoutError struct{}
+
+func (this timeoutError) Error() string   { return "Connection timed out." }
+func (this timeoutError) Timeout() bool   { return true }
+func (this timeoutError) Temporary() bool { return true }
+
+// rayAddr is the address of a connection on top of a ray.
+type rayAddr struct {
+	dest v2net.Destination
+}
+
+func (this *rayAddr) Network() string {
+	if this.dest.IsUDP() {
+		return "udp"
+	}
+	return "tcp"
+}
+
+func (this *rayAddr) String() string {
+	return this.dest.NetAddr()
+}
+
+// conn is a net.Conn which writes into the input of an InboundRay, and reads from its output.
+type conn struct {
+	link          InboundRay
+	dest          v2net.Destination
+	current       *alloc.Buffer
+	writeMutex    sync.Mutex
+	closed        chan bool
+	closeOnce     sync.Once
+	deadlineMutex sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+// NewConn returns a connection to the given destination, on top of the given InboundRay, e.g., as
+// returned by a PacketDispatcher. Closing the connection cancels the ray.
+func NewConn(link InboundRay, dest v2net.Destination) net.Conn {
+	return &conn{
+		link:   link,
+		dest:   dest,
+		closed: make(chan bool),
+	}
+}
+
+// timer returns a channel which fires on the given deadline, and a function to stop it. Zero deadline
+// means never.
+func timer(deadline time.Time) (<-chan time.Time, func()) {
+	if deadline.IsZero() {
+		return nil, func() {}
+	}
+	t := time.NewTimer(deadline.Sub(time.Now()))
+	return t.C, func() { t.Stop() }
+}
+
+func (this *conn) Read(b []byte) (int, error) {
+	for this.current == nil || this.current.IsEmpty() {
+		if this.current != nil {
+			this.current.Release()
+			this.current = nil
+		}
+		this.deadlineMutex.Lock()
+		timeout, stop := timer(this.readDeadline)
+		this.deadlineMutex.Unlock()
+
+		select {
+		case chunk, open := <-this.link.InboundOutput():
+			stop()
+			if !open {
+				return 0, io.EOF
+			}
+			this.current = chunk
+		case <-timeout:
+			return 0, timeoutError{}
+		case <-this.closed:
+			stop()
+			return 0, ErrorConnClosed
+		}
+	}
+	n := copy(b, this.current.Value)
+	this.current.SliceFrom(n)
+	return n, nil
+}
+
+func (this *conn) Write(b []byte) (int, error) {
+	this.writeMutex.Lock()
+	defer this.writeMutex.Unlock()
+
+	this.deadlineMutex.Lock()
+	timeout, stop := timer(this.writeDeadline)
+	this.deadlineMutex.Unlock()
+	defer stop()
+
+	written := 0
+	for written < len(b) {
+		chunk := alloc.NewBuffer().Clear()
+		n := len(b) - written
+		if n > chunkSize {
+			n = chunkSize
+		}
+		chunk.Append(b[written : written+n])
+		select {
+		case this.link.InboundInput() <- chunk:
+			written += n
+		case <-timeout:
+			chunk.Release()
+			return written, timeoutError{}
+		case <-this.closed:
+			chunk.Release()
+			return written, ErrorConnClosed
+		}
+	}
+	return written, nil
+}
+
+// Close closes the input of the ray, and discards its remaining output.
+func (this *conn) Close() error {
+	this.closeOnce.Do(func() {
+		close(this.closed)
+		this.writeMutex.Lock()
+		close(this.link.InboundInput())
+		this.writeMutex.Unlock()
+		this.link.Cancel()
+		go func() {
+			for chunk := range this.link.InboundOutput() {
+				chunk.Release()
+			}
+		}()
+	})
+	return nil
+}
+
+func (this *conn) LocalAddr() net.Addr {
+	return &rayAddr{dest: v2net.TCPDestination(v2net.IPAddress([]byte{0, 0, 0, 0}), 0)}
+}
+
+func (this *conn) RemoteAddr() net.Addr {
+	return &rayAddr{dest: this.dest}
+}
+
+func (this *conn) SetDeadline(t time.Time) error {
+	this.deadlineMutex.Lock()
+	defer this.deadlineMutex.Unlock()
+
+	this.readDeadline = t
+	this.writeDeadline = t
+	return nil
+}
+
+func (this *conn) SetReadDeadline(t time.Time) error {
+	this.deadlineMutex.Lock()
+	defer this.deadlineMutex.Unlock()
+
+	this.readDeadline = t
+	return nil
+}
+
+func (this *conn) SetWriteDeadline(t time.Time) error {
+	this.deadlineMutex.Lock()
+	defer this.deadlineMutex.Unlock()
+
+	this.writeDeadline = t
+	return nil
+}
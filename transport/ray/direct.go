@@ -1,11 +1,14 @@
 package ray
 
 import (
+	"sync"
+
 	"github.com/v2ray/v2ray-core/common/alloc"
 )
 
 const (
 	bufferSize = 128
+	chunkSize  = 8 * 1024 // Typical size of a chunk, i.e., alloc.NewBuffer().
 )
 
 // NewRay creates a new Ray for direct traffic transport.
@@ -13,12 +16,29 @@ func NewRay() Ray {
 	return &directRay{
 		Input:  make(chan *alloc.Buffer, bufferSize),
 		Output: make(chan *alloc.Buffer, bufferSize),
+		done:   make(chan struct{}),
+	}
+}
+
+// NewRayWithBufferSize creates a new Ray that buffers about the given number of bytes in each
+// direction. Non-positive size means the default size.
+func NewRayWithBufferSize(size int) Ray {
+	if size <= 0 {
+		return NewRay()
+	}
+	chunks := (size + chunkSize - 1) / chunkSize
+	return &directRay{
+		Input:  make(chan *alloc.Buffer, chunks),
+		Output: make(chan *alloc.Buffer, chunks),
+		done:   make(chan struct{}),
 	}
 }
 
 type directRay struct {
-	Input  chan *alloc.Buffer
-	Output chan *alloc.Buffer
+	Input      chan *alloc.Buffer
+	Output     chan *alloc.Buffer
+	done       chan struct{}
+	cancelOnce sync.Once
 }
 
 func (this *directRay) OutboundInput() <-chan *alloc.Buffer {
@@ -36,3 +56,13 @@ func (this *directRay) InboundInput() chan<- *alloc.Buffer {
 func (this *directRay) InboundOutput() <-chan *alloc.Buffer {
 	return this.Output
 }
+
+func (this *directRay) Done() <-chan struct{} {
+	return this.done
+}
+
+func (this *directRay) Cancel() {
+	this.cancelOnce.Do(func() {
+		close(this.done)
+	})
+}
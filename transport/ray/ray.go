@@ -14,6 +14,11 @@ type OutboundRay interface {
 	// outbound connection. The outbound connection shall close the channel
 	// after all responses are receivced and put into the channel.
 	OutboundOutput() chan<- *alloc.Buffer
+
+	// Done returns a channel which is closed once the connection is canceled, e.g., the client is gone.
+	// The outbound connection shall stop dialing and reading from remote, and close its output as soon
+	// as possible.
+	Done() <-chan struct{}
 }
 
 // InboundRay is a transport interface for inbound connections.
@@ -27,6 +32,11 @@ type InboundRay interface {
 	// as response. The inbound connection shall write all the data from the
 	// channel until it is closed.
 	InboundOutput() <-chan *alloc.Buffer
+
+	// Cancel notifies the outbound connection that the inbound connection is finished, so that it
+	// stops as soon as possible. It is safe to call Cancel more than once, or after the outbound
+	// connection finishes.
+	Cancel()
 }
 
 // Ray is an internal tranport channel between inbound and outbound connection.